@@ -0,0 +1,79 @@
+package gofakes3
+
+import (
+	"net/http"
+
+	xml "github.com/oneclickvirt/gofakes3/xml"
+)
+
+// AccelerateStatus is the Status of an AccelerateConfiguration.
+type AccelerateStatus string
+
+const (
+	AccelerateEnabled   AccelerateStatus = "Enabled"
+	AccelerateSuspended AccelerateStatus = "Suspended"
+)
+
+// AccelerateConfiguration is used by the '?accelerate' subresource on
+// buckets, both as the response body for a GET and as the request body for a
+// PUT:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketAccelerateConfiguration.html
+//
+// Status is empty if transfer acceleration has never been configured.
+type AccelerateConfiguration struct {
+	XMLName xml.Name         `xml:"AccelerateConfiguration"`
+	Xmlns   string           `xml:"xmlns,attr"`
+	Status  AccelerateStatus `xml:"Status,omitempty"`
+}
+
+func (c *AccelerateConfiguration) validate() error {
+	switch c.Status {
+	case AccelerateEnabled, AccelerateSuspended:
+		return nil
+	default:
+		return ErrMalformedXML
+	}
+}
+
+func (g *GoFakeS3) getBucketAccelerate(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET BUCKET ACCELERATE", bucket)
+
+	if g.accelerate == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	config, err := g.accelerate.GetBucketAccelerate(r.Context(), bucket)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		config = &AccelerateConfiguration{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/"}
+	}
+
+	return g.xmlEncoder(w).Encode(config)
+}
+
+func (g *GoFakeS3) putBucketAccelerate(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT BUCKET ACCELERATE", bucket)
+
+	if g.accelerate == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	var in AccelerateConfiguration
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := in.validate(); err != nil {
+		return err
+	}
+	in.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	return g.accelerate.PutBucketAccelerate(r.Context(), bucket, &in)
+}
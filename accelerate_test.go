@@ -0,0 +1,48 @@
+package gofakes3_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestBucketAccelerate(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	assertStatus := func(expected string) {
+		t.Helper()
+		rs, err := svc.GetBucketAccelerateConfiguration(&s3.GetBucketAccelerateConfigurationInput{Bucket: aws.String(defaultBucket)})
+		ts.OK(err)
+		if aws.StringValue(rs.Status) != expected {
+			t.Fatal("unexpected status", aws.StringValue(rs.Status))
+		}
+	}
+
+	assertStatus("")
+
+	for _, status := range []string{"Enabled", "Suspended"} {
+		ts.OKAll(svc.PutBucketAccelerateConfiguration(&s3.PutBucketAccelerateConfigurationInput{
+			Bucket:                  aws.String(defaultBucket),
+			AccelerateConfiguration: &s3.AccelerateConfiguration{Status: aws.String(status)},
+		}))
+		assertStatus(status)
+	}
+
+	_, err := svc.PutBucketAccelerateConfiguration(&s3.PutBucketAccelerateConfigurationInput{
+		Bucket:                  aws.String(defaultBucket),
+		AccelerateConfiguration: &s3.AccelerateConfiguration{Status: aws.String("Disabled")},
+	})
+	if !hasErrorCode(err, gofakes3.ErrMalformedXML) {
+		t.Fatal("expected MalformedXML, found", err)
+	}
+	assertStatus("Suspended")
+
+	_, err = svc.GetBucketAccelerateConfiguration(&s3.GetBucketAccelerateConfigurationInput{Bucket: aws.String("missing")})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchBucket) {
+		t.Fatal("expected NoSuchBucket, found", err)
+	}
+}
@@ -0,0 +1,201 @@
+package gofakes3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat selects the layout of the lines written by WithAccessLog.
+type AccessLogFormat string
+
+const (
+	// AccessLogText writes lines in the Apache combined log format, followed
+	// by the request ID, Operation, bucket, key and duration:
+	//
+	//	127.0.0.1 - - [02/Jan/2006:15:04:05 +0000] "GET /bucket/key HTTP/1.1" 200 5 "-" "aws-sdk-go" 0000000000000001 GetObject bucket key 0.123ms
+	//
+	// Missing values are written as '-'.
+	AccessLogText AccessLogFormat = "text"
+
+	// AccessLogJSON writes one JSON object per line, with the same values
+	// as AccessLogText.
+	AccessLogJSON AccessLogFormat = "json"
+)
+
+// accessLog writes one line to out for every request served.
+type accessLog struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format AccessLogFormat
+}
+
+// accessLogEntry collects the details of a request as it passes through the
+// handlers, for the access log and the MetricsCollector. routeBase fills in
+// the bucket, key and Operation, which are not known to the middleware.
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	BytesIn    int64     `json:"bytesIn"`
+	Bytes      int64     `json:"bytes"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	RequestID  string    `json:"requestId,omitempty"`
+	Operation  Operation `json:"operation,omitempty"`
+	Bucket     string    `json:"bucket,omitempty"`
+	Key        string    `json:"key,omitempty"`
+	Duration   float64   `json:"durationMs"`
+}
+
+// accessLogEntryFromContext returns the entry for the request that ctx
+// belongs to, or nil if neither access logging nor metrics are enabled.
+func accessLogEntryFromContext(ctx context.Context) *accessLogEntry {
+	entry, _ := ctx.Value(accessLogKey).(*accessLogEntry)
+	return entry
+}
+
+// observeMiddleware writes the access log and reports metrics for every
+// request once the handler has returned. It must be inside
+// requestIDMiddleware so the request ID is known.
+func (g *GoFakeS3) observeMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		start := time.Now()
+		entry := &accessLogEntry{
+			Time:       g.timeSource.Now(),
+			RemoteAddr: rq.RemoteAddr,
+			Method:     rq.Method,
+			URI:        rq.RequestURI,
+			Proto:      rq.Proto,
+			Referer:    rq.Referer(),
+			UserAgent:  rq.UserAgent(),
+			RequestID:  RequestIDFromContext(rq.Context()),
+		}
+		if entry.URI == "" {
+			entry.URI = rq.URL.RequestURI()
+		}
+
+		lw := &accessLogWriter{ResponseWriter: w}
+		var body *countingReadCloser
+		if rq.Body != nil {
+			body = &countingReadCloser{ReadCloser: rq.Body}
+			rq.Body = body
+		}
+		rq = rq.WithContext(context.WithValue(rq.Context(), accessLogKey, entry))
+		handler.ServeHTTP(lw, rq)
+
+		entry.Status = lw.status
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		entry.Bytes = lw.bytes
+		if body != nil {
+			entry.BytesIn = body.n
+		}
+		elapsed := time.Since(start)
+		entry.Duration = float64(elapsed) / float64(time.Millisecond)
+
+		if g.accessLog != nil {
+			if err := g.accessLog.write(entry); err != nil {
+				g.log.Print(LogErr, "access log:", err)
+			}
+		}
+		if g.metrics != nil {
+			op := entry.Operation
+			if op == "" {
+				op = OpUnknown
+			}
+			g.metrics.ObserveRequest(op, entry.Status, elapsed, entry.BytesIn, entry.Bytes)
+		}
+	})
+}
+
+func (a *accessLog) write(entry *accessLogEntry) error {
+	var line []byte
+	if a.format == AccessLogJSON {
+		var err error
+		if line, err = json.Marshal(entry); err != nil {
+			return err
+		}
+		line = append(line, '\n')
+
+	} else {
+		line = []byte(fmt.Sprintf("%s - - [%s] %q %d %d %q %q %s %s %s %s %sms\n",
+			accessLogValue(entry.RemoteAddr),
+			entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			entry.Method+" "+entry.URI+" "+entry.Proto,
+			entry.Status,
+			entry.Bytes,
+			accessLogValue(entry.Referer),
+			accessLogValue(entry.UserAgent),
+			accessLogValue(entry.RequestID),
+			accessLogValue(string(entry.Operation)),
+			accessLogValue(entry.Bucket),
+			accessLogValue(entry.Key),
+			strconv.FormatFloat(entry.Duration, 'f', 3, 64)))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err := a.out.Write(line)
+	return err
+}
+
+func accessLogValue(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
+
+// accessLogWriter records the status and the size of the body sent through
+// an http.ResponseWriter.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush is passed through so the CompleteMultipartUpload keep-alive still
+// works with access logging enabled.
+func (w *accessLogWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// countingReadCloser counts the bytes read from a request body.
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReadCloser) Read(b []byte) (int, error) {
+	n, err := c.ReadCloser.Read(b)
+	c.n += int64(n)
+	return n, err
+}
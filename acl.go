@@ -0,0 +1,289 @@
+package gofakes3
+
+import (
+	"net/http"
+	"strings"
+
+	xml "github.com/oneclickvirt/gofakes3/xml"
+)
+
+// CannedACL is a predefined set of grantees and permissions, which can be
+// applied using the 'x-amz-acl' header:
+// https://docs.aws.amazon.com/AmazonS3/latest/dev/acl-overview.html#canned-acl
+type CannedACL string
+
+const (
+	ACLPrivate                CannedACL = "private"
+	ACLPublicRead             CannedACL = "public-read"
+	ACLPublicReadWrite        CannedACL = "public-read-write"
+	ACLAuthenticatedRead      CannedACL = "authenticated-read"
+	ACLAWSExecRead            CannedACL = "aws-exec-read"
+	ACLBucketOwnerRead        CannedACL = "bucket-owner-read"
+	ACLBucketOwnerFullControl CannedACL = "bucket-owner-full-control"
+)
+
+// Policy expands the canned ACL into the full AccessControlPolicy that S3
+// would report for it. ok is false if the canned ACL is not recognised.
+func (c CannedACL) Policy(owner *UserInfo) (policy *AccessControlPolicy, ok bool) {
+	policy = NewAccessControlPolicy(owner)
+
+	switch c {
+	case ACLPrivate, ACLBucketOwnerRead, ACLBucketOwnerFullControl:
+		// GoFakeS3 only has one owner, so the bucket owner ACLs are the same
+		// as private.
+
+	case ACLPublicRead:
+		policy.AddGrant(NewGroupGrantee(GroupAllUsers), PermissionRead)
+
+	case ACLPublicReadWrite:
+		policy.AddGrant(NewGroupGrantee(GroupAllUsers), PermissionRead)
+		policy.AddGrant(NewGroupGrantee(GroupAllUsers), PermissionWrite)
+
+	case ACLAuthenticatedRead:
+		policy.AddGrant(NewGroupGrantee(GroupAuthenticatedUsers), PermissionRead)
+
+	case ACLAWSExecRead:
+		// The grantee for this is an AWS-internal account that we can't
+		// meaningfully represent, so this is treated as private.
+
+	default:
+		return nil, false
+	}
+
+	return policy, true
+}
+
+// Permission is granted to a Grantee in an AccessControlPolicy.
+type Permission string
+
+const (
+	PermissionFullControl Permission = "FULL_CONTROL"
+	PermissionRead        Permission = "READ"
+	PermissionWrite       Permission = "WRITE"
+	PermissionReadACP     Permission = "READ_ACP"
+	PermissionWriteACP    Permission = "WRITE_ACP"
+)
+
+// GranteeType is the value of the 'xsi:type' attribute on a Grantee.
+type GranteeType string
+
+const (
+	GranteeCanonicalUser         GranteeType = "CanonicalUser"
+	GranteeAmazonCustomerByEmail GranteeType = "AmazonCustomerByEmail"
+	GranteeGroup                 GranteeType = "Group"
+)
+
+// Predefined groups that can be used as a Grantee:
+// https://docs.aws.amazon.com/AmazonS3/latest/dev/acl-overview.html#specifying-grantee-predefined-groups
+const (
+	GroupAllUsers           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	GroupAuthenticatedUsers = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+	GroupLogDelivery        = "http://acs.amazonaws.com/groups/s3/LogDelivery"
+)
+
+const xmlnsXSI = "http://www.w3.org/2001/XMLSchema-instance"
+
+// AccessControlPolicy is used by the '?acl' subresource, both as the response
+// body for a GET and as the request body for a PUT.
+type AccessControlPolicy struct {
+	XMLName xml.Name  `xml:"AccessControlPolicy"`
+	Xmlns   string    `xml:"xmlns,attr"`
+	Owner   *UserInfo `xml:"Owner,omitempty"`
+	Grants  []Grant   `xml:"AccessControlList>Grant"`
+}
+
+// NewAccessControlPolicy creates a policy that grants FULL_CONTROL to the
+// owner, which matches the 'private' canned ACL.
+func NewAccessControlPolicy(owner *UserInfo) *AccessControlPolicy {
+	policy := &AccessControlPolicy{
+		Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/",
+		Owner: owner,
+	}
+	if owner != nil {
+		policy.AddGrant(NewUserGrantee(owner), PermissionFullControl)
+	}
+	return policy
+}
+
+func (p *AccessControlPolicy) AddGrant(grantee *Grantee, permission Permission) {
+	p.Grants = append(p.Grants, Grant{Grantee: grantee, Permission: permission})
+}
+
+// GroupHasPermission reports whether the group identified by the URI has been
+// granted the permission. FULL_CONTROL implies all permissions.
+func (p *AccessControlPolicy) GroupHasPermission(group string, permission Permission) bool {
+	if p == nil {
+		return false
+	}
+	for _, grant := range p.Grants {
+		if grant.Grantee == nil || grant.Grantee.Type != GranteeGroup || grant.Grantee.URI != group {
+			continue
+		}
+		if grant.Permission == permission || grant.Permission == PermissionFullControl {
+			return true
+		}
+	}
+	return false
+}
+
+type Grant struct {
+	Grantee    *Grantee   `xml:"Grantee"`
+	Permission Permission `xml:"Permission"`
+}
+
+type Grantee struct {
+	XMLNSXSI     string      `xml:"xmlns:xsi,attr"`
+	Type         GranteeType `xml:"xsi:type,attr"`
+	ID           string      `xml:"ID,omitempty"`
+	DisplayName  string      `xml:"DisplayName,omitempty"`
+	EmailAddress string      `xml:"EmailAddress,omitempty"`
+	URI          string      `xml:"URI,omitempty"`
+}
+
+func NewUserGrantee(user *UserInfo) *Grantee {
+	return &Grantee{XMLNSXSI: xmlnsXSI, Type: GranteeCanonicalUser, ID: user.ID, DisplayName: user.DisplayName}
+}
+
+func NewGroupGrantee(uri string) *Grantee {
+	return &Grantee{XMLNSXSI: xmlnsXSI, Type: GranteeGroup, URI: uri}
+}
+
+// UnmarshalXML is needed because the xml package does not match the
+// namespaced 'xsi:type' attribute to the field tag used for marshalling.
+func (g *Grantee) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type grantee Grantee // Avoid recursing back into this method
+	var inner grantee
+	if err := d.DecodeElement(&inner, &start); err != nil {
+		return err
+	}
+	*g = Grantee(inner)
+	g.XMLNSXSI = xmlnsXSI
+
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "type" {
+			g.Type = GranteeType(attr.Value)
+		}
+	}
+
+	switch {
+	case g.Type != "":
+	case g.URI != "":
+		g.Type = GranteeGroup
+	case g.EmailAddress != "":
+		g.Type = GranteeAmazonCustomerByEmail
+	default:
+		g.Type = GranteeCanonicalUser
+	}
+	return nil
+}
+
+// aclGrantHeaders maps the 'x-amz-grant-*' headers to the permission they
+// grant.
+var aclGrantHeaders = []struct {
+	header     string
+	permission Permission
+}{
+	{"X-Amz-Grant-Full-Control", PermissionFullControl},
+	{"X-Amz-Grant-Read", PermissionRead},
+	{"X-Amz-Grant-Write", PermissionWrite},
+	{"X-Amz-Grant-Read-Acp", PermissionReadACP},
+	{"X-Amz-Grant-Write-Acp", PermissionWriteACP},
+}
+
+// aclFromHeaders builds an AccessControlPolicy from either the 'x-amz-acl'
+// canned ACL header or the 'x-amz-grant-*' headers. If none of these headers
+// are present, the returned policy is nil.
+//
+// The grant headers contain a comma separated list of grantees in the form
+// 'type="value"', where type is one of 'id', 'uri' or 'emailAddress':
+//
+//	x-amz-grant-read: uri="http://acs.amazonaws.com/groups/global/AllUsers", id="1234"
+func aclFromHeaders(hdr http.Header, owner *UserInfo) (*AccessControlPolicy, error) {
+	canned := hdr.Get("X-Amz-Acl")
+
+	var policy *AccessControlPolicy
+	for _, grantHeader := range aclGrantHeaders {
+		value := hdr.Get(grantHeader.header)
+		if value == "" {
+			continue
+		}
+		if canned != "" {
+			return nil, ErrorMessage(ErrInvalidRequest, "Specifying both Canned ACLs and Header Grants is not allowed")
+		}
+		if policy == nil {
+			policy = &AccessControlPolicy{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/", Owner: owner}
+		}
+
+		for _, item := range strings.Split(value, ",") {
+			grantee, err := parseGranteeHeaderItem(item)
+			if err != nil {
+				return nil, err
+			}
+			policy.AddGrant(grantee, grantHeader.permission)
+		}
+	}
+
+	if canned != "" {
+		cannedPolicy, ok := CannedACL(canned).Policy(owner)
+		if !ok {
+			return nil, ErrorInvalidArgument("x-amz-acl", canned, "Invalid canned ACL")
+		}
+		return cannedPolicy, nil
+	}
+
+	return policy, nil
+}
+
+func parseGranteeHeaderItem(item string) (*Grantee, error) {
+	item = strings.TrimSpace(item)
+	parts := strings.SplitN(item, "=", 2)
+	if len(parts) != 2 {
+		return nil, ErrorMessagef(ErrInvalidArgument, "invalid grantee %q", item)
+	}
+
+	kind, value := strings.TrimSpace(parts[0]), strings.Trim(strings.TrimSpace(parts[1]), `"`)
+	switch strings.ToLower(kind) {
+	case "id":
+		return &Grantee{XMLNSXSI: xmlnsXSI, Type: GranteeCanonicalUser, ID: value}, nil
+	case "uri":
+		return NewGroupGrantee(value), nil
+	case "emailaddress":
+		return &Grantee{XMLNSXSI: xmlnsXSI, Type: GranteeAmazonCustomerByEmail, EmailAddress: value}, nil
+	default:
+		return nil, ErrorMessagef(ErrInvalidArgument, "invalid grantee type %q", kind)
+	}
+}
+
+// authorizeAnonymous decides whether a request without credentials may proceed
+// when authentication is enabled. Only object reads are permitted, and only if
+// the object's ACL grants READ to the AllUsers group.
+func (g *GoFakeS3) authorizeAnonymous(bucket, object string, r *http.Request) error {
+	if !isObjectRead(object, r) || g.acl == nil {
+		return ErrAccessDenied
+	}
+
+	policy, err := g.acl.GetObjectACL(r.Context(), bucket, object)
+	if err != nil {
+		// S3 does not reveal whether the object exists to anonymous users:
+		return ErrAccessDenied
+	}
+	if !policy.GroupHasPermission(GroupAllUsers, PermissionRead) {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// isObjectRead reports whether the request is a plain GET or HEAD of an
+// object, without any subresources apart from those that only affect how the
+// object is read.
+func isObjectRead(object string, r *http.Request) bool {
+	if object == "" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	for k := range r.URL.Query() {
+		if k != "versionId" && k != "partNumber" && !strings.HasPrefix(k, "response-") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,347 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+	"github.com/oneclickvirt/gofakes3/s3mem"
+)
+
+func TestObjectACL(t *testing.T) {
+	assertGroupGrant := func(ts *testServer, key string, group string, permission string, expected bool) {
+		ts.Helper()
+		svc := ts.s3Client()
+		rs, err := svc.GetObjectAcl(&s3.GetObjectAclInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String(key),
+		})
+		ts.OK(err)
+
+		if rs.Owner == nil || aws.StringValue(rs.Owner.DisplayName) != "GoFakeS3" {
+			ts.Fatal("unexpected owner", rs.Owner)
+		}
+
+		found := false
+		for _, grant := range rs.Grants {
+			if aws.StringValue(grant.Grantee.URI) == group && aws.StringValue(grant.Permission) == permission {
+				found = true
+			}
+		}
+		if found != expected {
+			ts.Fatal("expected grant", group, permission, "to be", expected, "found", rs.Grants)
+		}
+	}
+
+	t.Run("default", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+		svc := ts.s3Client()
+		rs, err := svc.GetObjectAcl(&s3.GetObjectAclInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("foo"),
+		})
+		ts.OK(err)
+		if len(rs.Grants) != 1 || aws.StringValue(rs.Grants[0].Permission) != "FULL_CONTROL" {
+			ts.Fatal("unexpected grants", rs.Grants)
+		}
+		if aws.StringValue(rs.Grants[0].Grantee.ID) != aws.StringValue(rs.Owner.ID) {
+			ts.Fatal("unexpected grantee", rs.Grants[0].Grantee)
+		}
+	})
+
+	t.Run("canned", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+		svc := ts.s3Client()
+		ts.OKAll(svc.PutObjectAcl(&s3.PutObjectAclInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("foo"),
+			ACL:    aws.String("public-read"),
+		}))
+		assertGroupGrant(ts, "foo", gofakes3.GroupAllUsers, "READ", true)
+
+		ts.OKAll(svc.PutObjectAcl(&s3.PutObjectAclInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("foo"),
+			ACL:    aws.String("private"),
+		}))
+		assertGroupGrant(ts, "foo", gofakes3.GroupAllUsers, "READ", false)
+	})
+
+	t.Run("canned-invalid", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+		svc := ts.s3Client()
+		_, err := svc.PutObjectAcl(&s3.PutObjectAclInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("foo"),
+			ACL:    aws.String("nope"),
+		})
+		if !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+			ts.Fatal("expected InvalidArgument, found", err)
+		}
+	})
+
+	t.Run("grant-headers", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+		svc := ts.s3Client()
+		ts.OKAll(svc.PutObjectAcl(&s3.PutObjectAclInput{
+			Bucket:    aws.String(defaultBucket),
+			Key:       aws.String("foo"),
+			GrantRead: aws.String(`uri="` + gofakes3.GroupAuthenticatedUsers + `", id="1234"`),
+		}))
+		assertGroupGrant(ts, "foo", gofakes3.GroupAuthenticatedUsers, "READ", true)
+		assertGroupGrant(ts, "foo", gofakes3.GroupAllUsers, "READ", false)
+	})
+
+	t.Run("canned-and-grant-headers-fails", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+		svc := ts.s3Client()
+		_, err := svc.PutObjectAcl(&s3.PutObjectAclInput{
+			Bucket:    aws.String(defaultBucket),
+			Key:       aws.String("foo"),
+			ACL:       aws.String("private"),
+			GrantRead: aws.String(`id="1234"`),
+		})
+		if !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+			ts.Fatal("expected InvalidRequest, found", err)
+		}
+	})
+
+	t.Run("body", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+		svc := ts.s3Client()
+		ts.OKAll(svc.PutObjectAcl(&s3.PutObjectAclInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("foo"),
+			AccessControlPolicy: &s3.AccessControlPolicy{
+				Grants: []*s3.Grant{
+					{
+						Grantee: &s3.Grantee{
+							Type: aws.String("Group"),
+							URI:  aws.String(gofakes3.GroupAllUsers),
+						},
+						Permission: aws.String("READ"),
+					},
+				},
+			},
+		}))
+		assertGroupGrant(ts, "foo", gofakes3.GroupAllUsers, "READ", true)
+	})
+
+	t.Run("put-object-canned", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+
+		svc := ts.s3Client()
+		ts.OKAll(svc.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("foo"),
+			Body:   bytes.NewReader([]byte("hello")),
+			ACL:    aws.String("public-read"),
+		}))
+		assertGroupGrant(ts, "foo", gofakes3.GroupAllUsers, "READ", true)
+	})
+
+	t.Run("missing-key", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+
+		svc := ts.s3Client()
+		_, err := svc.GetObjectAcl(&s3.GetObjectAclInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("nope"),
+		})
+		if !hasErrorCode(err, gofakes3.ErrNoSuchKey) {
+			ts.Fatal("expected NoSuchKey, found", err)
+		}
+	})
+
+	t.Run("not-implemented", func(t *testing.T) {
+		ts := newTestServer(t, withBackend(&backendWithoutACL{s3mem.New()}))
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+		svc := ts.s3Client()
+		_, err := svc.GetObjectAcl(&s3.GetObjectAclInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("foo"),
+		})
+		if !hasErrorCode(err, gofakes3.ErrNotImplemented) {
+			ts.Fatal("expected NotImplemented, found", err)
+		}
+
+		_, err = svc.PutObjectAcl(&s3.PutObjectAclInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("foo"),
+			ACL:    aws.String("public-read"),
+		})
+		if !hasErrorCode(err, gofakes3.ErrNotImplemented) {
+			ts.Fatal("expected NotImplemented, found", err)
+		}
+	})
+}
+
+func TestBucketACL(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	assertGrants := func(expected ...string) {
+		t.Helper()
+		rs, err := svc.GetBucketAcl(&s3.GetBucketAclInput{Bucket: aws.String(defaultBucket)})
+		ts.OK(err)
+		if rs.Owner == nil || aws.StringValue(rs.Owner.DisplayName) != "GoFakeS3" {
+			t.Fatal("unexpected owner", rs.Owner)
+		}
+
+		var found []string
+		for _, grant := range rs.Grants {
+			grantee := aws.StringValue(grant.Grantee.URI)
+			if grantee == "" {
+				grantee = aws.StringValue(grant.Grantee.ID)
+			}
+			found = append(found, grantee+" "+aws.StringValue(grant.Permission))
+		}
+		if !reflect.DeepEqual(found, expected) {
+			t.Fatalf("unexpected grants:\nexp: %q\ngot: %q", expected, found)
+		}
+	}
+
+	owner := gofakes3.DefaultOwner().ID + " FULL_CONTROL"
+	assertGrants(owner)
+
+	for _, tc := range []struct {
+		canned   string
+		expected []string
+	}{
+		{"public-read", []string{owner, gofakes3.GroupAllUsers + " READ"}},
+		{"public-read-write", []string{owner, gofakes3.GroupAllUsers + " READ", gofakes3.GroupAllUsers + " WRITE"}},
+		{"authenticated-read", []string{owner, gofakes3.GroupAuthenticatedUsers + " READ"}},
+		{"private", []string{owner}},
+	} {
+		ts.OKAll(svc.PutBucketAcl(&s3.PutBucketAclInput{
+			Bucket: aws.String(defaultBucket),
+			ACL:    aws.String(tc.canned),
+		}))
+		assertGrants(tc.expected...)
+	}
+
+	ts.OKAll(svc.PutBucketAcl(&s3.PutBucketAclInput{
+		Bucket:    aws.String(defaultBucket),
+		GrantRead: aws.String(`uri="` + gofakes3.GroupLogDelivery + `"`),
+	}))
+	assertGrants(gofakes3.GroupLogDelivery + " READ")
+
+	ts.OKAll(svc.PutBucketAcl(&s3.PutBucketAclInput{
+		Bucket: aws.String(defaultBucket),
+		AccessControlPolicy: &s3.AccessControlPolicy{
+			Grants: []*s3.Grant{{
+				Grantee:    &s3.Grantee{Type: aws.String("CanonicalUser"), ID: aws.String("1234")},
+				Permission: aws.String("WRITE_ACP"),
+			}},
+		},
+	}))
+	assertGrants("1234 WRITE_ACP")
+
+	_, err := svc.GetBucketAcl(&s3.GetBucketAclInput{Bucket: aws.String("missing")})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchBucket) {
+		t.Fatal("expected NoSuchBucket, found", err)
+	}
+
+	_, err = svc.PutBucketAcl(&s3.PutBucketAclInput{Bucket: aws.String(defaultBucket), ACL: aws.String("nope")})
+	if !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
+	}
+}
+
+func TestBucketACLNotImplemented(t *testing.T) {
+	mem := s3mem.New()
+	ts := newTestServer(t, withBackend(&backendWithObjectACL{mem, mem}))
+	defer ts.Close()
+	ts.backendPutString(defaultBucket, "foo", nil, "hello")
+	svc := ts.s3Client()
+
+	// Object ACLs only need an ACLBackend:
+	ts.OKAll(svc.PutObjectAcl(&s3.PutObjectAclInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+		ACL:    aws.String("public-read"),
+	}))
+
+	_, err := svc.GetBucketAcl(&s3.GetBucketAclInput{Bucket: aws.String(defaultBucket)})
+	if !hasErrorCode(err, gofakes3.ErrNotImplemented) {
+		t.Fatal("expected NotImplemented, found", err)
+	}
+	_, err = svc.PutBucketAcl(&s3.PutBucketAclInput{Bucket: aws.String(defaultBucket), ACL: aws.String("public-read")})
+	if !hasErrorCode(err, gofakes3.ErrNotImplemented) {
+		t.Fatal("expected NotImplemented, found", err)
+	}
+}
+
+func TestObjectACLAnonymousAccess(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(
+		gofakes3.WithV4Auth(map[string]string{"dummy-access": "dummy-secret"}),
+	))
+	defer ts.Close()
+
+	svc := ts.s3Client()
+	for key, acl := range map[string]string{"public": "public-read", "private": "private"} {
+		ts.OKAll(svc.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader([]byte("hello")),
+			ACL:    aws.String(acl),
+		}))
+	}
+
+	assertStatus := func(method, path string, code int) {
+		t.Helper()
+		rq, err := http.NewRequest(method, ts.url(path), nil)
+		ts.OK(err)
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		defer rs.Body.Close()
+		if rs.StatusCode != code {
+			t.Fatal("expected status", code, "for", method, path, "found", rs.StatusCode)
+		}
+	}
+
+	assertStatus("GET", "/"+defaultBucket+"/public", 200)
+	assertStatus("HEAD", "/"+defaultBucket+"/public", 200)
+	assertStatus("GET", "/"+defaultBucket+"/private", 403)
+	assertStatus("GET", "/"+defaultBucket+"/nope", 403)
+	assertStatus("GET", "/"+defaultBucket+"/public?acl", 403)
+	assertStatus("PUT", "/"+defaultBucket+"/public", 403)
+	assertStatus("GET", "/"+defaultBucket, 403)
+}
+
+type backendWithoutACL struct {
+	gofakes3.Backend
+}
+
+// backendWithObjectACL supports object ACLs, but not bucket ACLs.
+type backendWithObjectACL struct {
+	gofakes3.Backend
+	gofakes3.ACLBackend
+}
@@ -2,7 +2,9 @@ package gofakes3
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
 )
@@ -29,6 +31,11 @@ type Object struct {
 	// If versioning is enabled for the bucket, this is true if this object version
 	// is a delete marker.
 	IsDeleteMarker bool
+
+	// LastModified is the time the object was stored. It is used for the
+	// Last-Modified header when Metadata does not contain one, and may be
+	// left zero if the backend does not know it.
+	LastModified time.Time
 }
 
 type ObjectList struct {
@@ -189,7 +196,9 @@ type Backend interface {
 	//
 	// If rnge is nil, it is assumed you want the entire object. If rnge is not
 	// nil, but the underlying backend does not support range requests,
-	// implementers MUST return ErrNotImplemented.
+	// implementers MUST return ErrNotImplemented. If the range can not be
+	// satisfied, implementers should return the error from
+	// ObjectRangeRequest.Range(), or see gofakes3.InvalidRange().
 	//
 	// If the backend is a VersionedBackend, GetObject retrieves the latest version.
 	GetObject(ctx context.Context, bucketName, objectName string, rangeRequest *ObjectRangeRequest) (*Object, error)
@@ -199,7 +208,8 @@ type Backend interface {
 	//
 	// If the returned Object is not nil, you MUST call Object.Contents.Close(),
 	// otherwise you will leak resources. Implementers should return a no-op
-	// implementation of io.ReadCloser.
+	// implementation of io.ReadCloser, or leave Contents nil; the body is
+	// never read.
 	//
 	// HeadObject should return a NotFound() error if the object does not
 	// exist.
@@ -232,6 +242,13 @@ type Backend interface {
 
 	DeleteMulti(ctx context.Context, bucketName string, objects ...string) (MultiDeleteResult, error)
 
+	// CopyObject copies the contents of the source object to the destination.
+	// The map containing meta is the complete metadata for the destination
+	// object; it has already been merged with the source metadata if the
+	// request asked for it to be preserved.
+	//
+	// If the destination bucket is versioned, the result must contain the
+	// VersionID of the new object.
 	CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, meta map[string]string) (CopyObjectResult, error)
 }
 
@@ -309,6 +326,422 @@ type VersionedBackend interface {
 	ListBucketVersions(bucketName string, prefix *Prefix, page *ListBucketVersionsPage) (*ListBucketVersionsResult, error)
 }
 
+// VersionCopyBackend may be optionally implemented by a VersionedBackend to
+// copy a specific version of an object.
+//
+// If you don't implement VersionCopyBackend, GoFakeS3 reads the version with
+// GetObjectVersion and stores the copy with Backend.PutObject. If PutObject
+// merges the metadata with that of an existing object, as MergeMetadata does,
+// restoring an old version over the current one will keep metadata that the
+// old version did not have.
+type VersionCopyBackend interface {
+	// CopyObjectVersion copies a specific version of an object, as
+	// Backend.CopyObject does for the current version. meta is the complete
+	// metadata of the copy; it MUST NOT be merged with the metadata of an
+	// existing destination object, so an old version can be restored
+	// exactly by copying it over the current one.
+	//
+	// CopyObjectVersion must return gofakes3.ErrNoSuchVersion if the source
+	// version does not exist.
+	CopyObjectVersion(srcBucket, srcKey string, srcVersion VersionID, dstBucket, dstKey string, meta map[string]string) (CopyObjectResult, error)
+}
+
+// ACLBackend may be optionally implemented by a Backend in order to support
+// the '?acl' subresource on objects.
+//
+// If you don't implement ACLBackend, requests to GoFakeS3 that attempt to
+// read or modify the ACL of an object will return ErrNotImplemented, and
+// anonymous requests will always be denied if authentication is enabled.
+type ACLBackend interface {
+	// GetObjectACL must return a gofakes3.ErrNoSuchKey error if the object
+	// does not exist. See gofakes3.KeyNotFound() for a convenient way to
+	// create one.
+	//
+	// If no ACL has been stored for the object, GetObjectACL should return a
+	// nil policy and a nil error; GoFakeS3 will treat this as the 'private'
+	// canned ACL.
+	GetObjectACL(ctx context.Context, bucketName, objectName string) (*AccessControlPolicy, error)
+
+	// PutObjectACL replaces the ACL for an object. It must return a
+	// gofakes3.ErrNoSuchKey error if the object does not exist.
+	PutObjectACL(ctx context.Context, bucketName, objectName string, acl *AccessControlPolicy) error
+}
+
+// BucketACLBackend may be optionally implemented by a Backend in order to
+// support the '?acl' subresource on buckets.
+//
+// If you don't implement BucketACLBackend, requests to GoFakeS3 that attempt
+// to read or modify the ACL of a bucket will return ErrNotImplemented.
+type BucketACLBackend interface {
+	// GetBucketACL must return a gofakes3.ErrNoSuchBucket error if the bucket
+	// does not exist. If no ACL has been stored for the bucket, GetBucketACL
+	// should return a nil policy and a nil error; GoFakeS3 will treat this as
+	// the 'private' canned ACL.
+	GetBucketACL(ctx context.Context, bucketName string) (*AccessControlPolicy, error)
+
+	// PutBucketACL replaces the ACL for a bucket. It must return a
+	// gofakes3.ErrNoSuchBucket error if the bucket does not exist.
+	PutBucketACL(ctx context.Context, bucketName string, acl *AccessControlPolicy) error
+}
+
+// PolicyBackend may be optionally implemented by a Backend in order to support
+// the '?policy' subresource on buckets.
+//
+// GoFakeS3 does not interpret the policy beyond some minimal validation; the
+// Backend should store the JSON document verbatim.
+type PolicyBackend interface {
+	// GetBucketPolicy must return a gofakes3.ErrNoSuchBucket error if the
+	// bucket does not exist, or a gofakes3.ErrNoSuchBucketPolicy error if the
+	// bucket exists but no policy has been set.
+	GetBucketPolicy(ctx context.Context, bucketName string) ([]byte, error)
+
+	// SetBucketPolicy must return a gofakes3.ErrNoSuchBucket error if the
+	// bucket does not exist.
+	SetBucketPolicy(ctx context.Context, bucketName string, policy []byte) error
+
+	// DeleteBucketPolicy must return a gofakes3.ErrNoSuchBucket error if the
+	// bucket does not exist. It must not return an error if the bucket
+	// exists but has no policy.
+	DeleteBucketPolicy(ctx context.Context, bucketName string) error
+}
+
+// CORSBackend may be optionally implemented by a Backend in order to support
+// the '?cors' subresource on buckets.
+//
+// If the Backend does not implement CORSBackend, or the bucket has no CORS
+// configuration, GoFakeS3 responds to all cross-origin requests with
+// permissive CORS headers.
+type CORSBackend interface {
+	// GetBucketCORS must return a gofakes3.ErrNoSuchBucket error if the
+	// bucket does not exist, or a gofakes3.ErrNoSuchCORSConfiguration error
+	// if the bucket exists but no CORS configuration has been set.
+	GetBucketCORS(ctx context.Context, bucketName string) (*CORSConfiguration, error)
+
+	// PutBucketCORS replaces the CORS configuration for a bucket. It must
+	// return a gofakes3.ErrNoSuchBucket error if the bucket does not exist.
+	PutBucketCORS(ctx context.Context, bucketName string, config *CORSConfiguration) error
+
+	// DeleteBucketCORS must return a gofakes3.ErrNoSuchBucket error if the
+	// bucket does not exist. It must not return an error if the bucket
+	// exists but has no CORS configuration.
+	DeleteBucketCORS(ctx context.Context, bucketName string) error
+}
+
+// WebsiteBackend may be optionally implemented by a Backend in order to
+// support the '?website' subresource on buckets. GoFakeS3 only acts on the
+// configuration if WithWebsiteServing is used.
+type WebsiteBackend interface {
+	// GetBucketWebsite must return a gofakes3.ErrNoSuchBucket error if the
+	// bucket does not exist, or a gofakes3.ErrNoSuchWebsiteConfiguration
+	// error if the bucket exists but no website configuration has been set.
+	GetBucketWebsite(ctx context.Context, bucketName string) (*WebsiteConfiguration, error)
+
+	// PutBucketWebsite replaces the website configuration for a bucket. It
+	// must return a gofakes3.ErrNoSuchBucket error if the bucket does not
+	// exist.
+	PutBucketWebsite(ctx context.Context, bucketName string, config *WebsiteConfiguration) error
+
+	// DeleteBucketWebsite must return a gofakes3.ErrNoSuchBucket error if the
+	// bucket does not exist. It must not return an error if the bucket
+	// exists but has no website configuration.
+	DeleteBucketWebsite(ctx context.Context, bucketName string) error
+}
+
+// EncryptionBackend may be optionally implemented by a Backend in order to
+// support the '?encryption' subresource on buckets. The default encryption is
+// added to new objects uploaded without encryption headers.
+type EncryptionBackend interface {
+	// GetBucketEncryption must return a gofakes3.ErrNoSuchBucket error if
+	// the bucket does not exist, or a
+	// gofakes3.ErrServerSideEncryptionConfigurationNotFound error if the
+	// bucket exists but no default encryption has been set.
+	GetBucketEncryption(ctx context.Context, bucketName string) (*ServerSideEncryptionConfiguration, error)
+
+	// PutBucketEncryption replaces the default encryption for a bucket. It
+	// must return a gofakes3.ErrNoSuchBucket error if the bucket does not
+	// exist.
+	PutBucketEncryption(ctx context.Context, bucketName string, config *ServerSideEncryptionConfiguration) error
+
+	// DeleteBucketEncryption must return a gofakes3.ErrNoSuchBucket error if
+	// the bucket does not exist. It must not return an error if the bucket
+	// exists but has no default encryption.
+	DeleteBucketEncryption(ctx context.Context, bucketName string) error
+}
+
+// RequestPaymentBackend may be optionally implemented by a Backend in order to
+// support the '?requestPayment' subresource on buckets. GoFakeS3 does not bill
+// anyone, so the configuration is only stored and returned.
+type RequestPaymentBackend interface {
+	// GetBucketRequestPayment must return a gofakes3.ErrNoSuchBucket error if
+	// the bucket does not exist. If no configuration has been stored, it
+	// should return a nil configuration and a nil error; GoFakeS3 will treat
+	// this as 'BucketOwner'.
+	GetBucketRequestPayment(ctx context.Context, bucketName string) (*RequestPaymentConfiguration, error)
+
+	// PutBucketRequestPayment replaces the configuration for a bucket. It
+	// must return a gofakes3.ErrNoSuchBucket error if the bucket does not
+	// exist.
+	PutBucketRequestPayment(ctx context.Context, bucketName string, config *RequestPaymentConfiguration) error
+}
+
+// AccelerateBackend may be optionally implemented by a Backend in order to
+// support the '?accelerate' subresource on buckets. GoFakeS3 has no transfer
+// acceleration, so the configuration is only stored and returned.
+type AccelerateBackend interface {
+	// GetBucketAccelerate must return a gofakes3.ErrNoSuchBucket error if the
+	// bucket does not exist. If no configuration has been stored, it should
+	// return a nil configuration and a nil error; GoFakeS3 will return an
+	// empty configuration, as S3 does.
+	GetBucketAccelerate(ctx context.Context, bucketName string) (*AccelerateConfiguration, error)
+
+	// PutBucketAccelerate replaces the configuration for a bucket. It must
+	// return a gofakes3.ErrNoSuchBucket error if the bucket does not exist.
+	PutBucketAccelerate(ctx context.Context, bucketName string, config *AccelerateConfiguration) error
+}
+
+// NotificationBackend may be optionally implemented by a Backend in order to
+// store the configuration set using the '?notification' subresource on
+// buckets.
+//
+// If you don't implement NotificationBackend, GoFakeS3 accepts and discards
+// configurations sent by a PUT, and returns an empty configuration for a GET,
+// as many clients read the configuration during setup.
+type NotificationBackend interface {
+	// GetBucketNotification must return a gofakes3.ErrNoSuchBucket error if
+	// the bucket does not exist. If no configuration has been set, it should
+	// return an empty configuration and a nil error.
+	GetBucketNotification(ctx context.Context, bucketName string) (*NotificationConfiguration, error)
+
+	// PutBucketNotification replaces the notification configuration for a
+	// bucket. It must return a gofakes3.ErrNoSuchBucket error if the bucket
+	// does not exist.
+	PutBucketNotification(ctx context.Context, bucketName string, config *NotificationConfiguration) error
+}
+
+// ObjectLockBackend may be optionally implemented by a Backend in order to
+// support the '?retention' and '?legal-hold' subresources on objects, and the
+// '?object-lock' subresource on buckets.
+//
+// In all object methods, an empty versionID refers to the current version of the
+// object. The methods must return a gofakes3.ErrNoSuchKey error if the object
+// does not exist, or a gofakes3.ErrNoSuchVersion error if the version does not
+// exist.
+//
+// GoFakeS3 enforces the retention and legal hold when objects are deleted;
+// the Backend only needs to store them.
+type ObjectLockBackend interface {
+	// GetObjectLockConfiguration must return a gofakes3.ErrNoSuchBucket error
+	// if the bucket does not exist, or a
+	// gofakes3.ErrObjectLockConfigurationNotFound error if Object Lock has
+	// never been enabled for the bucket.
+	GetObjectLockConfiguration(ctx context.Context, bucketName string) (*ObjectLockConfiguration, error)
+
+	// PutObjectLockConfiguration replaces the Object Lock configuration for a
+	// bucket. It must return a gofakes3.ErrNoSuchBucket error if the bucket
+	// does not exist.
+	PutObjectLockConfiguration(ctx context.Context, bucketName string, config *ObjectLockConfiguration) error
+
+	// GetObjectRetention should return a nil retention and a nil error if no
+	// retention has been set for the object version.
+	GetObjectRetention(ctx context.Context, bucketName, objectName string, versionID VersionID) (*ObjectLockRetention, error)
+
+	// PutObjectRetention replaces the retention for an object version. A nil
+	// retention removes it.
+	PutObjectRetention(ctx context.Context, bucketName, objectName string, versionID VersionID, retention *ObjectLockRetention) error
+
+	// GetObjectLegalHold should return a nil legal hold and a nil error if no
+	// legal hold has been set for the object version.
+	GetObjectLegalHold(ctx context.Context, bucketName, objectName string, versionID VersionID) (*ObjectLockLegalHold, error)
+
+	// PutObjectLegalHold replaces the legal hold for an object version.
+	PutObjectLegalHold(ctx context.Context, bucketName, objectName string, versionID VersionID, hold *ObjectLockLegalHold) error
+}
+
+// FlatListingBackend may be optionally implemented by a Backend whose
+// ListBucket does not roll keys up into CommonPrefixes by the delimiter, and
+// instead returns every key that matches the prefix in Contents.
+//
+// If FlatListing returns true, GoFakeS3 requests the whole listing for the
+// prefix without a page, then computes the CommonPrefixes and applies the
+// page itself using RollupObjectList. Listings without a delimiter are passed
+// to the Backend as usual.
+type FlatListingBackend interface {
+	FlatListing() bool
+}
+
+// ResumableBackend may be optionally implemented by a Backend in order to
+// support PutObject requests with the 'x-amz-write-offset-bytes' header, which
+// write to an existing object at an offset so an interrupted upload can be
+// resumed without sending the bytes that were already stored.
+//
+// Writes are append-only: GoFakeS3 checks that the offset equals the current
+// size of the object before calling WriteAt.
+type ResumableBackend interface {
+	// WriteAt appends size bytes read from input to an existing object. It
+	// must return a gofakes3.ErrNoSuchKey error if the object does not exist,
+	// or a gofakes3.ErrInvalidWriteOffset error if offset no longer equals
+	// the size of the object.
+	WriteAt(ctx context.Context, bucketName, objectName string, offset int64, input io.Reader, size int64) (PutObjectResult, error)
+}
+
+// QuotaBackend may be optionally implemented by a Backend in order to enforce
+// the per-bucket quotas configured with WithBucketQuota.
+//
+// If you don't implement QuotaBackend, quotas are not enforced.
+type QuotaBackend interface {
+	// BucketUsage returns the total size in bytes of the objects stored in
+	// the bucket, including noncurrent versions. It must return a
+	// gofakes3.ErrNoSuchBucket error if the bucket does not exist.
+	BucketUsage(ctx context.Context, bucketName string) (int64, error)
+
+	// TotalUsage returns the total size in bytes of the objects stored in
+	// every bucket, including noncurrent versions. It is called for every
+	// write when WithBackendMemoryLimit is used, so it should not need to
+	// visit every object.
+	TotalUsage(ctx context.Context) (int64, error)
+}
+
+// WrappingBackend may be implemented by a Backend that wraps another one,
+// such as the Backends in the backends package, which only implement the
+// methods of Backend themselves.
+//
+// GoFakeS3 looks for each of the optional Backend interfaces on the Backend
+// returned by Unwrap, and the Backends it wraps in turn, if the wrapping
+// Backend does not implement that interface itself. Calls to the optional
+// interfaces found this way go directly to the wrapped Backend.
+type WrappingBackend interface {
+	Unwrap() Backend
+}
+
+// optionalBackends holds the optional Backend interfaces implemented by a
+// Backend, or by the Backends it wraps. An interface that is not implemented
+// is left nil.
+type optionalBackends struct {
+	versioned  VersionedBackend
+	copier     VersionCopyBackend
+	acl        ACLBackend
+	bucketACL  BucketACLBackend
+	policy     PolicyBackend
+	lock       ObjectLockBackend
+	cors       CORSBackend
+	website    WebsiteBackend
+	notify     NotificationBackend
+	encryption EncryptionBackend
+	payment    RequestPaymentBackend
+	accelerate AccelerateBackend
+	flat       FlatListingBackend
+	resumable  ResumableBackend
+	usage      QuotaBackend
+}
+
+// findOptionalBackends looks for the optional Backend interfaces on b,
+// following WrappingBackend until each is found. The outermost Backend that
+// implements an interface is used.
+func findOptionalBackends(b Backend) (found optionalBackends) {
+	for b != nil {
+		if found.versioned == nil {
+			found.versioned, _ = b.(VersionedBackend)
+		}
+		if found.copier == nil {
+			found.copier, _ = b.(VersionCopyBackend)
+		}
+		if found.acl == nil {
+			found.acl, _ = b.(ACLBackend)
+		}
+		if found.bucketACL == nil {
+			found.bucketACL, _ = b.(BucketACLBackend)
+		}
+		if found.policy == nil {
+			found.policy, _ = b.(PolicyBackend)
+		}
+		if found.lock == nil {
+			found.lock, _ = b.(ObjectLockBackend)
+		}
+		if found.cors == nil {
+			found.cors, _ = b.(CORSBackend)
+		}
+		if found.website == nil {
+			found.website, _ = b.(WebsiteBackend)
+		}
+		if found.notify == nil {
+			found.notify, _ = b.(NotificationBackend)
+		}
+		if found.encryption == nil {
+			found.encryption, _ = b.(EncryptionBackend)
+		}
+		if found.payment == nil {
+			found.payment, _ = b.(RequestPaymentBackend)
+		}
+		if found.accelerate == nil {
+			found.accelerate, _ = b.(AccelerateBackend)
+		}
+		if found.flat == nil {
+			found.flat, _ = b.(FlatListingBackend)
+		}
+		if found.resumable == nil {
+			found.resumable, _ = b.(ResumableBackend)
+		}
+		if found.usage == nil {
+			found.usage, _ = b.(QuotaBackend)
+		}
+
+		wrapping, ok := b.(WrappingBackend)
+		if !ok {
+			break
+		}
+		b = wrapping.Unwrap()
+	}
+	return found
+}
+
+// BackendCapabilities reports which of the optional Backend interfaces a
+// Backend implements. Requests that need a missing interface fail with
+// ErrNotImplemented.
+type BackendCapabilities struct {
+	Versioned      bool // VersionedBackend
+	ACL            bool // ACLBackend
+	BucketACL      bool // BucketACLBackend
+	Policy         bool // PolicyBackend
+	ObjectLock     bool // ObjectLockBackend
+	CORS           bool // CORSBackend
+	Website        bool // WebsiteBackend
+	Notification   bool // NotificationBackend
+	Encryption     bool // EncryptionBackend
+	RequestPayment bool // RequestPaymentBackend
+	Accelerate     bool // AccelerateBackend
+	FlatListing    bool // FlatListingBackend, and FlatListing returns true
+	Resumable      bool // ResumableBackend
+	Quota          bool // QuotaBackend
+}
+
+// Capabilities inspects a Backend to find out which of the optional Backend
+// interfaces it implements, either itself or through the Backends it wraps;
+// see WrappingBackend.
+func Capabilities(b Backend) BackendCapabilities {
+	found := findOptionalBackends(b)
+	return BackendCapabilities{
+		Versioned:      found.versioned != nil,
+		ACL:            found.acl != nil,
+		BucketACL:      found.bucketACL != nil,
+		Policy:         found.policy != nil,
+		ObjectLock:     found.lock != nil,
+		CORS:           found.cors != nil,
+		Website:        found.website != nil,
+		Notification:   found.notify != nil,
+		Encryption:     found.encryption != nil,
+		RequestPayment: found.payment != nil,
+		Accelerate:     found.accelerate != nil,
+		FlatListing:    found.flat != nil && found.flat.FlatListing(),
+		Resumable:      found.resumable != nil,
+		Quota:          found.usage != nil,
+	}
+}
+
+func (c BackendCapabilities) String() string {
+	return fmt.Sprintf("versioned=%t acl=%t bucket-acl=%t policy=%t object-lock=%t cors=%t website=%t notification=%t encryption=%t request-payment=%t accelerate=%t flat-listing=%t resumable=%t quota=%t",
+		c.Versioned, c.ACL, c.BucketACL, c.Policy, c.ObjectLock, c.CORS, c.Website, c.Notification, c.Encryption, c.RequestPayment, c.Accelerate, c.FlatListing, c.Resumable, c.Quota)
+}
+
 func MergeMetadata(ctx context.Context, db Backend, bucketName string, objectName string, meta map[string]string) error {
 	// get potential existing object to potentially carry metadata over
 	existingObj, err := db.GetObject(ctx, bucketName, objectName, nil)
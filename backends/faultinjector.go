@@ -0,0 +1,143 @@
+// Package backends contains gofakes3.Backend implementations that wrap
+// another Backend to change its behaviour.
+package backends
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/oneclickvirt/gofakes3"
+)
+
+// FaultRule describes which calls to the inner Backend a FaultInjector fails,
+// and how. A call is failed by the first rule that matches it.
+//
+// For example, to fail GetObject in bucket "x" with a '503 Service
+// Unavailable' twice, then let it succeed:
+//
+//	backends.FaultRule{
+//		Method: "GetObject",
+//		Bucket: "x",
+//		Err:    gofakes3.ErrServiceUnavailable,
+//		Times:  2,
+//	}
+type FaultRule struct {
+	// Method is the name of the Backend method the rule applies to, such as
+	// "PutObject" or "ListBucket". If it is empty, the rule applies to every
+	// method.
+	Method string
+
+	// Bucket limits the rule to calls for a single bucket. For CopyObject,
+	// this is the destination bucket. If it is empty, the rule applies to
+	// every bucket.
+	Bucket string
+
+	// Err is returned in place of calling the inner Backend. Use a
+	// gofakes3.ErrorCode, or an error created with gofakes3.ErrorMessage, to
+	// choose the status of the response. If Err is nil, gofakes3.ErrInternal
+	// is returned.
+	Err error
+
+	// After is the number of matching calls that are passed through to the
+	// inner Backend before the rule starts to fail them.
+	After int
+
+	// Times is the number of calls the rule fails, after which every call
+	// is passed through. If Times is 0, there is no limit.
+	Times int
+
+	// Probability is the chance that a matching call is failed, between 0
+	// and 1. If Probability is 0, every matching call is failed.
+	Probability float64
+}
+
+type faultRuleState struct {
+	FaultRule
+	seen   int
+	failed int
+}
+
+// FaultInjector is a gofakes3.Backend that fails calls to an inner Backend
+// according to a list of FaultRules, so a client's handling of errors and
+// retries can be tested. Calls that are not failed are passed through.
+//
+// Only the methods of gofakes3.Backend are wrapped. GoFakeS3 still uses the
+// optional Backend interfaces, such as gofakes3.VersionedBackend, that the
+// inner Backend implements, but calls to them are passed straight through.
+type FaultInjector struct {
+	hookedBackend
+
+	mu    sync.Mutex
+	rules []*faultRuleState
+	rand  *rand.Rand
+}
+
+var _ gofakes3.Backend = &FaultInjector{}
+var _ gofakes3.WrappingBackend = &FaultInjector{}
+
+// NewFaultInjector wraps inner in a FaultInjector that applies rules.
+func NewFaultInjector(inner gofakes3.Backend, rules ...FaultRule) *FaultInjector {
+	f := &FaultInjector{
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	f.hookedBackend = hookedBackend{
+		inner: inner,
+		before: func(ctx context.Context, method, bucket string) error {
+			return f.fault(method, bucket)
+		},
+	}
+	f.SetRules(rules...)
+	return f
+}
+
+// SetRules replaces the rules of the FaultInjector. It may be called while
+// the server is running, to change the behaviour in the middle of a test.
+// The counts used by After and Times start again from zero.
+func (f *FaultInjector) SetRules(rules ...FaultRule) {
+	states := make([]*faultRuleState, len(rules))
+	for i, rule := range rules {
+		states[i] = &faultRuleState{FaultRule: rule}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = states
+}
+
+// Seed seeds the source of randomness used for FaultRule.Probability, so a
+// test can be repeated exactly.
+func (f *FaultInjector) Seed(seed int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rand = rand.New(rand.NewSource(seed))
+}
+
+// fault returns the error the call to method should fail with, or nil if it
+// should be passed through to the inner Backend.
+func (f *FaultInjector) fault(method, bucket string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, rule := range f.rules {
+		if (rule.Method != "" && rule.Method != method) || (rule.Bucket != "" && rule.Bucket != bucket) {
+			continue
+		}
+
+		rule.seen++
+		if rule.seen <= rule.After || (rule.Times > 0 && rule.failed >= rule.Times) {
+			continue
+		}
+		if rule.Probability > 0 && f.rand.Float64() >= rule.Probability {
+			continue
+		}
+
+		rule.failed++
+		if rule.Err == nil {
+			return gofakes3.ErrInternal
+		}
+		return rule.Err
+	}
+	return nil
+}
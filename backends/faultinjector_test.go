@@ -0,0 +1,173 @@
+package backends_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oneclickvirt/gofakes3"
+	"github.com/oneclickvirt/gofakes3/backends"
+	"github.com/oneclickvirt/gofakes3/s3mem"
+)
+
+func newInner(t *testing.T) gofakes3.Backend {
+	t.Helper()
+	ctx := context.Background()
+	inner := s3mem.New()
+	for _, bucket := range []string{"x", "y"} {
+		if err := inner.CreateBucket(ctx, bucket); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := inner.PutObject(ctx, bucket, "obj", nil, bytes.NewReader([]byte("hello")), 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return inner
+}
+
+// getObjects calls GetObject on bucket n times, and reports which calls
+// failed with ErrServiceUnavailable.
+func getObjects(t *testing.T, backend gofakes3.Backend, bucket string, n int) (failed []bool) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		obj, err := backend.GetObject(context.Background(), bucket, "obj", nil)
+		if err == nil {
+			obj.Contents.Close()
+		} else if !gofakes3.HasErrorCode(err, gofakes3.ErrServiceUnavailable) {
+			t.Fatal("unexpected error", err)
+		}
+		failed = append(failed, err != nil)
+	}
+	return failed
+}
+
+func assertFailed(t *testing.T, found []bool, expected ...bool) {
+	t.Helper()
+	if len(found) != len(expected) {
+		t.Fatal("unexpected number of calls", len(found))
+	}
+	for i := range found {
+		if found[i] != expected[i] {
+			t.Fatalf("call %d: failed %v, expected %v (all calls: %v)", i, found[i], expected[i], found)
+		}
+	}
+}
+
+func TestFaultInjectorTimes(t *testing.T) {
+	backend := backends.NewFaultInjector(newInner(t), backends.FaultRule{
+		Method: "GetObject",
+		Bucket: "x",
+		Err:    gofakes3.ErrServiceUnavailable,
+		Times:  2,
+	})
+	assertFailed(t, getObjects(t, backend, "y", 2), false, false)
+	assertFailed(t, getObjects(t, backend, "x", 4), true, true, false, false)
+
+	// Other methods are passed through:
+	obj, err := backend.HeadObject(context.Background(), "x", "obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.Contents.Close()
+}
+
+func TestFaultInjectorAfter(t *testing.T) {
+	backend := backends.NewFaultInjector(newInner(t), backends.FaultRule{
+		Err:   gofakes3.ErrServiceUnavailable,
+		After: 2,
+	})
+	assertFailed(t, getObjects(t, backend, "x", 4), false, false, true, true)
+}
+
+func TestFaultInjectorDefaultError(t *testing.T) {
+	backend := backends.NewFaultInjector(newInner(t), backends.FaultRule{Method: "ListBuckets"})
+	if _, err := backend.ListBuckets(context.Background()); !gofakes3.HasErrorCode(err, gofakes3.ErrInternal) {
+		t.Fatal("expected InternalError, found", err)
+	}
+}
+
+func TestFaultInjectorSetRules(t *testing.T) {
+	backend := backends.NewFaultInjector(newInner(t))
+	assertFailed(t, getObjects(t, backend, "x", 1), false)
+
+	backend.SetRules(backends.FaultRule{Err: gofakes3.ErrServiceUnavailable, Times: 1})
+	assertFailed(t, getObjects(t, backend, "x", 2), true, false)
+
+	backend.SetRules()
+	assertFailed(t, getObjects(t, backend, "x", 1), false)
+}
+
+func TestFaultInjectorProbability(t *testing.T) {
+	run := func() []bool {
+		backend := backends.NewFaultInjector(newInner(t), backends.FaultRule{
+			Err:         gofakes3.ErrServiceUnavailable,
+			Probability: 0.5,
+		})
+		backend.Seed(1)
+		return getObjects(t, backend, "x", 100)
+	}
+
+	first := run()
+	var failures int
+	for _, failed := range first {
+		if failed {
+			failures++
+		}
+	}
+	if failures == 0 || failures == len(first) {
+		t.Fatal("expected some of the calls to fail, found", failures)
+	}
+
+	// The same seed fails the same calls:
+	assertFailed(t, run(), first...)
+}
+
+func TestFaultInjectorServer(t *testing.T) {
+	backend := backends.NewFaultInjector(newInner(t), backends.FaultRule{
+		Method: "GetObject",
+		Err:    gofakes3.ErrServiceUnavailable,
+		Times:  1,
+	})
+	ts := httptest.NewServer(gofakes3.New(backend).Server())
+	defer ts.Close()
+
+	for _, status := range []int{http.StatusServiceUnavailable, http.StatusOK} {
+		rs, err := http.Get(ts.URL + "/x/obj")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+		if rs.StatusCode != status {
+			t.Fatal("unexpected status", rs.StatusCode, "expected", status)
+		}
+	}
+}
+
+func TestFaultInjectorCapabilities(t *testing.T) {
+	inner := newInner(t)
+	backend := backends.NewFaultInjector(backends.NewLatencyBackend(inner, 0))
+	if found, expected := gofakes3.Capabilities(backend), gofakes3.Capabilities(inner); found != expected {
+		t.Fatalf("found capabilities %s, expected %s", found, expected)
+	}
+
+	// Versioning is only available through the inner Backend:
+	ts := httptest.NewServer(gofakes3.New(backend).Server())
+	defer ts.Close()
+
+	body := `<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>`
+	rq, err := http.NewRequest("PUT", ts.URL+"/x?versioning", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := http.DefaultClient.Do(rq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+}
@@ -0,0 +1,99 @@
+package backends
+
+import (
+	"context"
+	"io"
+
+	"github.com/oneclickvirt/gofakes3"
+)
+
+// hookedBackend implements gofakes3.Backend by calling before, then passing
+// the call through to inner if before does not return an error. method is
+// the name of the Backend method, and bucket the bucket it applies to.
+type hookedBackend struct {
+	inner  gofakes3.Backend
+	before func(ctx context.Context, method, bucket string) error
+}
+
+// Unwrap returns the inner Backend, so GoFakeS3 can use the optional Backend
+// interfaces it implements; see gofakes3.WrappingBackend.
+func (h *hookedBackend) Unwrap() gofakes3.Backend {
+	return h.inner
+}
+
+func (h *hookedBackend) ListBuckets(ctx context.Context) ([]gofakes3.BucketInfo, error) {
+	if err := h.before(ctx, "ListBuckets", ""); err != nil {
+		return nil, err
+	}
+	return h.inner.ListBuckets(ctx)
+}
+
+func (h *hookedBackend) ListBucket(ctx context.Context, name string, prefix *gofakes3.Prefix, page gofakes3.ListBucketPage) (*gofakes3.ObjectList, error) {
+	if err := h.before(ctx, "ListBucket", name); err != nil {
+		return nil, err
+	}
+	return h.inner.ListBucket(ctx, name, prefix, page)
+}
+
+func (h *hookedBackend) CreateBucket(ctx context.Context, name string) error {
+	if err := h.before(ctx, "CreateBucket", name); err != nil {
+		return err
+	}
+	return h.inner.CreateBucket(ctx, name)
+}
+
+func (h *hookedBackend) BucketExists(ctx context.Context, name string) (exists bool, err error) {
+	if err := h.before(ctx, "BucketExists", name); err != nil {
+		return false, err
+	}
+	return h.inner.BucketExists(ctx, name)
+}
+
+func (h *hookedBackend) DeleteBucket(ctx context.Context, name string) error {
+	if err := h.before(ctx, "DeleteBucket", name); err != nil {
+		return err
+	}
+	return h.inner.DeleteBucket(ctx, name)
+}
+
+func (h *hookedBackend) GetObject(ctx context.Context, bucketName, objectName string, rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
+	if err := h.before(ctx, "GetObject", bucketName); err != nil {
+		return nil, err
+	}
+	return h.inner.GetObject(ctx, bucketName, objectName, rangeRequest)
+}
+
+func (h *hookedBackend) HeadObject(ctx context.Context, bucketName, objectName string) (*gofakes3.Object, error) {
+	if err := h.before(ctx, "HeadObject", bucketName); err != nil {
+		return nil, err
+	}
+	return h.inner.HeadObject(ctx, bucketName, objectName)
+}
+
+func (h *hookedBackend) DeleteObject(ctx context.Context, bucketName, objectName string) (gofakes3.ObjectDeleteResult, error) {
+	if err := h.before(ctx, "DeleteObject", bucketName); err != nil {
+		return gofakes3.ObjectDeleteResult{}, err
+	}
+	return h.inner.DeleteObject(ctx, bucketName, objectName)
+}
+
+func (h *hookedBackend) PutObject(ctx context.Context, bucketName, key string, meta map[string]string, input io.Reader, size int64) (gofakes3.PutObjectResult, error) {
+	if err := h.before(ctx, "PutObject", bucketName); err != nil {
+		return gofakes3.PutObjectResult{}, err
+	}
+	return h.inner.PutObject(ctx, bucketName, key, meta, input, size)
+}
+
+func (h *hookedBackend) DeleteMulti(ctx context.Context, bucketName string, objects ...string) (gofakes3.MultiDeleteResult, error) {
+	if err := h.before(ctx, "DeleteMulti", bucketName); err != nil {
+		return gofakes3.MultiDeleteResult{}, err
+	}
+	return h.inner.DeleteMulti(ctx, bucketName, objects...)
+}
+
+func (h *hookedBackend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, meta map[string]string) (gofakes3.CopyObjectResult, error) {
+	if err := h.before(ctx, "CopyObject", dstBucket); err != nil {
+		return gofakes3.CopyObjectResult{}, err
+	}
+	return h.inner.CopyObject(ctx, srcBucket, srcKey, dstBucket, dstKey, meta)
+}
@@ -0,0 +1,104 @@
+package backends
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/oneclickvirt/gofakes3"
+)
+
+// LatencyBackend is a gofakes3.Backend that waits before passing each call
+// through to an inner Backend, to simulate slow storage. This allows a
+// client's timeouts and deadlines to be tested.
+//
+// The wait is cut short if the request's context is done, in which case the
+// context's error, such as context.Canceled, is returned without calling the
+// inner Backend.
+//
+// Only the methods of gofakes3.Backend are wrapped. GoFakeS3 still uses the
+// optional Backend interfaces, such as gofakes3.VersionedBackend, that the
+// inner Backend implements, but calls to them are passed straight through.
+type LatencyBackend struct {
+	hookedBackend
+
+	latency time.Duration
+	methods map[string]time.Duration
+	jitter  time.Duration
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+var _ gofakes3.Backend = &LatencyBackend{}
+var _ gofakes3.WrappingBackend = &LatencyBackend{}
+
+// LatencyOption configures a LatencyBackend.
+type LatencyOption func(b *LatencyBackend)
+
+// WithMethodLatency sets the latency of a single Backend method, such as
+// "GetObject", in place of the latency passed to NewLatencyBackend.
+func WithMethodLatency(method string, latency time.Duration) LatencyOption {
+	return func(b *LatencyBackend) { b.methods[method] = latency }
+}
+
+// WithLatencyJitter adds a random duration between 0 and jitter to the
+// latency of every call.
+func WithLatencyJitter(jitter time.Duration) LatencyOption {
+	return func(b *LatencyBackend) { b.jitter = jitter }
+}
+
+// WithLatencySeed seeds the source of randomness used for the jitter, so a
+// test can be repeated exactly.
+func WithLatencySeed(seed int64) LatencyOption {
+	return func(b *LatencyBackend) { b.rand = rand.New(rand.NewSource(seed)) }
+}
+
+// NewLatencyBackend wraps inner in a LatencyBackend that waits for latency
+// before every call.
+func NewLatencyBackend(inner gofakes3.Backend, latency time.Duration, opts ...LatencyOption) *LatencyBackend {
+	b := &LatencyBackend{
+		latency: latency,
+		methods: map[string]time.Duration{},
+	}
+	b.hookedBackend = hookedBackend{inner: inner, before: b.wait}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.rand == nil {
+		b.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return b
+}
+
+// delay returns how long a call to method should wait.
+func (b *LatencyBackend) delay(method string) time.Duration {
+	d, ok := b.methods[method]
+	if !ok {
+		d = b.latency
+	}
+	if b.jitter > 0 {
+		b.mu.Lock()
+		d += time.Duration(b.rand.Int63n(int64(b.jitter)))
+		b.mu.Unlock()
+	}
+	return d
+}
+
+func (b *LatencyBackend) wait(ctx context.Context, method, bucket string) error {
+	d := b.delay(method)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,77 @@
+package backends_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oneclickvirt/gofakes3/backends"
+)
+
+func TestLatencyBackend(t *testing.T) {
+	const latency = 50 * time.Millisecond
+	backend := backends.NewLatencyBackend(newInner(t), latency,
+		backends.WithMethodLatency("HeadObject", 0))
+
+	start := time.Now()
+	obj, err := backend.GetObject(context.Background(), "x", "obj", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.Contents.Close()
+	if elapsed := time.Since(start); elapsed < latency {
+		t.Fatal("GetObject returned after", elapsed, "expected at least", latency)
+	}
+
+	start = time.Now()
+	obj, err = backend.HeadObject(context.Background(), "x", "obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.Contents.Close()
+	if elapsed := time.Since(start); elapsed >= latency {
+		t.Fatal("HeadObject returned after", elapsed, "expected no latency")
+	}
+}
+
+func TestLatencyBackendJitter(t *testing.T) {
+	const latency, jitter = 10 * time.Millisecond, 20 * time.Millisecond
+	backend := backends.NewLatencyBackend(newInner(t), latency,
+		backends.WithLatencyJitter(jitter),
+		backends.WithLatencySeed(1))
+
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		if _, err := backend.BucketExists(context.Background(), "x"); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < latency {
+			t.Fatal("BucketExists returned after", elapsed, "expected at least", latency)
+		}
+	}
+}
+
+func TestLatencyBackendContext(t *testing.T) {
+	backend := backends.NewLatencyBackend(newInner(t), time.Hour)
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		start := time.Now()
+		if _, err := backend.ListBuckets(ctx); err != context.Canceled {
+			t.Fatal("expected context.Canceled, found", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatal("cancellation took", elapsed)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := backend.ListBuckets(ctx); err != context.DeadlineExceeded {
+			t.Fatal("expected context.DeadlineExceeded, found", err)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package gofakes3
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"net/http"
+	"strings"
+)
+
+// ChecksumAlgorithm is one of the additional checksum algorithms S3 supports
+// for verifying object data, sent in the 'x-amz-checksum-algorithm' header:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/checking-object-integrity.html
+type ChecksumAlgorithm string
+
+const (
+	ChecksumNone   ChecksumAlgorithm = ""
+	ChecksumCRC32  ChecksumAlgorithm = "CRC32"
+	ChecksumCRC32C ChecksumAlgorithm = "CRC32C"
+	ChecksumSHA1   ChecksumAlgorithm = "SHA1"
+	ChecksumSHA256 ChecksumAlgorithm = "SHA256"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+func (c ChecksumAlgorithm) Valid() bool {
+	switch c {
+	case ChecksumCRC32, ChecksumCRC32C, ChecksumSHA1, ChecksumSHA256:
+		return true
+	}
+	return false
+}
+
+// Header returns the name of the header that carries a checksum calculated
+// using this algorithm, i.e. 'x-amz-checksum-crc32'.
+func (c ChecksumAlgorithm) Header() string {
+	return "x-amz-checksum-" + strings.ToLower(string(c))
+}
+
+func (c ChecksumAlgorithm) newHash() hash.Hash {
+	switch c {
+	case ChecksumCRC32:
+		return crc32.NewIEEE()
+	case ChecksumCRC32C:
+		return crc32.New(crc32cTable)
+	case ChecksumSHA1:
+		return sha1.New()
+	case ChecksumSHA256:
+		return sha256.New()
+	default:
+		panic(fmt.Errorf("gofakes3: unknown checksum algorithm %q", c))
+	}
+}
+
+// Sum returns the base64 encoded checksum of data, as it appears in the
+// 'x-amz-checksum-*' headers.
+func (c ChecksumAlgorithm) Sum(data []byte) string {
+	h := c.newHash()
+	h.Write(data)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// compositeSum calculates the checksum of a multipart upload from the
+// checksums of its parts. S3 calculates the checksum of the concatenated
+// binary checksums of each part, and appends the number of parts:
+//
+//	base64(checksum(checksum(part1) + checksum(part2) + ...)) + "-" + len(parts)
+func (c ChecksumAlgorithm) compositeSum(parts []string) (string, error) {
+	h := c.newHash()
+	for _, part := range parts {
+		raw, err := base64.StdEncoding.DecodeString(part)
+		if err != nil {
+			return "", err
+		}
+		h.Write(raw)
+	}
+	return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(h.Sum(nil)), len(parts)), nil
+}
+
+// echoChecksumHeaders copies any 'x-amz-checksum-*' headers sent with a
+// request to the response, without verifying them. CRC64NVME is echoed even
+// though GoFakeS3 can not calculate it.
+func echoChecksumHeaders(from, to http.Header) {
+	for _, alg := range []ChecksumAlgorithm{ChecksumCRC32, ChecksumCRC32C, ChecksumSHA1, ChecksumSHA256, "CRC64NVME"} {
+		if v := from.Get(alg.Header()); v != "" {
+			to.Set(alg.Header(), v)
+		}
+	}
+}
+
+// checksumAlgorithmFromHeaders reads the 'x-amz-checksum-algorithm' header.
+func checksumAlgorithmFromHeaders(hdr http.Header) (ChecksumAlgorithm, error) {
+	value := hdr.Get("x-amz-checksum-algorithm")
+	if value == "" {
+		return ChecksumNone, nil
+	}
+	alg := ChecksumAlgorithm(strings.ToUpper(value))
+	if !alg.Valid() {
+		return ChecksumNone, ErrorInvalidArgument("x-amz-checksum-algorithm", value, "Checksum algorithm provided is unsupported. Please try again with any of the valid types: [CRC32, CRC32C, SHA1, SHA256]")
+	}
+	return alg, nil
+}
+
+// checksumsFromHeaders returns the checksums that must be calculated for a
+// new object: one for each 'x-amz-checksum-*' header that was sent, with the
+// header's value as the expected checksum, and one with no expected value
+// for the algorithm named in the 'x-amz-sdk-checksum-algorithm' or
+// 'x-amz-checksum-algorithm' header if no value was sent for it. CRC64NVME
+// can not be calculated, so it is left to echoChecksumHeaders.
+func checksumsFromHeaders(hdr http.Header) (map[ChecksumAlgorithm]string, error) {
+	checksums := map[ChecksumAlgorithm]string{}
+	for _, alg := range []ChecksumAlgorithm{ChecksumCRC32, ChecksumCRC32C, ChecksumSHA1, ChecksumSHA256} {
+		value := hdr.Get(alg.Header())
+		if value == "" {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(raw) != alg.newHash().Size() {
+			return nil, ErrorMessagef(ErrInvalidRequest, "Value for %s header is invalid.", alg.Header())
+		}
+		checksums[alg] = value
+	}
+
+	declared := hdr.Get("x-amz-sdk-checksum-algorithm")
+	if declared == "" {
+		declared = hdr.Get("x-amz-checksum-algorithm")
+	}
+	if declared == "" {
+		return checksums, nil
+	}
+	alg := ChecksumAlgorithm(strings.ToUpper(declared))
+	if alg == "CRC64NVME" {
+		return checksums, nil
+	} else if !alg.Valid() {
+		return nil, ErrorInvalidArgument("x-amz-sdk-checksum-algorithm", declared, "Checksum algorithm provided is unsupported. Please try again with any of the valid types: [CRC32, CRC32C, SHA1, SHA256]")
+	}
+	if _, ok := checksums[alg]; !ok {
+		checksums[alg] = ""
+	}
+	return checksums, nil
+}
+
+// trailerChecksum returns the checksum algorithm named in the 'x-amz-trailer'
+// header, which announces a checksum sent in the trailer of an 'aws-chunked'
+// body.
+func trailerChecksum(hdr http.Header) (ChecksumAlgorithm, bool) {
+	name := strings.ToLower(hdr.Get("x-amz-trailer"))
+	if !strings.HasPrefix(name, "x-amz-checksum-") {
+		return ChecksumNone, false
+	}
+	alg := ChecksumAlgorithm(strings.ToUpper(strings.TrimPrefix(name, "x-amz-checksum-")))
+	return alg, alg.Valid()
+}
+
+// checkChecksumType rejects a checksum header for any algorithm other than
+// alg, as S3 only permits the algorithm declared when the multipart upload
+// was created.
+func checkChecksumType(hdr http.Header, alg ChecksumAlgorithm) error {
+	for _, other := range []ChecksumAlgorithm{ChecksumCRC32, ChecksumCRC32C, ChecksumSHA1, ChecksumSHA256} {
+		if other != alg && hdr.Get(other.Header()) != "" {
+			return ErrorMessagef(ErrInvalidRequest, "Checksum Type mismatch occurred, expected checksum Type: %s, actual checksum Type: %s",
+				strings.ToLower(string(alg)), strings.ToLower(string(other)))
+		}
+	}
+	return nil
+}
+
+// verifyChecksumHeaders checks sum, the checksum of a part calculated using
+// alg, against the matching 'x-amz-checksum-*' header, if one was sent. A
+// checksum header for any other algorithm is rejected.
+func verifyChecksumHeaders(hdr http.Header, alg ChecksumAlgorithm, sum string) error {
+	if err := checkChecksumType(hdr, alg); err != nil {
+		return err
+	}
+	if expected := hdr.Get(alg.Header()); expected != "" && expected != sum {
+		return ErrorMessagef(ErrBadDigest, "The %s you specified did not match the calculated checksum.", alg)
+	}
+	return nil
+}
+
+// verifyUntrackedChecksums checks any 'x-amz-checksum-*' headers sent with a
+// part of a multipart upload that was created without a checksum algorithm,
+// against sums, the checksums calculated as the part was read. The checksums
+// are verified and sent back, but are not kept with the part.
+func verifyUntrackedChecksums(hdr http.Header, sums map[ChecksumAlgorithm]string, out http.Header) error {
+	checksums, err := checksumsFromHeaders(hdr)
+	if err != nil {
+		return err
+	}
+	for alg, expected := range checksums {
+		sum, ok := sums[alg]
+		if !ok {
+			continue
+		}
+		if expected != "" && sum != expected {
+			return ErrorMessagef(ErrBadDigest, "The %s you specified did not match the calculated checksum.", alg)
+		}
+		out.Set(alg.Header(), sum)
+	}
+	return nil
+}
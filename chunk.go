@@ -1,26 +1,97 @@
 package gofakes3
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"strings"
 )
 
+// isAWSChunked reports whether a request body is sent using 'aws-chunked'
+// content encoding. Some clients only declare this in the Content-Encoding
+// header, without the streaming 'x-amz-content-sha256' value. In both cases
+// the Content-Length header is the encoded length, and the size of the object
+// comes from the 'X-Amz-Decoded-Content-Length' header.
+//
+// The '-TRAILER' variants, which the v2 SDKs use by default, send a checksum
+// in a trailer after the final chunk; see chunkedReader.
+func isAWSChunked(hdr http.Header) bool {
+	switch hdr.Get("X-Amz-Content-Sha256") {
+	case "STREAMING-AWS4-HMAC-SHA256-PAYLOAD",
+		"STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER",
+		"STREAMING-UNSIGNED-PAYLOAD-TRAILER":
+		return true
+	}
+	for _, enc := range strings.Split(hdr.Get("Content-Encoding"), ",") {
+		if strings.EqualFold(strings.TrimSpace(enc), "aws-chunked") {
+			return true
+		}
+	}
+	return false
+}
+
+// stripAWSChunkedEncoding removes 'aws-chunked' from the Content-Encoding
+// stored with an object, as S3 does; it describes the upload, not the object.
+// So does the 'x-amz-trailer' header.
+func stripAWSChunkedEncoding(meta map[string]string) {
+	delete(meta, "X-Amz-Trailer")
+
+	enc, ok := meta["Content-Encoding"]
+	if !ok {
+		return
+	}
+	var keep []string
+	for _, v := range strings.Split(enc, ",") {
+		if v = strings.TrimSpace(v); v != "" && !strings.EqualFold(v, "aws-chunked") {
+			keep = append(keep, v)
+		}
+	}
+	if len(keep) == 0 {
+		delete(meta, "Content-Encoding")
+	} else {
+		meta["Content-Encoding"] = strings.Join(keep, ",")
+	}
+}
+
+// chunkedReader decodes a body sent using 'aws-chunked' content encoding.
+// Chunk signatures are not verified, and may be left out, as they are for
+// 'STREAMING-UNSIGNED-PAYLOAD-TRAILER'.
+//
+// The number of decoded bytes is checked against decodedLength, which comes
+// from the 'X-Amz-Decoded-Content-Length' header; if they differ,
+// ErrIncompleteBody is returned instead of io.EOF when the final chunk is
+// reached.
+//
+// Any trailing headers sent after the final chunk, such as
+// 'x-amz-checksum-crc32', are available in trailer once io.EOF has been
+// returned.
 type chunkedReader struct {
-	inner         io.Reader
+	inner         *bufio.Reader
 	chunkRemain   int
 	notFirstChunk bool
+	decodedLength int64
+	decoded       int64
+	trailer       http.Header
+	err           error
 }
 
-func newChunkedReader(inner io.Reader) *chunkedReader {
+func newChunkedReader(inner io.Reader, decodedLength int64) *chunkedReader {
 	return &chunkedReader{
-		inner:         inner,
+		inner:         bufio.NewReader(inner),
 		chunkRemain:   0,
 		notFirstChunk: false,
+		decodedLength: decodedLength,
+		trailer:       http.Header{},
 	}
 }
 
 func (r *chunkedReader) Read(p []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
 	sizeToRead := len(p)
 	for sizeToRead > 0 {
 		if r.chunkRemain > 0 {
@@ -33,9 +104,14 @@ func (r *chunkedReader) Read(p []byte) (n int, err error) {
 			r.chunkRemain -= innerN
 			sizeToRead -= innerN
 			n += innerN
+			r.decoded += int64(innerN)
 			if err != nil {
 				return n, err
 			}
+			if r.decoded > r.decodedLength {
+				r.err = ErrIncompleteBody
+				return n, r.err
+			}
 		} else {
 			if !r.notFirstChunk {
 				// Is first chunk.
@@ -47,18 +123,54 @@ func (r *chunkedReader) Read(p []byte) (n int, err error) {
 					return n, err
 				}
 			}
-			// read next chunk header
+			// read next chunk header; the rest of the line is either empty or
+			// ";chunk-signature=" + signature:
 			chunkSize := 0
-			_, err = fmt.Fscanf(r.inner, "%x;", &chunkSize)
+			_, err = fmt.Fscanf(r.inner, "%x", &chunkSize)
 			if err != nil {
 				return n, err
 			}
 			r.chunkRemain = chunkSize
-			_, err = io.CopyN(ioutil.Discard, r.inner, 16+64+2) // "chunk-signature=" + sizeOfHash + "\r\n"
-			if err != nil {
+			if _, err = r.inner.ReadString('\n'); err != nil {
 				return n, err
 			}
+
+			// An empty chunk marks the end of the body:
+			if chunkSize == 0 {
+				r.err = r.readTrailer()
+				if r.err == nil {
+					r.err = io.EOF
+				}
+				if r.decoded != r.decodedLength {
+					r.err = ErrIncompleteBody
+				}
+				return n, r.err
+			}
 		}
 	}
 	return n, nil
 }
+
+// readTrailer reads the trailing headers that follow the final chunk, up to
+// the empty line that ends the body. The end of the body is also accepted in
+// place of the empty line.
+func (r *chunkedReader) readTrailer() error {
+	for {
+		line, err := r.inner.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if err != nil && err != io.EOF {
+				return err
+			}
+			return nil
+		} else if err != nil {
+			return ErrIncompleteBody
+		}
+
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return ErrIncompleteBody
+		}
+		r.trailer.Set(strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]))
+	}
+}
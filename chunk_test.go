@@ -29,7 +29,7 @@ func TestChunkedUploadSuccess(t *testing.T) {
 	payload += "0;chunk-signature=b6c6ea8a5354eaf15b3cb7646744f4275b71ea724fed81ceb9323e279d449df9\r\n\r\n"
 
 	inner := strings.NewReader(payload)
-	chunkedReader := newChunkedReader(inner)
+	chunkedReader := newChunkedReader(inner, 65536+1024)
 	buf, err := ioutil.ReadAll(chunkedReader)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, string(buf), strings.Repeat("a", 65536+1024))
@@ -42,7 +42,7 @@ func (errReader) Read(p []byte) (n int, err error) {
 }
 
 func TestChunkedUploadFail(t *testing.T) {
-	chunkedReader := newChunkedReader(errReader{})
+	chunkedReader := newChunkedReader(errReader{}, 65536+1024)
 	buf, err := ioutil.ReadAll(chunkedReader)
 	assert.Equal(t, errors.New("err"), err)
 	assert.Equal(t, "", string(buf))
@@ -50,7 +50,7 @@ func TestChunkedUploadFail(t *testing.T) {
 	chunkedReader = newChunkedReader(io.MultiReader(
 		strings.NewReader("10000;chunk-signature=ad80c730a21e5b8d04586a2213dd63b9a0e99e0e2307b0ade35a65485a288648\r\n"),
 		errReader{},
-	))
+	), 65536+1024)
 	buf, err = ioutil.ReadAll(chunkedReader)
 	assert.Equal(t, errors.New("err"), err)
 	assert.Equal(t, "", string(buf))
@@ -58,7 +58,7 @@ func TestChunkedUploadFail(t *testing.T) {
 	chunkedReader = newChunkedReader(io.MultiReader(
 		strings.NewReader("incorrect_data"),
 		errReader{},
-	))
+	), 65536+1024)
 	buf, err = ioutil.ReadAll(chunkedReader)
 	assert.Equal(t, errors.New("expected integer"), err)
 	assert.Equal(t, "", string(buf))
@@ -68,7 +68,7 @@ func TestChunkedUploadFail(t *testing.T) {
 	chunkedReader = newChunkedReader(io.MultiReader(
 		strings.NewReader(payload),
 		errReader{},
-	))
+	), 65536+1024)
 	buf, err = ioutil.ReadAll(chunkedReader)
 	assert.Equal(t, errors.New("err"), err)
 	assert.Equal(t, strings.Repeat("a", 200), string(buf))
@@ -78,7 +78,7 @@ func TestChunkedUploadFail(t *testing.T) {
 	chunkedReader = newChunkedReader(io.MultiReader(
 		strings.NewReader(payload),
 		errReader{},
-	))
+	), 65536+1024)
 	buf = make([]byte, 1024)
 	n, err := chunkedReader.Read(buf)
 	assert.Equal(t, nil, err)
@@ -96,7 +96,7 @@ func TestChunkedUploadFail(t *testing.T) {
 	chunkedReader = newChunkedReader(io.MultiReader(
 		strings.NewReader(payload),
 		errReader{},
-	))
+	), 65536+1024)
 	buf = make([]byte, 65536+1024)
 	n, err = io.ReadFull(chunkedReader, buf)
 	assert.Equal(t, errors.New("err"), err)
@@ -107,11 +107,57 @@ func TestChunkedUploadFail(t *testing.T) {
 	chunkedReader = newChunkedReader(io.MultiReader(
 		strings.NewReader(payload),
 		errReader{},
-	))
+	), 65536+1024)
 	buf = make([]byte, 65536+1024)
 	n, err = io.ReadFull(chunkedReader, buf)
 	assert.Equal(t, errors.New("err"), err)
 	assert.Equal(t, "", string(buf[:n]))
 	assert.Equal(t, 0, n)
+}
+
+func TestChunkedUploadDecodedLengthMismatch(t *testing.T) {
+	payload := "400;chunk-signature=0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497\r\n"
+	payload += strings.Repeat("a", 1024)
+	payload += "\r\n"
+	payload += "0;chunk-signature=b6c6ea8a5354eaf15b3cb7646744f4275b71ea724fed81ceb9323e279d449df9\r\n\r\n"
+
+	for _, decodedLength := range []int64{1023, 1025} {
+		chunkedReader := newChunkedReader(strings.NewReader(payload), decodedLength)
+		_, err := ioutil.ReadAll(chunkedReader)
+		assert.Equal(t, ErrIncompleteBody, err)
+	}
+}
 
+func TestChunkedUploadTrailer(t *testing.T) {
+	// STREAMING-UNSIGNED-PAYLOAD-TRAILER leaves out the chunk signatures:
+	payload := "400\r\n" + strings.Repeat("a", 1024) + "\r\n"
+	payload += "0\r\n"
+	payload += "x-amz-checksum-crc32:AAAAAA==\r\n"
+	payload += "\r\n"
+
+	chunkedReader := newChunkedReader(strings.NewReader(payload), 1024)
+	buf, err := ioutil.ReadAll(chunkedReader)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, strings.Repeat("a", 1024), string(buf))
+	assert.Equal(t, "AAAAAA==", chunkedReader.trailer.Get("x-amz-checksum-crc32"))
+
+	// STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER signs the trailer as well:
+	payload = "400;chunk-signature=0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497\r\n"
+	payload += strings.Repeat("a", 1024) + "\r\n"
+	payload += "0;chunk-signature=b6c6ea8a5354eaf15b3cb7646744f4275b71ea724fed81ceb9323e279d449df9\r\n"
+	payload += "x-amz-checksum-sha256:LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=\r\n"
+	payload += "x-amz-trailer-signature:63bddb248ad2590c92712055f51b8e78ab024eead08276b24f010b0efd74843f\r\n"
+	payload += "\r\n"
+
+	chunkedReader = newChunkedReader(strings.NewReader(payload), 1024)
+	buf, err = ioutil.ReadAll(chunkedReader)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, strings.Repeat("a", 1024), string(buf))
+	assert.Equal(t, "LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=", chunkedReader.trailer.Get("x-amz-checksum-sha256"))
+
+	// A trailer that is cut off is an incomplete body:
+	payload = "400\r\n" + strings.Repeat("a", 1024) + "\r\n0\r\nx-amz-checksum-crc32:AAAA"
+	chunkedReader = newChunkedReader(strings.NewReader(payload), 1024)
+	_, err = ioutil.ReadAll(chunkedReader)
+	assert.Equal(t, ErrIncompleteBody, err)
 }
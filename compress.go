@@ -0,0 +1,60 @@
+package gofakes3
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+
+	xml "github.com/oneclickvirt/gofakes3/xml"
+)
+
+// xmlListingEncode encodes a listing response. If WithCompressListings is
+// enabled and the client accepts it, the response is gzip-compressed as it is
+// encoded, so large listings are never buffered in full.
+func (g *GoFakeS3) xmlListingEncode(w http.ResponseWriter, r *http.Request, v interface{}) (err error) {
+	if !g.compressListings || !acceptsGzip(r) {
+		return g.xmlEncoder(w).Encode(v)
+	}
+
+	hdr := w.Header()
+	hdr.Set("Content-Type", "application/xml")
+	hdr.Set("Content-Encoding", "gzip")
+	hdr.Add("Vary", "Accept-Encoding")
+
+	gz := gzip.NewWriter(w)
+	defer CheckClose(gz, &err)
+
+	if _, err := gz.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	xe := xml.NewEncoder(gz)
+	xe.Indent("", "  ")
+	return xe.Encode(v)
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding header permits a
+// gzip-encoded response.
+func acceptsGzip(r *http.Request) bool {
+	for _, item := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(item, ";")
+		coding := strings.TrimSpace(parts[0])
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		// A quality value of 0 means "not acceptable":
+		rejected := false
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				rejected = err == nil && q == 0
+			}
+		}
+		if !rejected {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package gofakes3
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// checkConditionalHeaders evaluates the conditional request headers for a GET
+// or HEAD request against the ETag and modification time of the object.
+//
+// S3 evaluates the headers in the following order, which matches RFC 7232,
+// section 6:
+//
+//	If-Match, If-Unmodified-Since, If-None-Match, If-Modified-Since
+//
+// If-Unmodified-Since is ignored if If-Match is present, and
+// If-Modified-Since is ignored if If-None-Match is present. From the docs:
+//
+//	If both of the If-Match and If-Unmodified-Since headers are present in
+//	the request as follows: If-Match condition evaluates to true, and;
+//	If-Unmodified-Since condition evaluates to false; then, S3 returns 200 OK
+//	and the data requested.
+//
+//	If both of the If-None-Match and If-Modified-Since headers are present in
+//	the request as follows: If-None-Match condition evaluates to false, and;
+//	If-Modified-Since condition evaluates to true; then, S3 returns 304 Not
+//	Modified response code.
+//
+// If lastModified is the zero time, the date-based conditions are skipped.
+func checkConditionalHeaders(hdr http.Header, etag string, lastModified time.Time) error {
+	if ifMatch := hdr.Get("If-Match"); ifMatch != "" {
+		if !etagListMatches(ifMatch, etag) {
+			return ErrPreconditionFailed
+		}
+
+	} else if since, ok := parseConditionalTime(hdr.Get("If-Unmodified-Since")); ok && !lastModified.IsZero() {
+		if lastModified.Truncate(time.Second).After(since) {
+			return ErrPreconditionFailed
+		}
+	}
+
+	if ifNoneMatch := hdr.Get("If-None-Match"); ifNoneMatch != "" {
+		if etagListMatches(ifNoneMatch, etag) {
+			return ErrNotModified
+		}
+
+	} else if since, ok := parseConditionalTime(hdr.Get("If-Modified-Since")); ok && !lastModified.IsZero() {
+		if !lastModified.Truncate(time.Second).After(since) {
+			return ErrNotModified
+		}
+	}
+
+	return nil
+}
+
+// checkCopySourceConditions evaluates the 'x-amz-copy-source-if-*' headers
+// of a CopyObject or UploadPartCopy request against the source object. They
+// follow the same precedence rules as the conditional headers of a GET, as
+// described for checkConditionalHeaders, but every failure is reported as
+// ErrPreconditionFailed; there is no '304 Not Modified' for a copy.
+func checkCopySourceConditions(hdr http.Header, obj *Object) error {
+	conditions := http.Header{}
+	for _, name := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		if v := hdr.Get("x-amz-copy-source-" + name); v != "" {
+			conditions.Set(name, v)
+		}
+	}
+	if len(conditions) == 0 {
+		return nil
+	}
+
+	err := checkConditionalHeaders(conditions, hex.EncodeToString(obj.Hash), objectLastModified(obj))
+	if err == ErrNotModified {
+		return ErrPreconditionFailed
+	}
+	return err
+}
+
+// checkConditionalWrite evaluates the If-Match and If-None-Match headers of
+// a PutObject request against the object currently stored at the key:
+// If-None-Match: * fails if the object exists, and If-Match fails if the
+// object's ETag differs or the object does not exist.
+//
+// If a precondition fails, the ETag and version ID of the existing object are
+// sent with the '412 PreconditionFailed', so a client can reconcile without
+// another HEAD request.
+//
+// This is best-effort: the object is read before the new one is written, and
+// the two are not atomic, so two concurrent writers may both pass the check.
+// S3 reports such conflicts with a '409 ConditionalRequestConflict' instead.
+func (g *GoFakeS3) checkConditionalWrite(bucket, object string, w http.ResponseWriter, r *http.Request) (err error) {
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	if ifMatch == "" && ifNoneMatch == "" {
+		return nil
+	}
+
+	obj, err := g.storage.HeadObject(r.Context(), bucket, object)
+	if HasErrorCode(err, ErrNoSuchKey) {
+		obj, err = nil, nil
+	} else if err != nil {
+		return err
+	} else {
+		defer CheckClose(obj.Contents, &err)
+	}
+
+	if obj == nil || obj.IsDeleteMarker {
+		// If-None-Match: * is satisfied by a missing key, so the write goes
+		// ahead as usual:
+		if ifMatch != "" {
+			return KeyNotFound(object)
+		}
+		return nil
+	}
+
+	etag := hex.EncodeToString(obj.Hash)
+	if (ifNoneMatch != "" && etagListMatches(ifNoneMatch, etag)) ||
+		(ifMatch != "" && !etagListMatches(ifMatch, etag)) {
+		w.Header().Set("ETag", `"`+etag+`"`)
+		if obj.VersionID != "" {
+			w.Header().Set("x-amz-version-id", string(obj.VersionID))
+		}
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// ifRangeMatches reports whether the Range header of a GET request should be
+// honoured, given the value of the If-Range header. If it does not match, the
+// whole object is returned instead.
+//
+// If-Range holds either an ETag or an HTTP-date. An ETag must match exactly,
+// and as per RFC 7233, a weak ETag never matches. A date matches if the
+// object has not been modified since.
+func ifRangeMatches(ifRange string, etag string, lastModified time.Time) bool {
+	ifRange = strings.TrimSpace(ifRange)
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return !strings.HasPrefix(ifRange, "W/") && strings.Trim(ifRange, `"`) == strings.Trim(etag, `"`)
+	}
+	if at, err := http.ParseTime(ifRange); err == nil {
+		return !lastModified.IsZero() && !lastModified.Truncate(time.Second).After(at)
+	}
+	// Some clients send the ETag without quotes:
+	return ifRange == strings.Trim(etag, `"`)
+}
+
+// etagListMatches reports whether etag is present in the comma separated list
+// of entity tags found in an If-Match or If-None-Match header. The wildcard
+// '*' matches any ETag. Weak validators are compared as if they were strong.
+func etagListMatches(list string, etag string) bool {
+	etag = strings.Trim(etag, `"`)
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if strings.Trim(candidate, `"`) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseConditionalTime parses an HTTP date from a conditional header. As
+// per RFC 7232, an invalid date causes the header to be ignored.
+func parseConditionalTime(v string) (time.Time, bool) {
+	if v == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
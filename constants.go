@@ -39,6 +39,10 @@ const (
 	MaxBucketVersionKeys        = 1000
 	DefaultMaxBucketVersionKeys = 1000
 
+	// From the docs: "The request can contain a list of up to 1000 keys that
+	// you want to delete."
+	MaxDeleteMultiKeys = 1000
+
 	// From the docs: "Part numbers can be any number from 1 to 10,000, inclusive."
 	MaxUploadPartNumber = 10000
 )
@@ -2,7 +2,10 @@ package gofakes3
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
+
+	xml "github.com/oneclickvirt/gofakes3/xml"
 )
 
 var (
@@ -24,23 +27,322 @@ var (
 		"x-amz-meta-to",
 		"x-amz-security-token",
 	}
-	corsHeadersString = strings.Join(corsHeaders, ", ")
+
+	corsMethods = []string{"GET", "PUT", "HEAD", "POST", "DELETE"}
 )
 
+// MaxCORSRules is the maximum number of rules S3 permits in a bucket's CORS
+// configuration.
+const MaxCORSRules = 100
+
+// CORSConfiguration is used by the '?cors' subresource on buckets, both as
+// the response body for a GET and as the request body for a PUT:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/cors.html
+type CORSConfiguration struct {
+	XMLName xml.Name   `xml:"CORSConfiguration"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Rules   []CORSRule `xml:"CORSRule"`
+}
+
+// CORSRule describes the cross-origin requests that are permitted for a
+// bucket. AllowedOrigins and AllowedHeaders may contain at most one '*'
+// wildcard each.
+type CORSRule struct {
+	ID             string   `xml:"ID,omitempty"`
+	AllowedOrigins []string `xml:"AllowedOrigin"`
+	AllowedMethods []string `xml:"AllowedMethod"`
+	AllowedHeaders []string `xml:"AllowedHeader,omitempty"`
+	ExposeHeaders  []string `xml:"ExposeHeader,omitempty"`
+	MaxAgeSeconds  int      `xml:"MaxAgeSeconds,omitempty"`
+}
+
+func (c *CORSConfiguration) validate() error {
+	if len(c.Rules) == 0 || len(c.Rules) > MaxCORSRules {
+		return ErrMalformedXML
+	}
+
+	for _, rule := range c.Rules {
+		if len(rule.AllowedOrigins) == 0 || len(rule.AllowedMethods) == 0 || rule.MaxAgeSeconds < 0 {
+			return ErrMalformedXML
+		}
+		for _, method := range rule.AllowedMethods {
+			if !containsString(method, corsMethods) {
+				return ErrorMessagef(ErrInvalidRequest, "Found unsupported HTTP method in CORS config. Unsupported method is %s", method)
+			}
+		}
+		for _, origin := range rule.AllowedOrigins {
+			if strings.Count(origin, "*") > 1 {
+				return ErrorMessagef(ErrInvalidRequest, `AllowedOrigin "%s" can not have more than one wildcard.`, origin)
+			}
+		}
+		for _, header := range rule.AllowedHeaders {
+			if strings.Count(header, "*") > 1 {
+				return ErrorMessagef(ErrInvalidRequest, `AllowedHeader "%s" can not have more than one wildcard.`, header)
+			}
+		}
+	}
+	return nil
+}
+
+// Match returns the first rule that permits a request from origin using
+// method and sending headers, or nil if no rule matches. For a preflight
+// request, method and headers come from the 'Access-Control-Request-*'
+// headers.
+func (c *CORSConfiguration) Match(origin, method string, headers []string) *CORSRule {
+	if c == nil || origin == "" || method == "" {
+		return nil
+	}
+
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if rule.allowsOrigin(origin) != "" && containsString(method, rule.AllowedMethods) && rule.allowsHeaders(headers) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// allowsOrigin returns the AllowedOrigin that matched origin, or an empty
+// string if none did.
+func (rule *CORSRule) allowsOrigin(origin string) string {
+	for _, allowed := range rule.AllowedOrigins {
+		if wildcardMatch(allowed, origin) {
+			return allowed
+		}
+	}
+	return ""
+}
+
+func (rule *CORSRule) allowsHeaders(headers []string) bool {
+next:
+	for _, header := range headers {
+		for _, allowed := range rule.AllowedHeaders {
+			if wildcardMatch(strings.ToLower(allowed), strings.ToLower(header)) {
+				continue next
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// setHeaders adds the 'Access-Control-*' response headers for a request that
+// matched the rule. requestHeaders are only sent in response to a preflight
+// request.
+func (rule *CORSRule) setHeaders(hdr http.Header, origin string, preflight bool, requestHeaders []string) {
+	if rule.allowsOrigin(origin) == "*" {
+		hdr.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		hdr.Set("Access-Control-Allow-Origin", origin)
+		hdr.Set("Access-Control-Allow-Credentials", "true")
+	}
+	hdr.Add("Vary", "Origin")
+	hdr.Set("Access-Control-Allow-Methods", strings.Join(rule.AllowedMethods, ", "))
+	if len(rule.ExposeHeaders) > 0 {
+		hdr.Set("Access-Control-Expose-Headers", strings.Join(rule.ExposeHeaders, ", "))
+	}
+
+	if preflight {
+		if len(requestHeaders) > 0 {
+			hdr.Set("Access-Control-Allow-Headers", strings.Join(requestHeaders, ", "))
+		}
+		if rule.MaxAgeSeconds > 0 {
+			hdr.Set("Access-Control-Max-Age", strconv.Itoa(rule.MaxAgeSeconds))
+		}
+	}
+}
+
+// wildcardMatch reports whether s matches pattern, which may contain a single
+// '*' that matches any sequence of characters.
+func wildcardMatch(pattern, s string) bool {
+	idx := strings.IndexByte(pattern, '*')
+	if idx < 0 {
+		return pattern == s
+	}
+	prefix, suffix := pattern[:idx], pattern[idx+1:]
+	return len(s) >= len(prefix)+len(suffix) && strings.HasPrefix(s, prefix) && strings.HasSuffix(s, suffix)
+}
+
+func splitHeaderList(value string) []string {
+	var out []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// CORSPolicy controls the CORS headers GoFakeS3 sends in response to requests
+// for buckets that do not have their own CORS configuration (see CORSBackend),
+// and to requests that are not addressed to a bucket. See WithCORSPolicy.
+//
+// The zero value does not permit any cross-origin requests.
+type CORSPolicy struct {
+	// AllowedOrigins may contain a single '*' wildcard in each entry; an
+	// entry of "*" permits any origin.
+	AllowedOrigins []string
+
+	AllowedMethods []string
+
+	// AllowedHeaders is sent in the 'Access-Control-Allow-Headers' header.
+	// If it contains "*", the headers requested by a preflight request are
+	// sent back instead.
+	AllowedHeaders []string
+
+	ExposeHeaders []string
+
+	// AllowCredentials sends 'Access-Control-Allow-Credentials: true'. As
+	// browsers reject credentials with a wildcard origin, the request's
+	// origin is always sent back when this is set.
+	AllowCredentials bool
+
+	// MaxAgeSeconds is sent in response to preflight requests if it is
+	// greater than zero.
+	MaxAgeSeconds int
+}
+
+// DefaultCORSPolicy returns the CORSPolicy GoFakeS3 uses unless WithCORSPolicy
+// is passed to New. It permits cross-origin requests from anywhere.
+func DefaultCORSPolicy() CORSPolicy {
+	return CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"POST", "GET", "OPTIONS", "PUT", "DELETE", "HEAD"},
+		AllowedHeaders: append([]string(nil), corsHeaders...),
+		ExposeHeaders:  []string{"ETag"},
+	}
+}
+
+// allowedOrigin returns the value to send in the 'Access-Control-Allow-Origin'
+// header in response to a request from origin, or an empty string if the
+// origin is not permitted. Requests without an origin are only given headers
+// if any origin is permitted.
+func (p *CORSPolicy) allowedOrigin(origin string) string {
+	for _, allowed := range p.AllowedOrigins {
+		switch {
+		case allowed == "*" && (origin == "" || !p.AllowCredentials):
+			return "*"
+		case origin != "" && wildcardMatch(allowed, origin):
+			return origin
+		}
+	}
+	return ""
+}
+
+func (p *CORSPolicy) setHeaders(hdr http.Header, allowedOrigin string, requestHeaders string) {
+	hdr.Set("Access-Control-Allow-Origin", allowedOrigin)
+	if allowedOrigin != "*" {
+		hdr.Add("Vary", "Origin")
+	}
+	if p.AllowCredentials {
+		hdr.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(p.AllowedMethods) > 0 {
+		hdr.Set("Access-Control-Allow-Methods", strings.Join(p.AllowedMethods, ", "))
+	}
+	if containsString("*", p.AllowedHeaders) {
+		if requestHeaders != "" {
+			hdr.Set("Access-Control-Allow-Headers", requestHeaders)
+		}
+	} else if len(p.AllowedHeaders) > 0 {
+		hdr.Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+	}
+	if len(p.ExposeHeaders) > 0 {
+		hdr.Set("Access-Control-Expose-Headers", strings.Join(p.ExposeHeaders, ", "))
+	}
+	if p.MaxAgeSeconds > 0 {
+		hdr.Set("Access-Control-Max-Age", strconv.Itoa(p.MaxAgeSeconds))
+	}
+}
+
 type withCORS struct {
-	r   http.Handler
-	log Logger
+	r http.Handler
+	g *GoFakeS3
 }
 
 func (s *withCORS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, HEAD")
-	w.Header().Set("Access-Control-Allow-Headers", corsHeadersString)
-	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+	config, err := s.bucketCORS(r)
+	if err != nil {
+		s.g.httpError(w, r, err)
+		return
+	}
 
+	if config == nil {
+		s.applyPolicy(w, r)
+		return
+	}
+
+	origin := r.Header.Get("Origin")
 	if r.Method == "OPTIONS" {
+		method := r.Header.Get("Access-Control-Request-Method")
+		headers := splitHeaderList(r.Header.Get("Access-Control-Request-Headers"))
+		rule := config.Match(origin, method, headers)
+		if rule == nil {
+			s.g.httpError(w, r, ErrAccessForbidden)
+			return
+		}
+		rule.setHeaders(w.Header(), origin, true, headers)
 		return
 	}
 
+	if rule := config.Match(origin, r.Method, nil); rule != nil {
+		rule.setHeaders(w.Header(), origin, false, nil)
+	}
 	s.r.ServeHTTP(w, r)
 }
+
+// applyPolicy handles requests to buckets without a CORS configuration using
+// the CORSPolicy supplied to WithCORSPolicy. Preflight requests are answered
+// here and never reach the router.
+func (s *withCORS) applyPolicy(w http.ResponseWriter, r *http.Request) {
+	policy := &s.g.corsPolicy
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == "OPTIONS"
+
+	allowedOrigin := policy.allowedOrigin(origin)
+	if preflight {
+		method := r.Header.Get("Access-Control-Request-Method")
+		if allowedOrigin == "" || (method != "" && !containsString(method, policy.AllowedMethods)) {
+			s.g.httpError(w, r, ErrAccessForbidden)
+			return
+		}
+	}
+
+	if allowedOrigin != "" {
+		policy.setHeaders(w.Header(), allowedOrigin, r.Header.Get("Access-Control-Request-Headers"))
+	}
+
+	if preflight {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	s.r.ServeHTTP(w, r)
+}
+
+// bucketCORS returns the CORS configuration of the bucket the request is
+// addressed to, or nil if there isn't one.
+func (s *withCORS) bucketCORS(r *http.Request) (*CORSConfiguration, error) {
+	if s.g.cors == nil {
+		return nil, nil
+	}
+	bucket := strings.SplitN(strings.Trim(r.URL.Path, "/"), "/", 2)[0]
+	if bucket == "" {
+		return nil, nil
+	}
+
+	config, err := s.g.cors.GetBucketCORS(r.Context(), bucket)
+	if HasErrorCode(err, ErrNoSuchCORSConfiguration) || HasErrorCode(err, ErrNoSuchBucket) {
+		return nil, nil
+	}
+	return config, err
+}
+
+func containsString(s string, in []string) bool {
+	for _, v := range in {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+package gofakes3_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestBucketCORS(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.GetBucketCors(&s3.GetBucketCorsInput{Bucket: aws.String(defaultBucket)})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchCORSConfiguration) {
+		t.Fatal("expected NoSuchCORSConfiguration, found", err)
+	}
+
+	ts.OKAll(svc.PutBucketCors(&s3.PutBucketCorsInput{
+		Bucket: aws.String(defaultBucket),
+		CORSConfiguration: &s3.CORSConfiguration{
+			CORSRules: []*s3.CORSRule{{
+				AllowedOrigins: aws.StringSlice([]string{"https://example.com"}),
+				AllowedMethods: aws.StringSlice([]string{"GET", "PUT"}),
+				AllowedHeaders: aws.StringSlice([]string{"x-amz-*"}),
+				ExposeHeaders:  aws.StringSlice([]string{"ETag"}),
+				MaxAgeSeconds:  aws.Int64(300),
+			}},
+		},
+	}))
+
+	rs, err := svc.GetBucketCors(&s3.GetBucketCorsInput{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+	if len(rs.CORSRules) != 1 {
+		t.Fatal("unexpected rules", rs.CORSRules)
+	}
+	rule := rs.CORSRules[0]
+	if origins := aws.StringValueSlice(rule.AllowedOrigins); len(origins) != 1 || origins[0] != "https://example.com" {
+		t.Fatal("unexpected origins", origins)
+	}
+	if aws.Int64Value(rule.MaxAgeSeconds) != 300 {
+		t.Fatal("unexpected max age", aws.Int64Value(rule.MaxAgeSeconds))
+	}
+
+	ts.OKAll(svc.DeleteBucketCors(&s3.DeleteBucketCorsInput{Bucket: aws.String(defaultBucket)}))
+
+	_, err = svc.GetBucketCors(&s3.GetBucketCorsInput{Bucket: aws.String(defaultBucket)})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchCORSConfiguration) {
+		t.Fatal("expected NoSuchCORSConfiguration, found", err)
+	}
+}
+
+func TestBucketCORSInvalid(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	for _, rule := range []*s3.CORSRule{
+		{AllowedOrigins: aws.StringSlice([]string{"*"}), AllowedMethods: aws.StringSlice([]string{"PATCH"})},
+		{AllowedOrigins: aws.StringSlice([]string{"https://*.*.com"}), AllowedMethods: aws.StringSlice([]string{"GET"})},
+	} {
+		_, err := svc.PutBucketCors(&s3.PutBucketCorsInput{
+			Bucket:            aws.String(defaultBucket),
+			CORSConfiguration: &s3.CORSConfiguration{CORSRules: []*s3.CORSRule{rule}},
+		})
+		if !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+			t.Fatal("expected InvalidRequest for", rule, "found", err)
+		}
+	}
+}
+
+func TestBucketCORSRequests(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+	do := func(method, origin string, hdr map[string]string) *http.Response {
+		t.Helper()
+		rq, err := http.NewRequest(method, ts.url("/"+defaultBucket+"/foo"), nil)
+		ts.OK(err)
+		if origin != "" {
+			rq.Header.Set("Origin", origin)
+		}
+		for k, v := range hdr {
+			rq.Header.Set(k, v)
+		}
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		rs.Body.Close()
+		return rs
+	}
+
+	// Without a CORS configuration, everything is permitted:
+	rs := do("OPTIONS", "https://anywhere.example", map[string]string{"Access-Control-Request-Method": "DELETE"})
+	if rs.StatusCode != 204 || rs.Header.Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatal("unexpected permissive response", rs.StatusCode, rs.Header)
+	}
+
+	ts.OKAll(svc.PutBucketCors(&s3.PutBucketCorsInput{
+		Bucket: aws.String(defaultBucket),
+		CORSConfiguration: &s3.CORSConfiguration{
+			CORSRules: []*s3.CORSRule{
+				{
+					AllowedOrigins: aws.StringSlice([]string{"https://*.example.com"}),
+					AllowedMethods: aws.StringSlice([]string{"GET", "PUT"}),
+					AllowedHeaders: aws.StringSlice([]string{"x-amz-*", "Content-Type"}),
+					ExposeHeaders:  aws.StringSlice([]string{"ETag"}),
+					MaxAgeSeconds:  aws.Int64(300),
+				},
+				{
+					AllowedOrigins: aws.StringSlice([]string{"*"}),
+					AllowedMethods: aws.StringSlice([]string{"HEAD"}),
+				},
+			},
+		},
+	}))
+
+	t.Run("preflight", func(t *testing.T) {
+		rs := do("OPTIONS", "https://app.example.com", map[string]string{
+			"Access-Control-Request-Method":  "PUT",
+			"Access-Control-Request-Headers": "content-type, x-amz-meta-foo",
+		})
+		if rs.StatusCode != 200 {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+		for k, v := range map[string]string{
+			"Access-Control-Allow-Origin":      "https://app.example.com",
+			"Access-Control-Allow-Credentials": "true",
+			"Access-Control-Allow-Methods":     "GET, PUT",
+			"Access-Control-Allow-Headers":     "content-type, x-amz-meta-foo",
+			"Access-Control-Expose-Headers":    "ETag",
+			"Access-Control-Max-Age":           "300",
+		} {
+			if found := rs.Header.Get(k); found != v {
+				t.Fatal("expected", k, v, "found", found)
+			}
+		}
+	})
+
+	t.Run("preflight-wildcard", func(t *testing.T) {
+		rs := do("OPTIONS", "https://other.example", map[string]string{"Access-Control-Request-Method": "HEAD"})
+		if rs.StatusCode != 200 || rs.Header.Get("Access-Control-Allow-Origin") != "*" {
+			t.Fatal("unexpected response", rs.StatusCode, rs.Header)
+		}
+		if rs.Header.Get("Access-Control-Allow-Credentials") != "" {
+			t.Fatal("unexpected credentials header")
+		}
+	})
+
+	t.Run("preflight-forbidden", func(t *testing.T) {
+		for _, tc := range []struct {
+			origin string
+			hdr    map[string]string
+		}{
+			{"https://evil.example", map[string]string{"Access-Control-Request-Method": "PUT"}},
+			{"https://app.example.com", map[string]string{"Access-Control-Request-Method": "DELETE"}},
+			{"https://app.example.com", map[string]string{"Access-Control-Request-Method": "PUT", "Access-Control-Request-Headers": "authorization"}},
+			{"", map[string]string{"Access-Control-Request-Method": "HEAD"}},
+		} {
+			rs := do("OPTIONS", tc.origin, tc.hdr)
+			if rs.StatusCode != 403 {
+				t.Fatal("expected 403 for", tc.origin, tc.hdr, "found", rs.StatusCode)
+			}
+			if rs.Header.Get("Access-Control-Allow-Origin") != "" {
+				t.Fatal("unexpected Access-Control-Allow-Origin for", tc.origin)
+			}
+		}
+	})
+
+	t.Run("actual", func(t *testing.T) {
+		rs := do("GET", "https://app.example.com", nil)
+		if rs.StatusCode != 200 || rs.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+			t.Fatal("unexpected response", rs.StatusCode, rs.Header)
+		}
+
+		rs = do("GET", "https://evil.example", nil)
+		if rs.StatusCode != 200 || rs.Header.Get("Access-Control-Allow-Origin") != "" {
+			t.Fatal("unexpected response", rs.StatusCode, rs.Header)
+		}
+	})
+}
+
+func TestCORSPolicy(t *testing.T) {
+	do := func(ts *testServer, method, origin string, hdr map[string]string) *http.Response {
+		t.Helper()
+		rq, err := http.NewRequest(method, ts.url("/"+defaultBucket+"/foo"), nil)
+		ts.OK(err)
+		if origin != "" {
+			rq.Header.Set("Origin", origin)
+		}
+		for k, v := range hdr {
+			rq.Header.Set(k, v)
+		}
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		rs.Body.Close()
+		return rs
+	}
+
+	t.Run("default", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+		rs := do(ts, "GET", "", nil)
+		if rs.StatusCode != 200 || rs.Header.Get("Access-Control-Allow-Origin") != "*" ||
+			rs.Header.Get("Access-Control-Expose-Headers") != "ETag" {
+			t.Fatal("unexpected response", rs.StatusCode, rs.Header)
+		}
+	})
+
+	t.Run("restricted", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithCORSPolicy(gofakes3.CORSPolicy{
+			AllowedOrigins:   []string{"https://*.example.com"},
+			AllowedMethods:   []string{"GET", "PUT"},
+			AllowedHeaders:   []string{"*"},
+			AllowCredentials: true,
+			MaxAgeSeconds:    60,
+		})))
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+		rs := do(ts, "OPTIONS", "https://app.example.com", map[string]string{
+			"Access-Control-Request-Method":  "PUT",
+			"Access-Control-Request-Headers": "x-amz-meta-foo",
+		})
+		if rs.StatusCode != 204 {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+		for k, v := range map[string]string{
+			"Access-Control-Allow-Origin":      "https://app.example.com",
+			"Access-Control-Allow-Credentials": "true",
+			"Access-Control-Allow-Methods":     "GET, PUT",
+			"Access-Control-Allow-Headers":     "x-amz-meta-foo",
+			"Access-Control-Max-Age":           "60",
+		} {
+			if found := rs.Header.Get(k); found != v {
+				t.Fatal("expected", k, v, "found", found)
+			}
+		}
+
+		rs = do(ts, "OPTIONS", "https://evil.example", map[string]string{"Access-Control-Request-Method": "GET"})
+		if rs.StatusCode != 403 {
+			t.Fatal("expected 403, found", rs.StatusCode)
+		}
+		rs = do(ts, "OPTIONS", "https://app.example.com", map[string]string{"Access-Control-Request-Method": "DELETE"})
+		if rs.StatusCode != 403 {
+			t.Fatal("expected 403, found", rs.StatusCode)
+		}
+
+		rs = do(ts, "GET", "https://evil.example", nil)
+		if rs.StatusCode != 200 || rs.Header.Get("Access-Control-Allow-Origin") != "" {
+			t.Fatal("unexpected response", rs.StatusCode, rs.Header)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package gofakes3
+
+import (
+	"regexp"
+)
+
+// denyRule is added by WithDenyPattern.
+type denyRule struct {
+	pattern    *regexp.Regexp
+	operations map[Operation]bool
+}
+
+func (d denyRule) matches(path string, op Operation) bool {
+	if len(d.operations) > 0 && !d.operations[op] {
+		return false
+	}
+	return d.pattern.MatchString(path)
+}
+
+// checkDenyRules returns ErrAccessDenied if a rule added with WithDenyPattern
+// matches the request. The pattern is matched against 'bucket/key', or just
+// 'bucket' if the request does not address an object.
+func (g *GoFakeS3) checkDenyRules(bucket, object string, op Operation) error {
+	if len(g.denyRules) == 0 {
+		return nil
+	}
+
+	path := bucket
+	if object != "" {
+		path += "/" + object
+	}
+	for _, rule := range g.denyRules {
+		if rule.matches(path, op) {
+			g.log.Print(LogInfo, "denied by pattern", rule.pattern, op, path)
+			return ErrAccessDenied
+		}
+	}
+	return nil
+}
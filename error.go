@@ -15,11 +15,43 @@ import (
 const (
 	ErrNone ErrorCode = ""
 
+	ErrAccessDenied ErrorCode = "AccessDenied"
+
+	// A CORS preflight request did not match any rule in the bucket's CORS
+	// configuration.
+	ErrAccessForbidden ErrorCode = "AccessForbidden"
+
 	// The Content-MD5 you specified did not match what we received.
 	ErrBadDigest ErrorCode = "BadDigest"
 
 	ErrBucketAlreadyExists ErrorCode = "BucketAlreadyExists"
 
+	// Your proposed upload is smaller than the minimum allowed object size.
+	// See entityTooSmall().
+	ErrEntityTooSmall ErrorCode = "EntityTooSmall"
+
+	// Your proposed upload exceeds the maximum allowed object size.
+	ErrEntityTooLarge ErrorCode = "EntityTooLarge"
+
+	// The 'x-amz-write-offset-bytes' header of a PutObject does not match the
+	// current size of the object.
+	ErrInvalidWriteOffset ErrorCode = "InvalidWriteOffset"
+
+	// The ExpressionType of a SelectObjectContent request is not SQL.
+	ErrInvalidExpressionType ErrorCode = "InvalidExpressionType"
+
+	// The SQL expression of a SelectObjectContent request could not be parsed.
+	ErrParseSelectFailure ErrorCode = "ParseSelectFailure"
+
+	// The object queried by a SelectObjectContent request could not be read
+	// using the requested InputSerialization.
+	ErrCSVParsingError  ErrorCode = "CSVParsingError"
+	ErrJSONParsingError ErrorCode = "JSONParsingError"
+
+	// Storing the object would take the bucket over the quota configured
+	// with WithBucketQuota. This is not an error S3 returns.
+	ErrQuotaExceeded ErrorCode = "QuotaExceeded"
+
 	// Raised when attempting to delete a bucket that still contains items.
 	ErrBucketNotEmpty ErrorCode = "BucketNotEmpty"
 
@@ -49,6 +81,9 @@ const (
 	ErrInvalidDigest ErrorCode = "InvalidDigest"
 
 	ErrInvalidRange         ErrorCode = "InvalidRange"
+	ErrInvalidRequest       ErrorCode = "InvalidRequest"
+	ErrInvalidObjectState   ErrorCode = "InvalidObjectState"
+	ErrInvalidStorageClass  ErrorCode = "InvalidStorageClass"
 	ErrInvalidToken         ErrorCode = "InvalidToken"
 	ErrKeyTooLong           ErrorCode = "KeyTooLongError" // This is not a typo: Error is part of the string, but redundant in the constant name
 	ErrMalformedPOSTRequest ErrorCode = "MalformedPOSTRequest"
@@ -62,10 +97,14 @@ const (
 	// specified in order by part number.
 	ErrInvalidPartOrder ErrorCode = "InvalidPartOrder"
 
+	// The policy of a browser-based POST upload could not be parsed.
+	ErrInvalidPolicyDocument ErrorCode = "InvalidPolicyDocument"
+
 	ErrInvalidURI ErrorCode = "InvalidURI"
 
 	ErrMetadataTooLarge ErrorCode = "MetadataTooLarge"
 	ErrMethodNotAllowed ErrorCode = "MethodNotAllowed"
+	ErrMalformedPolicy  ErrorCode = "MalformedPolicy"
 	ErrMalformedXML     ErrorCode = "MalformedXML"
 
 	// You must provide the Content-Length HTTP header.
@@ -77,18 +116,60 @@ const (
 	// See KeyNotFound() for a helper function for this error:
 	ErrNoSuchKey ErrorCode = "NoSuchKey"
 
+	// The specified bucket does not have a bucket policy.
+	ErrNoSuchBucketPolicy ErrorCode = "NoSuchBucketPolicy"
+
+	// The specified bucket does not have a CORS configuration.
+	ErrNoSuchCORSConfiguration ErrorCode = "NoSuchCORSConfiguration"
+
+	// The specified bucket does not have a website configuration.
+	ErrNoSuchWebsiteConfiguration ErrorCode = "NoSuchWebsiteConfiguration"
+
+	// The bucket does not have a default encryption configuration.
+	ErrServerSideEncryptionConfigurationNotFound ErrorCode = "ServerSideEncryptionConfigurationNotFoundError"
+
+	// Object Lock has never been enabled for the specified bucket.
+	ErrObjectLockConfigurationNotFound ErrorCode = "ObjectLockConfigurationNotFoundError"
+
+	// The specified object does not have an Object Lock retention or legal
+	// hold.
+	ErrNoSuchObjectLockConfiguration ErrorCode = "NoSuchObjectLockConfiguration"
+
 	// The specified multipart upload does not exist. The upload ID might be
 	// invalid, or the multipart upload might have been aborted or completed.
 	ErrNoSuchUpload ErrorCode = "NoSuchUpload"
 
+	// A RestoreObject request was made while the object is still being
+	// restored.
+	ErrRestoreAlreadyInProgress ErrorCode = "RestoreAlreadyInProgress"
+
 	ErrNoSuchVersion ErrorCode = "NoSuchVersion"
 
 	// No need to retransmit the object
 	ErrNotModified ErrorCode = "NotModified"
 
+	// The bucket you are attempting to access must be addressed using the
+	// specified endpoint. See permanentRedirect().
+	ErrPermanentRedirect ErrorCode = "PermanentRedirect"
+
+	// At least one of the preconditions you specified did not hold.
+	ErrPreconditionFailed ErrorCode = "PreconditionFailed"
+
+	// The client stopped sending the request body for longer than the
+	// timeout configured with WithReadTimeout.
+	ErrRequestTimeout ErrorCode = "RequestTimeout"
+
 	ErrRequestTimeTooSkewed ErrorCode = "RequestTimeTooSkewed"
-	ErrTooManyBuckets       ErrorCode = "TooManyBuckets"
-	ErrNotImplemented       ErrorCode = "NotImplemented"
+
+	// Storing the data would take the backend over the memory limit
+	// configured with WithBackendMemoryLimit.
+	ErrServiceUnavailable ErrorCode = "ServiceUnavailable"
+
+	// The signature of a browser-based POST upload did not match the policy.
+	ErrSignatureDoesNotMatch ErrorCode = "SignatureDoesNotMatch"
+
+	ErrTooManyBuckets ErrorCode = "TooManyBuckets"
+	ErrNotImplemented ErrorCode = "NotImplemented"
 
 	ErrInternal ErrorCode = "InternalError"
 )
@@ -220,10 +301,60 @@ func (e ErrorCode) Message() string {
 		return `Bucket name must match the regex "^[a-zA-Z0-9.\-_]{1,255}$"`
 	case ErrNoSuchBucket:
 		return "The specified bucket does not exist"
+	case ErrRequestTimeout:
+		return "Your socket connection to the server was not read from or written to within the timeout period."
 	case ErrRequestTimeTooSkewed:
 		return "The difference between the request time and the current time is too large"
 	case ErrMalformedXML:
 		return "The XML you provided was not well-formed or did not validate against our published schema"
+	case ErrAccessDenied:
+		return "Access Denied"
+	case ErrNoSuchBucketPolicy:
+		return "The bucket policy does not exist"
+	case ErrNoSuchCORSConfiguration:
+		return "The CORS configuration does not exist"
+	case ErrNoSuchWebsiteConfiguration:
+		return "The specified bucket does not have a website configuration"
+	case ErrServerSideEncryptionConfigurationNotFound:
+		return "The server side encryption configuration was not found"
+	case ErrAccessForbidden:
+		return "CORSResponse: This CORS request is not allowed. This is usually because the evalution of Origin, request method / Access-Control-Request-Method or Access-Control-Request-Headers are not whitelisted by the resource's CORS spec."
+	case ErrObjectLockConfigurationNotFound:
+		return "Object Lock configuration does not exist for this bucket"
+	case ErrNoSuchObjectLockConfiguration:
+		return "The specified object does not have a ObjectLock configuration"
+	case ErrInvalidRange:
+		return "The requested range is not satisfiable"
+	case ErrInvalidObjectState:
+		return "The operation is not valid for the object's storage class"
+	case ErrRestoreAlreadyInProgress:
+		return "Object restore is already in progress"
+	case ErrInvalidStorageClass:
+		return "The storage class you specified is not valid"
+	case ErrEntityTooSmall:
+		return "Your proposed upload is smaller than the minimum allowed size"
+	case ErrEntityTooLarge:
+		return "Your proposed upload exceeds the maximum allowed object size."
+	case ErrInvalidWriteOffset:
+		return "The write offset value that you specified does not match the current object size."
+	case ErrInvalidExpressionType:
+		return "The ExpressionType is invalid. Only SQL expressions are supported."
+	case ErrParseSelectFailure:
+		return "The SQL expression could not be parsed."
+	case ErrQuotaExceeded:
+		return "Your upload exceeds the storage quota for the bucket."
+	case ErrServiceUnavailable:
+		return "Please reduce your request rate."
+	case ErrCSVParsingError:
+		return "Encountered an error parsing the CSV file."
+	case ErrJSONParsingError:
+		return "Encountered an error parsing the JSON file."
+	case ErrInvalidPolicyDocument:
+		return "The content of the form does not meet the conditions specified in the policy document."
+	case ErrSignatureDoesNotMatch:
+		return "The request signature we calculated does not match the signature you provided. Check your key and signing method."
+	case ErrPermanentRedirect:
+		return "The bucket you are attempting to access must be addressed using the specified endpoint. Please send all future requests to this endpoint."
 	default:
 		return ""
 	}
@@ -232,10 +363,19 @@ func (e ErrorCode) Message() string {
 func (e ErrorCode) Status() int {
 	switch e {
 	case ErrBucketAlreadyExists,
-		ErrBucketNotEmpty:
+		ErrBucketNotEmpty,
+		ErrRestoreAlreadyInProgress:
 		return http.StatusConflict
 
 	case ErrBadDigest,
+		ErrEntityTooSmall,
+		ErrEntityTooLarge,
+		ErrInvalidWriteOffset,
+		ErrInvalidExpressionType,
+		ErrQuotaExceeded,
+		ErrParseSelectFailure,
+		ErrCSVParsingError,
+		ErrJSONParsingError,
 		ErrIllegalVersioningConfiguration,
 		ErrIncompleteBody,
 		ErrIncorrectNumberOfFilesInPostRequest,
@@ -245,34 +385,58 @@ func (e ErrorCode) Status() int {
 		ErrInvalidDigest,
 		ErrInvalidPart,
 		ErrInvalidPartOrder,
+		ErrInvalidPolicyDocument,
+		ErrInvalidRequest,
+		ErrInvalidStorageClass,
 		ErrInvalidToken,
 		ErrInvalidURI,
 		ErrKeyTooLong,
 		ErrMetadataTooLarge,
 		ErrMethodNotAllowed,
 		ErrMalformedPOSTRequest,
+		ErrMalformedPolicy,
 		ErrMalformedXML,
+		ErrRequestTimeout,
 		ErrTooManyBuckets:
 		return http.StatusBadRequest
 
-	case ErrRequestTimeTooSkewed:
+	case ErrAccessDenied,
+		ErrAccessForbidden,
+		ErrInvalidObjectState,
+		ErrRequestTimeTooSkewed,
+		ErrSignatureDoesNotMatch:
 		return http.StatusForbidden
 
 	case ErrInvalidRange:
 		return http.StatusRequestedRangeNotSatisfiable
 
 	case ErrNoSuchBucket,
+		ErrNoSuchBucketPolicy,
+		ErrNoSuchCORSConfiguration,
 		ErrNoSuchKey,
+		ErrNoSuchObjectLockConfiguration,
 		ErrNoSuchUpload,
-		ErrNoSuchVersion:
+		ErrObjectLockConfigurationNotFound,
+		ErrNoSuchVersion,
+		ErrNoSuchWebsiteConfiguration,
+		ErrServerSideEncryptionConfigurationNotFound:
 		return http.StatusNotFound
 
 	case ErrNotImplemented:
 		return http.StatusNotImplemented
 
+	case ErrServiceUnavailable:
+		return http.StatusServiceUnavailable
+
 	case ErrNotModified:
 		return http.StatusNotModified
 
+	case ErrPermanentRedirect:
+		return http.StatusMovedPermanently
+
+	case ErrPreconditionFailed:
+		return http.StatusPreconditionFailed
+
 	case ErrMissingContentLength:
 		return http.StatusLengthRequired
 
@@ -340,6 +504,91 @@ func requestTimeTooSkewed(at time.Time, max time.Duration) error {
 	}
 }
 
+type permanentRedirectResponse struct {
+	ErrorResponse
+	Bucket   string
+	Endpoint string
+}
+
+var _ errorResponse = &permanentRedirectResponse{}
+
+func permanentRedirect(bucket, endpoint string) error {
+	code := ErrPermanentRedirect
+	return &permanentRedirectResponse{
+		ErrorResponse{Code: code, Message: code.Message()},
+		bucket, endpoint,
+	}
+}
+
+type invalidRangeResponse struct {
+	ErrorResponse
+	RangeRequested   string `xml:",omitempty"`
+	ActualObjectSize int64
+}
+
+var _ errorResponse = &invalidRangeResponse{}
+
+// InvalidRange creates an ErrInvalidRange error for a range that can not be
+// satisfied by an object of the given size. GoFakeS3 fills in the range that
+// was requested when it sends the error to the client.
+func InvalidRange(size int64) error {
+	code := ErrInvalidRange
+	return &invalidRangeResponse{
+		ErrorResponse:    ErrorResponse{Code: code, Message: code.Message()},
+		ActualObjectSize: size,
+	}
+}
+
+type invalidPartResponse struct {
+	ErrorResponse
+	UploadID   UploadID `xml:"UploadId"`
+	PartNumber int
+	ETag       string
+}
+
+var _ errorResponse = &invalidPartResponse{}
+
+func invalidPart(uploadID UploadID, partNumber int, etag, message string) error {
+	return &invalidPartResponse{
+		ErrorResponse{Code: ErrInvalidPart, Message: message},
+		uploadID, partNumber, etag,
+	}
+}
+
+type entityTooSmallResponse struct {
+	ErrorResponse
+	ProposedSize   int64
+	MinSizeAllowed int64
+	PartNumber     int
+	ETag           string
+}
+
+var _ errorResponse = &entityTooSmallResponse{}
+
+func entityTooSmall(partNumber int, etag string, size, min int64) error {
+	code := ErrEntityTooSmall
+	return &entityTooSmallResponse{
+		ErrorResponse{Code: code, Message: code.Message()},
+		size, min, partNumber, etag,
+	}
+}
+
+type entityTooLargeResponse struct {
+	ErrorResponse
+	ProposedSize   int64
+	MaxSizeAllowed int64
+}
+
+var _ errorResponse = &entityTooLargeResponse{}
+
+func entityTooLarge(size, max int64) error {
+	code := ErrEntityTooLarge
+	return &entityTooLargeResponse{
+		ErrorResponse{Code: code, Message: code.Message()},
+		size, max,
+	}
+}
+
 // durationAsMilliseconds tricks xml.Marshal into serialising a time.Duration as
 // truncated milliseconds instead of nanoseconds.
 type durationAsMilliseconds time.Duration
@@ -0,0 +1,265 @@
+package gofakes3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event names, as they appear in the eventName field of an EventRecord:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/notification-how-to-event-types-and-destinations.html
+const (
+	EventObjectCreatedPut                     = "ObjectCreated:Put"
+	EventObjectCreatedPost                    = "ObjectCreated:Post"
+	EventObjectCreatedCopy                    = "ObjectCreated:Copy"
+	EventObjectCreatedCompleteMultipartUpload = "ObjectCreated:CompleteMultipartUpload"
+	EventObjectRemovedDelete                  = "ObjectRemoved:Delete"
+	EventObjectRemovedDeleteMarkerCreated     = "ObjectRemoved:DeleteMarkerCreated"
+)
+
+// DefaultEventBufferSize is the number of events that may be waiting for
+// delivery to an EventSink before new events are dropped.
+const DefaultEventBufferSize = 1000
+
+// DefaultEventDeliveryTimeout is how long an EventSink may take to deliver an
+// event before the delivery is cancelled. See WithEventDeliveryTimeout.
+const DefaultEventDeliveryTimeout = 10 * time.Second
+
+// Event is the JSON envelope S3 uses to deliver event notifications:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/notification-content-structure.html
+type Event struct {
+	Records []EventRecord `json:"Records"`
+}
+
+type EventRecord struct {
+	EventVersion      string            `json:"eventVersion"`
+	EventSource       string            `json:"eventSource"`
+	AWSRegion         string            `json:"awsRegion"`
+	EventTime         string            `json:"eventTime"`
+	EventName         string            `json:"eventName"`
+	UserIdentity      EventIdentity     `json:"userIdentity"`
+	RequestParameters map[string]string `json:"requestParameters"`
+	ResponseElements  map[string]string `json:"responseElements"`
+	S3                EventS3           `json:"s3"`
+}
+
+type EventIdentity struct {
+	PrincipalID string `json:"principalId"`
+}
+
+type EventS3 struct {
+	SchemaVersion   string      `json:"s3SchemaVersion"`
+	ConfigurationID string      `json:"configurationId"`
+	Bucket          EventBucket `json:"bucket"`
+	Object          EventObject `json:"object"`
+}
+
+type EventBucket struct {
+	Name          string        `json:"name"`
+	OwnerIdentity EventIdentity `json:"ownerIdentity"`
+	ARN           string        `json:"arn"`
+}
+
+type EventObject struct {
+	Key       string `json:"key"`
+	Size      int64  `json:"size,omitempty"`
+	ETag      string `json:"eTag,omitempty"`
+	VersionID string `json:"versionId,omitempty"`
+	Sequencer string `json:"sequencer"`
+}
+
+// EventSink receives an Event whenever an object is created or removed. See
+// WithEventSink.
+//
+// Events are delivered one at a time from a single goroutine, so Deliver
+// does not need to be safe for concurrent use. A slow EventSink does not
+// slow down requests, but events are dropped if too many are waiting.
+//
+// Deliver must return once ctx is done, which happens when the delivery
+// timeout expires or when GoFakeS3.Close gives up waiting for it.
+type EventSink interface {
+	Deliver(ctx context.Context, event *Event) error
+}
+
+// HTTPEventSink is an EventSink that POSTs each Event as JSON to URL. A
+// response with a status other than 2xx is reported as an error.
+type HTTPEventSink struct {
+	URL string
+
+	// Client is used to send the events. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+var _ EventSink = &HTTPEventSink{}
+
+func (s *HTTPEventSink) Deliver(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	rq, err := http.NewRequestWithContext(ctx, "POST", s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	rq.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	rs, err := client.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode < 200 || rs.StatusCode > 299 {
+		return fmt.Errorf("gofakes3: event sink %s responded with status %d", s.URL, rs.StatusCode)
+	}
+	return nil
+}
+
+// eventDispatcher queues events for delivery to an EventSink, so a slow
+// EventSink can not hold up requests.
+type eventDispatcher struct {
+	sequencer uint64 // accessed atomically; keep first for alignment
+
+	sink    EventSink
+	queue   chan *Event
+	timeout time.Duration
+	log     Logger
+	done    chan struct{}
+
+	// ctx is cancelled when close gives up waiting for the queued events.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newEventDispatcher(sink EventSink, size int, timeout time.Duration, log Logger) *eventDispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &eventDispatcher{
+		sink:    sink,
+		queue:   make(chan *Event, size),
+		timeout: timeout,
+		log:     log,
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	go d.run()
+	return d
+}
+
+func (d *eventDispatcher) run() {
+	defer close(d.done)
+	for event := range d.queue {
+		if d.ctx.Err() != nil {
+			d.log.Print(LogWarn, "server closed, dropping", event.Records[0].EventName, "event")
+			continue
+		}
+		if err := d.deliver(event); err != nil {
+			d.log.Print(LogErr, "event delivery failed:", err)
+		}
+	}
+}
+
+func (d *eventDispatcher) deliver(event *Event) error {
+	ctx, cancel := context.WithTimeout(d.ctx, d.timeout)
+	defer cancel()
+	return d.sink.Deliver(ctx, event)
+}
+
+func (d *eventDispatcher) send(event *Event) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		d.log.Print(LogWarn, "server closed, dropping", event.Records[0].EventName, "event")
+		return
+	}
+
+	select {
+	case d.queue <- event:
+	default:
+		d.log.Print(LogWarn, "event queue full, dropping", event.Records[0].EventName, "event")
+	}
+}
+
+// close stops the dispatcher from accepting events, then waits for the
+// events already queued to be delivered. If they are not delivered within
+// the delivery timeout, the delivery in progress is cancelled and the events
+// still queued are dropped.
+func (d *eventDispatcher) close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+
+	timer := time.NewTimer(d.timeout)
+	defer timer.Stop()
+	select {
+	case <-d.done:
+	case <-timer.C:
+		d.log.Print(LogWarn, "events not delivered in time, cancelling delivery")
+	}
+	d.cancel()
+}
+
+// emitEvent sends an event to the EventSink, if there is one. The request ID
+// is taken from the response headers.
+func (g *GoFakeS3) emitEvent(w http.ResponseWriter, r *http.Request, name, bucket string, obj EventObject) {
+	if g.events == nil {
+		return
+	}
+
+	region := g.region
+	if region == "" {
+		region = "us-east-1"
+	}
+	sourceIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		sourceIP = host
+	}
+	owner := g.owner()
+
+	// S3 sends keys URL-encoded, and ETags without quotes:
+	obj.Key = url.QueryEscape(obj.Key)
+	obj.ETag = strings.Trim(obj.ETag, `"`)
+	obj.Sequencer = fmt.Sprintf("%016X", atomic.AddUint64(&g.events.sequencer, 1))
+
+	g.events.send(&Event{Records: []EventRecord{{
+		EventVersion:      "2.1",
+		EventSource:       "aws:s3",
+		AWSRegion:         region,
+		EventTime:         g.timeSource.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		EventName:         name,
+		UserIdentity:      EventIdentity{PrincipalID: owner.ID},
+		RequestParameters: map[string]string{"sourceIPAddress": sourceIP},
+		ResponseElements: map[string]string{
+			"x-amz-request-id": w.Header().Get("x-amz-request-id"),
+			"x-amz-id-2":       w.Header().Get("x-amz-id-2"),
+		},
+		S3: EventS3{
+			SchemaVersion: "1.0",
+			Bucket: EventBucket{
+				Name:          bucket,
+				OwnerIdentity: EventIdentity{PrincipalID: owner.ID},
+				ARN:           "arn:aws:s3:::" + bucket,
+			},
+			Object: obj,
+		},
+	}}})
+}
@@ -0,0 +1,252 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+type chanEventSink chan *gofakes3.Event
+
+func (c chanEventSink) Deliver(ctx context.Context, event *gofakes3.Event) error {
+	c <- event
+	return nil
+}
+
+func (c chanEventSink) next(t *testing.T) gofakes3.EventRecord {
+	t.Helper()
+	select {
+	case event := <-c:
+		if len(event.Records) != 1 {
+			t.Fatal("unexpected records", event.Records)
+		}
+		return event.Records[0]
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	panic("unreachable")
+}
+
+func TestEventSink(t *testing.T) {
+	sink := make(chanEventSink, 10)
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithEventSink(sink)))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	assertEvent := func(name, key string, size int64) gofakes3.EventRecord {
+		t.Helper()
+		record := sink.next(t)
+		if record.EventName != name || record.S3.Object.Key != key || record.S3.Object.Size != size {
+			t.Fatal("unexpected event", record.EventName, record.S3.Object)
+		}
+		if record.EventSource != "aws:s3" || record.S3.Bucket.Name != defaultBucket {
+			t.Fatal("unexpected event", record)
+		}
+		return record
+	}
+
+	ts.OKAll(svc.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("a file"),
+		Body:   bytes.NewReader([]byte("hello")),
+	}))
+	record := assertEvent(gofakes3.EventObjectCreatedPut, "a+file", 5)
+	if record.S3.Object.ETag != "5d41402abc4b2a76b9719d911017c592" {
+		t.Fatal("unexpected etag", record.S3.Object.ETag)
+	}
+	if record.EventTime != defaultDate.UTC().Format("2006-01-02T15:04:05.000Z") {
+		t.Fatal("unexpected event time", record.EventTime)
+	}
+	if record.ResponseElements["x-amz-request-id"] == "" {
+		t.Fatal("missing request id")
+	}
+
+	ts.OKAll(svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("copy"),
+		CopySource: aws.String(defaultBucket + "/a file"),
+	}))
+	assertEvent(gofakes3.EventObjectCreatedCopy, "copy", 5)
+
+	svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("copy"),
+	})
+	assertEvent(gofakes3.EventObjectRemovedDelete, "copy", 0)
+
+	// Failed requests do not send events:
+	_, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("nope"),
+		Key:    aws.String("foo"),
+		Body:   bytes.NewReader([]byte("hello")),
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	select {
+	case event := <-sink:
+		t.Fatal("unexpected event", event.Records[0].EventName)
+	default:
+	}
+}
+
+func TestEventSinkMultipartUpload(t *testing.T) {
+	sink := make(chanEventSink, 10)
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithEventSink(sink), gofakes3.WithMinPartSize(0)))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	upload := ts.createMultipartUpload(defaultBucket, "multi", nil)
+	part := ts.uploadPart(defaultBucket, "multi", upload, 1, []byte("hello"))
+	ts.OKAll(svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(defaultBucket),
+		Key:      aws.String("multi"),
+		UploadId: aws.String(upload),
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: []*s3.CompletedPart{part},
+		},
+	}))
+
+	record := sink.next(t)
+	if record.EventName != gofakes3.EventObjectCreatedCompleteMultipartUpload || record.S3.Object.Size != 5 {
+		t.Fatal("unexpected event", record.EventName, record.S3.Object)
+	}
+}
+
+func TestHTTPEventSink(t *testing.T) {
+	received := make(chan *gofakes3.Event, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event gofakes3.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- &event
+	}))
+	defer hook.Close()
+
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithEventSink(&gofakes3.HTTPEventSink{URL: hook.URL})))
+	defer ts.Close()
+	ts.OKAll(ts.s3Client().PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+		Body:   bytes.NewReader([]byte("hello")),
+	}))
+
+	record := chanEventSink(received).next(t)
+	if record.EventName != gofakes3.EventObjectCreatedPut || record.S3.Object.Key != "foo" {
+		t.Fatal("unexpected event", record)
+	}
+}
+
+// slowEventSink records the events it is given, slowly.
+type slowEventSink struct {
+	mu     sync.Mutex
+	events []*gofakes3.Event
+}
+
+func (s *slowEventSink) Deliver(ctx context.Context, event *gofakes3.Event) error {
+	time.Sleep(10 * time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestEventSinkClose(t *testing.T) {
+	sink := &slowEventSink{}
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithEventSink(sink)))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	put := func(key string) {
+		ts.OKAll(svc.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader([]byte("hello")),
+		}))
+	}
+	delivered := func() int {
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		return len(sink.events)
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		put(key)
+	}
+
+	// The queued events are delivered before Close returns:
+	ts.OK(ts.GoFakeS3.Close())
+	if n := delivered(); n != 3 {
+		t.Fatal("expected 3 events to be delivered, found", n)
+	}
+
+	// Later events are dropped, and closing again does nothing:
+	put("d")
+	ts.OK(ts.GoFakeS3.Close())
+	if n := delivered(); n != 3 {
+		t.Fatal("unexpected event after Close", n)
+	}
+}
+
+// hungEventSink never delivers an event, but gives up when asked to.
+type hungEventSink struct {
+	attempts int32
+}
+
+func (s *hungEventSink) Deliver(ctx context.Context, event *gofakes3.Event) error {
+	atomic.AddInt32(&s.attempts, 1)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestEventSinkTimeout(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	sink := &hungEventSink{}
+	ts := newTestServer(t, withFakerOptions(
+		gofakes3.WithEventSink(sink),
+		gofakes3.WithEventDeliveryTimeout(timeout),
+	))
+	defer ts.Close()
+
+	put := func(key string) {
+		ts.OKAll(ts.s3Client().PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader([]byte("hello")),
+		}))
+	}
+
+	// A hung delivery is cancelled, so the next event is still attempted:
+	put("a")
+	put("b")
+	deadline := time.Now().Add(10 * timeout)
+	for atomic.LoadInt32(&sink.attempts) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected 2 delivery attempts, found", atomic.LoadInt32(&sink.attempts))
+		}
+		time.Sleep(timeout / 5)
+	}
+
+	// Close does not wait for every queued event to time out:
+	for _, key := range []string{"c", "d", "e", "f", "g", "h", "i", "j"} {
+		put(key)
+	}
+	start := time.Now()
+	ts.OK(ts.GoFakeS3.Close())
+	if elapsed := time.Since(start); elapsed > 5*timeout {
+		t.Fatal("Close took", elapsed)
+	}
+}
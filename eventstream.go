@@ -0,0 +1,89 @@
+package gofakes3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// eventStreamHeader is a header of an event stream message. Only string
+// values are needed by GoFakeS3.
+type eventStreamHeader struct {
+	name, value string
+}
+
+// eventStreamStringType is the type of a string header value.
+const eventStreamStringType = 7
+
+// eventStreamWriter writes messages using the binary event stream encoding
+// used by SelectObjectContent:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/RESTSelectObjectAppendix.html
+//
+// Each message is laid out as follows, with all integers in big-endian
+// order, and both CRCs calculated using CRC32 (IEEE):
+//
+//	total length    uint32  length of the whole message, including the CRCs
+//	headers length  uint32
+//	prelude CRC     uint32  CRC of the two lengths
+//	headers         name length (uint8), name, value type (uint8),
+//	                value length (uint16), value; repeated
+//	payload
+//	message CRC     uint32  CRC of everything before it
+type eventStreamWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func newEventStreamWriter(w io.Writer) *eventStreamWriter {
+	return &eventStreamWriter{w: w}
+}
+
+// writeMessage encodes a single message and writes it to the underlying
+// writer in one call.
+func (e *eventStreamWriter) writeMessage(headers []eventStreamHeader, payload []byte) error {
+	var hdrs bytes.Buffer
+	for _, h := range headers {
+		hdrs.WriteByte(byte(len(h.name)))
+		hdrs.WriteString(h.name)
+		hdrs.WriteByte(eventStreamStringType)
+		binary.Write(&hdrs, binary.BigEndian, uint16(len(h.value)))
+		hdrs.WriteString(h.value)
+	}
+
+	const preludeLen, crcLen = 12, 4
+	total := preludeLen + hdrs.Len() + len(payload) + crcLen
+
+	e.buf.Reset()
+	binary.Write(&e.buf, binary.BigEndian, uint32(total))
+	binary.Write(&e.buf, binary.BigEndian, uint32(hdrs.Len()))
+	binary.Write(&e.buf, binary.BigEndian, crc32.ChecksumIEEE(e.buf.Bytes()))
+	e.buf.Write(hdrs.Bytes())
+	e.buf.Write(payload)
+	binary.Write(&e.buf, binary.BigEndian, crc32.ChecksumIEEE(e.buf.Bytes()))
+
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+// writeEvent writes an event message, such as 'Records' or 'End'. The
+// content type is omitted if it is empty.
+func (e *eventStreamWriter) writeEvent(eventType, contentType string, payload []byte) error {
+	headers := []eventStreamHeader{
+		{":event-type", eventType},
+	}
+	if contentType != "" {
+		headers = append(headers, eventStreamHeader{":content-type", contentType})
+	}
+	headers = append(headers, eventStreamHeader{":message-type", "event"})
+	return e.writeMessage(headers, payload)
+}
+
+// writeError writes an error message, which ends the stream.
+func (e *eventStreamWriter) writeError(code ErrorCode, message string) error {
+	return e.writeMessage([]eventStreamHeader{
+		{":error-code", string(code)},
+		{":error-message", message},
+		{":message-type", "error"},
+	}, nil)
+}
@@ -2,10 +2,11 @@ package gofakes3
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
-	log "github.com/sirupsen/logrus"
 	"io"
 	"io/ioutil"
 	"math"
@@ -29,17 +30,59 @@ import (
 type GoFakeS3 struct {
 	requestID uint64
 
-	storage   Backend
-	versioned VersionedBackend
+	storage    Backend
+	versioned  VersionedBackend
+	copier     VersionCopyBackend
+	acl        ACLBackend
+	bucketACL  BucketACLBackend
+	policy     PolicyBackend
+	lock       ObjectLockBackend
+	cors       CORSBackend
+	website    WebsiteBackend
+	notify     NotificationBackend
+	encryption EncryptionBackend
+	payment    RequestPaymentBackend
+	accelerate AccelerateBackend
+	flat       FlatListingBackend
+	resumable  ResumableBackend
+	usage      QuotaBackend
+	policies   bucketPolicyCache
+	eventSink  EventSink
+	events     *eventDispatcher
+	corsPolicy CORSPolicy
+	ownerInfo  UserInfo
 
 	timeSource              TimeSource
 	timeSkew                time.Duration
+	readTimeout             time.Duration
 	metadataSizeLimit       int
+	minPartSize             int64
+	maxUploadParts          int
+	maxBucketKeys           int64
+	maxObjectSize           int64
 	integrityCheck          bool
 	failOnUnimplementedPage bool
 	hostBucket              bool
+	websiteServing          bool
 	autoBucket              bool
+	allowForceDelete        bool
+	startupChecks           bool
+	completeKeepAlive       time.Duration
+	denyRules               []denyRule
+	compressListings        bool
+	responseTrailersEnabled bool
+	prefixPlaceholders      bool
+	bucketQuotas            map[string]int64
+	memoryLimit             int64
+	memoryMu                sync.Mutex
+	memoryReserved          int64
+	accessLog               *accessLog
+	metrics                 MetricsCollector
+	region                  string
 	uploader                *uploader
+	restorer                *restorer
+	restoreDelay            time.Duration
+	eventTimeout            time.Duration
 	log                     Logger
 
 	// simple v4 signature
@@ -55,13 +98,36 @@ func New(backend Backend, options ...Option) *GoFakeS3 {
 		storage:           backend,
 		timeSkew:          DefaultSkewLimit,
 		metadataSizeLimit: DefaultMetadataSizeLimit,
+		minPartSize:       DefaultUploadPartSize,
+		maxUploadParts:    MaxUploadPartNumber,
+		maxBucketKeys:     MaxBucketKeys,
+		corsPolicy:        DefaultCORSPolicy(),
+		ownerInfo:         DefaultOwner(),
 		integrityCheck:    true,
 		uploader:          newUploader(),
+		restorer:          newRestorer(),
+		restoreDelay:      DefaultRestoreDelay,
+		eventTimeout:      DefaultEventDeliveryTimeout,
 		requestID:         0,
 	}
 
 	// versioned MUST be set before options as one of the options disables it:
-	s3.versioned, _ = backend.(VersionedBackend)
+	found := findOptionalBackends(backend)
+	s3.versioned = found.versioned
+	s3.copier = found.copier
+	s3.acl = found.acl
+	s3.bucketACL = found.bucketACL
+	s3.policy = found.policy
+	s3.lock = found.lock
+	s3.cors = found.cors
+	s3.website = found.website
+	s3.notify = found.notify
+	s3.encryption = found.encryption
+	s3.payment = found.payment
+	s3.accelerate = found.accelerate
+	s3.flat = found.flat
+	s3.resumable = found.resumable
+	s3.usage = found.usage
 
 	for _, opt := range options {
 		opt(s3)
@@ -70,6 +136,11 @@ func New(backend Backend, options ...Option) *GoFakeS3 {
 	if s3.log == nil {
 		s3.log = DiscardLog()
 	}
+	s3.log.Print(LogInfo, "backend capabilities:", Capabilities(backend))
+
+	if s3.eventSink != nil {
+		s3.events = newEventDispatcher(s3.eventSink, DefaultEventBufferSize, s3.eventTimeout, s3.log)
+	}
 
 	if s3.timeSource == nil {
 		s3.timeSource = DefaultTimeSource()
@@ -79,16 +150,58 @@ func New(backend Backend, options ...Option) *GoFakeS3 {
 		s3.AddAuthKeys(s3.v4AuthPair)
 	}
 
+	if s3.startupChecks {
+		if err := s3.checkBackend(); err != nil {
+			s3.log.Print(LogErr, err)
+		}
+	}
+
 	return s3
 }
 
+// NewWithChecks is like New, but calls ListBuckets on the backend once before
+// returning, so a misconfigured backend is reported straight away rather than
+// on the first request. A panic in the backend is returned as an error.
+func NewWithChecks(backend Backend, options ...Option) (*GoFakeS3, error) {
+	s3 := New(backend, options...)
+	if err := s3.checkBackend(); err != nil {
+		return nil, err
+	}
+	return s3, nil
+}
+
+func (g *GoFakeS3) checkBackend() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("gofakes3: backend panicked in ListBuckets: %v", r)
+		}
+	}()
+
+	if _, err := g.storage.ListBuckets(context.Background()); err != nil {
+		return fmt.Errorf("gofakes3: backend failed startup check: %w", err)
+	}
+	return nil
+}
+
 func (g *GoFakeS3) nextRequestID() uint64 {
 	return atomic.AddUint64(&g.requestID, 1)
 }
 
+// Close delivers the events still queued for the EventSink, then stops the
+// goroutine that delivers them. Close waits for the events for no longer
+// than the event delivery timeout; after that, the delivery in progress is
+// cancelled and the remaining events are dropped, as are events from
+// requests served after Close. Close may be called more than once.
+func (g *GoFakeS3) Close() error {
+	if g.events != nil {
+		g.events.close()
+	}
+	return nil
+}
+
 // Create the AWS S3 API
 func (g *GoFakeS3) Server() http.Handler {
-	var handler http.Handler = &withCORS{r: http.HandlerFunc(g.routeBase), log: g.log}
+	var handler http.Handler = &withCORS{r: http.HandlerFunc(g.routeBase), g: g}
 
 	if g.timeSkew != 0 {
 		handler = g.timeSkewMiddleware(handler)
@@ -98,7 +211,35 @@ func (g *GoFakeS3) Server() http.Handler {
 		handler = g.hostBucketMiddleware(handler)
 	}
 
-	return g.authMiddleware(handler)
+	handler = g.authMiddleware(handler)
+
+	if g.readTimeout > 0 {
+		handler = g.readTimeoutMiddleware(handler)
+	}
+
+	if g.accessLog != nil || g.metrics != nil {
+		handler = g.observeMiddleware(handler)
+	}
+
+	return g.requestIDMiddleware(handler)
+}
+
+// requestIDMiddleware assigns every request an ID, which is sent in the
+// "x-amz-request-id" and "x-amz-id-2" headers of the response and in the
+// <RequestId> of any error, including those returned by other middleware.
+// The ID is available to handlers using RequestIDFromContext.
+func (g *GoFakeS3) requestIDMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		id := fmt.Sprintf("%016X", g.nextRequestID())
+
+		hdr := w.Header()
+		hdr.Set("x-amz-id-2", base64.StdEncoding.EncodeToString([]byte(id+id+id+id))) // x-amz-id-2 is 48 bytes of random stuff
+		hdr.Set("x-amz-request-id", id)
+		hdr.Set("Server", "AmazonS3")
+
+		rq = rq.WithContext(context.WithValue(rq.Context(), requestIDKey, id))
+		handler.ServeHTTP(w, rq)
+	})
 }
 
 func (g *GoFakeS3) AddAuthKeys(p map[string]string) {
@@ -123,7 +264,12 @@ func (g *GoFakeS3) authMiddleware(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
 		g.mu.RLock()
 		defer g.mu.RUnlock()
-		if len(g.v4AuthPair) > 0 {
+		if len(g.v4AuthPair) > 0 && !requestHasCredentials(rq) {
+			// Anonymous requests are passed through so the router can decide
+			// whether they are permitted once the bucket and object are known:
+			rq = rq.WithContext(context.WithValue(rq.Context(), anonymousRequestKey, true))
+
+		} else if len(g.v4AuthPair) > 0 {
 			result := signature.V4SignVerify(rq)
 
 			if result == signature.ErrUnsupportAlgorithm {
@@ -134,9 +280,17 @@ func (g *GoFakeS3) authMiddleware(handler http.Handler) http.Handler {
 				g.log.Print(LogWarn, "Access Denied:", rq.RemoteAddr, "=>", rq.URL)
 
 				resp := signature.GetAPIError(result)
+				w.Header().Set("Content-Type", "application/xml")
 				w.WriteHeader(resp.HTTPStatusCode)
-				w.Header().Add("content-type", "application/xml")
-				_, _ = w.Write(signature.EncodeAPIErrorToResponse(resp))
+				if rq.Method != http.MethodHead {
+					if err := g.xmlEncoder(w).Encode(&ErrorResponse{
+						Code:      ErrorCode(resp.Code),
+						Message:   resp.Description,
+						RequestID: RequestIDFromContext(rq.Context()),
+					}); err != nil {
+						g.log.Print(LogErr, err)
+					}
+				}
 				return
 			}
 		}
@@ -145,6 +299,32 @@ func (g *GoFakeS3) authMiddleware(handler http.Handler) http.Handler {
 	})
 }
 
+type contextKey int
+
+const (
+	anonymousRequestKey contextKey = iota
+	bucketKey
+	objectKey
+	operationKey
+	requestIDKey
+	accessLogKey
+)
+
+// requestHasCredentials reports whether the request contains any form of
+// signature, either in the Authorization header or in a presigned URL.
+func requestHasCredentials(rq *http.Request) bool {
+	if rq.Header.Get("Authorization") != "" {
+		return true
+	}
+	q := rq.URL.Query()
+	return q.Get("X-Amz-Credential") != "" || q.Get("AWSAccessKeyId") != ""
+}
+
+func isAnonymousRequest(rq *http.Request) bool {
+	anonymous, _ := rq.Context().Value(anonymousRequestKey).(bool)
+	return anonymous
+}
+
 func (g *GoFakeS3) timeSkewMiddleware(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
 		timeHdr := rq.Header.Get("x-amz-date")
@@ -183,7 +363,7 @@ func (g *GoFakeS3) hostBucketMiddleware(handler http.Handler) http.Handler {
 }
 
 func (g *GoFakeS3) httpError(w http.ResponseWriter, r *http.Request, err error) {
-	resp := ensureErrorResponse(err, "") // FIXME: request id
+	resp := ensureErrorResponse(err, RequestIDFromContext(r.Context()))
 	if resp.ErrorCode() == ErrInternal {
 		g.log.Print(LogErr, err)
 	}
@@ -198,6 +378,13 @@ func (g *GoFakeS3) httpError(w http.ResponseWriter, r *http.Request, err error)
 	}
 }
 
+// owner returns the user that is reported as the owner of all buckets and
+// objects. See WithOwner.
+func (g *GoFakeS3) owner() *UserInfo {
+	owner := g.ownerInfo
+	return &owner
+}
+
 func (g *GoFakeS3) listBuckets(w http.ResponseWriter, r *http.Request) error {
 	buckets, err := g.storage.ListBuckets(r.Context())
 	if err != nil {
@@ -207,10 +394,7 @@ func (g *GoFakeS3) listBuckets(w http.ResponseWriter, r *http.Request) error {
 	s := &Storage{
 		Xmlns:   "http://s3.amazonaws.com/doc/2006-03-01/",
 		Buckets: buckets,
-		Owner: &UserInfo{
-			ID:          "fe7272ea58be830e56fe1663b10fafef",
-			DisplayName: "GoFakeS3",
-		},
+		Owner:   g.owner(),
 	}
 
 	return g.xmlEncoder(w).Encode(s)
@@ -236,7 +420,11 @@ func (g *GoFakeS3) listBucket(bucketName string, w http.ResponseWriter, r *http.
 
 	q := r.URL.Query()
 	prefix := prefixFromQuery(q)
-	page, err := listBucketPageFromQuery(q)
+	page, err := listBucketPageFromQuery(q, g.maxBucketKeys)
+	if err != nil {
+		return err
+	}
+	enc, err := listEncodingFromQuery(q)
 	if err != nil {
 		return err
 	}
@@ -246,41 +434,24 @@ func (g *GoFakeS3) listBucket(bucketName string, w http.ResponseWriter, r *http.
 	g.log.Print(LogInfo, "bucketname:", bucketName, "prefix:", prefix, "page:", fmt.Sprintf("%+v", page))
 
 	ctx := r.Context()
-	objects, err := g.storage.ListBucket(ctx, bucketName, &prefix, page)
-	log.Debugf("objects.Contents: %v, prefix: %v", objects.Contents, prefix)
-
-	if strings.HasSuffix(prefix.Prefix, "/") {
-		hasPrefixSelf := false
-		if objects.Contents != nil {
-			for _, v := range objects.Contents {
-				if v.Key == prefix.Prefix {
-					hasPrefixSelf = true
-					break
-				}
-			}
-		}
-
-		if !hasPrefixSelf {
-			log.Debugf("objects.Contents not has prefix self, need to add it, prefix: %v", prefix)
-			objects.Contents = append(objects.Contents, &Content{
-				Key:          prefix.Prefix,
-				LastModified: NewContentTime(time.Time{}),
-				ETag:         "",
-				Size:         0,
-				StorageClass: StorageStandard,
-				Owner:        nil,
-			})
-		}
-		log.Debugf("objects.Contents: %v", objects.Contents)
+	var objects *ObjectList
+	if page.MaxKeys == 0 {
+		// S3 returns an empty page that is not truncated for 'max-keys=0'.
+		// A Backend treats a MaxKeys of 0 as no limit, so it is not asked:
+		objects = NewObjectList()
+	} else if g.flat != nil && prefix.HasDelimiter && g.flat.FlatListing() {
+		objects, err = g.listBucketFlat(ctx, bucketName, prefix, page)
+	} else {
+		objects, err = g.storage.ListBucket(ctx, bucketName, &prefix, page)
 	}
-
 	if err != nil {
 		if err == ErrInternalPageNotImplemented && !g.failOnUnimplementedPage {
 			// We have observed (though not yet confirmed) that simple clients
 			// tend to work fine if you simply ignore pagination, so the
-			// default if this is not implemented is to retry without it. If
-			// you care about this performance impact for some weird reason,
-			// you'll need to handle it yourself.
+			// default if this is not implemented is to retry without it. The
+			// whole bucket is listed every time, which is slow for large
+			// buckets, so it is logged; WithStrictPagination disables it.
+			g.log.Print(LogWarn, "backend does not implement pagination, listing all of bucket", bucketName)
 			objects, err = g.storage.ListBucket(ctx, bucketName, &prefix, ListBucketPage{})
 			if err != nil {
 				return err
@@ -293,38 +464,55 @@ func (g *GoFakeS3) listBucket(bucketName string, w http.ResponseWriter, r *http.
 		}
 	}
 
+	if g.prefixPlaceholders && page.MaxKeys > 0 {
+		addPrefixPlaceholder(objects, prefix)
+	}
+
+	for _, v := range objects.Contents {
+		v.Key = enc.encode(v.Key)
+	}
+	enc.encodePrefixes(objects.CommonPrefixes)
+
 	base := ListBucketResultBase{
 		Xmlns:          "http://s3.amazonaws.com/doc/2006-03-01/",
 		Name:           bucketName,
 		CommonPrefixes: objects.CommonPrefixes,
 		Contents:       objects.Contents,
 		IsTruncated:    objects.IsTruncated,
-		Delimiter:      prefix.Delimiter,
-		Prefix:         URLEncode(prefix.Prefix),
+		Delimiter:      enc.encode(prefix.Delimiter),
+		Prefix:         enc.encode(prefix.Prefix),
 		MaxKeys:        page.MaxKeys,
 	}
 
 	if !isVersion2 {
 		var result = &ListBucketResult{
 			ListBucketResultBase: base,
-			Marker:               page.Marker,
+			Marker:               enc.encode(page.Marker),
+			EncodingType:         string(enc),
 		}
 		if base.Delimiter != "" {
 			// From the S3 docs: "This element is returned only if you specify
 			// a delimiter request parameter." Dunno why. This hack has been moved
 			// into GoFakeS3 to spare backend implementers the trouble.
-			result.NextMarker = objects.NextMarker
+			result.NextMarker = enc.encode(objects.NextMarker)
 		}
-		return g.xmlEncoder(w).Encode(result)
+		return g.xmlListingEncode(w, r, result)
 
 	} else {
 		var result = &ListBucketResultV2{
 			ListBucketResultBase: base,
-			KeyCount:             int64(len(objects.CommonPrefixes) + len(objects.Contents)),
-			StartAfter:           q.Get("start-after"),
-			ContinuationToken:    q.Get("continuation-token"),
-			EncodingType:         "url",
+			EncodingType:         string(enc),
 		}
+
+		// The continuation token takes over from start-after once the first
+		// page has been returned, so S3 only echoes whichever of the two
+		// drove this page; see listBucketPageFromQuery:
+		if _, ok := q["continuation-token"]; ok {
+			result.ContinuationToken = q.Get("continuation-token")
+		} else {
+			result.StartAfter = enc.encode(q.Get("start-after"))
+		}
+
 		if objects.NextMarker != "" {
 			// We are just cheating with these continuation tokens; they're just the NextMarker
 			// from v1 in disguise! That may change at any time and should not be relied upon
@@ -332,28 +520,64 @@ func (g *GoFakeS3) listBucket(bucketName string, w http.ResponseWriter, r *http.
 			result.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(objects.NextMarker))
 		}
 
-		// On the topic of "fetch-owner", the AWS docs say, in typically vague style:
 		// "If you want the owner information in the response, you can specify
-		// this parameter with the value set to true."
-		//
-		// What does the bare word 'true' mean when we're talking about a query
-		// string parameter, which can only be a string? Does it mean the word
-		// 'true'? Does it mean 'any truthy string'? Does it mean only the key
-		// needs to be present (i.e. '?fetch-owner'), which we are assuming
-		// for now? This is why you need proper technical writers.
-		//
-		// Probably need to hit up the s3assumer at some point, but until then, here's
-		// another FIXME!
-		if _, ok := q["fetch-owner"]; !ok {
+		// this parameter with the value set to true." S3 only returns the
+		// owner for 'fetch-owner=true', in any case; 'false', any other value
+		// or the bare key leave it out:
+		if !strings.EqualFold(q.Get("fetch-owner"), "true") {
 			for _, v := range result.Contents {
 				v.Owner = nil
 			}
+		} else {
+			// Backends are not required to know who owns each object, so
+			// the configured owner is reported for objects without one:
+			for _, v := range result.Contents {
+				if v.Owner == nil || v.Owner.ID == "" {
+					v.Owner = g.owner()
+				}
+			}
 		}
+		result.KeyCount = int64(len(result.CommonPrefixes) + len(result.Contents))
 
-		return g.xmlEncoder(w).Encode(result)
+		return g.xmlListingEncode(w, r, result)
 	}
 }
 
+// listBucketFlat lists a bucket using a FlatListingBackend, which does not
+// compute CommonPrefixes: the whole listing for the prefix is requested, then
+// rolled up and paged by RollupObjectList.
+func (g *GoFakeS3) listBucketFlat(ctx context.Context, bucketName string, prefix Prefix, page ListBucketPage) (*ObjectList, error) {
+	objects, err := g.storage.ListBucket(ctx, bucketName, &prefix, ListBucketPage{})
+	if err != nil {
+		return nil, err
+	}
+	return RollupObjectList(objects.Contents, prefix, page), nil
+}
+
+// addPrefixPlaceholder adds an empty object for the prefix itself to the
+// listing if the prefix ends in the delimiter, or '/' if there is none, and no
+// such object exists, for clients that expect "directory" placeholders; see
+// WithPrefixPlaceholders. S3 never does this.
+func addPrefixPlaceholder(objects *ObjectList, prefix Prefix) {
+	delim := "/"
+	if prefix.HasDelimiter && prefix.Delimiter != "" {
+		delim = prefix.Delimiter
+	}
+	if !strings.HasSuffix(prefix.Prefix, delim) {
+		return
+	}
+	for _, v := range objects.Contents {
+		if v.Key == prefix.Prefix {
+			return
+		}
+	}
+	objects.Contents = append(objects.Contents, &Content{
+		Key:          prefix.Prefix,
+		LastModified: NewContentTime(time.Time{}),
+		StorageClass: StorageStandard,
+	})
+}
+
 func (g *GoFakeS3) getBucketLocation(bucketName string, w http.ResponseWriter, r *http.Request) error {
 	g.log.Print(LogInfo, "GET BUCKET LOCATION")
 
@@ -362,249 +586,1065 @@ func (g *GoFakeS3) getBucketLocation(bucketName string, w http.ResponseWriter, r
 	}
 
 	result := GetBucketLocation{
-		Xmlns:              "http://s3.amazonaws.com/doc/2006-03-01/",
-		LocationConstraint: "",
+		Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/",
+	}
+	if g.region != "us-east-1" {
+		// S3 reports buckets in us-east-1 without a location constraint:
+		result.LocationConstraint = g.region
 	}
 
 	return g.xmlEncoder(w).Encode(result)
 }
 
-func (g *GoFakeS3) listBucketVersions(bucketName string, w http.ResponseWriter, r *http.Request) error {
-	if g.versioned == nil {
+func (g *GoFakeS3) getBucketPolicy(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET BUCKET POLICY", bucket)
+
+	if g.policy == nil {
 		return ErrNotImplemented
 	}
-
-	if err := g.ensureBucketExists(r, bucketName); err != nil {
+	if err := g.ensureBucketExists(r, bucket); err != nil {
 		return err
 	}
 
-	q := r.URL.Query()
-	prefix := prefixFromQuery(q)
-	page, err := listBucketVersionsPageFromQuery(q)
+	policy, err := g.policy.GetBucketPolicy(r.Context(), bucket)
 	if err != nil {
 		return err
 	}
 
-	// S300004:
-	if page.HasVersionIDMarker {
-		if page.VersionIDMarker == "" {
-			return ErrorInvalidArgument("version-id-marker", "", "A version-id marker cannot be empty.")
-		} else if !page.HasKeyMarker {
-			return ErrorInvalidArgument("version-id-marker", "", "A version-id marker cannot be specified without a key marker.")
-		}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(policy)
+	return err
+}
 
-	} else if page.HasKeyMarker && page.KeyMarker == "" {
-		// S300004: S3 ignores everything if you pass an empty key marker so
-		// let's hide that bit of ugliness from Backend.
-		page = ListBucketVersionsPage{}
-	}
+func (g *GoFakeS3) putBucketPolicy(bucket string, w http.ResponseWriter, r *http.Request) (err error) {
+	g.log.Print(LogInfo, "PUT BUCKET POLICY", bucket)
 
-	bucket, err := g.versioned.ListBucketVersions(bucketName, &prefix, &page)
-	if err != nil {
-		return err
+	if g.policy == nil {
+		return ErrNotImplemented
 	}
-
-	for _, ver := range bucket.Versions {
-		// S300005: S3 returns the _string_ 'null' for the version ID if the
-		// bucket has never had versioning enabled. GoFakeS3 backend
-		// implementers should be able to simply return the empty string;
-		// GoFakeS3 itself should handle this particular bit of jank once and
-		// once only.
-		if ver.GetVersionID() == "" {
-			ver.setVersionID("null")
-		}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
 	}
 
-	return g.xmlEncoder(w).Encode(bucket)
-}
-
-// CreateBucket creates a new S3 bucket in the BoltDB storage.
-func (g *GoFakeS3) createBucket(bucket string, w http.ResponseWriter, r *http.Request) error {
-	g.log.Print(LogInfo, "CREATE BUCKET:", bucket)
-
-	if err := ValidateBucketName(bucket); err != nil {
+	defer CheckClose(r.Body, &err)
+	policy, err := ioutil.ReadAll(r.Body)
+	if err != nil {
 		return err
 	}
-	if err := g.storage.CreateBucket(r.Context(), bucket); err != nil {
+	if err := validateBucketPolicy(policy); err != nil {
 		return err
 	}
 
-	w.Header().Set("Location", "/"+bucket)
-	_, err := w.Write([]byte{})
-	if err != nil {
+	if err := g.policy.SetBucketPolicy(r.Context(), bucket, policy); err != nil {
 		return err
 	}
+
+	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
 
-// DeleteBucket deletes the bucket in the underlying backend, if and only if it
-// contains no items.
-func (g *GoFakeS3) deleteBucket(bucket string, w http.ResponseWriter, r *http.Request) error {
-	g.log.Print(LogInfo, "DELETE BUCKET:", bucket)
+func (g *GoFakeS3) deleteBucketPolicy(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "DELETE BUCKET POLICY", bucket)
 
+	if g.policy == nil {
+		return ErrNotImplemented
+	}
 	if err := g.ensureBucketExists(r, bucket); err != nil {
 		return err
 	}
-	if err := g.storage.DeleteBucket(r.Context(), bucket); err != nil {
+
+	if err := g.policy.DeleteBucketPolicy(r.Context(), bucket); err != nil {
 		return err
 	}
+	g.policies.forget(bucket)
 
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
 
-// HeadBucket checks whether a bucket exists.
-func (g *GoFakeS3) headBucket(bucket string, w http.ResponseWriter, r *http.Request) error {
-	g.log.Print(LogInfo, "HEAD BUCKET", bucket)
-	g.log.Print(LogInfo, "bucketname:", bucket)
+func (g *GoFakeS3) getBucketCORS(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET BUCKET CORS", bucket)
 
+	if g.cors == nil {
+		return ErrNotImplemented
+	}
 	if err := g.ensureBucketExists(r, bucket); err != nil {
 		return err
 	}
 
-	_, err := w.Write([]byte{})
+	config, err := g.cors.GetBucketCORS(r.Context(), bucket)
 	if err != nil {
 		return err
 	}
-	return nil
-}
 
-// CheckClose is a utility function used to check the return from
-// Close in a defer statement.
-func CheckClose(c io.Closer, err *error) {
-	cerr := c.Close()
-	if *err == nil {
-		*err = cerr
-	}
+	return g.xmlEncoder(w).Encode(config)
 }
 
-// GetObject retrievs a bucket object.
-func (g *GoFakeS3) getObject(
-	bucket, object string,
-	versionID VersionID,
-	w http.ResponseWriter,
-	r *http.Request,
-) (err error) {
-
-	g.log.Print(LogInfo, "GET OBJECT", "Bucket:", bucket, "Object:", object)
+func (g *GoFakeS3) putBucketCORS(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT BUCKET CORS", bucket)
 
+	if g.cors == nil {
+		return ErrNotImplemented
+	}
 	if err := g.ensureBucketExists(r, bucket); err != nil {
 		return err
 	}
 
-	rnge, err := parseRangeHeader(r.Header.Get("Range"))
-	if err != nil {
+	var in CORSConfiguration
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
 		return err
 	}
+	if err := in.validate(); err != nil {
+		return err
+	}
+	in.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
 
-	var obj *Object
+	return g.cors.PutBucketCORS(r.Context(), bucket, &in)
+}
 
-	{ // get object from backend
-		if versionID == "" {
-			obj, err = g.storage.GetObject(r.Context(), bucket, object, rnge)
-			if err != nil {
-				return err
-			}
-		} else {
-			if g.versioned == nil {
-				return ErrNotImplemented
-			}
-			obj, err = g.versioned.GetObjectVersion(bucket, object, versionID, rnge)
-			if err != nil {
-				return err
-			}
-		}
-	}
+func (g *GoFakeS3) deleteBucketCORS(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "DELETE BUCKET CORS", bucket)
 
-	if obj == nil {
-		g.log.Print(LogErr, "unexpected nil object for key", bucket, object)
-		return ErrInternal
+	if g.cors == nil {
+		return ErrNotImplemented
 	}
-	defer CheckClose(obj.Contents, &err)
-
-	if err := g.writeGetOrHeadObjectResponse(obj, w, r); err != nil {
+	if err := g.ensureBucketExists(r, bucket); err != nil {
 		return err
 	}
 
-	// Writes Content-Length, and Content-Range if applicable:
-	obj.Range.writeHeader(obj.Size, w)
-
-	if _, err := io.Copy(w, obj.Contents); err != nil {
+	if err := g.cors.DeleteBucketCORS(r.Context(), bucket); err != nil {
 		return err
 	}
 
+	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
 
-// writeGetOrHeadObjectResponse contains shared logic for constructing headers for
-// a HEAD and a GET request for a /bucket/object URL.
-func (g *GoFakeS3) writeGetOrHeadObjectResponse(obj *Object, w http.ResponseWriter, r *http.Request) error {
-	// "If the current version of the object is a delete marker, Amazon S3
-	// behaves as if the object was deleted and includes x-amz-delete-marker:
-	// true in the response."
-	if obj.IsDeleteMarker {
-		w.Header().Set("x-amz-version-id", string(obj.VersionID))
-		w.Header().Set("x-amz-delete-marker", "true")
-		return KeyNotFound(obj.Name)
-	}
+func (g *GoFakeS3) getBucketWebsite(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET BUCKET WEBSITE", bucket)
 
-	for mk, mv := range obj.Metadata {
-		w.Header().Set(mk, mv)
+	if g.website == nil {
+		return ErrNotImplemented
 	}
-
-	if obj.VersionID != "" {
-		w.Header().Set("x-amz-version-id", string(obj.VersionID))
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
 	}
 
-	etag := `"` + hex.EncodeToString(obj.Hash) + `"`
-	w.Header().Set("ETag", etag)
-
-	if r.Header.Get("If-None-Match") == etag {
-		return ErrNotModified
+	config, err := g.website.GetBucketWebsite(r.Context(), bucket)
+	if err != nil {
+		return err
 	}
 
-	w.Header().Set("Accept-Ranges", "bytes")
-
-	return nil
+	return g.xmlEncoder(w).Encode(config)
 }
 
-// headObject retrieves only meta information of an object and not the whole.
-func (g *GoFakeS3) headObject(
-	bucket, object string,
-	versionID VersionID,
-	w http.ResponseWriter,
-	r *http.Request,
-) (err error) {
-
-	g.log.Print(LogInfo, "HEAD OBJECT", bucket, object)
+func (g *GoFakeS3) putBucketWebsite(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT BUCKET WEBSITE", bucket)
 
+	if g.website == nil {
+		return ErrNotImplemented
+	}
 	if err := g.ensureBucketExists(r, bucket); err != nil {
 		return err
 	}
 
-	obj, err := g.storage.HeadObject(r.Context(), bucket, object)
-	if err != nil {
+	var in WebsiteConfiguration
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
 		return err
 	}
-	if obj == nil {
-		g.log.Print(LogErr, "unexpected nil object for key", bucket, object)
-		return ErrInternal
-	}
-	defer CheckClose(obj.Contents, &err)
-
-	if err := g.writeGetOrHeadObjectResponse(obj, w, r); err != nil {
+	if err := in.validate(); err != nil {
 		return err
 	}
+	in.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
 
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", obj.Size))
-
-	return nil
+	return g.website.PutBucketWebsite(r.Context(), bucket, &in)
 }
 
-// createObjectBrowserUpload allows objects to be created from a multipart upload initiated
-// by a browser form.
-func (g *GoFakeS3) createObjectBrowserUpload(bucket string, w http.ResponseWriter, r *http.Request) (err error) {
-	g.log.Print(LogInfo, "CREATE OBJECT THROUGH BROWSER UPLOAD")
+func (g *GoFakeS3) deleteBucketWebsite(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "DELETE BUCKET WEBSITE", bucket)
+
+	if g.website == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	if err := g.website.DeleteBucketWebsite(r.Context(), bucket); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (g *GoFakeS3) getBucketEncryption(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET BUCKET ENCRYPTION", bucket)
+
+	if g.encryption == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	config, err := g.encryption.GetBucketEncryption(r.Context(), bucket)
+	if err != nil {
+		return err
+	}
+
+	return g.xmlEncoder(w).Encode(config)
+}
+
+func (g *GoFakeS3) putBucketEncryption(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT BUCKET ENCRYPTION", bucket)
+
+	if g.encryption == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	var in ServerSideEncryptionConfiguration
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := in.validate(); err != nil {
+		return err
+	}
+	in.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	return g.encryption.PutBucketEncryption(r.Context(), bucket, &in)
+}
+
+func (g *GoFakeS3) deleteBucketEncryption(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "DELETE BUCKET ENCRYPTION", bucket)
+
+	if g.encryption == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	if err := g.encryption.DeleteBucketEncryption(r.Context(), bucket); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (g *GoFakeS3) getBucketNotification(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET BUCKET NOTIFICATION", bucket)
+
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	var out NotificationConfiguration
+	if g.notify != nil {
+		config, err := g.notify.GetBucketNotification(r.Context(), bucket)
+		if err != nil {
+			return err
+		}
+		out = *config
+	}
+	out.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	return g.xmlEncoder(w).Encode(&out)
+}
+
+func (g *GoFakeS3) putBucketNotification(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT BUCKET NOTIFICATION", bucket)
+
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	var in NotificationConfiguration
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := in.validate(); err != nil {
+		return err
+	}
+
+	if g.notify == nil {
+		return nil
+	}
+	return g.notify.PutBucketNotification(r.Context(), bucket, &in)
+}
+
+func (g *GoFakeS3) listBucketVersions(bucketName string, w http.ResponseWriter, r *http.Request) error {
+	if g.versioned == nil {
+		return ErrNotImplemented
+	}
+
+	if err := g.ensureBucketExists(r, bucketName); err != nil {
+		return err
+	}
+
+	q := r.URL.Query()
+	prefix := prefixFromQuery(q)
+	page, err := listBucketVersionsPageFromQuery(q)
+	if err != nil {
+		return err
+	}
+	enc, err := listEncodingFromQuery(q)
+	if err != nil {
+		return err
+	}
+
+	// S300004:
+	if page.HasVersionIDMarker {
+		if page.VersionIDMarker == "" {
+			return ErrorInvalidArgument("version-id-marker", "", "A version-id marker cannot be empty.")
+		} else if !page.HasKeyMarker {
+			return ErrorInvalidArgument("version-id-marker", "", "A version-id marker cannot be specified without a key marker.")
+		}
+
+	} else if page.HasKeyMarker && page.KeyMarker == "" {
+		// S300004: S3 ignores everything if you pass an empty key marker so
+		// let's hide that bit of ugliness from Backend.
+		page = ListBucketVersionsPage{}
+	}
+
+	// S300005: a bucket that has never been versioned reports the 'null'
+	// version ID, which the Backend knows nothing about. Such a key has a
+	// single version, so the page starts at the next key:
+	backendPage := page
+	if backendPage.VersionIDMarker == "null" {
+		backendPage.VersionIDMarker, backendPage.HasVersionIDMarker = "", false
+	}
+
+	bucket, err := g.versioned.ListBucketVersions(bucketName, &prefix, &backendPage)
+	if err != nil {
+		return err
+	}
+	bucket.VersionIDMarker = page.VersionIDMarker
+
+	for _, ver := range bucket.Versions {
+		// S300005: S3 returns the _string_ 'null' for the version ID if the
+		// bucket has never had versioning enabled. GoFakeS3 backend
+		// implementers should be able to simply return the empty string;
+		// GoFakeS3 itself should handle this particular bit of jank once and
+		// once only.
+		if ver.GetVersionID() == "" {
+			ver.setVersionID("null")
+		}
+	}
+
+	// The next page must start exactly where this one stopped; if the
+	// Backend did not say where that was, the markers are taken from the
+	// last version or common prefix in the page:
+	if bucket.IsTruncated {
+		var lastKey string
+		var lastVersion VersionID
+		if n := len(bucket.Versions); n > 0 {
+			lastKey, lastVersion = bucket.Versions[n-1].key(), bucket.Versions[n-1].GetVersionID()
+		}
+		if bucket.NextKeyMarker == "" {
+			bucket.NextKeyMarker, bucket.NextVersionIDMarker = lastKey, lastVersion
+			if n := len(bucket.CommonPrefixes); n > 0 && bucket.CommonPrefixes[n-1].Prefix > lastKey {
+				bucket.NextKeyMarker, bucket.NextVersionIDMarker = bucket.CommonPrefixes[n-1].Prefix, ""
+			}
+		} else if bucket.NextVersionIDMarker == "" && bucket.NextKeyMarker == lastKey {
+			bucket.NextVersionIDMarker = lastVersion
+		}
+	}
+
+	for _, ver := range bucket.Versions {
+		switch ver := ver.(type) {
+		case *Version:
+			ver.Key = enc.encode(ver.Key)
+		case *DeleteMarker:
+			ver.Key = enc.encode(ver.Key)
+		}
+	}
+
+	bucket.EncodingType = string(enc)
+	bucket.Prefix = enc.encode(bucket.Prefix)
+	bucket.Delimiter = enc.encode(bucket.Delimiter)
+	bucket.KeyMarker = enc.encode(bucket.KeyMarker)
+	bucket.NextKeyMarker = enc.encode(bucket.NextKeyMarker)
+	enc.encodePrefixes(bucket.CommonPrefixes)
+
+	return g.xmlListingEncode(w, r, bucket)
+}
+
+// CreateBucket creates a new S3 bucket in the BoltDB storage.
+func (g *GoFakeS3) createBucket(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "CREATE BUCKET:", bucket)
+
+	if err := ValidateBucketName(bucket); err != nil {
+		return err
+	}
+
+	// Object Lock requires versioning, so S3 enables it for the new bucket:
+	lockEnabled := strings.EqualFold(r.Header.Get("x-amz-bucket-object-lock-enabled"), "true")
+	if lockEnabled && (g.lock == nil || g.versioned == nil) {
+		return ErrNotImplemented
+	}
+
+	if err := g.storage.CreateBucket(r.Context(), bucket); err != nil {
+		return err
+	}
+
+	if lockEnabled {
+		if err := g.enableObjectLock(r.Context(), bucket); err != nil {
+			// Leave no half-configured bucket behind, so the request can be
+			// retried:
+			if derr := g.storage.DeleteBucket(r.Context(), bucket); derr != nil {
+				g.log.Print(LogErr, "could not delete bucket", bucket, "after failing to enable object lock:", derr)
+			}
+			return err
+		}
+	}
+
+	w.Header().Set("Location", "/"+bucket)
+	_, err := w.Write([]byte{})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// enableObjectLock enables versioning and Object Lock for a bucket that has
+// just been created.
+func (g *GoFakeS3) enableObjectLock(ctx context.Context, bucket string) error {
+	versioning := VersioningConfiguration{Status: VersioningEnabled}
+	if err := g.versioned.SetVersioningConfiguration(bucket, versioning); err != nil {
+		return err
+	}
+
+	config := &ObjectLockConfiguration{
+		Xmlns:             "http://s3.amazonaws.com/doc/2006-03-01/",
+		ObjectLockEnabled: objectLockEnabled,
+	}
+	return g.lock.PutObjectLockConfiguration(ctx, bucket, config)
+}
+
+// DeleteBucket deletes the bucket in the underlying backend, if and only if it
+// contains no items.
+func (g *GoFakeS3) deleteBucket(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "DELETE BUCKET:", bucket)
+
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+	if g.allowForceDelete && isForceDelete(r) {
+		if err := g.emptyBucket(bucket, r); err != nil {
+			return err
+		}
+	}
+	if err := g.storage.DeleteBucket(r.Context(), bucket); err != nil {
+		return err
+	}
+	g.policies.forget(bucket)
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// isForceDelete reports whether a DeleteBucket request asks for the objects
+// in the bucket to be deleted too. See WithAllowForceDelete.
+func isForceDelete(r *http.Request) bool {
+	if _, ok := r.URL.Query()["force"]; ok {
+		return true
+	}
+	return strings.EqualFold(r.Header.Get("x-amz-force"), "true")
+}
+
+// emptyBucket deletes every object in the bucket, one page at a time. If the
+// bucket has ever had versioning enabled, every version and delete marker is
+// deleted. Objects protected by object lock are not deleted; the first one
+// found stops the delete with ErrAccessDenied, leaving the objects that
+// remain in place.
+func (g *GoFakeS3) emptyBucket(bucket string, r *http.Request) error {
+	g.log.Print(LogInfo, "EMPTY BUCKET:", bucket)
+
+	if g.versioned != nil {
+		config, err := g.versioned.VersioningConfiguration(bucket)
+		if err != nil {
+			return err
+		}
+		if config.Status != "" {
+			return g.emptyVersionedBucket(bucket, r)
+		}
+	}
+
+	ctx := r.Context()
+	for {
+		objects, err := g.storage.ListBucket(ctx, bucket, &Prefix{}, ListBucketPage{MaxKeys: DefaultMaxBucketKeys})
+		if err == ErrInternalPageNotImplemented {
+			objects, err = g.storage.ListBucket(ctx, bucket, &Prefix{}, ListBucketPage{})
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, item := range objects.Contents {
+			if err := g.checkObjectLockDelete(bucket, item.Key, "", r); err != nil {
+				return err
+			}
+			if _, err := g.storage.DeleteObject(ctx, bucket, item.Key); err != nil && !HasErrorCode(err, ErrNoSuchKey) {
+				return err
+			}
+		}
+		if !objects.IsTruncated || len(objects.Contents) == 0 {
+			return nil
+		}
+	}
+}
+
+func (g *GoFakeS3) emptyVersionedBucket(bucket string, r *http.Request) error {
+	for {
+		versions, err := g.versioned.ListBucketVersions(bucket, &Prefix{}, &ListBucketVersionsPage{MaxKeys: DefaultMaxBucketVersionKeys})
+		if err != nil {
+			return err
+		}
+
+		for _, item := range versions.Versions {
+			var key string
+			switch item := item.(type) {
+			case *Version:
+				key = item.Key
+			case *DeleteMarker:
+				key = item.Key
+			default:
+				return ErrInternal
+			}
+
+			version := item.GetVersionID()
+			if err := g.checkObjectLockDelete(bucket, key, version, r); err != nil {
+				return err
+			}
+			if _, err := g.versioned.DeleteObjectVersion(bucket, key, version); err != nil {
+				return err
+			}
+		}
+		if !versions.IsTruncated || len(versions.Versions) == 0 {
+			return nil
+		}
+	}
+}
+
+// HeadBucket checks whether a bucket exists.
+func (g *GoFakeS3) headBucket(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "HEAD BUCKET", bucket)
+	g.log.Print(LogInfo, "bucketname:", bucket)
+
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	if g.region != "" {
+		w.Header().Set("x-amz-bucket-region", g.region)
+	}
+
+	// Set the length explicitly rather than writing an empty body, so the
+	// response is never sent with chunked encoding:
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// CheckClose is a utility function used to check the return from
+// Close in a defer statement.
+func CheckClose(c io.Closer, err *error) {
+	if c == nil {
+		return
+	}
+	cerr := c.Close()
+	if *err == nil {
+		*err = cerr
+	}
+}
+
+// GetObject retrievs a bucket object.
+func (g *GoFakeS3) getObject(
+	bucket, object string,
+	versionID VersionID,
+	w http.ResponseWriter,
+	r *http.Request,
+) (err error) {
+
+	g.log.Print(LogInfo, "GET OBJECT", "Bucket:", bucket, "Object:", object)
+
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	rnge, err := parseRangeHeader(r.Header.Get("Range"))
+	if err != nil {
+		return err
+	}
+	if ifRange := r.Header.Get("If-Range"); rnge != nil && ifRange != "" {
+		if rnge, err = g.checkIfRange(bucket, object, versionID, ifRange, rnge, r); err != nil {
+			return err
+		}
+	}
+
+	var obj *Object
+
+	{ // get object from backend
+		if versionID == "" {
+			obj, err = g.storage.GetObject(r.Context(), bucket, object, rnge)
+			if err != nil {
+				return completeRangeError(err, r.Header.Get("Range"), w)
+			}
+		} else {
+			if g.versioned == nil {
+				return ErrNotImplemented
+			}
+			obj, err = g.versioned.GetObjectVersion(bucket, object, versionID, rnge)
+			if err != nil {
+				return completeRangeError(err, r.Header.Get("Range"), w)
+			}
+		}
+	}
+
+	if obj == nil {
+		g.log.Print(LogErr, "unexpected nil object for key", bucket, object)
+		return ErrInternal
+	}
+	defer CheckClose(obj.Contents, &err)
+
+	if err := g.writeGetOrHeadObjectResponse(obj, w, r); err != nil {
+		return err
+	}
+	g.writeRestoreHeader(bucket, obj, w)
+
+	// Writes Content-Length, and Content-Range if applicable. The size of the
+	// body is always known, so this must happen before the first write so the
+	// response is never chunked; only WithResponseTrailers removes it again:
+	obj.Range.writeHeader(obj.Size, w)
+	body, setTrailers := g.responseTrailers(w, r)
+	if obj.Range != nil {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+
+	if _, err := copyContext(r.Context(), body, obj.Contents); err != nil {
+		return err
+	}
+	setTrailers()
+
+	return nil
+}
+
+// checkIfRange returns rnge if the If-Range header matches the object, or nil
+// if the whole object should be returned instead. The range is passed to the
+// Backend along with the GET, so the object is fetched once beforehand to
+// compare it with the header.
+func (g *GoFakeS3) checkIfRange(bucket, object string, versionID VersionID, ifRange string, rnge *ObjectRangeRequest, r *http.Request) (_ *ObjectRangeRequest, err error) {
+	var obj *Object
+	if versionID == "" {
+		obj, err = g.storage.HeadObject(r.Context(), bucket, object)
+	} else if g.versioned == nil {
+		return nil, ErrNotImplemented
+	} else {
+		obj, err = g.versioned.HeadObjectVersion(bucket, object, versionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer CheckClose(obj.Contents, &err)
+
+	if !ifRangeMatches(ifRange, hex.EncodeToString(obj.Hash), objectLastModified(obj)) {
+		return nil, nil
+	}
+	return rnge, nil
+}
+
+// responseHeaderOverrides maps the query parameters accepted by GetObject and
+// HeadObject to the response headers they replace. Presigned download URLs
+// often use them, for example to force a filename with
+// 'response-content-disposition'.
+var responseHeaderOverrides = map[string]string{
+	"response-cache-control":       "Cache-Control",
+	"response-content-disposition": "Content-Disposition",
+	"response-content-encoding":    "Content-Encoding",
+	"response-content-language":    "Content-Language",
+	"response-content-type":        "Content-Type",
+	"response-expires":             "Expires",
+}
+
+// writeGetOrHeadObjectResponse contains shared logic for constructing headers for
+// a HEAD and a GET request for a /bucket/object URL.
+func (g *GoFakeS3) writeGetOrHeadObjectResponse(obj *Object, w http.ResponseWriter, r *http.Request) error {
+	// "If the current version of the object is a delete marker, Amazon S3
+	// behaves as if the object was deleted and includes x-amz-delete-marker:
+	// true in the response."
+	if obj.IsDeleteMarker {
+		w.Header().Set("x-amz-version-id", string(obj.VersionID))
+		w.Header().Set("x-amz-delete-marker", "true")
+		return KeyNotFound(obj.Name)
+	}
+
+	if err := checkSSECustomerKey(obj.Metadata,
+		r.Header.Get(sseCustomerAlgHeader),
+		r.Header.Get(sseCustomerKeyHeader),
+		r.Header.Get(sseCustomerMD5Header)); err != nil {
+		return err
+	}
+
+	for mk, mv := range obj.Metadata {
+		// The Content-Length stored with the object is that of the request
+		// that uploaded it, which may have been aws-chunked; the caller sets
+		// the real one:
+		if mk == "Content-Length" {
+			continue
+		}
+		if isUserMetadataKey(mk) {
+			// Set directly, as Set would canonicalise the key; S3 returns
+			// user metadata in lower case:
+			w.Header()[metadataKey(mk)] = []string{mv}
+			continue
+		}
+		w.Header().Set(mk, mv)
+	}
+
+	// S3 reports this for objects uploaded without a Content-Type. Without
+	// it, net/http would sniff one from the body:
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "binary/octet-stream")
+	}
+
+	query := r.URL.Query()
+	for param, hdr := range responseHeaderOverrides {
+		if v := query.Get(param); v != "" {
+			w.Header().Set(hdr, v)
+		}
+	}
+
+	if obj.VersionID != "" {
+		w.Header().Set("x-amz-version-id", string(obj.VersionID))
+	}
+
+	etag := `"` + hex.EncodeToString(obj.Hash) + `"`
+	w.Header().Set("ETag", etag)
+
+	lastModified := objectLastModified(obj)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", formatHeaderTime(lastModified))
+	}
+	if err := checkConditionalHeaders(r.Header, etag, lastModified); err != nil {
+		return err
+	}
+
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	return nil
+}
+
+// objectLastModified returns the time obj was stored, preferring the
+// Last-Modified recorded in its metadata when it was uploaded. It returns the
+// zero time if neither is known.
+func objectLastModified(obj *Object) time.Time {
+	if lm, ok := obj.Metadata["Last-Modified"]; ok {
+		if t, err := http.ParseTime(lm); err == nil {
+			return t
+		}
+	}
+	return obj.LastModified
+}
+
+// headObject retrieves only meta information of an object and not the whole.
+func (g *GoFakeS3) headObject(
+	bucket, object string,
+	versionID VersionID,
+	w http.ResponseWriter,
+	r *http.Request,
+) (err error) {
+
+	g.log.Print(LogInfo, "HEAD OBJECT", bucket, object)
+
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	var obj *Object
+	if versionID == "" {
+		obj, err = g.storage.HeadObject(r.Context(), bucket, object)
+	} else if g.versioned == nil {
+		return ErrNotImplemented
+	} else {
+		obj, err = g.versioned.HeadObjectVersion(bucket, object, versionID)
+	}
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		g.log.Print(LogErr, "unexpected nil object for key", bucket, object)
+		return ErrInternal
+	}
+	defer CheckClose(obj.Contents, &err)
+
+	// The headers must be the same as those sent by getObject, apart from
+	// the body:
+	if err := g.writeGetOrHeadObjectResponse(obj, w, r); err != nil {
+		return err
+	}
+	g.writeRestoreHeader(bucket, obj, w)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", obj.Size))
+
+	return nil
+}
+
+func (g *GoFakeS3) getObjectACL(bucket, object string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET OBJECT ACL", bucket, object)
+
+	if g.acl == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	policy, err := g.acl.GetObjectACL(r.Context(), bucket, object)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		policy = NewAccessControlPolicy(g.owner())
+	}
+
+	return g.xmlEncoder(w).Encode(policy)
+}
+
+// putObjectACL accepts either a canned ACL in the 'x-amz-acl' header, the
+// 'x-amz-grant-*' headers, or an AccessControlPolicy in the request body.
+func (g *GoFakeS3) putObjectACL(bucket, object string, w http.ResponseWriter, r *http.Request) (err error) {
+	g.log.Print(LogInfo, "PUT OBJECT ACL", bucket, object)
+
+	if g.acl == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	policy, err := g.aclFromRequest(r)
+	if err != nil {
+		return err
+	}
+	return g.acl.PutObjectACL(r.Context(), bucket, object, policy)
+}
+
+func (g *GoFakeS3) getBucketACL(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET BUCKET ACL", bucket)
+
+	if g.bucketACL == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	policy, err := g.bucketACL.GetBucketACL(r.Context(), bucket)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		policy = NewAccessControlPolicy(g.owner())
+	}
+
+	return g.xmlEncoder(w).Encode(policy)
+}
+
+// putBucketACL accepts the same forms of ACL as putObjectACL.
+func (g *GoFakeS3) putBucketACL(bucket string, w http.ResponseWriter, r *http.Request) (err error) {
+	g.log.Print(LogInfo, "PUT BUCKET ACL", bucket)
+
+	if g.bucketACL == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	policy, err := g.aclFromRequest(r)
+	if err != nil {
+		return err
+	}
+	return g.bucketACL.PutBucketACL(r.Context(), bucket, policy)
+}
+
+// aclFromRequest reads the ACL for a PUT to the '?acl' subresource, from
+// either the 'x-amz-acl' or 'x-amz-grant-*' headers, or from an
+// AccessControlPolicy in the request body.
+func (g *GoFakeS3) aclFromRequest(r *http.Request) (policy *AccessControlPolicy, err error) {
+	policy, err = aclFromHeaders(r.Header, g.owner())
+	if err != nil {
+		return nil, err
+	}
+
+	if policy == nil {
+		var in AccessControlPolicy
+		if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+			return nil, err
+		}
+		in.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+		if in.Owner == nil {
+			in.Owner = g.owner()
+		}
+		policy = &in
+
+	} else {
+		defer CheckClose(r.Body, &err)
+	}
+
+	return policy, nil
+}
+
+func (g *GoFakeS3) getObjectLockConfiguration(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET BUCKET OBJECT LOCK", bucket)
+
+	if g.lock == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	config, err := g.lock.GetObjectLockConfiguration(r.Context(), bucket)
+	if err != nil {
+		return err
+	}
+
+	return g.xmlEncoder(w).Encode(config)
+}
+
+func (g *GoFakeS3) putObjectLockConfiguration(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT BUCKET OBJECT LOCK", bucket)
+
+	if g.lock == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	var in ObjectLockConfiguration
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := in.validate(); err != nil {
+		return err
+	}
+	in.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	return g.lock.PutObjectLockConfiguration(r.Context(), bucket, &in)
+}
+
+func (g *GoFakeS3) getObjectRetention(bucket, object string, version VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET OBJECT RETENTION", bucket, object, version)
+
+	if g.lock == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	retention, err := g.lock.GetObjectRetention(r.Context(), bucket, object, version)
+	if err != nil {
+		return err
+	}
+	if retention == nil || retention.Mode == "" {
+		return ErrNoSuchObjectLockConfiguration
+	}
+
+	return g.xmlEncoder(w).Encode(retention)
+}
+
+// putObjectRetention replaces the retention of an object version. S3 does not
+// allow COMPLIANCE retention to be shortened or removed, and only allows
+// GOVERNANCE retention to be if 'x-amz-bypass-governance-retention' is sent.
+func (g *GoFakeS3) putObjectRetention(bucket, object string, version VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT OBJECT RETENTION", bucket, object, version)
+
+	if g.lock == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	var in ObjectLockRetention
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	now := g.timeSource.Now()
+	if err := validateRetention(&in, now); err != nil {
+		return err
+	}
+	in.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	existing, err := g.lock.GetObjectRetention(r.Context(), bucket, object, version)
+	if err != nil {
+		return err
+	}
+	if err := checkRetentionChange(existing, &in, now, bypassGovernanceRetention(r)); err != nil {
+		return err
+	}
+
+	retention := &in
+	if in.Mode == "" {
+		retention = nil
+	}
+	return g.lock.PutObjectRetention(r.Context(), bucket, object, version, retention)
+}
+
+func (g *GoFakeS3) getObjectLegalHold(bucket, object string, version VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET OBJECT LEGAL HOLD", bucket, object, version)
+
+	if g.lock == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	hold, err := g.lock.GetObjectLegalHold(r.Context(), bucket, object, version)
+	if err != nil {
+		return err
+	}
+	if hold == nil {
+		return ErrNoSuchObjectLockConfiguration
+	}
+
+	return g.xmlEncoder(w).Encode(hold)
+}
+
+func (g *GoFakeS3) putObjectLegalHold(bucket, object string, version VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT OBJECT LEGAL HOLD", bucket, object, version)
+
+	if g.lock == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	var in ObjectLockLegalHold
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if !in.Status.Valid() {
+		return ErrMalformedXML
+	}
+	in.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	return g.lock.PutObjectLegalHold(r.Context(), bucket, object, version, &in)
+}
+
+// createObjectBrowserUpload allows objects to be created from a multipart upload initiated
+// by a browser form.
+func (g *GoFakeS3) createObjectBrowserUpload(bucket string, w http.ResponseWriter, r *http.Request) (err error) {
+	g.log.Print(LogInfo, "CREATE OBJECT THROUGH BROWSER UPLOAD")
 
 	if err := g.ensureBucketExists(r, bucket); err != nil {
 		return err
@@ -615,6 +1655,11 @@ func (g *GoFakeS3) createObjectBrowserUpload(bucket string, w http.ResponseWrite
 		return ErrMalformedPOSTRequest
 	}
 
+	policy, err := g.checkPostPolicy(bucket, r)
+	if err != nil {
+		return err
+	}
+
 	keyValues := r.MultipartForm.Value["key"]
 	if len(keyValues) != 1 {
 		return ErrIncorrectNumberOfFilesInPostRequest
@@ -630,6 +1675,23 @@ func (g *GoFakeS3) createObjectBrowserUpload(bucket string, w http.ResponseWrite
 	}
 	fileHeader := fileValues[0]
 
+	if policy != nil && policy.contentLengthRange != nil {
+		if err := policy.contentLengthRange.check(fileHeader.Size); err != nil {
+			return err
+		}
+	}
+	if err := g.checkObjectSize(fileHeader.Size); err != nil {
+		return err
+	}
+	if err := g.checkBucketQuota(r.Context(), bucket, fileHeader.Size); err != nil {
+		return err
+	}
+	release, err := g.checkMemoryLimit(r.Context(), fileHeader.Size, 0)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	infile, err := fileHeader.Open()
 	if err != nil {
 		return err
@@ -640,6 +1702,9 @@ func (g *GoFakeS3) createObjectBrowserUpload(bucket string, w http.ResponseWrite
 	if err != nil {
 		return err
 	}
+	if err := g.applyDefaultEncryption(bucket, meta, r); err != nil {
+		return err
+	}
 
 	if len(key) > KeySizeLimit {
 		return ResourceError(ErrKeyTooLong, key)
@@ -659,7 +1724,59 @@ func (g *GoFakeS3) createObjectBrowserUpload(bucket string, w http.ResponseWrite
 		w.Header().Set("x-amz-version-id", string(result.VersionID))
 	}
 
-	w.Header().Set("ETag", `"`+hex.EncodeToString(rdr.Sum(nil))+`"`)
+	etag := `"` + hex.EncodeToString(rdr.Sum(nil)) + `"`
+	w.Header().Set("ETag", etag)
+	g.emitEvent(w, r, EventObjectCreatedPost, bucket, EventObject{Key: key, Size: fileHeader.Size, ETag: etag, VersionID: string(result.VersionID)})
+	return g.writeBrowserUploadResponse(bucket, key, etag, w, r)
+}
+
+// writeBrowserUploadResponse responds to a successful browser upload as
+// requested by the 'success_action_redirect' and 'success_action_status'
+// form fields:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/RESTObjectPOST.html
+//
+// A valid redirect URL takes precedence and results in a 303 to that URL, with
+// the bucket, key and etag added to the query string. Otherwise the status
+// may be 200 or 204, which are sent without a body, or 201, which returns a
+// PostResponse document. Any other status is ignored, and 200 is sent for
+// compatibility with earlier versions of gofakes3.
+func (g *GoFakeS3) writeBrowserUploadResponse(bucket, key, etag string, w http.ResponseWriter, r *http.Request) error {
+	if redirect := r.MultipartForm.Value["success_action_redirect"]; len(redirect) > 0 {
+		if u, err := url.Parse(redirect[0]); err == nil && u.IsAbs() {
+			query := u.Query()
+			query.Set("bucket", bucket)
+			query.Set("key", key)
+			query.Set("etag", etag)
+			u.RawQuery = query.Encode()
+			w.Header().Set("Location", u.String())
+			w.WriteHeader(http.StatusSeeOther)
+			return nil
+		}
+	}
+
+	var status string
+	if values := r.MultipartForm.Value["success_action_status"]; len(values) > 0 {
+		status = values[0]
+	}
+
+	switch status {
+	case "201":
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		location := (&url.URL{Scheme: scheme, Host: r.Host, Path: "/" + bucket + "/" + key}).String()
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusCreated)
+		return g.xmlEncoder(w).Encode(&PostResponse{
+			Location: location,
+			Bucket:   bucket,
+			Key:      key,
+			ETag:     etag,
+		})
+	case "204":
+		w.WriteHeader(http.StatusNoContent)
+	}
 	return nil
 }
 
@@ -675,6 +1792,9 @@ func (g *GoFakeS3) createObject(bucket, object string, w http.ResponseWriter, r
 	if err != nil {
 		return err
 	}
+	if err := g.applyDefaultEncryption(bucket, meta, r); err != nil {
+		return err
+	}
 
 	if _, ok := meta["X-Amz-Copy-Source"]; ok {
 		return g.copyObject(bucket, object, meta, w, r)
@@ -695,6 +1815,25 @@ func (g *GoFakeS3) createObject(bucket, object string, w http.ResponseWriter, r
 		return ResourceError(ErrKeyTooLong, object)
 	}
 
+	if err := g.checkConditionalWrite(bucket, object, w, r); err != nil {
+		return err
+	}
+
+	offset, resume, err := g.checkWriteOffset(bucket, object, r)
+	if err != nil {
+		return err
+	}
+
+	acl, err := aclFromHeaders(r.Header, g.owner())
+	if err != nil {
+		return err
+	}
+
+	retention, hold, err := g.objectLockForPut(bucket, r)
+	if err != nil {
+		return err
+	}
+
 	var md5Base64 string
 	if g.integrityCheck {
 		md5Base64 = r.Header.Get("Content-MD5")
@@ -705,18 +1844,46 @@ func (g *GoFakeS3) createObject(bucket, object string, w http.ResponseWriter, r
 	}
 
 	var reader io.Reader
+	var trailer http.Header
 
-	if sha, ok := meta["X-Amz-Content-Sha256"]; ok && sha == "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
-		reader = newChunkedReader(r.Body)
+	if isAWSChunked(r.Header) {
 		size, err = strconv.ParseInt(meta["X-Amz-Decoded-Content-Length"], 10, 64)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest) // XXX: no code for this, according to s3tests
 			return nil
 		}
+		chunked := newChunkedReader(r.Body, size)
+		reader, trailer = chunked, chunked.trailer
+		stripAWSChunkedEncoding(meta)
 	} else {
 		reader = r.Body
 	}
 
+	if err := g.checkObjectSize(offset + size); err != nil {
+		return err
+	}
+	if err := g.checkBucketQuota(r.Context(), bucket, size); err != nil {
+		return err
+	}
+	release, err := g.checkMemoryLimit(r.Context(), size, 0)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	checksums, err := checksumsFromHeaders(r.Header)
+	if err != nil {
+		return err
+	}
+
+	// Checksums that are calculated here, or sent in the trailer, are only
+	// known once the body has been read, so it must be read before it is
+	// stored for the checksums to be kept with the object:
+	readFirst := false
+	for _, expected := range checksums {
+		readFirst = readFirst || expected == ""
+	}
+
 	// hashingReader is still needed to get the ETag even if integrityCheck
 	// is set to false:
 	rdr, err := newHashingReader(reader, md5Base64)
@@ -724,8 +1891,32 @@ func (g *GoFakeS3) createObject(bucket, object string, w http.ResponseWriter, r
 	if err != nil {
 		return err
 	}
+	for alg, expected := range checksums {
+		rdr.addChecksum(alg, expected)
+	}
+	if alg, ok := trailerChecksum(r.Header); ok && trailer != nil {
+		rdr.addTrailerChecksum(alg, trailer)
+		readFirst = true
+	}
+
+	var body io.Reader = rdr
+	if readFirst {
+		data, err := ReadAll(rdr, size)
+		if err != nil {
+			return err
+		}
+		for alg, sum := range rdr.Checksums() {
+			meta[http.CanonicalHeaderKey(alg.Header())] = sum
+		}
+		body = bytes.NewReader(data)
+	}
 
-	result, err := g.storage.PutObject(r.Context(), bucket, object, meta, rdr, size)
+	var result PutObjectResult
+	if resume {
+		result, err = g.resumable.WriteAt(r.Context(), bucket, object, offset, body, size)
+	} else {
+		result, err = g.storage.PutObject(r.Context(), bucket, object, meta, body, size)
+	}
 	if err != nil {
 		return err
 	}
@@ -734,8 +1925,32 @@ func (g *GoFakeS3) createObject(bucket, object string, w http.ResponseWriter, r
 		g.log.Print(LogInfo, "CREATED VERSION:", bucket, object, result.VersionID)
 		w.Header().Set("x-amz-version-id", string(result.VersionID))
 	}
-	w.Header().Set("ETag", `"`+hex.EncodeToString(rdr.Sum(nil))+`"`)
 
+	if acl != nil && g.acl != nil {
+		if err := g.acl.PutObjectACL(r.Context(), bucket, object, acl); err != nil {
+			return err
+		}
+	}
+
+	if err := g.putObjectLock(r, bucket, object, result.VersionID, retention, hold); err != nil {
+		return err
+	}
+
+	etag := `"` + hex.EncodeToString(rdr.Sum(nil)) + `"`
+	if resume {
+		// The ETag is that of the whole object, not of the bytes written:
+		if etag, err = g.objectETag(r, bucket, object); err != nil {
+			return err
+		}
+	}
+	w.Header().Set("ETag", etag)
+	echoChecksumHeaders(r.Header, w.Header())
+	for alg, sum := range rdr.Checksums() {
+		w.Header().Set(alg.Header(), sum)
+	}
+	echoEncryptionHeaders(meta, w.Header())
+
+	g.emitEvent(w, r, EventObjectCreatedPut, bucket, EventObject{Key: object, Size: size, ETag: etag, VersionID: string(result.VersionID)})
 	return nil
 }
 
@@ -752,20 +1967,50 @@ func (g *GoFakeS3) copyObject(bucket, object string, meta map[string]string, w h
 		return ResourceError(ErrKeyTooLong, object)
 	}
 
-	// XXX No support for versionId subresource
-	parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
-	srcBucket := parts[0]
-	srcKey := strings.SplitN(parts[1], "?", 2)[0]
+	directive := meta["X-Amz-Metadata-Directive"]
+	if directive == "" {
+		directive = "COPY"
+	}
+	if directive != "COPY" && directive != "REPLACE" {
+		return ErrorInvalidArgument("x-amz-metadata-directive", directive, "Unknown metadata directive.")
+	}
+
+	srcBucket, srcKey, srcVersion, err := parseCopySource(source)
+	if err != nil {
+		return err
+	}
+
+	_, changesStorageClass := meta["X-Amz-Storage-Class"]
+	changesEncryption := meta[sseHeader] != "" || meta[sseCustomerAlgHeader] != ""
+	if srcBucket == bucket && srcKey == object && srcVersion == "" && directive == "COPY" && !changesStorageClass && !changesEncryption {
+		return ErrorMessage(ErrInvalidRequest, "This copy request is illegal because it is trying to copy an object to itself without changing the object's metadata, storage class, website redirect location or encryption attributes.")
+	}
 
-	srcKey, err = url.QueryUnescape(srcKey)
+	ctx := r.Context()
+	srcObj, err := g.headCopySource(ctx, srcBucket, srcKey, srcVersion)
 	if err != nil {
 		return err
 	}
-	ctx := r.Context()
-	srcObj, err := g.storage.HeadObject(ctx, srcBucket, srcKey)
+	if err := checkCopySourceConditions(r.Header, srcObj); err != nil {
+		return err
+	}
+	if err := g.checkObjectSize(srcObj.Size); err != nil {
+		return err
+	}
+	if err := g.checkBucketQuota(ctx, bucket, srcObj.Size); err != nil {
+		return err
+	}
+	release, err := g.checkMemoryLimit(ctx, srcObj.Size, 0)
 	if err != nil {
 		return err
 	}
+	defer release()
+	if err := checkSSECustomerKey(srcObj.Metadata,
+		r.Header.Get(sseCopySourceCustomerAlgHeader),
+		r.Header.Get(sseCopySourceCustomerKeyHeader),
+		r.Header.Get(sseCopySourceCustomerMD5Header)); err != nil {
+		return err
+	}
 
 	// if srcObj == nil {
 	// 	g.log.Print(LogErr, "unexpected nil object for key", bucket, object)
@@ -777,15 +2022,36 @@ func (g *GoFakeS3) copyObject(bucket, object string, meta map[string]string, w h
 	// "If the current version of the object is a delete marker, Amazon S3
 	// behaves as if the object was deleted."
 
-	// merge metadata, ACL is not preserved
-	// for k, v := range srcObj.Metadata {
-	// 	if _, found := meta[k]; !found && k != "X-Amz-Acl" {
-	// 		meta[k] = v
-	// 	}
-	// }
+	// With the COPY directive, the user metadata and the content headers are
+	// those of the source, and any sent with the request are ignored. With
+	// REPLACE, only the request metadata is used. The ACL and the encryption
+	// settings are never preserved.
 	delete(meta, "X-Amz-Acl")
+	if directive == "COPY" {
+		copied := make(map[string]string, len(srcObj.Metadata))
+		for k, v := range srcObj.Metadata {
+			copied[metadataKey(k)] = v
+		}
+		delete(copied, "X-Amz-Acl")
+		for _, k := range sseMetadataKeys {
+			delete(copied, k)
+		}
+		for k, v := range meta {
+			if !isCopiedMetadataKey(k) {
+				copied[k] = v
+			}
+		}
+		meta = copied
+	}
 
-	result, err := g.storage.CopyObject(ctx, srcBucket, srcKey, bucket, object, meta)
+	var result CopyObjectResult
+	if srcVersion == "" {
+		result, err = g.storage.CopyObject(ctx, srcBucket, srcKey, bucket, object, meta)
+	} else if g.copier != nil {
+		result, err = g.copier.CopyObjectVersion(srcBucket, srcKey, srcVersion, bucket, object, meta)
+	} else {
+		result, err = g.copyObjectVersion(ctx, srcBucket, srcKey, srcVersion, bucket, object, meta)
+	}
 	if err != nil {
 		return err
 	}
@@ -793,23 +2059,127 @@ func (g *GoFakeS3) copyObject(bucket, object string, meta map[string]string, w h
 	if srcObj.VersionID != "" {
 		w.Header().Set("x-amz-copy-source-version-id", string(srcObj.VersionID))
 	}
-	// currently not supported
-	// if result.VersionID != "" {
-	// 	g.log.Print(LogInfo, "CREATED VERSION:", bucket, object, result.VersionID)
-	// 	w.Header().Set("x-amz-version-id", string(result.VersionID))
-	// }
+	if result.VersionID != "" {
+		g.log.Print(LogInfo, "CREATED VERSION:", bucket, object, result.VersionID)
+		w.Header().Set("x-amz-version-id", string(result.VersionID))
+	}
 
+	echoEncryptionHeaders(meta, w.Header())
+	g.emitEvent(w, r, EventObjectCreatedCopy, bucket, EventObject{Key: object, Size: srcObj.Size, ETag: result.ETag, VersionID: string(result.VersionID)})
+
+	result.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
 	return g.xmlEncoder(w).Encode(result)
 }
 
+// copyObjectVersion copies a specific version of an object for a Backend
+// that does not implement VersionCopyBackend, by reading the version and
+// storing it with PutObject.
+func (g *GoFakeS3) copyObjectVersion(ctx context.Context, srcBucket, srcKey string, srcVersion VersionID, dstBucket, dstKey string, meta map[string]string) (result CopyObjectResult, err error) {
+	obj, err := g.getCopySource(ctx, srcBucket, srcKey, srcVersion)
+	if err != nil {
+		return result, err
+	}
+	defer CheckClose(obj.Contents, &err)
+
+	put, err := g.storage.PutObject(ctx, dstBucket, dstKey, meta, obj.Contents, obj.Size)
+	if err != nil {
+		return result, err
+	}
+	return CopyObjectResult{
+		ETag:         `"` + hex.EncodeToString(obj.Hash) + `"`,
+		LastModified: NewContentTime(g.timeSource.Now()),
+		VersionID:    put.VersionID,
+	}, nil
+}
+
+// parseCopySource splits the 'x-amz-copy-source' header into a bucket, an
+// unescaped key and the version ID from the versionId subresource, if there
+// is one.
+func parseCopySource(source string) (bucket, key string, versionID VersionID, err error) {
+	parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", ErrorInvalidArgument("x-amz-copy-source", source, "Copy Source must mention the source bucket and key: sourcebucket/sourcekey")
+	}
+
+	keyAndQuery := strings.SplitN(parts[1], "?", 2)
+	key, err = url.QueryUnescape(keyAndQuery[0])
+	if err != nil {
+		return "", "", "", err
+	}
+
+	// A specific version of the source can be selected with the versionId
+	// subresource; the 'null' version is the current one:
+	if len(keyAndQuery) == 2 {
+		query, err := url.ParseQuery(keyAndQuery[1])
+		if err != nil {
+			return "", "", "", ErrorInvalidArgument("x-amz-copy-source", source, "Invalid copy source encoding.")
+		}
+		if values, ok := query["versionId"]; ok {
+			if values[0] == "" {
+				return "", "", "", ErrorInvalidArgument("x-amz-copy-source", source, "Invalid version id specified")
+			}
+			versionID = VersionID(versionFromQuery(values))
+		}
+	}
+	return parts[0], key, versionID, nil
+}
+
+// headCopySource fetches the source of a copy, which is the current version
+// of the object unless versionID is set.
+func (g *GoFakeS3) headCopySource(ctx context.Context, bucket, key string, versionID VersionID) (*Object, error) {
+	if versionID == "" {
+		return g.storage.HeadObject(ctx, bucket, key)
+	} else if g.versioned == nil {
+		return nil, ErrNotImplemented
+	}
+
+	obj, err := g.versioned.HeadObjectVersion(bucket, key, versionID)
+	if err != nil {
+		return nil, err
+	}
+	if obj.IsDeleteMarker {
+		obj.Contents.Close()
+		return nil, ErrorMessage(ErrInvalidRequest, "The source of a copy request may not specifically refer to a delete marker by version id.")
+	}
+	return obj, nil
+}
+
+// getCopySource is like headCopySource, but the object's contents are
+// included.
+func (g *GoFakeS3) getCopySource(ctx context.Context, bucket, key string, versionID VersionID) (*Object, error) {
+	if versionID == "" {
+		return g.storage.GetObject(ctx, bucket, key, nil)
+	} else if g.versioned == nil {
+		return nil, ErrNotImplemented
+	}
+
+	obj, err := g.versioned.GetObjectVersion(bucket, key, versionID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if obj.IsDeleteMarker {
+		obj.Contents.Close()
+		return nil, ErrorMessage(ErrInvalidRequest, "The source of a copy request may not specifically refer to a delete marker by version id.")
+	}
+	return obj, nil
+}
+
 func (g *GoFakeS3) deleteObject(bucket, object string, w http.ResponseWriter, r *http.Request) error {
 	g.log.Print(LogInfo, "DELETE:", bucket, object)
 	if err := g.ensureBucketExists(r, bucket); err != nil {
 		return err
 	}
+	if err := g.checkObjectLockDelete(bucket, object, "", r); err != nil {
+		return err
+	}
 
 	result, err := g.storage.DeleteObject(r.Context(), bucket, object)
-	if err != nil {
+	if HasErrorCode(err, ErrNoSuchKey) && !g.versioningEnabled(bucket) {
+		// S3 does not report missing keys when deleting from an unversioned
+		// bucket; the delete is idempotent:
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	} else if err != nil {
 		return err
 	}
 
@@ -823,10 +2193,31 @@ func (g *GoFakeS3) deleteObject(bucket, object string, w http.ResponseWriter, r
 		w.Header().Set("x-amz-version-id", string(result.VersionID))
 	}
 
+	g.emitEvent(w, r, deleteEventName(result), bucket, EventObject{Key: object, VersionID: string(result.VersionID)})
+
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
 
+// deleteEventName returns the name of the event sent when an object is
+// deleted.
+func deleteEventName(result ObjectDeleteResult) string {
+	if result.IsDeleteMarker {
+		return EventObjectRemovedDeleteMarkerCreated
+	}
+	return EventObjectRemovedDelete
+}
+
+// versioningEnabled reports whether versioning is currently enabled for the
+// bucket. If the Backend does not support versioning, it never is.
+func (g *GoFakeS3) versioningEnabled(bucket string) bool {
+	if g.versioned == nil {
+		return false
+	}
+	config, err := g.versioned.VersioningConfiguration(bucket)
+	return err == nil && config.Enabled()
+}
+
 func (g *GoFakeS3) deleteObjectVersion(bucket, object string, version VersionID, w http.ResponseWriter, r *http.Request) error {
 	if g.versioned == nil {
 		return ErrNotImplemented
@@ -836,6 +2227,9 @@ func (g *GoFakeS3) deleteObjectVersion(bucket, object string, version VersionID,
 	if err := g.ensureBucketExists(r, bucket); err != nil {
 		return err
 	}
+	if err := g.checkObjectLockDelete(bucket, object, version, r); err != nil {
+		return err
+	}
 
 	result, err := g.versioned.DeleteObjectVersion(bucket, object, version)
 	if err != nil {
@@ -853,6 +2247,8 @@ func (g *GoFakeS3) deleteObjectVersion(bucket, object string, version VersionID,
 		w.Header().Set("x-amz-version-id", string(result.VersionID))
 	}
 
+	g.emitEvent(w, r, EventObjectRemovedDelete, bucket, EventObject{Key: object, VersionID: string(version)})
+
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
@@ -869,28 +2265,117 @@ func (g *GoFakeS3) deleteMulti(bucket string, w http.ResponseWriter, r *http.Req
 	var in DeleteRequest
 
 	defer CheckClose(r.Body, &err)
-	dc := xml.NewDecoder(r.Body)
-	if err := dc.Decode(&in); err != nil {
+	body, err := g.readDeleteMultiBody(r)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(body, &in); err != nil {
 		return ErrorMessage(ErrMalformedXML, err.Error())
 	}
 
-	keys := make([]string, len(in.Objects))
-	for i, o := range in.Objects {
-		keys[i] = o.Key
+	if len(in.Objects) == 0 || len(in.Objects) > MaxDeleteMultiKeys {
+		return ErrMalformedXML
 	}
 
-	out, err := g.storage.DeleteMulti(r.Context(), bucket, keys...)
-	if err != nil {
-		return err
+	if g.versioned == nil {
+		for _, o := range in.Objects {
+			if versionFromQuery([]string{o.VersionID}) != "" {
+				return ErrNotImplemented
+			}
+		}
+	}
+
+	var out MultiDeleteResult
+
+	// Keys protected by object lock, or versions that fail to delete, are
+	// reported individually rather than failing the whole request. Keys
+	// without a version are collected and passed to DeleteMulti:
+	keys := make([]string, 0, len(in.Objects))
+	for _, o := range in.Objects {
+		version := VersionID(versionFromQuery([]string{o.VersionID}))
+
+		err := g.checkObjectLockDelete(bucket, o.Key, version, r)
+		if err == nil && version == "" {
+			keys = append(keys, o.Key)
+			continue
+		}
+
+		var result ObjectDeleteResult
+		if err == nil {
+			result, err = g.versioned.DeleteObjectVersion(bucket, o.Key, version)
+		}
+		if err != nil {
+			er := ErrorResultFromError(err)
+			er.Key, er.VersionID = o.Key, o.VersionID
+			out.Error = append(out.Error, er)
+			continue
+		}
+
+		deleted := ObjectID{Key: o.Key, VersionID: string(version)}
+		if result.IsDeleteMarker {
+			deleted.DeleteMarker = true
+			deleted.DeleteMarkerVersionID = string(version)
+		}
+		out.Deleted = append(out.Deleted, deleted)
+	}
+
+	if len(keys) > 0 {
+		result, err := g.storage.DeleteMulti(r.Context(), bucket, keys...)
+		if err != nil {
+			return err
+		}
+		out.Deleted = append(out.Deleted, result.Deleted...)
+		out.Error = append(out.Error, result.Error...)
 	}
 
 	if in.Quiet {
 		out.Deleted = nil
 	}
 
+	out.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
 	return g.xmlEncoder(w).Encode(out)
 }
 
+// readDeleteMultiBody reads the body of a DeleteObjects request. S3 requires
+// the body to be protected by a Content-MD5 or a checksum header, which is
+// checked unless the integrity check has been disabled.
+func (g *GoFakeS3) readDeleteMultiBody(r *http.Request) ([]byte, error) {
+	if !g.integrityCheck {
+		return ioutil.ReadAll(r.Body)
+	}
+
+	md5Base64 := r.Header.Get("Content-MD5")
+	if _, ok := r.Header[textproto.CanonicalMIMEHeaderKey("Content-MD5")]; ok && md5Base64 == "" {
+		return nil, ErrInvalidDigest
+	}
+	checksums, err := checksumsFromHeaders(r.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	// CRC64NVME, which newer SDKs send by default, is accepted but not
+	// verified, as it is not otherwise supported:
+	protected := md5Base64 != "" || r.Header.Get("x-amz-checksum-crc64nvme") != ""
+	for _, expected := range checksums {
+		protected = protected || expected != ""
+	}
+	if !protected {
+		return nil, ErrorMessage(ErrInvalidRequest, "Missing required header for this request: Content-MD5")
+	}
+
+	hashed, err := newHashingReader(r.Body, md5Base64)
+	if err != nil {
+		return nil, err
+	}
+	for alg, expected := range checksums {
+		hashed.addChecksum(alg, expected)
+	}
+
+	// The whole body is read, rather than decoded as it arrives, so the
+	// digests are checked before anything is deleted:
+	return ioutil.ReadAll(hashed)
+}
+
 func (g *GoFakeS3) initiateMultipartUpload(bucket, object string, w http.ResponseWriter, r *http.Request) error {
 	g.log.Print(LogInfo, "initiate multipart upload", bucket, object)
 
@@ -898,12 +2383,24 @@ func (g *GoFakeS3) initiateMultipartUpload(bucket, object string, w http.Respons
 	if err != nil {
 		return err
 	}
+	checksum, err := checksumAlgorithmFromHeaders(r.Header)
+	if err != nil {
+		return err
+	}
 	if err := g.ensureBucketExists(r, bucket); err != nil {
 		return err
 	}
+	if err := g.applyDefaultEncryption(bucket, meta, r); err != nil {
+		return err
+	}
 
-	upload := g.uploader.Begin(bucket, object, meta, g.timeSource.Now())
+	upload := g.uploader.Begin(bucket, object, meta, checksum, g.timeSource.Now())
+	if checksum != ChecksumNone {
+		w.Header().Set("x-amz-checksum-algorithm", string(checksum))
+	}
+	echoEncryptionHeaders(meta, w.Header())
 	out := InitiateMultipartUpload{
+		Xmlns:    "http://s3.amazonaws.com/doc/2006-03-01/",
 		UploadID: upload.ID,
 		Bucket:   bucket,
 		Key:      object,
@@ -922,10 +2419,14 @@ func (g *GoFakeS3) putMultipartUploadPart(bucket, object string, uploadID Upload
 	g.log.Print(LogInfo, "put multipart upload", bucket, object, uploadID)
 
 	partNumber, err := strconv.ParseInt(r.URL.Query().Get("partNumber"), 10, 0)
-	if err != nil || partNumber <= 0 || partNumber > MaxUploadPartNumber {
+	if err != nil || partNumber <= 0 || partNumber > int64(g.maxUploadParts) {
 		return ErrInvalidPart
 	}
 
+	if source := r.Header.Get("x-amz-copy-source"); source != "" {
+		return g.copyMultipartUploadPart(bucket, object, uploadID, int(partNumber), source, w, r)
+	}
+
 	size, err := strconv.ParseInt(r.Header.Get("Content-Length"), 10, 64)
 	if err != nil {
 		return ErrMissingContentLength
@@ -948,55 +2449,202 @@ func (g *GoFakeS3) putMultipartUploadPart(bucket, object string, uploadID Upload
 	}
 
 	var rdr io.Reader
-	if sha, ok := meta["X-Amz-Content-Sha256"]; ok && sha == "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
-		rdr = newChunkedReader(r.Body)
+	var chunked *chunkedReader
+	if isAWSChunked(r.Header) {
 		size, err = strconv.ParseInt(meta["X-Amz-Decoded-Content-Length"], 10, 64)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest) // XXX: no code for this, according to s3tests
 			return nil
 		}
+		chunked = newChunkedReader(r.Body, size)
+		rdr = chunked
 	} else {
 		rdr = r.Body
 	}
 
+	// No part can be larger than the whole object:
+	if err := g.checkObjectSize(size); err != nil {
+		return err
+	}
+	if g.uploader.tempDir == "" {
+		release, err := g.checkMemoryLimit(r.Context(), size, 0)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	var md5Base64 string
 	if g.integrityCheck {
-		md5Base64 := r.Header.Get("Content-MD5")
+		md5Base64 = r.Header.Get("Content-MD5")
 		if _, ok := r.Header[textproto.CanonicalMIMEHeaderKey("Content-MD5")]; ok && md5Base64 == "" {
 			return ErrInvalidDigest // Satisfies s3tests
 		}
+	}
+
+	// The MD5, which is used as the ETag, and the checksums are calculated
+	// as the part is read, so it does not have to be held in memory:
+	hashed, err := newHashingReader(rdr, md5Base64)
+	if err != nil {
+		return err
+	}
+	if upload.ChecksumAlgorithm != ChecksumNone {
+		if err := checkChecksumType(r.Header, upload.ChecksumAlgorithm); err != nil {
+			return err
+		}
+		hashed.addChecksum(upload.ChecksumAlgorithm, "")
+	} else {
+		checksums, err := checksumsFromHeaders(r.Header)
+		if err != nil {
+			return err
+		}
+		for alg := range checksums {
+			hashed.addChecksum(alg, "")
+		}
+	}
+	if alg, ok := trailerChecksum(r.Header); ok && chunked != nil {
+		hashed.addChecksum(alg, "")
+	}
 
-		if md5Base64 != "" {
-			var err error
-			rdr, err = newHashingReader(rdr, md5Base64)
-			if err != nil {
-				return err
-			}
+	part, err := g.uploader.newPart(hashed, size)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			part.discard()
+		}
+	}()
+
+	// A checksum sent in the trailer is checked as if it were a header:
+	hdr := r.Header
+	if chunked != nil && len(chunked.trailer) > 0 {
+		hdr = r.Header.Clone()
+		for k, v := range chunked.trailer {
+			hdr[k] = v
+		}
+	}
+
+	sums := hashed.Checksums()
+	if upload.ChecksumAlgorithm != ChecksumNone {
+		part.Checksum = sums[upload.ChecksumAlgorithm]
+		if err := verifyChecksumHeaders(hdr, upload.ChecksumAlgorithm, part.Checksum); err != nil {
+			return err
 		}
+	} else if err := verifyUntrackedChecksums(hdr, sums, w.Header()); err != nil {
+		return err
+	}
+
+	// What the ETag actually is is not specified, so let's just invent any old thing
+	// from guaranteed unique input:
+	part.ETag = fmt.Sprintf(`"%s"`, hex.EncodeToString(hashed.Sum(nil)))
+	if err := upload.AddPart(int(partNumber), g.timeSource.Now(), part); err != nil {
+		return err
+	}
+
+	w.Header().Add("ETag", part.ETag)
+	if part.Checksum != "" {
+		w.Header().Set(upload.ChecksumAlgorithm.Header(), part.Checksum)
+	}
+	return nil
+}
+
+// copyMultipartUploadPart implements UploadPartCopy, which adds a part to a
+// multipart upload using all or part of an existing object, rather than the
+// request body.
+func (g *GoFakeS3) copyMultipartUploadPart(bucket, object string, uploadID UploadID, partNumber int, source string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "copy multipart upload part", source, "TO", bucket, object, uploadID)
+
+	srcBucket, srcKey, srcVersion, err := parseCopySource(source)
+	if err != nil {
+		return err
 	}
 
-	body, err := ReadAll(rdr, size)
+	upload, err := g.uploader.Get(bucket, object, uploadID)
 	if err != nil {
 		return err
 	}
 
-	if int64(len(body)) != size {
-		return ErrIncompleteBody
+	srcObj, err := g.getCopySource(r.Context(), srcBucket, srcKey, srcVersion)
+	if err != nil {
+		return err
+	}
+	defer srcObj.Contents.Close()
+	if err := checkCopySourceConditions(r.Header, srcObj); err != nil {
+		return err
+	}
+	release, err := g.checkMemoryLimit(r.Context(), srcObj.Size, 0)
+	if err != nil {
+		return err
 	}
+	defer release()
 
-	etag, err := upload.AddPart(int(partNumber), g.timeSource.Now(), body)
+	body, err := ReadAll(srcObj.Contents, srcObj.Size)
 	if err != nil {
 		return err
 	}
 
-	w.Header().Add("ETag", etag)
-	return nil
+	if rnge := r.Header.Get("x-amz-copy-source-range"); rnge != "" {
+		body, err = copySourceRange(rnge, body)
+		if err != nil {
+			return err
+		}
+	}
+	if err := g.checkBucketQuota(r.Context(), bucket, int64(len(body))); err != nil {
+		return err
+	}
+
+	part, err := g.uploader.newPart(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return err
+	}
+	part.ETag = fmt.Sprintf(`"%x"`, md5.Sum(body))
+	if upload.ChecksumAlgorithm != ChecksumNone {
+		part.Checksum = upload.ChecksumAlgorithm.Sum(body)
+	}
+
+	now := g.timeSource.Now()
+	if err := upload.AddPart(partNumber, now, part); err != nil {
+		part.discard()
+		return err
+	}
+
+	if srcObj.VersionID != "" {
+		w.Header().Set("x-amz-copy-source-version-id", string(srcObj.VersionID))
+	}
+
+	result := CopyPartResult{
+		Xmlns:        "http://s3.amazonaws.com/doc/2006-03-01/",
+		ETag:         part.ETag,
+		LastModified: NewContentTime(now),
+	}
+	result.Checksums.Set(upload.ChecksumAlgorithm, part.Checksum)
+	return g.xmlEncoder(w).Encode(result)
+}
+
+// copySourceRange returns the slice of body selected by the
+// 'x-amz-copy-source-range' header. Unlike the Range header, both the first
+// and last byte must be given, and the range must fit inside the source.
+func copySourceRange(value string, body []byte) ([]byte, error) {
+	rnge, err := parseRangeHeader(value)
+	if err != nil || rnge.FromEnd || rnge.End == RangeNoEnd {
+		return nil, ErrorInvalidArgument("x-amz-copy-source-range", value,
+			"The x-amz-copy-source-range value must be of the form bytes=first-last where first and last are the zero-based offsets of the first and last bytes to copy")
+	}
+	if rnge.End >= int64(len(body)) {
+		return nil, ErrorInvalidArgument("x-amz-copy-source-range", value,
+			fmt.Sprintf("Range specified is not valid for source object of size: %d", len(body)))
+	}
+	return body[rnge.Start : rnge.End+1], nil
 }
 
 func (g *GoFakeS3) abortMultipartUpload(bucket, object string, uploadID UploadID, w http.ResponseWriter, r *http.Request) error {
 	g.log.Print(LogInfo, "abort multipart upload", bucket, object, uploadID)
-	if _, err := g.uploader.Complete(bucket, object, uploadID); err != nil {
+	upload, err := g.uploader.Complete(bucket, object, uploadID)
+	if err != nil {
 		return err
 	}
+	upload.discard()
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
@@ -1009,29 +2657,110 @@ func (g *GoFakeS3) completeMultipartUpload(bucket, object string, uploadID Uploa
 		return err
 	}
 
-	upload, err := g.uploader.Complete(bucket, object, uploadID)
+	if g.completeKeepAlive > 0 {
+		return g.completeMultipartUploadKeepAlive(bucket, object, uploadID, &in, w, r)
+	}
+
+	done, err := g.finishMultipartUpload(bucket, object, uploadID, &in, r)
 	if err != nil {
 		return err
 	}
+	if done.versionID != "" {
+		w.Header().Set("x-amz-version-id", string(done.versionID))
+	}
+	g.emitCompletedUpload(w, r, done)
+	return g.xmlEncoder(w).Encode(done.out)
+}
 
-	fileBody, etag, err := upload.Reassemble(&in)
+// completedUpload is the outcome of finishMultipartUpload.
+type completedUpload struct {
+	out       *CompleteMultipartUploadResult
+	versionID VersionID
+	size      int64
+}
+
+// finishMultipartUpload does the work of CompleteMultipartUpload. It does
+// not touch the ResponseWriter, so it can run while keep-alive whitespace is
+// being written; see WithMultipartCompleteKeepAlive.
+func (g *GoFakeS3) finishMultipartUpload(bucket, object string, uploadID UploadID, in *CompleteMultipartUploadRequest, r *http.Request) (*completedUpload, error) {
+	upload, err := g.uploader.Get(bucket, object, uploadID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	result, err := g.storage.PutObject(r.Context(), bucket, object, upload.Meta, bytes.NewReader(fileBody), int64(len(fileBody)))
+	if len(in.Parts) > g.maxUploadParts {
+		return nil, ErrorMessagef(ErrInvalidPart, "An upload can not have more than %d parts.", g.maxUploadParts)
+	}
+
+	// The upload is only removed once the parts have been validated, so the
+	// client may retry with a corrected list of parts:
+	fileBody, size, err := upload.Reassemble(in, g.minPartSize)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if result.VersionID != "" {
-		w.Header().Set("x-amz-version-id", string(result.VersionID))
+	defer fileBody.Close()
+	if err := g.checkObjectSize(size); err != nil {
+		return nil, err
+	}
+	if err := g.checkBucketQuota(r.Context(), bucket, size); err != nil {
+		return nil, err
+	}
+	release, err := g.checkMemoryLimit(r.Context(), size, upload.memoryUsage())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if _, err := g.uploader.Complete(bucket, object, uploadID); err != nil {
+		return nil, err
+	}
+	defer func() {
+		fileBody.Close()
+		upload.discard()
+	}()
+
+	// The object lock headers are sent when the upload is initiated rather
+	// than here, so only the bucket's default retention applies:
+	var retention *ObjectLockRetention
+	if g.lock != nil {
+		config, err := g.lock.GetObjectLockConfiguration(r.Context(), bucket)
+		if err != nil && !HasErrorCode(err, ErrObjectLockConfigurationNotFound) {
+			return nil, err
+		}
+		retention = config.DefaultRetentionAt(g.timeSource.Now())
+	}
+	checksum, err := upload.CompositeChecksum(in)
+	if err != nil {
+		return nil, err
+	}
+
+	// The object's MD5 is calculated as it is streamed to the backend:
+	hashed, err := newHashingReader(fileBody, "")
+	if err != nil {
+		return nil, err
+	}
+	result, err := g.storage.PutObject(r.Context(), bucket, object, upload.Meta, hashed, size)
+	if err != nil {
+		return nil, err
+	}
+	etag := hex.EncodeToString(hashed.Sum(nil))
+	if err := g.putObjectLock(r, bucket, object, result.VersionID, retention, nil); err != nil {
+		return nil, err
 	}
 
-	return g.xmlEncoder(w).Encode(&CompleteMultipartUploadResult{
+	out := &CompleteMultipartUploadResult{
+		Xmlns:  "http://s3.amazonaws.com/doc/2006-03-01/",
 		ETag:   etag,
 		Bucket: bucket,
 		Key:    object,
-	})
+	}
+	out.Checksums.Set(upload.ChecksumAlgorithm, checksum)
+	return &completedUpload{out: out, versionID: result.VersionID, size: size}, nil
+}
+
+func (g *GoFakeS3) emitCompletedUpload(w http.ResponseWriter, r *http.Request, done *completedUpload) {
+	g.emitEvent(w, r, EventObjectCreatedCompleteMultipartUpload, done.out.Bucket,
+		EventObject{Key: done.out.Key, Size: done.size, ETag: done.out.ETag, VersionID: string(done.versionID)})
 }
 
 func (g *GoFakeS3) listMultipartUploads(bucket string, w http.ResponseWriter, r *http.Request) error {
@@ -1042,6 +2771,10 @@ func (g *GoFakeS3) listMultipartUploads(bucket string, w http.ResponseWriter, r
 	query := r.URL.Query()
 	prefix := prefixFromQuery(query)
 	marker := uploadListMarkerFromQuery(query)
+	enc, err := listEncodingFromQuery(query)
+	if err != nil {
+		return err
+	}
 
 	maxUploads, err := parseClampedInt(query.Get("max-uploads"), DefaultMaxUploads, 0, MaxUploadsLimit)
 	if err != nil {
@@ -1051,11 +2784,21 @@ func (g *GoFakeS3) listMultipartUploads(bucket string, w http.ResponseWriter, r
 		maxUploads = DefaultMaxUploads
 	}
 
-	out, err := g.uploader.List(bucket, marker, prefix, maxUploads)
+	out, err := g.uploader.List(bucket, marker, prefix, maxUploads, g.owner())
 	if err != nil {
 		return err
 	}
 
+	out.EncodingType = string(enc)
+	out.Prefix = enc.encode(out.Prefix)
+	out.Delimiter = enc.encode(out.Delimiter)
+	out.KeyMarker = enc.encode(out.KeyMarker)
+	out.NextKeyMarker = enc.encode(out.NextKeyMarker)
+	enc.encodePrefixes(out.CommonPrefixes)
+	for i := range out.Uploads {
+		out.Uploads[i].Key = enc.encode(out.Uploads[i].Key)
+	}
+
 	return g.xmlEncoder(w).Encode(out)
 }
 
@@ -1075,11 +2818,17 @@ func (g *GoFakeS3) listMultipartUploadParts(bucket, object string, uploadID Uplo
 	if err != nil {
 		return ErrInvalidURI
 	}
+	enc, err := listEncodingFromQuery(query)
+	if err != nil {
+		return err
+	}
 
-	out, err := g.uploader.ListParts(bucket, object, uploadID, int(marker), maxParts)
+	out, err := g.uploader.ListParts(bucket, object, uploadID, int(marker), maxParts, g.owner())
 	if err != nil {
 		return err
 	}
+	out.EncodingType = string(enc)
+	out.Key = enc.encode(out.Key)
 
 	return g.xmlEncoder(w).Encode(out)
 }
@@ -1099,6 +2848,7 @@ func (g *GoFakeS3) getBucketVersioning(bucket string, w http.ResponseWriter, r *
 		}
 	}
 
+	config.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
 	return g.xmlEncoder(w).Encode(config)
 }
 
@@ -1188,12 +2938,26 @@ func metadataSize(meta map[string]string) int {
 func metadataHeaders(headers map[string][]string, at time.Time, sizeLimit int) (map[string]string, error) {
 	meta := make(map[string]string)
 	for hk, hv := range headers {
-		if strings.HasPrefix(hk, "X-Amz-") || strings.HasPrefix(hk, "Content-") || hk == "Cache-Control" {
+		// Form fields in a POST upload are not canonicalised like headers, so
+		// 'content-type' would otherwise be ignored or returned in the wrong
+		// case:
+		hk = metadataKey(hk)
+		if isUserMetadataKey(hk) {
+			// S3 joins repeated user metadata headers into one value:
+			meta[hk] = strings.Join(hv, ",")
+		} else if strings.HasPrefix(hk, "X-Amz-") || strings.HasPrefix(hk, "Content-") || hk == "Cache-Control" {
 			meta[hk] = hv[0]
 		}
 	}
 	meta["Last-Modified"] = formatHeaderTime(at)
 
+	if sc, ok := meta["X-Amz-Storage-Class"]; ok && !StorageClass(sc).Valid() {
+		return meta, ErrInvalidStorageClass
+	}
+	if err := checkServerSideEncryption(meta); err != nil {
+		return meta, err
+	}
+
 	if sizeLimit > 0 && metadataSize(meta) > sizeLimit {
 		return meta, ErrMetadataTooLarge
 	}
@@ -1201,8 +2965,39 @@ func metadataHeaders(headers map[string][]string, at time.Time, sizeLimit int) (
 	return meta, nil
 }
 
-func listBucketPageFromQuery(query url.Values) (page ListBucketPage, rerr error) {
-	maxKeys, err := parseClampedInt(query.Get("max-keys"), DefaultMaxBucketKeys, 0, MaxBucketKeys)
+// userMetadataPrefix starts the name of every header that holds user
+// metadata.
+const userMetadataPrefix = "x-amz-meta-"
+
+// metadataKey returns the key the header hk is stored under in an object's
+// metadata. User metadata keys are lowercased, which is how S3 stores and
+// returns them; all other headers are canonicalised.
+func metadataKey(hk string) string {
+	if isUserMetadataKey(hk) {
+		return strings.ToLower(hk)
+	}
+	return http.CanonicalHeaderKey(hk)
+}
+
+// isCopiedMetadataKey reports whether the metadata key k is taken from the
+// source of a copy with the COPY metadata directive, rather than from the
+// request: the user metadata and the headers that describe the content.
+func isCopiedMetadataKey(k string) bool {
+	return isUserMetadataKey(k) || strings.HasPrefix(k, "Content-") || k == "Cache-Control" || k == "Expires"
+}
+
+func isUserMetadataKey(hk string) bool {
+	return len(hk) > len(userMetadataPrefix) && strings.EqualFold(hk[:len(userMetadataPrefix)], userMetadataPrefix)
+}
+
+// listBucketPageFromQuery reads the page of a ListObjects or ListObjectsV2
+// request. max-keys is capped to maxBucketKeys; see WithMaxBucketKeys.
+func listBucketPageFromQuery(query url.Values, maxBucketKeys int64) (page ListBucketPage, rerr error) {
+	defaultKeys := int64(DefaultMaxBucketKeys)
+	if defaultKeys > maxBucketKeys {
+		defaultKeys = maxBucketKeys
+	}
+	maxKeys, err := parseClampedInt(query.Get("max-keys"), defaultKeys, 0, maxBucketKeys)
 	if err != nil {
 		return page, err
 	}
@@ -90,3 +90,32 @@ type failingResponseWriter struct {
 func (w *failingResponseWriter) Write(buf []byte) (n int, err error) {
 	return 0, fmt.Errorf("nope")
 }
+
+func TestBucketPolicyCache(t *testing.T) {
+	const (
+		allow = `{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "*"}}`
+		deny  = `{"Version": "2012-10-17", "Statement": {"Effect": "Deny", "Principal": "*", "Action": "s3:GetObject", "Resource": "*"}}`
+	)
+
+	var c bucketPolicyCache
+	first, err := c.parse("bucket", []byte(allow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := c.parse("bucket", []byte(allow)); again != first {
+		t.Fatal("expected the cached policy to be reused")
+	}
+
+	changed, err := c.parse("bucket", []byte(deny))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed == first || changed.Statement[0].Effect != "Deny" {
+		t.Fatal("expected the changed policy to be parsed")
+	}
+
+	c.forget("bucket")
+	if again, _ := c.parse("bucket", []byte(deny)); again == changed {
+		t.Fatal("expected the forgotten policy to be parsed again")
+	}
+}
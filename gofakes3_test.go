@@ -3,13 +3,20 @@ package gofakes3_test
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
@@ -54,6 +61,39 @@ func TestCreateBucket(t *testing.T) {
 	}))
 }
 
+func TestHeadBucket(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	u, err := url.Parse(ts.server.URL)
+	ts.OK(err)
+
+	for _, proto := range []string{"HTTP/1.0", "HTTP/1.1"} {
+		t.Run(proto, func(t *testing.T) {
+			conn, err := net.Dial("tcp", u.Host)
+			ts.OK(err)
+			defer conn.Close()
+
+			fmt.Fprintf(conn, "HEAD /%s %s\r\nHost: %s\r\nConnection: close\r\n\r\n", defaultBucket, proto, u.Host)
+			rq, err := http.NewRequest("HEAD", ts.url("/"+defaultBucket), nil)
+			ts.OK(err)
+			rs, err := http.ReadResponse(bufio.NewReader(conn), rq)
+			ts.OK(err)
+			defer rs.Body.Close()
+
+			if rs.StatusCode != http.StatusOK {
+				t.Fatal("unexpected status", rs.StatusCode)
+			}
+			if len(rs.TransferEncoding) != 0 {
+				t.Fatal("unexpected transfer encoding", rs.TransferEncoding)
+			}
+			if cl := rs.Header.Get("Content-Length"); cl != "0" {
+				t.Fatal("unexpected content length", cl)
+			}
+		})
+	}
+}
+
 func TestListBuckets(t *testing.T) {
 	ts := newTestServer(t, withoutInitialBuckets())
 	defer ts.Close()
@@ -112,6 +152,49 @@ func TestListBuckets(t *testing.T) {
 	assertBucketTime("test3", defaultDate.Add(1*time.Minute))
 }
 
+func TestListBucketsOwner(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		rs, err := ts.s3Client().ListBuckets(&s3.ListBucketsInput{})
+		ts.OK(err)
+		owner := gofakes3.DefaultOwner()
+		if aws.StringValue(rs.Owner.ID) != owner.ID || aws.StringValue(rs.Owner.DisplayName) != owner.DisplayName {
+			t.Fatal("unexpected owner", rs.Owner)
+		}
+	})
+
+	t.Run("display-name", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithOwnerDisplayName("someone")))
+		defer ts.Close()
+		rs, err := ts.s3Client().ListBuckets(&s3.ListBucketsInput{})
+		ts.OK(err)
+		if aws.StringValue(rs.Owner.ID) != gofakes3.DefaultOwner().ID || aws.StringValue(rs.Owner.DisplayName) != "someone" {
+			t.Fatal("unexpected owner", rs.Owner)
+		}
+	})
+
+	t.Run("empty-display-name", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithOwner("abc123", "")))
+		defer ts.Close()
+
+		rs, err := httpClient().Get(ts.url("/"))
+		ts.OK(err)
+		defer rs.Body.Close()
+		body, err := ioutil.ReadAll(rs.Body)
+		ts.OK(err)
+		if !bytes.Contains(body, []byte("<ID>abc123</ID>")) || bytes.Contains(body, []byte("<DisplayName")) {
+			t.Fatal("expected owner without DisplayName, found", string(body))
+		}
+
+		out, err := ts.s3Client().ListBuckets(&s3.ListBucketsInput{})
+		ts.OK(err)
+		if aws.StringValue(out.Owner.ID) != "abc123" || out.Owner.DisplayName != nil {
+			t.Fatal("unexpected owner", out.Owner)
+		}
+	})
+}
+
 func TestListBucketObjectSize(t *testing.T) {
 	ts := newTestServer(t)
 	defer ts.Close()
@@ -210,6 +293,210 @@ func TestCreateObjectMD5(t *testing.T) {
 	}
 }
 
+func TestCreateObjectEchoesChecksums(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	checksums := map[string]string{
+		"x-amz-checksum-crc32":     "NhCmhg==",
+		"x-amz-checksum-crc32c":    "mnG7TA==",
+		"x-amz-checksum-sha1":      "qvTGHdzF6KLavt4PO0gs2a6pQ00=",
+		"x-amz-checksum-sha256":    "LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=",
+		"x-amz-checksum-crc64nvme": "M3eFcAZSQlc=",
+	}
+
+	rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/object"), strings.NewReader("hello"))
+	ts.OK(err)
+	for k, v := range checksums {
+		rq.Header.Set(k, v)
+	}
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	for k, v := range checksums {
+		if found := rs.Header.Get(k); found != v {
+			t.Fatalf("expected %s %q, found %q", k, v, found)
+		}
+	}
+}
+
+func TestCreateObjectChecksums(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	put := func(key string, hdr map[string]string) *http.Response {
+		t.Helper()
+		rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/"+key), strings.NewReader("hello"))
+		ts.OK(err)
+		for k, v := range hdr {
+			rq.Header.Set(k, v)
+		}
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		rs.Body.Close()
+		return rs
+	}
+
+	// A checksum that does not match the body is rejected:
+	rs := put("bad", map[string]string{"x-amz-checksum-crc32": "AAAAAA=="})
+	if rs.StatusCode != http.StatusBadRequest {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	if ts.backendObjectExists(defaultBucket, "bad") {
+		t.Fatal("unexpected object")
+	}
+
+	// So is one that could not have come from the algorithm:
+	rs = put("invalid", map[string]string{"x-amz-checksum-sha256": "NhCmhg=="})
+	if rs.StatusCode != http.StatusBadRequest {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+
+	// If only the algorithm is sent, the checksum is calculated:
+	rs = put("calculated", map[string]string{"x-amz-sdk-checksum-algorithm": "SHA1"})
+	if rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	if sum := rs.Header.Get("x-amz-checksum-sha1"); sum != "qvTGHdzF6KLavt4PO0gs2a6pQ00=" {
+		t.Fatal("unexpected checksum", sum)
+	}
+
+	// A valid checksum is kept, and sent back with the object:
+	rs = put("valid", map[string]string{"x-amz-checksum-crc32": "NhCmhg=="})
+	if rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	obj, err := ts.s3Client().GetObject(&s3.GetObjectInput{
+		Bucket:       aws.String(defaultBucket),
+		Key:          aws.String("valid"),
+		ChecksumMode: aws.String("ENABLED"),
+	})
+	ts.OK(err)
+	obj.Body.Close()
+	if aws.StringValue(obj.ChecksumCRC32) != "NhCmhg==" {
+		t.Fatal("unexpected checksum", aws.StringValue(obj.ChecksumCRC32))
+	}
+}
+
+func TestCreateObjectUnsignedPayloadTrailer(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	put := func(key, checksum string) *http.Response {
+		t.Helper()
+		body := "5\r\nhello\r\n0\r\nx-amz-checksum-crc32:" + checksum + "\r\n\r\n"
+		rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/"+key), strings.NewReader(body))
+		ts.OK(err)
+		rq.Header.Set("Content-Encoding", "aws-chunked")
+		rq.Header.Set("X-Amz-Content-Sha256", "STREAMING-UNSIGNED-PAYLOAD-TRAILER")
+		rq.Header.Set("X-Amz-Decoded-Content-Length", "5")
+		rq.Header.Set("X-Amz-Trailer", "x-amz-checksum-crc32")
+		rq.Header.Set("X-Amz-Sdk-Checksum-Algorithm", "CRC32")
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		rs.Body.Close()
+		return rs
+	}
+
+	rs := put("object", "NhCmhg==")
+	if rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	if sum := rs.Header.Get("x-amz-checksum-crc32"); sum != "NhCmhg==" {
+		t.Fatal("unexpected checksum", sum)
+	}
+	ts.assertObject(defaultBucket, "object", nil, "hello")
+
+	obj, err := ts.s3Client().GetObject(&s3.GetObjectInput{
+		Bucket:       aws.String(defaultBucket),
+		Key:          aws.String("object"),
+		ChecksumMode: aws.String("ENABLED"),
+	})
+	ts.OK(err)
+	obj.Body.Close()
+	if aws.StringValue(obj.ChecksumCRC32) != "NhCmhg==" {
+		t.Fatal("unexpected checksum", aws.StringValue(obj.ChecksumCRC32))
+	}
+	if obj.ContentEncoding != nil {
+		t.Fatal("unexpected content encoding", aws.StringValue(obj.ContentEncoding))
+	}
+
+	rs = put("bad", "AAAAAA==")
+	if rs.StatusCode != http.StatusBadRequest {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	if ts.backendObjectExists(defaultBucket, "bad") {
+		t.Fatal("unexpected object")
+	}
+}
+
+func TestCreateObjectEmpty(t *testing.T) {
+	const emptyETag = `"d41d8cd98f00b204e9800998ecf8427e"`
+
+	for idx, tc := range []struct {
+		body string
+		hdr  map[string]string
+	}{
+		{"", nil},
+		{"0;chunk-signature=b6c6ea8a5354eaf15b3cb7646744f4275b71ea724fed81ceb9323e279d449df9\r\n\r\n", map[string]string{
+			"X-Amz-Content-Sha256":         "STREAMING-AWS4-HMAC-SHA256-PAYLOAD",
+			"X-Amz-Decoded-Content-Length": "0",
+		}},
+		{"0\r\nx-amz-checksum-crc32:AAAAAA==\r\n\r\n", map[string]string{
+			"Content-Encoding":             "aws-chunked",
+			"X-Amz-Content-Sha256":         "STREAMING-UNSIGNED-PAYLOAD-TRAILER",
+			"X-Amz-Decoded-Content-Length": "0",
+			"X-Amz-Trailer":                "x-amz-checksum-crc32",
+		}},
+
+		// Some clients leave out the final chunk when there is no data:
+		{"", map[string]string{
+			"X-Amz-Content-Sha256":         "STREAMING-AWS4-HMAC-SHA256-PAYLOAD",
+			"X-Amz-Decoded-Content-Length": "0",
+		}},
+	} {
+		t.Run(fmt.Sprint(idx), func(t *testing.T) {
+			ts := newTestServer(t)
+			defer ts.Close()
+			svc := ts.s3Client()
+
+			rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/empty"), strings.NewReader(tc.body))
+			ts.OK(err)
+			for k, v := range tc.hdr {
+				rq.Header.Set(k, v)
+			}
+			rs, err := httpClient().Do(rq)
+			ts.OK(err)
+			rs.Body.Close()
+			if rs.StatusCode != http.StatusOK {
+				t.Fatal("unexpected status", rs.StatusCode)
+			}
+			if etag := rs.Header.Get("ETag"); etag != emptyETag {
+				t.Fatal("unexpected etag", etag)
+			}
+
+			obj, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String(defaultBucket), Key: aws.String("empty")})
+			ts.OK(err)
+			body, err := ioutil.ReadAll(obj.Body)
+			obj.Body.Close()
+			ts.OK(err)
+			if len(body) != 0 || aws.StringValue(obj.ETag) != emptyETag {
+				t.Fatal("unexpected object", len(body), aws.StringValue(obj.ETag))
+			}
+
+			head, err := svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(defaultBucket), Key: aws.String("empty")})
+			ts.OK(err)
+			if aws.Int64Value(head.ContentLength) != 0 || aws.StringValue(head.ETag) != emptyETag {
+				t.Fatal("unexpected object", aws.Int64Value(head.ContentLength), aws.StringValue(head.ETag))
+			}
+		})
+	}
+}
+
 func TestCreateObjectWithMissingContentLength(t *testing.T) {
 	ts := newTestServer(t)
 	defer ts.Close()
@@ -260,6 +547,77 @@ func TestCreateObjectWithInvalidContentLength(t *testing.T) {
 	}
 }
 
+func TestCreateObjectChunkedDecodedLengthMismatch(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	body := "5;chunk-signature=" + strings.Repeat("0", 64) + "\r\nhello\r\n" +
+		"0;chunk-signature=" + strings.Repeat("0", 64) + "\r\n\r\n"
+
+	put := func(key, decodedLength string) *http.Response {
+		t.Helper()
+		rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/"+key), strings.NewReader(body))
+		ts.OK(err)
+		rq.Header.Set("X-Amz-Content-Sha256", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD")
+		rq.Header.Set("X-Amz-Decoded-Content-Length", decodedLength)
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		rs.Body.Close()
+		return rs
+	}
+
+	if rs := put("ok", "5"); rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	ts.assertObject(defaultBucket, "ok", nil, "hello")
+
+	for _, decodedLength := range []string{"4", "6"} {
+		if rs := put("bad", decodedLength); rs.StatusCode != http.StatusBadRequest {
+			t.Fatal("unexpected status for", decodedLength, rs.StatusCode)
+		}
+		if ts.backendObjectExists(defaultBucket, "bad") {
+			t.Fatal("object should not exist")
+		}
+	}
+}
+
+func TestCreateObjectAWSChunkedContentEncoding(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	body := "5;chunk-signature=" + strings.Repeat("0", 64) + "\r\nhello\r\n" +
+		"0;chunk-signature=" + strings.Repeat("0", 64) + "\r\n\r\n"
+
+	for _, tc := range []struct {
+		key, encoding, stored string
+	}{
+		{"plain", "aws-chunked", ""},
+		{"gzip", "aws-chunked, gzip", "gzip"},
+	} {
+		rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/"+tc.key), strings.NewReader(body))
+		ts.OK(err)
+		rq.Header.Set("Content-Encoding", tc.encoding)
+		rq.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+		rq.Header.Set("X-Amz-Decoded-Content-Length", "5")
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		rs.Body.Close()
+		if rs.StatusCode != http.StatusOK {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+
+		obj, err := ts.backend.HeadObject(mockR.Context(), defaultBucket, tc.key)
+		ts.OK(err)
+		if obj.Size != 5 {
+			t.Fatal("unexpected size", obj.Size)
+		}
+		if enc := obj.Metadata["Content-Encoding"]; enc != tc.stored {
+			t.Fatal("unexpected stored Content-Encoding", enc)
+		}
+		ts.assertObject(defaultBucket, tc.key, nil, "hello")
+	}
+}
+
 func TestCreateObjectWithContentDisposition(t *testing.T) {
 	ts := newTestServer(t)
 	defer ts.Close()
@@ -398,17 +756,126 @@ func TestCopyObject(t *testing.T) {
 		t.Fatal("object copying failed")
 	}
 
-	if v := obj.Metadata["X-Amz-Meta-One"]; v != "src" {
+	// Without a metadata directive, the metadata is copied from the source
+	// and the metadata sent with the request is ignored:
+	if v := obj.Metadata["Content-Type"]; v != "text/plain" {
 		t.Fatalf("bad Content-Type: %q", v)
 	}
 
-	if v := obj.Metadata["X-Amz-Meta-Two"]; v != "dst" {
-		t.Fatalf("bad Content-Encoding: %q", v)
+	if v := obj.Metadata["x-amz-meta-one"]; v != "src" {
+		t.Fatalf("bad x-amz-meta-one: %q", v)
+	}
+
+	if v := obj.Metadata["x-amz-meta-two"]; v != "src" {
+		t.Fatalf("bad x-amz-meta-two: %q", v)
+	}
+
+	if v, ok := obj.Metadata["x-amz-meta-three"]; ok {
+		t.Fatalf("unexpected x-amz-meta-three: %q", v)
+	}
+}
+
+func TestCopyObjectMetadataDirective(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	srcMeta := map[string]string{
+		"Content-Type":   "text/plain",
+		"X-Amz-Meta-One": "src",
+	}
+	ts.backendPutString(defaultBucket, "src-key", srcMeta, "content")
+
+	copyObject := func(dst, directive string) error {
+		t.Helper()
+		in := &s3.CopyObjectInput{
+			Bucket:      aws.String(defaultBucket),
+			Key:         aws.String(dst),
+			CopySource:  aws.String("/" + defaultBucket + "/src-key"),
+			ContentType: aws.String("application/json"),
+			Metadata:    map[string]*string{"Two": aws.String("dst")},
+		}
+		if directive != "" {
+			in.MetadataDirective = aws.String(directive)
+		}
+		_, err := svc.CopyObject(in)
+		return err
+	}
+
+	assertMeta := func(key string, expected map[string]string) {
+		t.Helper()
+		obj, err := ts.backend.HeadObject(mockR.Context(), defaultBucket, key)
+		ts.OK(err)
+		for k, v := range expected {
+			if obj.Metadata[k] != v {
+				t.Fatalf("unexpected %s for %s: %q", k, key, obj.Metadata[k])
+			}
+		}
+	}
+
+	ts.OK(copyObject("copied", "COPY"))
+	assertMeta("copied", map[string]string{
+		"Content-Type":   "text/plain",
+		"x-amz-meta-one": "src",
+		"x-amz-meta-two": "",
+	})
+
+	ts.OK(copyObject("replaced", "REPLACE"))
+	assertMeta("replaced", map[string]string{
+		"Content-Type":   "application/json",
+		"x-amz-meta-one": "",
+		"x-amz-meta-two": "dst",
+	})
+
+	if err := copyObject("src-key", ""); !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+		t.Fatal("expected InvalidRequest, found", err)
+	}
+	if err := copyObject("src-key", "nope"); !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
+	}
+	ts.OK(copyObject("src-key", "REPLACE"))
+	assertMeta("src-key", map[string]string{"Content-Type": "application/json"})
+	ts.assertObject(defaultBucket, "src-key", nil, "content")
+}
+
+func TestCopyObjectReplaceWithoutMetadata(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.backendPutString(defaultBucket, "object", map[string]string{
+		"Content-Type":   "text/plain",
+		"X-Amz-Meta-One": "1",
+		"X-Amz-Meta-Two": "2",
+	}, "content")
+
+	// A copy to itself with REPLACE and no metadata replaces the user metadata
+	// with the empty set:
+	_, err := svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:            aws.String(defaultBucket),
+		Key:               aws.String("object"),
+		CopySource:        aws.String("/" + defaultBucket + "/object"),
+		MetadataDirective: aws.String("REPLACE"),
+	})
+	ts.OK(err)
+
+	head, err := svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	if len(head.Metadata) != 0 {
+		t.Fatal("unexpected metadata", head.Metadata)
 	}
 
-	if v := obj.Metadata["X-Amz-Meta-Three"]; v != "dst" {
-		t.Fatalf("bad Content-Encoding: %q", v)
+	obj, err := ts.backend.HeadObject(mockR.Context(), defaultBucket, "object")
+	ts.OK(err)
+	for k := range obj.Metadata {
+		if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+			t.Fatal("unexpected metadata", k)
+		}
 	}
+	ts.assertObject(defaultBucket, "object", nil, "content")
 }
 
 func TestCopyObjectWithSpecialChars(t *testing.T) {
@@ -466,45 +933,359 @@ func TestCopyObjectWithSpecialCharsEscapedInvalied(t *testing.T) {
 	}
 }
 
-func TestDeleteBucket(t *testing.T) {
-	t.Run("delete-empty", func(t *testing.T) {
-		ts := newTestServer(t, withoutInitialBuckets())
-		defer ts.Close()
-		svc := ts.s3Client()
+func TestCopyObjectSourceVersion(t *testing.T) {
+	ts := newTestServer(t, withVersioning())
+	defer ts.Close()
+	svc := ts.s3Client()
 
-		ts.backendCreateBucket("test")
-		ts.OKAll(svc.DeleteBucket(&s3.DeleteBucketInput{
-			Bucket: aws.String("test"),
-		}))
-	})
+	put := func(body string) string {
+		out, err := svc.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("object"),
+			Body:   strings.NewReader(body),
+		})
+		ts.OK(err)
+		return aws.StringValue(out.VersionId)
+	}
+	copyVersion := func(version string) (*s3.CopyObjectOutput, error) {
+		return svc.CopyObject(&s3.CopyObjectInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("object"),
+			CopySource: aws.String(defaultBucket + "/object?versionId=" + url.QueryEscape(version)),
+		})
+	}
 
-	t.Run("delete-fails-if-not-empty", func(t *testing.T) {
-		ts := newTestServer(t, withoutInitialBuckets())
-		defer ts.Close()
-		svc := ts.s3Client()
+	old := put("old")
+	put("new")
 
-		ts.backendCreateBucket("test")
-		ts.backendPutString("test", "test", nil, "test")
-		_, err := svc.DeleteBucket(&s3.DeleteBucketInput{
-			Bucket: aws.String("test"),
-		})
-		if !hasErrorCode(err, gofakes3.ErrBucketNotEmpty) {
-			t.Fatal("expected ErrBucketNotEmpty, found", err)
-		}
-	})
-}
+	// Restore the old version by copying it over the current one:
+	out, err := copyVersion(old)
+	ts.OK(err)
+	if aws.StringValue(out.CopySourceVersionId) != old {
+		t.Fatal("unexpected source version", aws.StringValue(out.CopySourceVersionId), "expected", old)
+	}
+	ts.assertObject(defaultBucket, "object", nil, "old")
 
-func TestDeleteMulti(t *testing.T) {
-	deletedKeys := func(rs *s3.DeleteObjectsOutput) []string {
-		deleted := make([]string, len(rs.Deleted))
-		for idx, del := range rs.Deleted {
-			deleted[idx] = *del.Key
-		}
-		sort.Strings(deleted)
-		return deleted
+	if _, err := copyVersion("nope"); !hasErrorCode(err, gofakes3.ErrNoSuchVersion) {
+		t.Fatal("expected NoSuchVersion, found", err)
 	}
 
-	assertDeletedKeys := func(t *testing.T, rs *s3.DeleteObjectsOutput, expected ...string) {
+	del, err := svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	if _, err := copyVersion(aws.StringValue(del.VersionId)); !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+		t.Fatal("expected InvalidRequest for a delete marker, found", err)
+	}
+}
+
+func TestCopyObjectRestoreVersionMetadata(t *testing.T) {
+	ts := newTestServer(t, withVersioning())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	put := func(body string, meta map[string]*string) string {
+		out, err := svc.PutObject(&s3.PutObjectInput{
+			Bucket:      aws.String(defaultBucket),
+			Key:         aws.String("object"),
+			Body:        strings.NewReader(body),
+			ContentType: aws.String("text/" + body),
+			Metadata:    meta,
+		})
+		ts.OK(err)
+		return aws.StringValue(out.VersionId)
+	}
+
+	v1 := put("plain", map[string]*string{"One": aws.String("v1")})
+	put("html", map[string]*string{"One": aws.String("v2"), "Two": aws.String("v2")})
+
+	// Restoring v1 leaves nothing behind from the current version:
+	_, err := svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("object"),
+		CopySource: aws.String(defaultBucket + "/object?versionId=" + url.QueryEscape(v1)),
+	})
+	ts.OK(err)
+
+	head, err := svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	if aws.StringValue(head.ContentType) != "text/plain" {
+		t.Fatal("unexpected Content-Type", aws.StringValue(head.ContentType))
+	}
+	if len(head.Metadata) != 1 || aws.StringValue(head.Metadata["One"]) != "v1" {
+		t.Fatal("unexpected metadata", head.Metadata)
+	}
+
+	// REPLACE with less metadata does not bring the current metadata back
+	// either:
+	_, err = svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:            aws.String(defaultBucket),
+		Key:               aws.String("object"),
+		CopySource:        aws.String(defaultBucket + "/object?versionId=" + url.QueryEscape(v1)),
+		MetadataDirective: aws.String("REPLACE"),
+	})
+	ts.OK(err)
+	head, err = svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	if len(head.Metadata) != 0 {
+		t.Fatal("unexpected metadata", head.Metadata)
+	}
+}
+
+// versionedBackendWithoutCopy hides s3mem's VersionCopyBackend, so GoFakeS3
+// has to copy versions using GetObjectVersion and PutObject.
+type versionedBackendWithoutCopy struct {
+	gofakes3.Backend
+	gofakes3.VersionedBackend
+}
+
+func TestCopyObjectVersionFallback(t *testing.T) {
+	mem := s3mem.New()
+	ts := newTestServer(t, withBackend(&versionedBackendWithoutCopy{mem, mem}))
+	defer ts.Close()
+	ts.OK(mem.SetVersioningConfiguration(defaultBucket, gofakes3.VersioningConfiguration{
+		Status: gofakes3.VersioningEnabled,
+	}))
+	svc := ts.s3Client()
+
+	v1, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(defaultBucket),
+		Key:         aws.String("src"),
+		Body:        strings.NewReader("v1"),
+		ContentType: aws.String("text/plain"),
+		Metadata:    map[string]*string{"One": aws.String("v1")},
+	})
+	ts.OK(err)
+	_, err = svc.PutObject(&s3.PutObjectInput{
+		Bucket:   aws.String(defaultBucket),
+		Key:      aws.String("src"),
+		Body:     strings.NewReader("v2"),
+		Metadata: map[string]*string{"Two": aws.String("v2")},
+	})
+	ts.OK(err)
+
+	out, err := svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("dst"),
+		CopySource: aws.String(defaultBucket + "/src?versionId=" + url.QueryEscape(aws.StringValue(v1.VersionId))),
+	})
+	ts.OK(err)
+	if aws.StringValue(out.VersionId) == "" {
+		t.Fatal("missing version ID")
+	}
+	ts.assertObject(defaultBucket, "dst", nil, "v1")
+
+	head, err := svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("dst"),
+	})
+	ts.OK(err)
+	if aws.StringValue(head.ContentType) != "text/plain" {
+		t.Fatal("unexpected Content-Type", aws.StringValue(head.ContentType))
+	}
+	if len(head.Metadata) != 1 || aws.StringValue(head.Metadata["One"]) != "v1" {
+		t.Fatal("unexpected metadata", head.Metadata)
+	}
+}
+
+func TestCopyObjectVersionID(t *testing.T) {
+	copyObject := func(ts *testServer) *s3.CopyObjectOutput {
+		ts.backendPutString(defaultBucket, "src", nil, "hello")
+		out, err := ts.s3Client().CopyObject(&s3.CopyObjectInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("dst"),
+			CopySource: aws.String(defaultBucket + "/src"),
+		})
+		ts.OK(err)
+		return out
+	}
+
+	t.Run("versioned", func(t *testing.T) {
+		ts := newTestServer(t, withVersioning())
+		defer ts.Close()
+
+		out := copyObject(ts)
+		head, err := ts.s3Client().HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("dst"),
+		})
+		ts.OK(err)
+		if aws.StringValue(out.VersionId) == "" || aws.StringValue(out.VersionId) != aws.StringValue(head.VersionId) {
+			t.Fatal("unexpected version", aws.StringValue(out.VersionId), "expected", aws.StringValue(head.VersionId))
+		}
+	})
+
+	t.Run("unversioned", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+
+		if out := copyObject(ts); out.VersionId != nil {
+			t.Fatal("unexpected version", aws.StringValue(out.VersionId))
+		}
+	})
+}
+
+func TestCopyObjectConditional(t *testing.T) {
+	const (
+		match   = `"5d41402abc4b2a76b9719d911017c592"` // md5("hello")
+		noMatch = `"notTheSameEtag"`
+	)
+	var (
+		modified = defaultDate
+		before   = modified.Add(-time.Hour)
+		after    = modified.Add(time.Hour)
+	)
+	timePtr := func(at time.Time) *time.Time { return &at }
+
+	for idx, tc := range []struct {
+		ifMatch, ifNoneMatch               string
+		ifUnmodifiedSince, ifModifiedSince *time.Time
+		ok                                 bool
+	}{
+		{ok: true},
+
+		{ifMatch: match, ok: true},
+		{ifMatch: noMatch, ok: false},
+		{ifUnmodifiedSince: timePtr(after), ok: true},
+		{ifUnmodifiedSince: timePtr(before), ok: false},
+		{ifNoneMatch: match, ok: false},
+		{ifNoneMatch: noMatch, ok: true},
+		{ifModifiedSince: timePtr(before), ok: true},
+		{ifModifiedSince: timePtr(after), ok: false},
+
+		// If-Match true short-circuits a failing If-Unmodified-Since:
+		{ifMatch: match, ifUnmodifiedSince: timePtr(before), ok: true},
+		{ifMatch: noMatch, ifUnmodifiedSince: timePtr(after), ok: false},
+
+		// If-None-Match false (i.e. the ETag matches) fails even if
+		// If-Modified-Since is true:
+		{ifNoneMatch: match, ifModifiedSince: timePtr(before), ok: false},
+		{ifNoneMatch: noMatch, ifModifiedSince: timePtr(after), ok: true},
+	} {
+		t.Run(fmt.Sprint(idx), func(t *testing.T) {
+			ts := newTestServer(t)
+			defer ts.Close()
+
+			ts.backendPutString(defaultBucket, "src", map[string]string{
+				"Last-Modified": modified.Format(http.TimeFormat),
+			}, "hello")
+
+			input := &s3.CopyObjectInput{
+				Bucket:                      aws.String(defaultBucket),
+				Key:                         aws.String("dst"),
+				CopySource:                  aws.String(defaultBucket + "/src"),
+				CopySourceIfUnmodifiedSince: tc.ifUnmodifiedSince,
+				CopySourceIfModifiedSince:   tc.ifModifiedSince,
+			}
+			if tc.ifMatch != "" {
+				input.CopySourceIfMatch = aws.String(tc.ifMatch)
+			}
+			if tc.ifNoneMatch != "" {
+				input.CopySourceIfNoneMatch = aws.String(tc.ifNoneMatch)
+			}
+			_, err := ts.s3Client().CopyObject(input)
+
+			if tc.ok {
+				ts.OK(err)
+				ts.assertObject(defaultBucket, "dst", nil, "hello")
+			} else {
+				if !hasErrorCode(err, gofakes3.ErrPreconditionFailed) {
+					t.Fatal("expected PreconditionFailed, found", err)
+				}
+				if ts.backendObjectExists(defaultBucket, "dst") {
+					t.Fatal("object copied despite the failed precondition")
+				}
+			}
+		})
+	}
+
+	t.Run("upload-part-copy", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "src", nil, "hello")
+
+		uploadID := ts.createMultipartUpload(defaultBucket, "dst", nil)
+		_, err := ts.s3Client().UploadPartCopy(&s3.UploadPartCopyInput{
+			Bucket:            aws.String(defaultBucket),
+			Key:               aws.String("dst"),
+			UploadId:          aws.String(uploadID),
+			PartNumber:        aws.Int64(1),
+			CopySource:        aws.String(defaultBucket + "/src"),
+			CopySourceIfMatch: aws.String(noMatch),
+		})
+		if !hasErrorCode(err, gofakes3.ErrPreconditionFailed) {
+			t.Fatal("expected PreconditionFailed, found", err)
+		}
+	})
+}
+
+func TestDeleteObjectMissingKey(t *testing.T) {
+	ts := newTestServer(t, withBackend(&backendWithStrictDelete{s3mem.New()}))
+	defer ts.Close()
+	ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+	for _, key := range []string{"foo", "foo", "nope"} {
+		rq, err := http.NewRequest("DELETE", ts.url("/"+defaultBucket+"/"+key), nil)
+		ts.OK(err)
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		rs.Body.Close()
+		if rs.StatusCode != http.StatusNoContent {
+			t.Fatal("expected 204 deleting", key, "found", rs.StatusCode)
+		}
+	}
+
+	if ts.backendObjectExists(defaultBucket, "foo") {
+		t.Fatal("object should have been deleted")
+	}
+}
+
+func TestDeleteBucket(t *testing.T) {
+	t.Run("delete-empty", func(t *testing.T) {
+		ts := newTestServer(t, withoutInitialBuckets())
+		defer ts.Close()
+		svc := ts.s3Client()
+
+		ts.backendCreateBucket("test")
+		ts.OKAll(svc.DeleteBucket(&s3.DeleteBucketInput{
+			Bucket: aws.String("test"),
+		}))
+	})
+
+	t.Run("delete-fails-if-not-empty", func(t *testing.T) {
+		ts := newTestServer(t, withoutInitialBuckets())
+		defer ts.Close()
+		svc := ts.s3Client()
+
+		ts.backendCreateBucket("test")
+		ts.backendPutString("test", "test", nil, "test")
+		_, err := svc.DeleteBucket(&s3.DeleteBucketInput{
+			Bucket: aws.String("test"),
+		})
+		if !hasErrorCode(err, gofakes3.ErrBucketNotEmpty) {
+			t.Fatal("expected ErrBucketNotEmpty, found", err)
+		}
+	})
+}
+
+func TestDeleteMulti(t *testing.T) {
+	deletedKeys := func(rs *s3.DeleteObjectsOutput) []string {
+		deleted := make([]string, len(rs.Deleted))
+		for idx, del := range rs.Deleted {
+			deleted[idx] = *del.Key
+		}
+		sort.Strings(deleted)
+		return deleted
+	}
+
+	assertDeletedKeys := func(t *testing.T, rs *s3.DeleteObjectsOutput, expected ...string) {
 		t.Helper()
 		found := deletedKeys(rs)
 		if !reflect.DeepEqual(found, expected) {
@@ -534,46 +1315,469 @@ func TestDeleteMulti(t *testing.T) {
 		ts.assertLs(defaultBucket, "", nil, []string{"bar", "baz"})
 	})
 
-	t.Run("multiple-files", func(t *testing.T) {
-		ts := newTestServer(t)
+	t.Run("multiple-files", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		svc := ts.s3Client()
+
+		ts.backendPutString(defaultBucket, "foo", nil, "one")
+		ts.backendPutString(defaultBucket, "bar", nil, "two")
+		ts.backendPutString(defaultBucket, "baz", nil, "three")
+
+		rs, err := svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(defaultBucket),
+			Delete: &s3.Delete{
+				Objects: []*s3.ObjectIdentifier{
+					{Key: aws.String("bar")},
+					{Key: aws.String("foo")},
+				},
+			},
+		})
+		ts.OK(err)
+		assertDeletedKeys(t, rs, "bar", "foo")
+		ts.assertLs(defaultBucket, "", nil, []string{"baz"})
+	})
+
+	t.Run("too-many-keys", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		svc := ts.s3Client()
+
+		objects := make([]*s3.ObjectIdentifier, gofakes3.MaxDeleteMultiKeys+1)
+		for idx := range objects {
+			objects[idx] = &s3.ObjectIdentifier{Key: aws.String(fmt.Sprintf("key%d", idx))}
+		}
+		_, err := svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(defaultBucket),
+			Delete: &s3.Delete{Objects: objects},
+		})
+		if !hasErrorCode(err, gofakes3.ErrMalformedXML) {
+			t.Fatal("expected MalformedXML, found", err)
+		}
+	})
+}
+
+func TestDeleteMultiContentMD5(t *testing.T) {
+	const body = `<Delete><Object><Key>foo</Key></Object></Delete>`
+	sum := md5.Sum([]byte(body))
+	validMD5 := base64.StdEncoding.EncodeToString(sum[:])
+	sha := sha256.Sum256([]byte(body))
+	validSHA256 := base64.StdEncoding.EncodeToString(sha[:])
+	wrongMD5 := base64.StdEncoding.EncodeToString(make([]byte, md5.Size))
+
+	for _, tc := range []struct {
+		name      string
+		headers   map[string]string
+		noCheck   bool
+		code      gofakes3.ErrorCode
+		deletedOK bool
+	}{
+		{name: "md5", headers: map[string]string{"Content-MD5": validMD5}, deletedOK: true},
+		{name: "sha256", headers: map[string]string{"x-amz-checksum-sha256": validSHA256}, deletedOK: true},
+		{name: "missing", code: gofakes3.ErrInvalidRequest},
+		{name: "empty", headers: map[string]string{"Content-MD5": ""}, code: gofakes3.ErrInvalidDigest},
+		{name: "wrong-md5", headers: map[string]string{"Content-MD5": wrongMD5}, code: gofakes3.ErrBadDigest},
+		{name: "wrong-sha256", headers: map[string]string{"x-amz-checksum-sha256": base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))}, code: gofakes3.ErrBadDigest},
+		{name: "unchecked", noCheck: true, deletedOK: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t, withFakerOptions(gofakes3.WithIntegrityCheck(!tc.noCheck)))
+			defer ts.Close()
+			ts.backendPutString(defaultBucket, "foo", nil, "one")
+
+			rq, err := http.NewRequest("POST", ts.url("/"+defaultBucket+"?delete"), strings.NewReader(body))
+			ts.OK(err)
+			for k, v := range tc.headers {
+				rq.Header[http.CanonicalHeaderKey(k)] = []string{v}
+			}
+			rs, err := httpClient().Do(rq)
+			ts.OK(err)
+			defer rs.Body.Close()
+			out, err := ioutil.ReadAll(rs.Body)
+			ts.OK(err)
+
+			if tc.code == "" {
+				if rs.StatusCode != http.StatusOK {
+					t.Fatal("unexpected status", rs.StatusCode, string(out))
+				}
+			} else if rs.StatusCode != tc.code.Status() || !strings.Contains(string(out), "<Code>"+string(tc.code)+"</Code>") {
+				t.Fatal("expected", tc.code, "found", rs.StatusCode, string(out))
+			}
+			if ts.backendObjectExists(defaultBucket, "foo") == tc.deletedOK {
+				t.Fatal("unexpected deletion state, deleted:", !tc.deletedOK)
+			}
+		})
+	}
+}
+
+func TestGetBucketLocation(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.backendPutString(defaultBucket, "foo", nil, "one")
+
+	out, err := svc.GetBucketLocation(&s3.GetBucketLocationInput{
+		Bucket: aws.String(defaultBucket),
+	})
+	if err != nil {
+		t.Fatal("get-bucket-location-failed", err)
+	}
+
+	if out.LocationConstraint != nil {
+		t.Fatal("location-constraint-not-empty", *out.LocationConstraint)
+	}
+}
+
+// Some proxies reject responses that are chunked when the size of the body
+// is known in advance, so the Content-Length must be sent for every GET.
+func TestGetObjectResponseOverrides(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	ts.backendPutString(defaultBucket, "foo", map[string]string{
+		"Content-Type":        "text/plain",
+		"Content-Disposition": "inline",
+		"Cache-Control":       "no-cache",
+	}, "hello")
+
+	for idx, tc := range []struct {
+		param, header, value string
+	}{
+		{"response-cache-control", "Cache-Control", "max-age=60"},
+		{"response-content-disposition", "Content-Disposition", `attachment; filename="bar.txt"`},
+		{"response-content-encoding", "Content-Encoding", "br"},
+		{"response-content-language", "Content-Language", "mi"},
+		{"response-content-type", "Content-Type", "application/octet-stream"},
+		{"response-expires", "Expires", "Thu, 01 Dec 1994 16:00:00 GMT"},
+	} {
+		for _, method := range []string{"GET", "HEAD"} {
+			t.Run(fmt.Sprint(idx, method), func(t *testing.T) {
+				query := url.Values{tc.param: {tc.value}}
+				rq, err := http.NewRequest(method, ts.url("/"+defaultBucket+"/foo?"+query.Encode()), nil)
+				ts.OK(err)
+				rs, err := httpClient().Do(rq)
+				ts.OK(err)
+				defer rs.Body.Close()
+				body, err := ioutil.ReadAll(rs.Body)
+				ts.OK(err)
+
+				if rs.StatusCode != http.StatusOK {
+					t.Fatal("unexpected status", rs.StatusCode, string(body))
+				}
+				if v := rs.Header.Get(tc.header); v != tc.value {
+					t.Fatalf("unexpected %s %q, expected %q", tc.header, v, tc.value)
+				}
+				if method == "GET" && string(body) != "hello" {
+					t.Fatal("unexpected body", string(body))
+				}
+			})
+		}
+	}
+
+	// Without overrides, the stored headers are used:
+	rs, err := httpClient().Get(ts.url("/" + defaultBucket + "/foo"))
+	ts.OK(err)
+	rs.Body.Close()
+	if rs.Header.Get("Content-Disposition") != "inline" || rs.Header.Get("Content-Type") != "text/plain" {
+		t.Fatal("unexpected headers", rs.Header)
+	}
+
+	// The SDK sends the overrides as query parameters:
+	svc := ts.s3Client()
+	out, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket:                     aws.String(defaultBucket),
+		Key:                        aws.String("foo"),
+		ResponseContentDisposition: aws.String("attachment"),
+	})
+	ts.OK(err)
+	out.Body.Close()
+	if aws.StringValue(out.ContentDisposition) != "attachment" {
+		t.Fatal("unexpected Content-Disposition", aws.StringValue(out.ContentDisposition))
+	}
+}
+
+func TestObjectContentHeaders(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	headers := map[string]string{
+		"Content-Disposition": `attachment; filename="foo.txt"`,
+		"Content-Encoding":    "identity",
+		"Content-Language":    "mi",
+		"Content-Type":        "text/csv; charset=utf-8",
+	}
+
+	assertHeaders := func(key string, expected map[string]string) {
+		t.Helper()
+		for _, method := range []string{"GET", "HEAD"} {
+			rq, err := http.NewRequest(method, ts.url("/"+defaultBucket+"/"+key), nil)
+			ts.OK(err)
+			rs, err := httpClient().Do(rq)
+			ts.OK(err)
+			rs.Body.Close()
+			for hk, hv := range expected {
+				if v := rs.Header.Get(hk); v != hv {
+					t.Fatalf("%s: unexpected %s %q, expected %q", method, hk, v, hv)
+				}
+			}
+		}
+	}
+
+	put := func(key string, headers map[string]string) {
+		t.Helper()
+		rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/"+key), strings.NewReader("a,b"))
+		ts.OK(err)
+		for hk, hv := range headers {
+			rq.Header.Set(hk, hv)
+		}
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		rs.Body.Close()
+		if rs.StatusCode != http.StatusOK {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+	}
+
+	put("foo", headers)
+	assertHeaders("foo", headers)
+
+	// Without a Content-Type, S3's default is used rather than a sniffed one:
+	put("bar", nil)
+	assertHeaders("bar", map[string]string{"Content-Type": "binary/octet-stream"})
+
+	// Form fields are not canonicalised like headers:
+	rs := postForm(ts, [][2]string{
+		{"key", "baz"},
+		{"content-type", "text/csv"},
+		{"content-disposition", "inline"},
+	}, []byte("a,b"))
+	rs.Body.Close()
+	if rs.StatusCode >= 300 {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	assertHeaders("baz", map[string]string{"Content-Type": "text/csv", "Content-Disposition": "inline"})
+}
+
+func TestUserMetadataCase(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/foo"), strings.NewReader("hello"))
+	ts.OK(err)
+	rq.Header.Set("X-Amz-Meta-Foo", "bar")
+	rq.Header.Add("X-Amz-Meta-Multi", "a")
+	rq.Header.Add("X-Amz-Meta-Multi", "b")
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	rs.Body.Close()
+
+	obj, err := ts.backend.HeadObject(mockR.Context(), defaultBucket, "foo")
+	ts.OK(err)
+	if obj.Metadata["x-amz-meta-foo"] != "bar" || obj.Metadata["x-amz-meta-multi"] != "a,b" {
+		t.Fatal("unexpected metadata", obj.Metadata)
+	}
+
+	// Go's client canonicalises response headers, so the raw response has to
+	// be checked:
+	client := ts.rawClient()
+	for _, method := range []string{"GET", "HEAD"} {
+		rq, err := http.NewRequest(method, client.URL("/"+defaultBucket+"/foo").String(), nil)
+		ts.OK(err)
+		rq.Header.Set("Connection", "close")
+		raw, err := client.SendRaw(rq)
+		ts.OK(err)
+		for _, hdr := range []string{"\r\nx-amz-meta-foo: bar\r\n", "\r\nx-amz-meta-multi: a,b\r\n"} {
+			if !strings.Contains(string(raw), hdr) {
+				t.Fatalf("%s: expected %q in response:\n%s", method, hdr, raw)
+			}
+		}
+	}
+
+	head, err := ts.s3Client().HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+	})
+	ts.OK(err)
+	if aws.StringValue(head.Metadata["Foo"]) != "bar" {
+		t.Fatal("unexpected metadata", head.Metadata)
+	}
+}
+
+// nilHeadContentsBackend returns objects without Contents from HeadObject.
+type nilHeadContentsBackend struct {
+	*s3mem.Backend
+}
+
+func (b nilHeadContentsBackend) HeadObject(ctx context.Context, bucketName, objectName string) (*gofakes3.Object, error) {
+	obj, err := b.Backend.HeadObject(ctx, bucketName, objectName)
+	if obj != nil {
+		obj.Contents.Close()
+		obj.Contents = nil
+	}
+	return obj, err
+}
+
+func TestHeadObjectMatchesGetObject(t *testing.T) {
+	// assertSameHeaders checks that HEAD returns every header that GET does
+	// for the object at path, except those that differ between any two
+	// requests:
+	assertSameHeaders := func(ts *testServer, path string) {
+		t.Helper()
+		headers := map[string]http.Header{}
+		for _, method := range []string{"GET", "HEAD"} {
+			rq, err := http.NewRequest(method, ts.url(path), nil)
+			ts.OK(err)
+			rs, err := httpClient().Do(rq)
+			ts.OK(err)
+			rs.Body.Close()
+			if rs.StatusCode != http.StatusOK {
+				t.Fatal(method, "unexpected status", rs.StatusCode)
+			}
+			for _, hdr := range []string{"Date", "X-Amz-Request-Id", "X-Amz-Id-2"} {
+				rs.Header.Del(hdr)
+			}
+			headers[method] = rs.Header
+		}
+		if !reflect.DeepEqual(headers["GET"], headers["HEAD"]) {
+			t.Fatalf("headers differ:\nGET:  %v\nHEAD: %v", headers["GET"], headers["HEAD"])
+		}
+	}
+
+	putObject := func(ts *testServer) *s3.PutObjectOutput {
+		out, err := ts.s3Client().PutObject(&s3.PutObjectInput{
+			Bucket:             aws.String(defaultBucket),
+			Key:                aws.String("object"),
+			Body:               bytes.NewReader([]byte("hello")),
+			CacheControl:       aws.String("max-age=60"),
+			ContentDisposition: aws.String(`attachment; filename="hello.txt"`),
+			ContentEncoding:    aws.String("identity"),
+			ContentType:        aws.String("text/plain"),
+			StorageClass:       aws.String("STANDARD_IA"),
+			Metadata:           map[string]*string{"Foo": aws.String("bar")},
+		})
+		ts.OK(err)
+		return out
+	}
+
+	t.Run("current", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		putObject(ts)
+		assertSameHeaders(ts, "/"+defaultBucket+"/object")
+	})
+
+	t.Run("version", func(t *testing.T) {
+		ts := newTestServer(t, withVersioning())
+		defer ts.Close()
+		first := putObject(ts)
+		putObject(ts)
+		assertSameHeaders(ts, "/"+defaultBucket+"/object?versionId="+aws.StringValue(first.VersionId))
+	})
+
+	t.Run("nil-contents", func(t *testing.T) {
+		ts := newTestServer(t, withBackend(nilHeadContentsBackend{s3mem.New()}))
 		defer ts.Close()
-		svc := ts.s3Client()
-
-		ts.backendPutString(defaultBucket, "foo", nil, "one")
-		ts.backendPutString(defaultBucket, "bar", nil, "two")
-		ts.backendPutString(defaultBucket, "baz", nil, "three")
-
-		rs, err := svc.DeleteObjects(&s3.DeleteObjectsInput{
-			Bucket: aws.String(defaultBucket),
-			Delete: &s3.Delete{
-				Objects: []*s3.ObjectIdentifier{
-					{Key: aws.String("bar")},
-					{Key: aws.String("foo")},
-				},
-			},
-		})
-		ts.OK(err)
-		assertDeletedKeys(t, rs, "bar", "foo")
-		ts.assertLs(defaultBucket, "", nil, []string{"baz"})
+		putObject(ts)
+		assertSameHeaders(ts, "/"+defaultBucket+"/object")
 	})
 }
 
-func TestGetBucketLocation(t *testing.T) {
+func TestGetObjectLastModified(t *testing.T) {
 	ts := newTestServer(t)
 	defer ts.Close()
-	svc := ts.s3Client()
 
-	ts.backendPutString(defaultBucket, "foo", nil, "one")
+	// Stored without a Last-Modified in the metadata, so the time comes from
+	// the backend:
+	ts.backendPutString(defaultBucket, "backend", nil, "hello")
 
-	out, err := svc.GetBucketLocation(&s3.GetBucketLocationInput{
+	_, err := ts.s3Client().PutObject(&s3.PutObjectInput{
 		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("client"),
+		Body:   bytes.NewReader([]byte("hello")),
 	})
-	if err != nil {
-		t.Fatal("get-bucket-location-failed", err)
+	ts.OK(err)
+
+	for _, key := range []string{"backend", "client"} {
+		for _, method := range []string{"GET", "HEAD"} {
+			rq, err := http.NewRequest(method, ts.url("/"+defaultBucket+"/"+key), nil)
+			ts.OK(err)
+			rs, err := httpClient().Do(rq)
+			ts.OK(err)
+			rs.Body.Close()
+			if lm := rs.Header.Get("Last-Modified"); lm != "Mon, 01 Jan 2018 12:00:00 GMT" {
+				t.Fatal(key, method, "unexpected Last-Modified", lm)
+			}
+		}
 	}
 
-	if out.LocationConstraint != nil {
-		t.Fatal("location-constraint-not-empty", *out.LocationConstraint)
+	// The header is what If-Modified-Since is compared with:
+	out, err := ts.s3Client().GetObject(&s3.GetObjectInput{
+		Bucket:          aws.String(defaultBucket),
+		Key:             aws.String("backend"),
+		IfModifiedSince: aws.Time(defaultDate.Add(-time.Second)),
+	})
+	ts.OK(err)
+	out.Body.Close()
+	if !aws.TimeValue(out.LastModified).Equal(defaultDate) {
+		t.Fatal("unexpected LastModified", out.LastModified)
+	}
+
+	_, err = ts.s3Client().GetObject(&s3.GetObjectInput{
+		Bucket:          aws.String(defaultBucket),
+		Key:             aws.String("backend"),
+		IfModifiedSince: aws.Time(defaultDate),
+	})
+	if !s3HasErrorCode(err, gofakes3.ErrNotModified) {
+		t.Fatal("expected NotModified, found", err)
+	}
+}
+
+func TestGetObjectContentLength(t *testing.T) {
+	for idx, tc := range []struct {
+		size  int
+		meta  map[string]string
+		rnge  string
+		chunk int
+	}{
+		{size: 0},
+		{size: 1024},
+		{size: 1 << 20},
+		{size: 1 << 20, rnge: "bytes=10-", chunk: 1<<20 - 10},
+
+		// A stale Content-Length stored with the object must not be used:
+		{size: 1 << 20, meta: map[string]string{"Content-Length": "5"}},
+	} {
+		t.Run(fmt.Sprint(idx), func(t *testing.T) {
+			ts := newTestServer(t)
+			defer ts.Close()
+			in := randomFileBody(int64(tc.size))
+			ts.backendPutBytes(defaultBucket, "foo", tc.meta, in)
+
+			rq, err := http.NewRequest("GET", ts.url("/"+defaultBucket+"/foo"), nil)
+			ts.OK(err)
+			if tc.rnge != "" {
+				rq.Header.Set("Range", tc.rnge)
+			}
+			rs, err := httpClient().Do(rq)
+			ts.OK(err)
+			defer rs.Body.Close()
+			body, err := ioutil.ReadAll(rs.Body)
+			ts.OK(err)
+
+			expected := tc.size
+			if tc.rnge != "" {
+				expected = tc.chunk
+			}
+			if len(rs.TransferEncoding) != 0 {
+				t.Fatal("unexpected Transfer-Encoding", rs.TransferEncoding)
+			}
+			if cl := rs.Header.Get("Content-Length"); cl != fmt.Sprint(expected) {
+				t.Fatal("unexpected Content-Length", cl)
+			}
+			if len(body) != expected {
+				t.Fatal("unexpected body length", len(body))
+			}
+		})
 	}
 }
 
@@ -641,6 +1845,52 @@ func TestGetObjectRange(t *testing.T) {
 	}
 }
 
+// TestGetObjectRangeProbe checks 'Range: bytes=0-0', which some clients use
+// to find out whether ranges are supported.
+func TestGetObjectRangeProbe(t *testing.T) {
+	for idx, tc := range []struct {
+		size int
+	}{
+		{0}, {1}, {2}, {1024},
+	} {
+		t.Run(fmt.Sprint(idx), func(t *testing.T) {
+			ts := newTestServer(t)
+			defer ts.Close()
+			in := randomFileBody(int64(tc.size))
+			ts.backendPutBytes(defaultBucket, "foo", nil, in)
+
+			rq, err := http.NewRequest("GET", ts.url("/"+defaultBucket+"/foo"), nil)
+			ts.OK(err)
+			rq.Header.Set("Range", "bytes=0-0")
+			rs, err := httpClient().Do(rq)
+			ts.OK(err)
+			defer rs.Body.Close()
+			body, err := ioutil.ReadAll(rs.Body)
+			ts.OK(err)
+
+			if tc.size == 0 {
+				if rs.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+					t.Fatal("expected 416, found", rs.StatusCode)
+				}
+				return
+			}
+
+			if rs.StatusCode != http.StatusPartialContent {
+				t.Fatal("expected 206, found", rs.StatusCode)
+			}
+			if cr := rs.Header.Get("Content-Range"); cr != fmt.Sprintf("bytes 0-0/%d", tc.size) {
+				t.Fatal("unexpected Content-Range", cr)
+			}
+			if cl := rs.Header.Get("Content-Length"); cl != "1" {
+				t.Fatal("unexpected Content-Length", cl)
+			}
+			if !bytes.Equal(body, in[:1]) {
+				t.Fatal("unexpected body", body)
+			}
+		})
+	}
+}
+
 func TestGetObjectRangeInvalid(t *testing.T) {
 	assertRangeInvalid := func(ts *testServer, key string, hdr string) {
 		svc := ts.s3Client()
@@ -672,6 +1922,36 @@ func TestGetObjectRangeInvalid(t *testing.T) {
 	}
 }
 
+func TestGetObjectRangeNotSatisfiable(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	ts.backendPutBytes(defaultBucket, "foo", nil, randomFileBody(1024))
+
+	rq, err := http.NewRequest("GET", ts.url("/"+defaultBucket+"/foo"), nil)
+	ts.OK(err)
+	rq.Header.Set("Range", "bytes=1024-2047")
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatal("expected 416, found", rs.StatusCode)
+	}
+	if cr := rs.Header.Get("Content-Range"); cr != "bytes */1024" {
+		t.Fatal("unexpected Content-Range", cr)
+	}
+
+	var body struct {
+		Code             gofakes3.ErrorCode
+		RangeRequested   string
+		ActualObjectSize int64
+	}
+	ts.OK(xml.NewDecoder(rs.Body).Decode(&body))
+	if body.Code != gofakes3.ErrInvalidRange || body.RangeRequested != "bytes=1024-2047" || body.ActualObjectSize != 1024 {
+		t.Fatal("unexpected error body", body)
+	}
+}
+
 func TestGetObjectIfNoneMatch(t *testing.T) {
 	objectKey := "foo"
 	assertModified := func(ts *testServer, ifNoneMatch string, shouldModify bool) {
@@ -718,6 +1998,294 @@ func TestGetObjectIfNoneMatch(t *testing.T) {
 	}
 }
 
+func TestGetObjectConditionalPrecedence(t *testing.T) {
+	const (
+		match   = `"5d41402abc4b2a76b9719d911017c592"` // md5("hello")
+		noMatch = `"notTheSameEtag"`
+	)
+	var (
+		modified = defaultDate
+		before   = modified.Add(-time.Hour).Format(http.TimeFormat)
+		after    = modified.Add(time.Hour).Format(http.TimeFormat)
+	)
+
+	for idx, tc := range []struct {
+		ifMatch, ifUnmodifiedSince, ifNoneMatch, ifModifiedSince string
+		status                                                   int
+	}{
+		{status: 200},
+
+		{ifMatch: match, status: 200},
+		{ifMatch: noMatch, status: 412},
+		{ifMatch: "*", status: 200},
+		{ifUnmodifiedSince: after, status: 200},
+		{ifUnmodifiedSince: before, status: 412},
+		{ifNoneMatch: match, status: 304},
+		{ifNoneMatch: noMatch, status: 200},
+		{ifNoneMatch: "*", status: 304},
+		{ifModifiedSince: before, status: 200},
+		{ifModifiedSince: after, status: 304},
+
+		// If-Match true short-circuits a failing If-Unmodified-Since:
+		{ifMatch: match, ifUnmodifiedSince: before, status: 200},
+		{ifMatch: noMatch, ifUnmodifiedSince: after, status: 412},
+
+		// If-None-Match false (i.e. the ETag matches) wins over If-Modified-Since:
+		{ifNoneMatch: match, ifModifiedSince: before, status: 304},
+		{ifNoneMatch: noMatch, ifModifiedSince: after, status: 200},
+
+		// If-Match is evaluated before If-None-Match:
+		{ifMatch: noMatch, ifNoneMatch: match, status: 412},
+		{ifMatch: noMatch, ifNoneMatch: noMatch, status: 412},
+		{ifMatch: match, ifNoneMatch: match, status: 304},
+		{ifMatch: match, ifNoneMatch: noMatch, status: 200},
+
+		// If-Unmodified-Since is evaluated before If-None-Match and If-Modified-Since:
+		{ifUnmodifiedSince: before, ifNoneMatch: match, status: 412},
+		{ifUnmodifiedSince: before, ifModifiedSince: after, status: 412},
+		{ifUnmodifiedSince: after, ifModifiedSince: after, status: 304},
+		{ifUnmodifiedSince: after, ifModifiedSince: before, status: 200},
+
+		// All four at once:
+		{ifMatch: match, ifUnmodifiedSince: before, ifNoneMatch: noMatch, ifModifiedSince: after, status: 200},
+		{ifMatch: match, ifUnmodifiedSince: before, ifNoneMatch: match, ifModifiedSince: before, status: 304},
+		{ifMatch: noMatch, ifUnmodifiedSince: after, ifNoneMatch: noMatch, ifModifiedSince: before, status: 412},
+
+		// Invalid dates are ignored:
+		{ifUnmodifiedSince: "nope", status: 200},
+		{ifModifiedSince: "nope", status: 200},
+	} {
+		for _, method := range []string{"GET", "HEAD"} {
+			t.Run(fmt.Sprintf("%d/%s", idx, method), func(t *testing.T) {
+				ts := newTestServer(t)
+				defer ts.Close()
+
+				ts.backendPutString(defaultBucket, "foo", map[string]string{
+					"Last-Modified": modified.Format(http.TimeFormat),
+				}, "hello")
+
+				rq, err := http.NewRequest(method, ts.url("/"+defaultBucket+"/foo"), nil)
+				ts.OK(err)
+				for hdr, v := range map[string]string{
+					"If-Match":            tc.ifMatch,
+					"If-Unmodified-Since": tc.ifUnmodifiedSince,
+					"If-None-Match":       tc.ifNoneMatch,
+					"If-Modified-Since":   tc.ifModifiedSince,
+				} {
+					if v != "" {
+						rq.Header.Set(hdr, v)
+					}
+				}
+
+				rs, err := httpClient().Do(rq)
+				ts.OK(err)
+				defer rs.Body.Close()
+
+				if rs.StatusCode != tc.status {
+					ts.Fatal("unexpected status", rs.StatusCode, "!=", tc.status)
+				}
+			})
+		}
+	}
+}
+
+func TestGetObjectIfRange(t *testing.T) {
+	var (
+		modified = defaultDate
+		before   = modified.Add(-time.Hour).Format(http.TimeFormat)
+		after    = modified.Add(time.Hour).Format(http.TimeFormat)
+	)
+
+	ts := newTestServer(t)
+	defer ts.Close()
+	ts.backendPutString(defaultBucket, "foo", map[string]string{
+		"Last-Modified": modified.Format(http.TimeFormat),
+	}, "hello")
+
+	for idx, tc := range []struct {
+		ifRange string
+		body    string
+	}{
+		{"", "el"},
+		{`"5d41402abc4b2a76b9719d911017c592"`, "el"},
+		{"5d41402abc4b2a76b9719d911017c592", "el"},
+		{`"notTheSameEtag"`, "hello"},
+		{`W/"5d41402abc4b2a76b9719d911017c592"`, "hello"},
+		{modified.Format(http.TimeFormat), "el"},
+		{after, "el"},
+		{before, "hello"},
+	} {
+		t.Run(fmt.Sprint(idx), func(t *testing.T) {
+			rq, err := http.NewRequest("GET", ts.url("/"+defaultBucket+"/foo"), nil)
+			ts.OK(err)
+			rq.Header.Set("Range", "bytes=1-2")
+			if tc.ifRange != "" {
+				rq.Header.Set("If-Range", tc.ifRange)
+			}
+
+			rs, err := httpClient().Do(rq)
+			ts.OK(err)
+			defer rs.Body.Close()
+			body, err := ioutil.ReadAll(rs.Body)
+			ts.OK(err)
+
+			if string(body) != tc.body {
+				t.Fatal("unexpected body", string(body))
+			}
+		})
+	}
+}
+
+func TestCreateObjectConditional(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+	for idx, tc := range []struct {
+		key         string
+		ifMatch     string
+		ifNoneMatch string
+		code        int
+	}{
+		{"foo", "", "*", http.StatusPreconditionFailed},
+		{"new", "", "*", http.StatusOK},
+		{"foo", `"5d41402abc4b2a76b9719d911017c592"`, "", http.StatusOK},
+		{"foo", `"notTheSameEtag"`, "", http.StatusPreconditionFailed},
+		{"missing", `"5d41402abc4b2a76b9719d911017c592"`, "", http.StatusNotFound},
+	} {
+		t.Run(fmt.Sprint(idx), func(t *testing.T) {
+			rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/"+tc.key), strings.NewReader("world"))
+			ts.OK(err)
+			if tc.ifMatch != "" {
+				rq.Header.Set("If-Match", tc.ifMatch)
+			}
+			if tc.ifNoneMatch != "" {
+				rq.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+
+			rs, err := httpClient().Do(rq)
+			ts.OK(err)
+			rs.Body.Close()
+			if rs.StatusCode != tc.code {
+				t.Fatal("unexpected status", rs.StatusCode, "!=", tc.code)
+			}
+		})
+	}
+
+	// The If-Match write above replaced "foo", and the If-None-Match write
+	// created "new":
+	ts.assertObject(defaultBucket, "foo", nil, "world")
+	ts.assertObject(defaultBucket, "new", nil, "world")
+}
+
+func TestCreateObjectConditionalExistingETag(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.OKAll(svc.PutBucketVersioning(&s3.PutBucketVersioningInput{
+		Bucket: aws.String(defaultBucket),
+		VersioningConfiguration: &s3.VersioningConfiguration{
+			Status: aws.String(string(gofakes3.VersioningEnabled)),
+		},
+	}))
+	out, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+		Body:   bytes.NewReader([]byte("hello")),
+	})
+	ts.OK(err)
+
+	rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/foo"), strings.NewReader("world"))
+	ts.OK(err)
+	rq.Header.Set("If-None-Match", "*")
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	rs.Body.Close()
+
+	if rs.StatusCode != http.StatusPreconditionFailed {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	if etag := rs.Header.Get("ETag"); etag != `"5d41402abc4b2a76b9719d911017c592"` {
+		t.Fatal("unexpected ETag", etag)
+	}
+	if vid := rs.Header.Get("x-amz-version-id"); vid == "" || vid != aws.StringValue(out.VersionId) {
+		t.Fatal("unexpected version id", vid, "!=", aws.StringValue(out.VersionId))
+	}
+	ts.assertObject(defaultBucket, "foo", nil, "hello")
+}
+
+func TestCreateObjectWriteOffset(t *testing.T) {
+	putAt := func(ts *testServer, key, offset, body string) *http.Response {
+		t.Helper()
+		rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/"+key), strings.NewReader(body))
+		ts.OK(err)
+		rq.Header.Set("x-amz-write-offset-bytes", offset)
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		rs.Body.Close()
+		return rs
+	}
+
+	t.Run("resume", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "foo", map[string]string{"X-Amz-Meta-Test": "yep"}, "hello")
+
+		rs := putAt(ts, "foo", "5", " world")
+		if rs.StatusCode != http.StatusOK {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+		if etag := rs.Header.Get("ETag"); etag != `"5eb63bbbe01eeed093cb22bb8f5acdc3"` {
+			t.Fatal("unexpected ETag", etag)
+		}
+		ts.assertObject(defaultBucket, "foo", map[string]string{"X-Amz-Meta-Test": "yep"}, "hello world")
+	})
+
+	t.Run("create", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		if rs := putAt(ts, "new", "0", "hello"); rs.StatusCode != http.StatusOK {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+		ts.assertObject(defaultBucket, "new", nil, "hello")
+	})
+
+	t.Run("fails", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+		for idx, tc := range []struct {
+			key, offset string
+			code        gofakes3.ErrorCode
+		}{
+			{"foo", "0", gofakes3.ErrInvalidWriteOffset},
+			{"foo", "4", gofakes3.ErrInvalidWriteOffset},
+			{"foo", "6", gofakes3.ErrInvalidWriteOffset},
+			{"missing", "5", gofakes3.ErrInvalidWriteOffset},
+			{"foo", "-1", gofakes3.ErrInvalidArgument},
+			{"foo", "nope", gofakes3.ErrInvalidArgument},
+		} {
+			if rs := putAt(ts, tc.key, tc.offset, "!"); rs.StatusCode != tc.code.Status() {
+				t.Fatal(idx, "unexpected status", rs.StatusCode, "!=", tc.code.Status())
+			}
+		}
+		ts.assertObject(defaultBucket, "foo", nil, "hello")
+		if ts.backendObjectExists(defaultBucket, "missing") {
+			t.Fatal("unexpected object")
+		}
+	})
+
+	t.Run("not-implemented", func(t *testing.T) {
+		ts := newTestServer(t, withBackend(&backendWithUnimplementedPaging{s3mem.New()}))
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "foo", nil, "hello")
+		if rs := putAt(ts, "foo", "5", "!"); rs.StatusCode != gofakes3.ErrNotImplemented.Status() {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+	})
+}
+
 func TestCreateObjectBrowserUpload(t *testing.T) {
 	addFile := func(tt gofakes3.TT, w *multipart.Writer, object string, b []byte) {
 		tt.Helper()
@@ -803,6 +2371,20 @@ func TestCreateObjectBrowserUpload(t *testing.T) {
 		addFile(ts.TT, w, strings.Repeat("a", gofakes3.KeySizeLimit+1), []byte("yep"))
 		assertUploadFails(ts, defaultBucket, w, &b, gofakes3.ErrKeyTooLong)
 	})
+
+	t.Run("quota-exceeded", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(
+			gofakes3.WithBucketQuota(map[string]int64{defaultBucket: 4}),
+		))
+		defer ts.Close()
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		addFile(ts.TT, w, "yep", []byte("stuff"))
+		assertUploadFails(ts, defaultBucket, w, &b, gofakes3.ErrQuotaExceeded)
+		if ts.backendObjectExists(defaultBucket, "yep") {
+			t.Fatal("object stored despite the quota")
+		}
+	})
 }
 
 func TestVersioning(t *testing.T) {
@@ -1013,39 +2595,202 @@ func TestObjectVersions(t *testing.T) {
 		list(ts, defaultBucket)
 	})
 
-	t.Run("delete-direct", func(t *testing.T) {
+	t.Run("delete-direct", func(t *testing.T) {
+		ts := newTestServer(t, withVersioning())
+		defer ts.Close()
+
+		create(ts, defaultBucket, "object", []byte("body 1"), v1)
+		list(ts, defaultBucket, v1)
+		create(ts, defaultBucket, "object", []byte("body 2"), v2)
+		list(ts, defaultBucket, v1, v2)
+
+		get(ts, defaultBucket, "object", []byte("body 2"), "")
+
+		deleteDirect(ts, defaultBucket, "object", v3)
+		list(ts, defaultBucket, v1, v2, v3)
+
+		svc := ts.s3Client()
+		_, err := svc.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("object"),
+		})
+		if !hasErrorCode(err, gofakes3.ErrNoSuchKey) {
+			ts.Fatal("expected ErrNoSuchKey, found", err)
+		}
+	})
+
+	t.Run("delete-multi", func(t *testing.T) {
+		ts := newTestServer(t, withVersioning())
+		defer ts.Close()
+
+		create(ts, defaultBucket, "object", []byte("body 1"), v1)
+		create(ts, defaultBucket, "object", []byte("body 2"), v2)
+
+		svc := ts.s3Client()
+		rs, err := svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(defaultBucket),
+			Delete: &s3.Delete{
+				Objects: []*s3.ObjectIdentifier{
+					{Key: aws.String("object"), VersionId: aws.String(v1)},
+					{Key: aws.String("object")},
+				},
+			},
+		})
+		ts.OK(err)
+		if len(rs.Errors) != 0 || len(rs.Deleted) != 2 {
+			t.Fatal("unexpected result", rs)
+		}
+
+		for _, deleted := range rs.Deleted {
+			if aws.StringValue(deleted.VersionId) == v1 {
+				if aws.BoolValue(deleted.DeleteMarker) {
+					t.Fatal("unexpected delete marker for deleted version", deleted)
+				}
+			} else if !aws.BoolValue(deleted.DeleteMarker) || aws.StringValue(deleted.DeleteMarkerVersionId) != v3 {
+				t.Fatal("expected delete marker", v3, "found", deleted)
+			}
+		}
+		list(ts, defaultBucket, v2, v3)
+	})
+
+	t.Run("delete-multi-unversioned", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithoutVersioning()))
+		defer ts.Close()
+
+		svc := ts.s3Client()
+		_, err := svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(defaultBucket),
+			Delete: &s3.Delete{
+				Objects: []*s3.ObjectIdentifier{
+					{Key: aws.String("object"), VersionId: aws.String(v1)},
+				},
+			},
+		})
+		if !hasErrorCode(err, gofakes3.ErrNotImplemented) {
+			ts.Fatal("expected ErrNotImplemented, found", err)
+		}
+	})
+
+	t.Run("list-never-versioned", func(t *testing.T) {
 		ts := newTestServer(t, withVersioning())
 		defer ts.Close()
 
-		create(ts, defaultBucket, "object", []byte("body 1"), v1)
-		list(ts, defaultBucket, v1)
-		create(ts, defaultBucket, "object", []byte("body 2"), v2)
-		list(ts, defaultBucket, v1, v2)
+		const neverVerBucket = "neverver"
+		ts.backendCreateBucket(neverVerBucket)
 
-		get(ts, defaultBucket, "object", []byte("body 2"), "")
+		ts.backendPutString(neverVerBucket, "object", nil, "body 1")
+		list(ts, neverVerBucket, "null") // S300005
+	})
 
-		deleteDirect(ts, defaultBucket, "object", v3)
-		list(ts, defaultBucket, v1, v2, v3)
+	// listPages lists every version in the bucket, maxKeys at a time, and
+	// returns the key and version ID of each in the order they were listed.
+	listPages := func(ts *testServer, bucket string, maxKeys int64) (found []string) {
+		ts.Helper()
+		svc := ts.s3Client()
+		input := &s3.ListObjectVersionsInput{
+			Bucket:  aws.String(bucket),
+			MaxKeys: aws.Int64(maxKeys),
+		}
+		for page := 0; ; page++ {
+			if page > 20 {
+				t.Fatal("too many pages")
+			}
+			out, err := svc.ListObjectVersions(input)
+			ts.OK(err)
+			if int64(len(out.Versions)) > maxKeys {
+				t.Fatal("page has more than", maxKeys, "versions:", len(out.Versions))
+			}
+			for _, ver := range out.Versions {
+				found = append(found, aws.StringValue(ver.Key)+"@"+aws.StringValue(ver.VersionId))
+			}
+			if !aws.BoolValue(out.IsTruncated) {
+				return found
+			}
+			input.KeyMarker = out.NextKeyMarker
+			input.VersionIdMarker = out.NextVersionIdMarker
+		}
+	}
+
+	t.Run("list-pages", func(t *testing.T) {
+		ts := newTestServer(t, withVersioning())
+		defer ts.Close()
 
+		// Keys are listed in ascending order, and the versions of each key
+		// from newest to oldest:
 		svc := ts.s3Client()
-		_, err := svc.GetObject(&s3.GetObjectInput{
-			Bucket: aws.String(defaultBucket),
-			Key:    aws.String("object"),
-		})
-		if !hasErrorCode(err, gofakes3.ErrNoSuchKey) {
-			ts.Fatal("expected ErrNoSuchKey, found", err)
+		versions := map[string][]string{}
+		for _, key := range []string{"b", "a", "c", "a", "b", "a"} {
+			out, err := svc.PutObject(&s3.PutObjectInput{
+				Bucket: aws.String(defaultBucket),
+				Key:    aws.String(key),
+				Body:   bytes.NewReader([]byte("body")),
+			})
+			ts.OK(err)
+			versions[key] = append([]string{key + "@" + aws.StringValue(out.VersionId)}, versions[key]...)
+		}
+		var expected []string
+		for _, key := range []string{"a", "b", "c"} {
+			expected = append(expected, versions[key]...)
+		}
+
+		for _, maxKeys := range []int64{1, 2, 4, 6, 10} {
+			if found := listPages(ts, defaultBucket, maxKeys); !reflect.DeepEqual(found, expected) {
+				t.Fatal("max-keys", maxKeys, "versions mismatch. found:", found, "expected:", expected)
+			}
 		}
 	})
 
-	t.Run("list-never-versioned", func(t *testing.T) {
+	t.Run("list-pages-never-versioned", func(t *testing.T) {
 		ts := newTestServer(t, withVersioning())
 		defer ts.Close()
 
 		const neverVerBucket = "neverver"
 		ts.backendCreateBucket(neverVerBucket)
+		ts.backendPutString(neverVerBucket, "a", nil, "body")
+		ts.backendPutString(neverVerBucket, "b", nil, "body")
+		ts.backendPutString(neverVerBucket, "c", nil, "body")
+
+		// The 'null' version-id-marker resumes at the next key:
+		expected := []string{"a@null", "b@null", "c@null"}
+		if found := listPages(ts, neverVerBucket, 2); !reflect.DeepEqual(found, expected) {
+			t.Fatal("versions mismatch. found:", found, "expected:", expected)
+		}
+	})
 
-		ts.backendPutString(neverVerBucket, "object", nil, "body 1")
-		list(ts, neverVerBucket, "null") // S300005
+	t.Run("list-pages-common-prefixes", func(t *testing.T) {
+		ts := newTestServer(t, withVersioning())
+		defer ts.Close()
+		for _, key := range []string{"a", "d/1", "d/2", "e"} {
+			ts.backendPutString(defaultBucket, key, nil, "body")
+		}
+
+		// Common prefixes count towards max-keys, and are not repeated on
+		// the next page:
+		svc := ts.s3Client()
+		input := &s3.ListObjectVersionsInput{
+			Bucket:    aws.String(defaultBucket),
+			Delimiter: aws.String("/"),
+			MaxKeys:   aws.Int64(1),
+		}
+		var found []string
+		for {
+			out, err := svc.ListObjectVersions(input)
+			ts.OK(err)
+			for _, ver := range out.Versions {
+				found = append(found, aws.StringValue(ver.Key))
+			}
+			for _, prefix := range out.CommonPrefixes {
+				found = append(found, aws.StringValue(prefix.Prefix))
+			}
+			if !aws.BoolValue(out.IsTruncated) {
+				break
+			}
+			input.KeyMarker = out.NextKeyMarker
+			input.VersionIdMarker = out.NextVersionIdMarker
+		}
+		if expected := []string{"a", "d/", "e"}; !reflect.DeepEqual(found, expected) {
+			t.Fatal("listing mismatch. found:", found, "expected:", expected)
+		}
 	})
 }
 
@@ -1178,8 +2923,25 @@ func TestListBucketPagesFallback(t *testing.T) {
 		}
 	})
 
+	t.Run("strict", func(t *testing.T) {
+		ts := newTestServer(t,
+			withBackend(&backendWithUnimplementedPaging{s3mem.New()}),
+			withFakerOptions(gofakes3.WithStrictPagination()),
+		)
+		defer ts.Close()
+		createData(ts, "", 5)
+		_, err := ts.listBucketV1Pages(nil, 2, "")
+		if !hasErrorCode(err, gofakes3.ErrNotImplemented) {
+			t.Fatal(err)
+		}
+	})
+
 	t.Run("fallback-enabled", func(t *testing.T) {
-		ts := newTestServer(t, withBackend(&backendWithUnimplementedPaging{s3mem.New()}))
+		var buf bytes.Buffer
+		ts := newTestServer(t,
+			withBackend(&backendWithUnimplementedPaging{s3mem.New()}),
+			withFakerOptions(gofakes3.WithLogger(gofakes3.StdLog(log.New(&buf, "", 0), gofakes3.LogWarn))),
+		)
 		defer ts.Close()
 		createData(ts, "", 5)
 		r := ts.mustListBucketV1Pages(nil, 2, "")
@@ -1188,10 +2950,486 @@ func TestListBucketPagesFallback(t *testing.T) {
 		if len(r.Contents) != 5 {
 			t.Fatal()
 		}
+
+		// The fallback is logged every time it happens:
+		ts.mustListBucketV1Pages(nil, 2, "")
+		if n := strings.Count(buf.String(), "does not implement pagination"); n != 2 {
+			t.Fatal("expected the fallback to be logged twice, found", buf.String())
+		}
+	})
+}
+
+// countingListBackend counts the calls to ListBucket.
+type countingListBackend struct {
+	gofakes3.Backend
+	lists int
+}
+
+func (b *countingListBackend) ListBucket(ctx context.Context, name string, prefix *gofakes3.Prefix, page gofakes3.ListBucketPage) (*gofakes3.ObjectList, error) {
+	b.lists++
+	return b.Backend.ListBucket(ctx, name, prefix, page)
+}
+
+func TestListBucketMaxKeysZero(t *testing.T) {
+	backend := &countingListBackend{Backend: s3mem.New()}
+	ts := newTestServer(t, withBackend(backend))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	for _, key := range []string{"a", "b/c", "d"} {
+		ts.backendPutString(defaultBucket, key, nil, "")
+	}
+
+	for _, delim := range []string{"", "/"} {
+		v1, err := svc.ListObjects(&s3.ListObjectsInput{
+			Bucket:    aws.String(defaultBucket),
+			Delimiter: aws.String(delim),
+			MaxKeys:   aws.Int64(0),
+		})
+		ts.OK(err)
+		if len(v1.Contents) != 0 || len(v1.CommonPrefixes) != 0 || aws.BoolValue(v1.IsTruncated) || aws.Int64Value(v1.MaxKeys) != 0 {
+			t.Fatal("unexpected V1 result", v1)
+		}
+
+		v2, err := svc.ListObjectsV2(&s3.ListObjectsV2Input{
+			Bucket:    aws.String(defaultBucket),
+			Delimiter: aws.String(delim),
+			MaxKeys:   aws.Int64(0),
+		})
+		ts.OK(err)
+		if len(v2.Contents) != 0 || len(v2.CommonPrefixes) != 0 || aws.BoolValue(v2.IsTruncated) ||
+			aws.Int64Value(v2.KeyCount) != 0 || v2.NextContinuationToken != nil {
+			t.Fatal("unexpected V2 result", v2)
+		}
+	}
+
+	if backend.lists != 0 {
+		t.Fatal("expected the backend not to be listed, found", backend.lists, "calls")
+	}
+}
+
+func TestListBucketDelimiters(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	for _, key := range []string{"2020-01-a", "2020-01-b", "2020-02-a", "2021", "x::y::z", "x::y:z", "x/y"} {
+		ts.backendPutString(defaultBucket, key, nil, "")
+	}
+
+	list := func(prefix, delim string) (prefixes, keys []string) {
+		t.Helper()
+		out, err := svc.ListObjectsV2(&s3.ListObjectsV2Input{
+			Bucket:    aws.String(defaultBucket),
+			Prefix:    aws.String(prefix),
+			Delimiter: aws.String(delim),
+		})
+		ts.OK(err)
+		for _, cp := range out.CommonPrefixes {
+			prefixes = append(prefixes, aws.StringValue(cp.Prefix))
+		}
+		for _, c := range out.Contents {
+			keys = append(keys, aws.StringValue(c.Key))
+		}
+		return prefixes, keys
+	}
+
+	for idx, tc := range []struct {
+		prefix, delim string
+		prefixes      []string
+		keys          []string
+	}{
+		{"", "-", []string{"2020-"}, []string{"2021", "x/y", "x::y::z", "x::y:z"}},
+		{"2020-", "-", []string{"2020-01-", "2020-02-"}, nil},
+		{"2020-01-", "-", nil, []string{"2020-01-a", "2020-01-b"}},
+		{"", "::", []string{"x::"}, []string{"2020-01-a", "2020-01-b", "2020-02-a", "2021", "x/y"}},
+		{"x::", "::", []string{"x::y::"}, []string{"x::y:z"}},
+	} {
+		prefixes, keys := list(tc.prefix, tc.delim)
+		if !reflect.DeepEqual(prefixes, tc.prefixes) || !reflect.DeepEqual(keys, tc.keys) {
+			t.Fatal(idx, "unexpected listing", prefixes, keys)
+		}
+	}
+}
+
+func TestListBucketFlatListingBackend(t *testing.T) {
+	ts := newTestServer(t, withBackend(&flatListingBackend{s3mem.New()}))
+	defer ts.Close()
+	for _, key := range []string{"a", "b/1", "b/2", "c/d/e", "c/f", "d"} {
+		ts.backendPutString(defaultBucket, key, nil, "")
+	}
+
+	ts.assertLs(defaultBucket, "", []string{"b/", "c/"}, []string{"a", "d"})
+	ts.assertLs(defaultBucket, "c/", []string{"c/d/"}, []string{"c/f"})
+
+	// Pages are applied after the rollup:
+	prefix := gofakes3.NewFolderPrefix("")
+	r := ts.mustListBucketV2Pages(&prefix, 1, "")
+	if len(r.CommonPrefixes) != 2 || len(r.Contents) != 2 {
+		t.Fatal("unexpected listing", r.CommonPrefixes, r.Contents)
+	}
+}
+
+func TestListBucketV2FetchOwner(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithOwner("owner-id", "owner-name")))
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.backendPutString(defaultBucket, "a", nil, "")
+	ts.backendPutString(defaultBucket, "b", nil, "")
+
+	out, err := svc.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:     aws.String(defaultBucket),
+		FetchOwner: aws.Bool(true),
+	})
+	ts.OK(err)
+	if len(out.Contents) != 2 {
+		t.Fatal("unexpected contents", out.Contents)
+	}
+	for _, c := range out.Contents {
+		if c.Owner == nil || aws.StringValue(c.Owner.ID) != "owner-id" || aws.StringValue(c.Owner.DisplayName) != "owner-name" {
+			t.Fatal("unexpected owner for", aws.StringValue(c.Key), c.Owner)
+		}
+	}
+
+	out, err = svc.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+	for _, c := range out.Contents {
+		if c.Owner != nil {
+			t.Fatal("unexpected owner for", aws.StringValue(c.Key), c.Owner)
+		}
+	}
+
+	// The value of the parameter is a boolean, so neither 'false' nor the
+	// bare key ask for the owner:
+	for _, tc := range []struct {
+		query string
+		owner bool
+	}{
+		{"fetch-owner=true", true},
+		{"fetch-owner=TRUE", true},
+		{"fetch-owner=false", false},
+		{"fetch-owner=False", false},
+		{"fetch-owner", false},
+		{"fetch-owner=", false},
+	} {
+		rs, err := httpClient().Get(ts.url("/" + defaultBucket + "?list-type=2&" + tc.query))
+		ts.OK(err)
+		body, err := ioutil.ReadAll(rs.Body)
+		rs.Body.Close()
+		ts.OK(err)
+		if rs.StatusCode != http.StatusOK {
+			t.Fatal(tc.query, "unexpected status", rs.StatusCode, string(body))
+		}
+		if found := strings.Count(string(body), "<ID>owner-id</ID>"); (tc.owner && found != 2) || (!tc.owner && found != 0) {
+			t.Fatal(tc.query, "unexpected owners", found, string(body))
+		}
+	}
+}
+
+func TestListBucketV2EchoesPaginationFields(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		ts.backendPutString(defaultBucket, key, nil, "")
+	}
+
+	first, err := svc.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:     aws.String(defaultBucket),
+		MaxKeys:    aws.Int64(2),
+		StartAfter: aws.String("a"),
+	})
+	ts.OK(err)
+	if aws.StringValue(first.StartAfter) != "a" || first.ContinuationToken != nil {
+		t.Fatal("unexpected first page", first.StartAfter, first.ContinuationToken)
+	}
+	if aws.Int64Value(first.KeyCount) != 2 || first.NextContinuationToken == nil {
+		t.Fatal("unexpected first page", first.KeyCount, first.NextContinuationToken)
+	}
+
+	// The SDK keeps sending start-after along with the continuation token,
+	// but S3 only echoes the token:
+	second, err := svc.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:            aws.String(defaultBucket),
+		MaxKeys:           aws.Int64(2),
+		StartAfter:        aws.String("a"),
+		ContinuationToken: first.NextContinuationToken,
 	})
+	ts.OK(err)
+	if second.StartAfter != nil {
+		t.Fatal("unexpected StartAfter", aws.StringValue(second.StartAfter))
+	}
+	if aws.StringValue(second.ContinuationToken) != aws.StringValue(first.NextContinuationToken) {
+		t.Fatal("unexpected ContinuationToken", aws.StringValue(second.ContinuationToken))
+	}
+	if aws.Int64Value(second.KeyCount) != 2 || aws.StringValue(second.Contents[0].Key) != "d" {
+		t.Fatal("unexpected second page", second.KeyCount, second.Contents)
+	}
 }
 
 func tryDumpResponse(rs *http.Response, body bool) string {
 	b, _ := httputil.DumpResponse(rs, body)
 	return string(b)
 }
+
+func TestCapabilities(t *testing.T) {
+	caps := gofakes3.Capabilities(s3mem.New())
+	if caps != (gofakes3.BackendCapabilities{Versioned: true, ACL: true, BucketACL: true, Policy: true, ObjectLock: true, CORS: true, Website: true, Notification: true, Encryption: true, RequestPayment: true, Accelerate: true, Resumable: true, Quota: true}) {
+		t.Fatal("unexpected capabilities", caps)
+	}
+
+	caps = gofakes3.Capabilities(&backendWithoutACL{s3mem.New()})
+	if caps != (gofakes3.BackendCapabilities{}) {
+		t.Fatal("unexpected capabilities", caps)
+	}
+
+	caps = gofakes3.Capabilities(&flatListingBackend{&backendWithoutACL{s3mem.New()}})
+	if caps != (gofakes3.BackendCapabilities{FlatListing: true}) || !strings.Contains(caps.String(), "flat-listing=true") {
+		t.Fatal("unexpected capabilities", caps)
+	}
+}
+
+func TestCapabilitiesString(t *testing.T) {
+	// Every field must appear in String, so the startup log shows it:
+	fields := map[string]string{
+		"Versioned":      "versioned",
+		"ACL":            "acl",
+		"BucketACL":      "bucket-acl",
+		"Policy":         "policy",
+		"ObjectLock":     "object-lock",
+		"CORS":           "cors",
+		"Website":        "website",
+		"Notification":   "notification",
+		"Encryption":     "encryption",
+		"RequestPayment": "request-payment",
+		"Accelerate":     "accelerate",
+		"FlatListing":    "flat-listing",
+		"Resumable":      "resumable",
+		"Quota":          "quota",
+	}
+
+	typ := reflect.TypeOf(gofakes3.BackendCapabilities{})
+	if typ.NumField() != len(fields) {
+		t.Fatal("BackendCapabilities has", typ.NumField(), "fields, but the test knows", len(fields))
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i).Name
+		name, ok := fields[field]
+		if !ok {
+			t.Fatal("no name for field", field)
+		}
+
+		var caps gofakes3.BackendCapabilities
+		reflect.ValueOf(&caps).Elem().Field(i).SetBool(true)
+		str := caps.String()
+		if !strings.Contains(" "+str, " "+name+"=true") || strings.Count(str, "=true") != 1 || strings.Count(str, "=") != len(fields) {
+			t.Fatalf("%s: unexpected string %q", field, str)
+		}
+	}
+}
+
+type contextRecordingBackend struct {
+	gofakes3.Backend
+	ctx context.Context
+}
+
+func (b *contextRecordingBackend) PutObject(ctx context.Context, bucketName, key string, meta map[string]string, input io.Reader, size int64) (gofakes3.PutObjectResult, error) {
+	b.ctx = ctx
+	return b.Backend.PutObject(ctx, bucketName, key, meta, input, size)
+}
+
+func TestRequestContext(t *testing.T) {
+	backend := &contextRecordingBackend{Backend: s3mem.New()}
+	ts := newTestServer(t, withBackend(backend))
+	defer ts.Close()
+
+	client := ts.rawClient()
+	body := []byte("hello")
+	rq := client.Request("PUT", "/"+defaultBucket+"/dir/key", body)
+	rs, err := client.Do(rq)
+	ts.OK(err)
+	rs.Body.Close()
+
+	if backend.ctx == nil {
+		t.Fatal("PutObject not called")
+	}
+	if bucket := gofakes3.BucketFromContext(backend.ctx); bucket != defaultBucket {
+		t.Fatal("unexpected bucket", bucket)
+	}
+	if object := gofakes3.ObjectFromContext(backend.ctx); object != "dir/key" {
+		t.Fatal("unexpected object", object)
+	}
+	if op := gofakes3.OperationFromContext(backend.ctx); op != gofakes3.OpPutObject {
+		t.Fatal("unexpected operation", op)
+	}
+	if id := gofakes3.RequestIDFromContext(backend.ctx); id == "" || id != rs.Header.Get("x-amz-request-id") {
+		t.Fatal("unexpected request id", id, rs.Header.Get("x-amz-request-id"))
+	}
+
+	if op := gofakes3.OperationFromContext(context.Background()); op != gofakes3.OpUnknown {
+		t.Fatal("unexpected operation", op)
+	}
+}
+
+func TestStorageClass(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	assertStorageClass := func(key string, expected string) {
+		t.Helper()
+		head, err := svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(defaultBucket), Key: aws.String(key)})
+		ts.OK(err)
+		if aws.StringValue(head.StorageClass) != expected {
+			t.Fatal("unexpected storage class for", key, aws.StringValue(head.StorageClass))
+		}
+
+		list, err := svc.ListObjects(&s3.ListObjectsInput{Bucket: aws.String(defaultBucket), Prefix: aws.String(key)})
+		ts.OK(err)
+		if len(list.Contents) != 1 || aws.StringValue(list.Contents[0].StorageClass) != expected {
+			t.Fatal("unexpected listing for", key, list.Contents)
+		}
+	}
+
+	ts.OKAll(svc.PutObject(&s3.PutObjectInput{
+		Bucket:       aws.String(defaultBucket),
+		Key:          aws.String("infrequent"),
+		Body:         bytes.NewReader([]byte("hello")),
+		StorageClass: aws.String(s3.StorageClassStandardIa),
+	}))
+	assertStorageClass("infrequent", "STANDARD_IA")
+
+	ts.OKAll(svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:       aws.String(defaultBucket),
+		Key:          aws.String("archived"),
+		CopySource:   aws.String(defaultBucket + "/infrequent"),
+		StorageClass: aws.String(s3.StorageClassGlacier),
+	}))
+	assertStorageClass("archived", "GLACIER")
+
+	// Copying an object to itself is permitted if the storage class changes:
+	ts.OKAll(svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:       aws.String(defaultBucket),
+		Key:          aws.String("infrequent"),
+		CopySource:   aws.String(defaultBucket + "/infrequent"),
+		StorageClass: aws.String(s3.StorageClassDeepArchive),
+	}))
+	assertStorageClass("infrequent", "DEEP_ARCHIVE")
+
+	_, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket:       aws.String(defaultBucket),
+		Key:          aws.String("nope"),
+		Body:         bytes.NewReader([]byte("hello")),
+		StorageClass: aws.String("NOPE"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidStorageClass) {
+		t.Fatal("expected InvalidStorageClass, found", err)
+	}
+}
+
+// TestResponseNamespaces checks the responses of GoFakeS3 against the
+// responses in testdata/responses. These are not captured from S3: they are
+// the example responses from the Amazon S3 API reference, with the namespace
+// S3 sends added to the root element where an example leaves it out.
+//
+// The root element and its namespace must match the response from S3, and
+// every element in the response from GoFakeS3 must also be in the response
+// from S3, in the same namespace. The values are not compared.
+func TestResponseNamespaces(t *testing.T) {
+	ts := newTestServer(t, withVersioning(), withFakerOptions(gofakes3.WithMinPartSize(1)))
+	defer ts.Close()
+
+	ts.backendPutString(defaultBucket, "src", nil, "hello")
+	uploadID := ts.createMultipartUpload(defaultBucket, "multi", nil)
+	part := ts.uploadPart(defaultBucket, "multi", uploadID, 1, []byte("hello"))
+
+	copySource := http.Header{"X-Amz-Copy-Source": {"/" + defaultBucket + "/src"}}
+	completeBody := `<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>` + aws.StringValue(part.ETag) + `</ETag></Part></CompleteMultipartUpload>`
+	deleteBody := `<Delete><Object><Key>src</Key></Object></Delete>`
+	deleteHeader := http.Header{"Content-MD5": {hashMD5Bytes([]byte(deleteBody)).Base64()}}
+
+	// The requests are made in order, against the same server:
+	for _, tc := range []struct {
+		file   string
+		method string
+		path   string
+		header http.Header
+		body   string
+	}{
+		{"InitiateMultipartUpload.xml", "POST", "/multi?uploads", nil, ""},
+		{"ListMultipartUploads.xml", "GET", "?uploads", nil, ""},
+		{"ListParts.xml", "GET", "/multi?uploadId=" + uploadID, nil, ""},
+		{"UploadPartCopy.xml", "PUT", "/multi?partNumber=2&uploadId=" + uploadID, copySource, ""},
+		{"CompleteMultipartUpload.xml", "POST", "/multi?uploadId=" + uploadID, nil, completeBody},
+		{"CopyObject.xml", "PUT", "/copy", copySource, ""},
+		{"GetBucketVersioning.xml", "GET", "?versioning", nil, ""},
+		{"DeleteObjects.xml", "POST", "?delete", deleteHeader, deleteBody},
+		{"Error.xml", "GET", "/missing", nil, ""},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			golden, err := ioutil.ReadFile(filepath.Join("testdata", "responses", tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rq, err := http.NewRequest(tc.method, ts.url("/"+defaultBucket+tc.path), strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tc.header {
+				rq.Header[k] = v
+			}
+			rs, err := httpClient().Do(rq)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+			out, err := ioutil.ReadAll(rs.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenRoot, goldenPaths := xmlElementPaths(t, golden)
+			root, paths := xmlElementPaths(t, out)
+			if root != goldenRoot {
+				t.Fatalf("root element is %v, expected %v:\n%s", root, goldenRoot, out)
+			}
+			for path := range paths {
+				if !goldenPaths[path] {
+					t.Fatalf("%s is not in the response from S3:\n%s", path, out)
+				}
+			}
+		})
+	}
+}
+
+// xmlElementPaths returns the root element of doc, and the path to every
+// element below it. Each element in a path is prefixed with its namespace.
+func xmlElementPaths(t *testing.T, doc []byte) (root xml.Name, paths map[string]bool) {
+	t.Helper()
+
+	var path []string
+	paths = map[string]bool{}
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return root, paths
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if root.Local == "" {
+				root = tok.Name
+			} else {
+				path = append(path, "{"+tok.Name.Space+"}"+tok.Name.Local)
+				paths[strings.Join(path, "/")] = true
+			}
+		case xml.EndElement:
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+	}
+}
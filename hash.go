@@ -7,18 +7,31 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"net/http"
 )
 
 // hashingReader proxies an existing io.Reader, passing each read block to the
-// given hash.Hash.
+// given hash.Hash, and to the hashes of any checksums added with
+// addChecksum, so the body only needs to be read once.
 //
 // If the expected hash is not empty, once the underlying reader returns EOF,
-// the hash is checked.
+// the hash is checked. So are the expected values of the checksums.
 type hashingReader struct {
 	inner    io.Reader
 	expected []byte
 	hash     hash.Hash
 	sum      []byte
+
+	checksums []*readerChecksum
+	writer    io.Writer
+}
+
+type readerChecksum struct {
+	alg      ChecksumAlgorithm
+	hash     hash.Hash
+	expected string
+	trailer  http.Header
+	sum      string
 }
 
 func newHashingReader(inner io.Reader, expectedMD5Base64 string) (*hashingReader, error) {
@@ -35,13 +48,57 @@ func newHashingReader(inner io.Reader, expectedMD5Base64 string) (*hashingReader
 		}
 	}
 
+	md5Hash := md5.New()
 	return &hashingReader{
 		inner:    inner,
 		expected: md5Bytes,
-		hash:     md5.New(),
+		hash:     md5Hash,
+		writer:   md5Hash,
 	}, nil
 }
 
+// addChecksum calculates a checksum using alg as the body is read. If
+// expected is not empty, it is compared with the checksum at EOF, and
+// ErrBadDigest is returned if they differ.
+func (h *hashingReader) addChecksum(alg ChecksumAlgorithm, expected string) {
+	h.checksum(alg).expected = expected
+}
+
+// addTrailerChecksum is like addChecksum, but the expected checksum is read
+// from trailer at EOF. trailer is filled in by a chunkedReader as the final
+// chunk is read.
+func (h *hashingReader) addTrailerChecksum(alg ChecksumAlgorithm, trailer http.Header) {
+	h.checksum(alg).trailer = trailer
+}
+
+func (h *hashingReader) checksum(alg ChecksumAlgorithm) *readerChecksum {
+	for _, cs := range h.checksums {
+		if cs.alg == alg {
+			return cs
+		}
+	}
+
+	cs := &readerChecksum{alg: alg, hash: alg.newHash()}
+	h.checksums = append(h.checksums, cs)
+
+	writers := []io.Writer{h.hash}
+	for _, cs := range h.checksums {
+		writers = append(writers, cs.hash)
+	}
+	h.writer = io.MultiWriter(writers...)
+	return cs
+}
+
+// Checksums returns the base64 encoded checksums added with addChecksum,
+// once the inner reader has returned EOF.
+func (h *hashingReader) Checksums() map[ChecksumAlgorithm]string {
+	sums := make(map[ChecksumAlgorithm]string, len(h.checksums))
+	for _, cs := range h.checksums {
+		sums[cs.alg] = cs.sum
+	}
+	return sums
+}
+
 // Sum returns the hash of the data read from the inner reader so far.
 // If into is passed, it may be used if the hash needs to be computed.
 func (h *hashingReader) Sum(into []byte) []byte {
@@ -55,7 +112,7 @@ func (h *hashingReader) Read(p []byte) (n int, err error) {
 	n, err = h.inner.Read(p)
 
 	if n != 0 {
-		wn, _ := h.hash.Write(p[:n]) // Hash.Write never returns an error.
+		wn, _ := h.writer.Write(p[:n]) // Hash.Write never returns an error.
 		if wn != n {
 			return n, fmt.Errorf("short write to hasher")
 		}
@@ -70,6 +127,16 @@ func (h *hashingReader) Read(p []byte) (n int, err error) {
 				// what S3 responds with in this case.
 				return n, ErrBadDigest
 			}
+
+			for _, cs := range h.checksums {
+				cs.sum = base64.StdEncoding.EncodeToString(cs.hash.Sum(nil))
+				if cs.expected == "" && cs.trailer != nil {
+					cs.expected = cs.trailer.Get(cs.alg.Header())
+				}
+				if cs.expected != "" && cs.sum != cs.expected {
+					return n, ErrorMessagef(ErrBadDigest, "The %s you specified did not match the calculated checksum.", cs.alg)
+				}
+			}
 		}
 		return n, err
 	}
@@ -732,6 +732,7 @@ func (ts *testServer) listBucketV2Pages(prefix *gofakes3.Prefix, maxKeys int64,
 
 func (ts *testServer) Close() {
 	ts.server.Close()
+	ts.OK(ts.GoFakeS3.Close())
 }
 
 func hashMD5Bytes(body []byte) hashValue {
@@ -829,6 +830,19 @@ func httpClient() *http.Client {
 	}
 }
 
+// flatListingBackend ignores the delimiter when listing, leaving GoFakeS3 to
+// compute the CommonPrefixes.
+type flatListingBackend struct {
+	gofakes3.Backend
+}
+
+func (b *flatListingBackend) FlatListing() bool { return true }
+
+func (b *flatListingBackend) ListBucket(ctx context.Context, name string, prefix *gofakes3.Prefix, page gofakes3.ListBucketPage) (*gofakes3.ObjectList, error) {
+	flat := gofakes3.Prefix{HasPrefix: prefix.HasPrefix, Prefix: prefix.Prefix}
+	return b.Backend.ListBucket(ctx, name, &flat, page)
+}
+
 type backendWithUnimplementedPaging struct {
 	gofakes3.Backend
 }
@@ -840,6 +854,20 @@ func (b *backendWithUnimplementedPaging) ListBucket(ctx context.Context, name st
 	return b.Backend.ListBucket(mockR.Context(), name, prefix, page)
 }
 
+// backendWithStrictDelete reports missing keys on delete, which s3mem does
+// not do.
+type backendWithStrictDelete struct {
+	gofakes3.Backend
+}
+
+func (b *backendWithStrictDelete) DeleteObject(ctx context.Context, name, objectName string) (gofakes3.ObjectDeleteResult, error) {
+	obj, err := b.Backend.HeadObject(ctx, name, objectName)
+	if err != nil {
+		return gofakes3.ObjectDeleteResult{}, err
+	}
+	return b.Backend.DeleteObject(ctx, name, obj.Name)
+}
+
 type rawClient struct {
 	client *http.Client
 	base   *url.URL
@@ -0,0 +1,87 @@
+package gofakes3
+
+import (
+	"net/http"
+	"time"
+
+	xml "github.com/oneclickvirt/gofakes3/xml"
+)
+
+// completeMultipartUploadKeepAlive runs finishMultipartUpload in the
+// background, writing a space to the response every g.completeKeepAlive until
+// it is done. If it finishes before the first space is due, the response is
+// the same as without the keep-alive.
+func (g *GoFakeS3) completeMultipartUploadKeepAlive(bucket, object string, uploadID UploadID, in *CompleteMultipartUploadRequest, w http.ResponseWriter, r *http.Request) error {
+	type outcome struct {
+		done *completedUpload
+		err  error
+	}
+	result := make(chan outcome, 1)
+	go func() {
+		done, err := g.finishMultipartUpload(bucket, object, uploadID, in, r)
+		result <- outcome{done, err}
+	}()
+
+	ticker := time.NewTicker(g.completeKeepAlive)
+	defer ticker.Stop()
+
+	flusher, _ := w.(http.Flusher)
+	started := false
+
+	for {
+		select {
+		case res := <-result:
+			if !started {
+				if res.err != nil {
+					return res.err
+				}
+				if res.done.versionID != "" {
+					w.Header().Set("x-amz-version-id", string(res.done.versionID))
+				}
+				g.emitCompletedUpload(w, r, res.done)
+				return g.xmlEncoder(w).Encode(res.done.out)
+			}
+
+			// The 200 status and the XML declaration have already been
+			// sent, so errors have to go in the body:
+			var out interface{}
+			if res.err != nil {
+				resp := ensureErrorResponse(res.err, RequestIDFromContext(r.Context()))
+				if resp.ErrorCode() == ErrInternal {
+					g.log.Print(LogErr, res.err)
+				}
+				out = resp
+			} else {
+				g.emitCompletedUpload(w, r, res.done)
+				out = res.done.out
+			}
+			xe := xml.NewEncoder(w)
+			xe.Indent("", "  ")
+			if err := xe.Encode(out); err != nil {
+				g.log.Print(LogErr, err)
+			}
+			return nil
+
+		case <-ticker.C:
+			if !started {
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write([]byte(xml.Header))
+				started = true
+			}
+			if _, err := w.Write([]byte(" ")); err != nil {
+				// The client has gone; the upload still completes, but there
+				// is nobody to tell:
+				if res := <-result; res.err != nil {
+					g.log.Print(LogErr, res.err)
+				} else {
+					g.emitCompletedUpload(w, r, res.done)
+				}
+				return nil
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -54,6 +54,13 @@ const (
 //			panic("unknown level")
 //		}
 //	}
+//
+// Every request is logged once at LogInfo with its Operation as the first
+// value, so a Logger can filter by operation using a type assertion:
+//
+//	if op, ok := v[0].(gofakes3.Operation); ok && op == gofakes3.OpPutObject {
+//		...
+//	}
 type Logger interface {
 	Print(level LogLevel, v ...interface{})
 }
@@ -17,8 +17,20 @@ type Storage struct {
 }
 
 type UserInfo struct {
-	ID          string `xml:"ID"`
-	DisplayName string `xml:"DisplayName"`
+	ID string `xml:"ID"`
+
+	// DisplayName is omitted from responses if empty, as some S3-compatible
+	// services do not populate it.
+	DisplayName string `xml:"DisplayName,omitempty"`
+}
+
+// DefaultOwner returns the user reported as the owner of all buckets and
+// objects unless WithOwner or WithOwnerDisplayName is used.
+func DefaultOwner() UserInfo {
+	return UserInfo{
+		ID:          "fe7272ea58be830e56fe1663b10fafef",
+		DisplayName: "GoFakeS3",
+	}
 }
 
 type Buckets []BucketInfo
@@ -51,30 +63,81 @@ type CommonPrefix struct {
 type CompletedPart struct {
 	PartNumber int    `xml:"PartNumber"`
 	ETag       string `xml:"ETag"`
+	Checksums
 }
 
 type CompleteMultipartUploadRequest struct {
 	Parts []CompletedPart `xml:"Part"`
 }
 
-func (c CompleteMultipartUploadRequest) partsAreSorted() bool {
-	return sort.IntsAreSorted(c.partIDs())
+// firstUnsortedPart returns the index of the first part whose number is not
+// strictly greater than the part before it, or -1 if the parts are in
+// ascending order with no duplicates.
+func (c CompleteMultipartUploadRequest) firstUnsortedPart() int {
+	for i := 1; i < len(c.Parts); i++ {
+		if c.Parts[i].PartNumber <= c.Parts[i-1].PartNumber {
+			return i
+		}
+	}
+	return -1
 }
 
-func (c CompleteMultipartUploadRequest) partIDs() []int {
-	inParts := make([]int, 0, len(c.Parts))
-	for _, inputPart := range c.Parts {
-		inParts = append(inParts, inputPart.PartNumber)
+type CompleteMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr,omitempty"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+	Checksums
+}
+
+// PostResponse is returned by a browser-based POST upload when the form's
+// 'success_action_status' field is 201.
+type PostResponse struct {
+	XMLName  xml.Name `xml:"PostResponse"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// Checksums holds the additional checksums that may accompany an object or
+// part. At most one of these is expected to be set, matching the
+// ChecksumAlgorithm in use.
+type Checksums struct {
+	ChecksumCRC32  string `xml:"ChecksumCRC32,omitempty"`
+	ChecksumCRC32C string `xml:"ChecksumCRC32C,omitempty"`
+	ChecksumSHA1   string `xml:"ChecksumSHA1,omitempty"`
+	ChecksumSHA256 string `xml:"ChecksumSHA256,omitempty"`
+}
+
+func (c *Checksums) Get(alg ChecksumAlgorithm) string {
+	switch alg {
+	case ChecksumCRC32:
+		return c.ChecksumCRC32
+	case ChecksumCRC32C:
+		return c.ChecksumCRC32C
+	case ChecksumSHA1:
+		return c.ChecksumSHA1
+	case ChecksumSHA256:
+		return c.ChecksumSHA256
+	default:
+		return ""
 	}
-	sort.Ints(inParts)
-	return inParts
 }
 
-type CompleteMultipartUploadResult struct {
-	Location string `xml:"Location"`
-	Bucket   string `xml:"Bucket"`
-	Key      string `xml:"Key"`
-	ETag     string `xml:"ETag"`
+func (c *Checksums) Set(alg ChecksumAlgorithm, value string) {
+	switch alg {
+	case ChecksumCRC32:
+		c.ChecksumCRC32 = value
+	case ChecksumCRC32C:
+		c.ChecksumCRC32C = value
+	case ChecksumSHA1:
+		c.ChecksumSHA1 = value
+	case ChecksumSHA256:
+		c.ChecksumSHA256 = value
+	}
 }
 
 type Content struct {
@@ -120,6 +183,7 @@ type DeleteRequest struct {
 // MultiDeleteResult contains the response from a multi delete operation.
 type MultiDeleteResult struct {
 	XMLName xml.Name      `xml:"DeleteResult"`
+	Xmlns   string        `xml:"xmlns,attr,omitempty"`
 	Deleted []ObjectID    `xml:"Deleted"`
 	Error   []ErrorResult `xml:",omitempty"`
 }
@@ -138,6 +202,7 @@ func (d MultiDeleteResult) AsError() error {
 type ErrorResult struct {
 	XMLName   xml.Name  `xml:"Error"`
 	Key       string    `xml:"Key,omitempty"`
+	VersionID string    `xml:"VersionId,omitempty"`
 	Code      ErrorCode `xml:"Code,omitempty"`
 	Message   string    `xml:"Message,omitempty"`
 	Resource  string    `xml:"Resource,omitempty"`
@@ -160,7 +225,7 @@ func ErrorResultFromError(err error) ErrorResult {
 			Code:      err.Code,
 		}
 	case Error:
-		return ErrorResult{Code: err.ErrorCode()}
+		return ErrorResult{Code: err.ErrorCode(), Message: err.ErrorCode().Message()}
 	default:
 		return ErrorResult{Code: ErrInternal}
 	}
@@ -171,6 +236,8 @@ func (er ErrorResult) String() string {
 }
 
 type InitiateMultipartUpload struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr,omitempty"`
 	Bucket   string   `xml:"Bucket"`
 	Key      string   `xml:"Key"`
 	UploadID UploadID `xml:"UploadId"`
@@ -229,6 +296,8 @@ type ListBucketResult struct {
 	// truncated, you can use the value of the last Key in the response as the
 	// marker in the subsequent request to get the next set of object keys.
 	NextMarker string `xml:"NextMarker,omitempty"`
+
+	EncodingType string `xml:"EncodingType,omitempty"`
 }
 
 type ListBucketResultV2 struct {
@@ -265,6 +334,7 @@ var _ VersionItem = &DeleteMarker{}
 
 func (d DeleteMarker) GetVersionID() VersionID   { return d.VersionID }
 func (d *DeleteMarker) setVersionID(i VersionID) { d.VersionID = i }
+func (d DeleteMarker) key() string               { return d.Key }
 
 type Version struct {
 	XMLName      xml.Name    `xml:"Version"`
@@ -285,10 +355,12 @@ var _ VersionItem = &Version{}
 
 func (v Version) GetVersionID() VersionID   { return v.VersionID }
 func (v *Version) setVersionID(i VersionID) { v.VersionID = i }
+func (v Version) key() string               { return v.Key }
 
 type VersionItem interface {
 	GetVersionID() VersionID
 	setVersionID(v VersionID)
+	key() string
 }
 
 type ListBucketVersionsResult struct {
@@ -319,6 +391,8 @@ type ListBucketVersionsResult struct {
 	// request parameter in a subsequent request.
 	NextVersionIDMarker VersionID `xml:"NextVersionIdMarker,omitempty"`
 
+	EncodingType string `xml:"EncodingType,omitempty"`
+
 	// AWS responds with a list of either <Version> or <DeleteMarker> objects. The order
 	// needs to be preserved and they need to be direct of ListBucketVersionsResult:
 	//	<ListBucketVersionsResult>
@@ -368,7 +442,9 @@ func (b *ListBucketVersionsResult) AddPrefix(prefix string) {
 }
 
 type ListMultipartUploadsResult struct {
-	Bucket string `xml:"Bucket"`
+	XMLName xml.Name `xml:"ListMultipartUploadsResult"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Bucket  string   `xml:"Bucket"`
 
 	// Together with upload-id-marker, this parameter specifies the multipart upload
 	// after which listing should begin.
@@ -395,6 +471,7 @@ type ListMultipartUploadsResult struct {
 
 	CommonPrefixes []CommonPrefix `xml:"CommonPrefixes,omitempty"`
 	IsTruncated    bool           `xml:"IsTruncated,omitempty"`
+	EncodingType   string         `xml:"EncodingType,omitempty"`
 
 	Uploads []ListMultipartUploadItem `xml:"Upload"`
 }
@@ -410,6 +487,7 @@ type ListMultipartUploadItem struct {
 
 type ListMultipartUploadPartsResult struct {
 	XMLName xml.Name `xml:"ListPartsResult"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
 
 	Bucket               string       `xml:"Bucket"`
 	Key                  string       `xml:"Key"`
@@ -421,6 +499,7 @@ type ListMultipartUploadPartsResult struct {
 	NextPartNumberMarker int          `xml:"NextPartNumberMarker"`
 	MaxParts             int64        `xml:"MaxParts"`
 	IsTruncated          bool         `xml:"IsTruncated,omitempty"`
+	EncodingType         string       `xml:"EncodingType,omitempty"`
 
 	Parts []ListMultipartUploadPartItem `xml:"Part"`
 }
@@ -430,13 +509,29 @@ type ListMultipartUploadPartItem struct {
 	LastModified ContentTime `xml:"LastModified,omitempty"`
 	ETag         string      `xml:"ETag,omitempty"`
 	Size         int64       `xml:"Size"`
+	Checksums
 }
 
 // CopyObjectResult contains the response from a CopyObject operation.
 type CopyObjectResult struct {
 	XMLName      xml.Name    `xml:"CopyObjectResult"`
+	Xmlns        string      `xml:"xmlns,attr,omitempty"`
 	ETag         string      `xml:"ETag,omitempty"`
 	LastModified ContentTime `xml:"LastModified,omitempty"`
+
+	// VersionID is the version of the new object, if the destination bucket
+	// is versioned. It is sent in the 'x-amz-version-id' header rather than
+	// the body.
+	VersionID VersionID `xml:"-"`
+}
+
+// CopyPartResult contains the response from an UploadPartCopy operation.
+type CopyPartResult struct {
+	XMLName      xml.Name    `xml:"CopyPartResult"`
+	Xmlns        string      `xml:"xmlns,attr,omitempty"`
+	ETag         string      `xml:"ETag,omitempty"`
+	LastModified ContentTime `xml:"LastModified,omitempty"`
+	Checksums
 }
 
 // MFADeleteStatus is used by VersioningConfiguration.
@@ -467,11 +562,17 @@ const (
 	MFADeleteDisabled MFADeleteStatus = "Disabled"
 )
 
+// ObjectID identifies an object, or an object version, in a DeleteObjects
+// request. It is also used for the objects reported as deleted in the
+// response.
 type ObjectID struct {
-	Key string `xml:"Key"`
-
-	// Versions not supported in GoFakeS3 yet.
+	Key       string `xml:"Key"`
 	VersionID string `xml:"VersionId,omitempty" json:"VersionId,omitempty"`
+
+	// DeleteMarker is only used in the response. It is set if a delete marker
+	// was created, or if the deleted version was a delete marker.
+	DeleteMarker          bool   `xml:"DeleteMarker,omitempty" json:"DeleteMarker,omitempty"`
+	DeleteMarkerVersionID string `xml:"DeleteMarkerVersionId,omitempty" json:"DeleteMarkerVersionId,omitempty"`
 }
 
 type StorageClass string
@@ -484,9 +585,40 @@ func (s StorageClass) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 }
 
 const (
-	StorageStandard StorageClass = "STANDARD"
+	StorageStandard           StorageClass = "STANDARD"
+	StorageStandardIA         StorageClass = "STANDARD_IA"
+	StorageOneZoneIA          StorageClass = "ONEZONE_IA"
+	StorageGlacier            StorageClass = "GLACIER"
+	StorageDeepArchive        StorageClass = "DEEP_ARCHIVE"
+	StorageIntelligentTiering StorageClass = "INTELLIGENT_TIERING"
 )
 
+// Valid reports whether s is one of the storage classes GoFakeS3 accepts in
+// the "x-amz-storage-class" header. The empty string is not valid; callers
+// should treat a missing header as StorageStandard.
+func (s StorageClass) Valid() bool {
+	switch s {
+	case StorageStandard,
+		StorageStandardIA,
+		StorageOneZoneIA,
+		StorageGlacier,
+		StorageDeepArchive,
+		StorageIntelligentTiering:
+		return true
+	default:
+		return false
+	}
+}
+
+// storageClassFromMetadata returns the storage class stored in an object's
+// metadata, which is StorageStandard if none was requested.
+func storageClassFromMetadata(meta map[string]string) StorageClass {
+	if sc, ok := meta["X-Amz-Storage-Class"]; ok {
+		return StorageClass(sc)
+	}
+	return StorageStandard
+}
+
 // UploadID uses a string as the underlying type, but the string should only
 // represent a decimal integer. See uploader.uploadID for details.
 type UploadID string
@@ -495,6 +627,7 @@ type VersionID string
 
 type VersioningConfiguration struct {
 	XMLName xml.Name `xml:"VersioningConfiguration"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
 
 	Status VersioningStatus `xml:"Status,omitempty"`
 
@@ -0,0 +1,28 @@
+package gofakes3
+
+import "time"
+
+// MetricsCollector receives a report of every request served by GoFakeS3,
+// to count requests and measure latencies, for example with Prometheus
+// counters and histograms labelled by Operation and status. See WithMetrics.
+//
+// ObserveRequest is called once per request, after the response has been
+// sent, and may be called concurrently. op is OpUnknown for requests that
+// were rejected before they were routed, such as those that failed
+// authentication. bytesIn is the size of the request body that was read, and
+// bytesOut the size of the response body.
+//
+// An adapter for Prometheus might look like this:
+//
+//	type PromMetrics struct {
+//		requests *prometheus.CounterVec   // labels: operation, status
+//		latency  *prometheus.HistogramVec // labels: operation
+//	}
+//
+//	func (m *PromMetrics) ObserveRequest(op gofakes3.Operation, status int, dur time.Duration, bytesIn, bytesOut int64) {
+//		m.requests.WithLabelValues(string(op), strconv.Itoa(status)).Inc()
+//		m.latency.WithLabelValues(string(op)).Observe(dur.Seconds())
+//	}
+type MetricsCollector interface {
+	ObserveRequest(op Operation, status int, dur time.Duration, bytesIn, bytesOut int64)
+}
@@ -0,0 +1,94 @@
+package gofakes3
+
+import (
+	"strings"
+
+	xml "github.com/oneclickvirt/gofakes3/xml"
+)
+
+// NotificationConfiguration is used by the '?notification' subresource on
+// buckets, both as the response body for a GET and as the request body for a
+// PUT:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_NotificationConfiguration.html
+//
+// An empty configuration disables notifications for the bucket.
+type NotificationConfiguration struct {
+	XMLName                      xml.Name                      `xml:"NotificationConfiguration"`
+	Xmlns                        string                        `xml:"xmlns,attr"`
+	TopicConfigurations          []TopicConfiguration          `xml:"TopicConfiguration,omitempty"`
+	QueueConfigurations          []QueueConfiguration          `xml:"QueueConfiguration,omitempty"`
+	LambdaFunctionConfigurations []LambdaFunctionConfiguration `xml:"CloudFunctionConfiguration,omitempty"`
+	EventBridgeConfiguration     *EventBridgeConfiguration     `xml:"EventBridgeConfiguration,omitempty"`
+}
+
+// NotificationRule contains the parts of a notification that are common to
+// all of the destinations.
+type NotificationRule struct {
+	ID     string              `xml:"Id,omitempty"`
+	Events []string            `xml:"Event"`
+	Filter *NotificationFilter `xml:"Filter,omitempty"`
+}
+
+type TopicConfiguration struct {
+	NotificationRule
+	Topic string `xml:"Topic"`
+}
+
+type QueueConfiguration struct {
+	NotificationRule
+	Queue string `xml:"Queue"`
+}
+
+type LambdaFunctionConfiguration struct {
+	NotificationRule
+	CloudFunction string `xml:"CloudFunction"`
+}
+
+// EventBridgeConfiguration has no fields; its presence enables delivery of
+// all events to Amazon EventBridge.
+type EventBridgeConfiguration struct{}
+
+type NotificationFilter struct {
+	FilterRules []FilterRule `xml:"S3Key>FilterRule"`
+}
+
+// FilterRule matches object keys by "prefix" or "suffix".
+type FilterRule struct {
+	Name  string `xml:"Name"`
+	Value string `xml:"Value"`
+}
+
+func (c *NotificationConfiguration) rules() []NotificationRule {
+	var rules []NotificationRule
+	for _, t := range c.TopicConfigurations {
+		rules = append(rules, t.NotificationRule)
+	}
+	for _, q := range c.QueueConfigurations {
+		rules = append(rules, q.NotificationRule)
+	}
+	for _, l := range c.LambdaFunctionConfigurations {
+		rules = append(rules, l.NotificationRule)
+	}
+	return rules
+}
+
+func (c *NotificationConfiguration) validate() error {
+	for _, rule := range c.rules() {
+		if len(rule.Events) == 0 {
+			return ErrMalformedXML
+		}
+		for _, event := range rule.Events {
+			if !strings.HasPrefix(event, "s3:") {
+				return ErrorMessage(ErrInvalidArgument, "The event is not supported for notifications")
+			}
+		}
+		if rule.Filter != nil {
+			for _, filter := range rule.Filter.FilterRules {
+				if name := strings.ToLower(filter.Name); name != "prefix" && name != "suffix" {
+					return ErrorMessage(ErrInvalidArgument, "filter rule name must be either prefix or suffix")
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package gofakes3_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+	"github.com/oneclickvirt/gofakes3/s3mem"
+)
+
+var testNotificationConfig = &s3.NotificationConfiguration{
+	QueueConfigurations: []*s3.QueueConfiguration{{
+		Id:       aws.String("created"),
+		QueueArn: aws.String("arn:aws:sqs:us-east-1:123456789012:queue"),
+		Events:   aws.StringSlice([]string{"s3:ObjectCreated:*"}),
+		Filter: &s3.NotificationConfigurationFilter{
+			Key: &s3.KeyFilter{
+				FilterRules: []*s3.FilterRule{{Name: aws.String("prefix"), Value: aws.String("images/")}},
+			},
+		},
+	}},
+}
+
+func TestBucketNotification(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	rs, err := svc.GetBucketNotificationConfiguration(&s3.GetBucketNotificationConfigurationRequest{
+		Bucket: aws.String(defaultBucket),
+	})
+	ts.OK(err)
+	if len(rs.QueueConfigurations) != 0 || len(rs.TopicConfigurations) != 0 || len(rs.LambdaFunctionConfigurations) != 0 {
+		t.Fatal("expected empty configuration, found", rs)
+	}
+
+	ts.OKAll(svc.PutBucketNotificationConfiguration(&s3.PutBucketNotificationConfigurationInput{
+		Bucket:                    aws.String(defaultBucket),
+		NotificationConfiguration: testNotificationConfig,
+	}))
+
+	rs, err = svc.GetBucketNotificationConfiguration(&s3.GetBucketNotificationConfigurationRequest{
+		Bucket: aws.String(defaultBucket),
+	})
+	ts.OK(err)
+	if len(rs.QueueConfigurations) != 1 {
+		t.Fatal("unexpected configuration", rs)
+	}
+	queue := rs.QueueConfigurations[0]
+	if aws.StringValue(queue.QueueArn) != "arn:aws:sqs:us-east-1:123456789012:queue" ||
+		aws.StringValue(queue.Filter.Key.FilterRules[0].Value) != "images/" {
+		t.Fatal("unexpected queue configuration", queue)
+	}
+
+	_, err = svc.GetBucketNotificationConfiguration(&s3.GetBucketNotificationConfigurationRequest{
+		Bucket: aws.String("nope"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchBucket) {
+		t.Fatal("expected NoSuchBucket, found", err)
+	}
+}
+
+func TestBucketNotificationDiscarded(t *testing.T) {
+	ts := newTestServer(t, withBackend(&backendWithoutACL{s3mem.New()}))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.OKAll(svc.PutBucketNotificationConfiguration(&s3.PutBucketNotificationConfigurationInput{
+		Bucket:                    aws.String(defaultBucket),
+		NotificationConfiguration: testNotificationConfig,
+	}))
+
+	rs, err := svc.GetBucketNotificationConfiguration(&s3.GetBucketNotificationConfigurationRequest{
+		Bucket: aws.String(defaultBucket),
+	})
+	ts.OK(err)
+	if len(rs.QueueConfigurations) != 0 {
+		t.Fatal("expected empty configuration, found", rs)
+	}
+}
@@ -0,0 +1,287 @@
+package gofakes3
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	xml "github.com/oneclickvirt/gofakes3/xml"
+)
+
+// ObjectLockMode is the retention mode applied to an object version:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/object-lock-overview.html#object-lock-retention-modes
+type ObjectLockMode string
+
+const (
+	// ObjectLockGovernance prevents most users from deleting the object
+	// version or shortening its retention, but the lock may be bypassed using
+	// the 'x-amz-bypass-governance-retention' header.
+	ObjectLockGovernance ObjectLockMode = "GOVERNANCE"
+
+	// ObjectLockCompliance prevents anybody from deleting the object version
+	// or shortening its retention until the retention period expires.
+	ObjectLockCompliance ObjectLockMode = "COMPLIANCE"
+)
+
+func (m ObjectLockMode) Valid() bool {
+	return m == ObjectLockGovernance || m == ObjectLockCompliance
+}
+
+type LegalHoldStatus string
+
+const (
+	LegalHoldOn  LegalHoldStatus = "ON"
+	LegalHoldOff LegalHoldStatus = "OFF"
+)
+
+func (s LegalHoldStatus) Valid() bool {
+	return s == LegalHoldOn || s == LegalHoldOff
+}
+
+// ObjectLockConfiguration is used by the '?object-lock' subresource on buckets,
+// both as the response body for a GET and as the request body for a PUT.
+type ObjectLockConfiguration struct {
+	XMLName           xml.Name        `xml:"ObjectLockConfiguration"`
+	Xmlns             string          `xml:"xmlns,attr"`
+	ObjectLockEnabled string          `xml:"ObjectLockEnabled,omitempty"`
+	Rule              *ObjectLockRule `xml:"Rule,omitempty"`
+}
+
+type ObjectLockRule struct {
+	DefaultRetention *DefaultRetention `xml:"DefaultRetention"`
+}
+
+// DefaultRetention is applied to new object versions that are placed in the
+// bucket without an explicit retention. Exactly one of Days or Years must be
+// set.
+type DefaultRetention struct {
+	Mode  ObjectLockMode `xml:"Mode"`
+	Days  int            `xml:"Days,omitempty"`
+	Years int            `xml:"Years,omitempty"`
+}
+
+const objectLockEnabled = "Enabled"
+
+func (c *ObjectLockConfiguration) Enabled() bool {
+	return c != nil && c.ObjectLockEnabled == objectLockEnabled
+}
+
+// DefaultRetentionAt returns the retention that should be applied to an
+// object version created at the given time, or nil if there is no default.
+func (c *ObjectLockConfiguration) DefaultRetentionAt(at time.Time) *ObjectLockRetention {
+	if !c.Enabled() || c.Rule == nil || c.Rule.DefaultRetention == nil {
+		return nil
+	}
+	def := c.Rule.DefaultRetention
+	return &ObjectLockRetention{
+		Xmlns:           "http://s3.amazonaws.com/doc/2006-03-01/",
+		Mode:            def.Mode,
+		RetainUntilDate: NewContentTime(at.AddDate(def.Years, 0, def.Days)),
+	}
+}
+
+func (c *ObjectLockConfiguration) validate() error {
+	if !c.Enabled() {
+		return ErrMalformedXML
+	}
+	if c.Rule == nil {
+		return nil
+	}
+
+	def := c.Rule.DefaultRetention
+	if def == nil || !def.Mode.Valid() {
+		return ErrMalformedXML
+	}
+	if (def.Days > 0) == (def.Years > 0) || def.Days < 0 || def.Years < 0 {
+		return ErrMalformedXML
+	}
+	return nil
+}
+
+// ObjectLockRetention is used by the '?retention' subresource, both as the
+// response body for a GET and as the request body for a PUT.
+type ObjectLockRetention struct {
+	XMLName         xml.Name       `xml:"Retention"`
+	Xmlns           string         `xml:"xmlns,attr"`
+	Mode            ObjectLockMode `xml:"Mode,omitempty"`
+	RetainUntilDate ContentTime    `xml:"RetainUntilDate,omitempty"`
+}
+
+// ActiveAt reports whether the retention prevents the object version from
+// being deleted at the given time.
+func (r *ObjectLockRetention) ActiveAt(at time.Time) bool {
+	return r != nil && r.Mode != "" && r.RetainUntilDate.After(at)
+}
+
+// ObjectLockLegalHold is used by the '?legal-hold' subresource, both as the
+// response body for a GET and as the request body for a PUT.
+type ObjectLockLegalHold struct {
+	XMLName xml.Name        `xml:"LegalHold"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	Status  LegalHoldStatus `xml:"Status"`
+}
+
+func (l *ObjectLockLegalHold) On() bool {
+	return l != nil && l.Status == LegalHoldOn
+}
+
+// objectLockFromHeaders reads the 'x-amz-object-lock-*' headers that may be
+// sent with a PutObject request. Either result may be nil if the relevant
+// headers were not sent.
+func objectLockFromHeaders(hdr http.Header, now time.Time) (*ObjectLockRetention, *ObjectLockLegalHold, error) {
+	var retention *ObjectLockRetention
+	var hold *ObjectLockLegalHold
+
+	mode, until := hdr.Get("x-amz-object-lock-mode"), hdr.Get("x-amz-object-lock-retain-until-date")
+	if mode != "" || until != "" {
+		if mode == "" || until == "" {
+			return nil, nil, ErrorMessage(ErrInvalidArgument, "x-amz-object-lock-retain-until-date and x-amz-object-lock-mode must both be supplied")
+		}
+		if !ObjectLockMode(mode).Valid() {
+			return nil, nil, ErrorInvalidArgument("x-amz-object-lock-mode", mode, "Unknown wormMode directive.")
+		}
+		untilTime, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, nil, ErrorInvalidArgument("x-amz-object-lock-retain-until-date", until, "The retain until date must be provided in ISO 8601 format")
+		}
+		retention = &ObjectLockRetention{Mode: ObjectLockMode(mode), RetainUntilDate: NewContentTime(untilTime)}
+		if err := validateRetention(retention, now); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if status := hdr.Get("x-amz-object-lock-legal-hold"); status != "" {
+		if !LegalHoldStatus(status).Valid() {
+			return nil, nil, ErrorInvalidArgument("x-amz-object-lock-legal-hold", status, "Legal Hold must be either of 'ON' or 'OFF'")
+		}
+		hold = &ObjectLockLegalHold{Status: LegalHoldStatus(status)}
+	}
+
+	return retention, hold, nil
+}
+
+// objectLockForPut works out the retention and legal hold to apply to a new
+// object version from the 'x-amz-object-lock-*' headers, falling back to the
+// bucket's default retention if the headers do not specify one.
+func (g *GoFakeS3) objectLockForPut(bucket string, r *http.Request) (*ObjectLockRetention, *ObjectLockLegalHold, error) {
+	now := g.timeSource.Now()
+	retention, hold, err := objectLockFromHeaders(r.Header, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if g.lock == nil {
+		if retention != nil || hold != nil {
+			return nil, nil, ErrNotImplemented
+		}
+		return nil, nil, nil
+	}
+
+	if retention == nil {
+		config, err := g.lock.GetObjectLockConfiguration(r.Context(), bucket)
+		if err != nil && !HasErrorCode(err, ErrObjectLockConfigurationNotFound) {
+			return nil, nil, err
+		}
+		retention = config.DefaultRetentionAt(now)
+	}
+
+	return retention, hold, nil
+}
+
+// putObjectLock stores the retention and legal hold for a new object version.
+// Either may be nil.
+func (g *GoFakeS3) putObjectLock(r *http.Request, bucket, object string, version VersionID, retention *ObjectLockRetention, hold *ObjectLockLegalHold) error {
+	if retention != nil {
+		retention.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+		if err := g.lock.PutObjectRetention(r.Context(), bucket, object, version, retention); err != nil {
+			return err
+		}
+	}
+	if hold != nil {
+		hold.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+		if err := g.lock.PutObjectLegalHold(r.Context(), bucket, object, version, hold); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRetention checks a retention sent by a client. A retention with
+// neither a Mode nor a RetainUntilDate is valid; it removes the retention.
+func validateRetention(retention *ObjectLockRetention, now time.Time) error {
+	if retention.Mode == "" && retention.RetainUntilDate.IsZero() {
+		return nil
+	}
+	if !retention.Mode.Valid() || retention.RetainUntilDate.IsZero() {
+		return ErrMalformedXML
+	}
+	if !retention.RetainUntilDate.After(now) {
+		return ErrorMessage(ErrInvalidArgument, "The retain until date must be in the future!")
+	}
+	return nil
+}
+
+func bypassGovernanceRetention(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("x-amz-bypass-governance-retention"), "true")
+}
+
+// checkRetentionChange decides whether the existing retention of an object
+// version may be replaced. COMPLIANCE retention may only be extended, and
+// GOVERNANCE retention may only be weakened with the bypass header.
+func checkRetentionChange(existing, replacement *ObjectLockRetention, now time.Time, bypass bool) error {
+	if !existing.ActiveAt(now) {
+		return nil
+	}
+
+	weakened := replacement.Mode == "" || replacement.RetainUntilDate.Before(existing.RetainUntilDate.Time)
+	switch existing.Mode {
+	case ObjectLockCompliance:
+		if weakened || replacement.Mode != ObjectLockCompliance {
+			return ErrAccessDenied
+		}
+	case ObjectLockGovernance:
+		if weakened && !bypass {
+			return ErrAccessDenied
+		}
+	}
+	return nil
+}
+
+// checkObjectLockDelete returns ErrAccessDenied if the object version may not
+// be deleted because of its retention or legal hold. An empty versionID
+// refers to the current version.
+func (g *GoFakeS3) checkObjectLockDelete(bucket, object string, versionID VersionID, r *http.Request) error {
+	if g.lock == nil {
+		return nil
+	}
+
+	// Deleting an object without a version in a versioned bucket only adds
+	// a delete marker, which object lock does not prevent:
+	if versionID == "" && g.versioningEnabled(bucket) {
+		return nil
+	}
+
+	ctx := r.Context()
+	hold, err := g.lock.GetObjectLegalHold(ctx, bucket, object, versionID)
+	if HasErrorCode(err, ErrNoSuchKey) || HasErrorCode(err, ErrNoSuchVersion) {
+		// Leave it to the delete to decide what to do with a missing object:
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if hold.On() {
+		return ErrAccessDenied
+	}
+
+	retention, err := g.lock.GetObjectRetention(ctx, bucket, object, versionID)
+	if err != nil {
+		return err
+	}
+	if retention.ActiveAt(g.timeSource.Now()) {
+		if retention.Mode == ObjectLockCompliance || !bypassGovernanceRetention(r) {
+			return ErrAccessDenied
+		}
+	}
+
+	return nil
+}
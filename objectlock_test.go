@@ -0,0 +1,448 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+	"github.com/oneclickvirt/gofakes3/s3mem"
+)
+
+func TestObjectRetention(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+	_, err := svc.GetObjectRetention(&s3.GetObjectRetentionInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchObjectLockConfiguration) {
+		t.Fatal("expected NoSuchObjectLockConfiguration, found", err)
+	}
+
+	until := defaultDate.Add(24 * time.Hour)
+	ts.OKAll(svc.PutObjectRetention(&s3.PutObjectRetentionInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+		Retention: &s3.ObjectLockRetention{
+			Mode:            aws.String("COMPLIANCE"),
+			RetainUntilDate: aws.Time(until),
+		},
+	}))
+
+	rs, err := svc.GetObjectRetention(&s3.GetObjectRetentionInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+	})
+	ts.OK(err)
+	if aws.StringValue(rs.Retention.Mode) != "COMPLIANCE" || !aws.TimeValue(rs.Retention.RetainUntilDate).Equal(until) {
+		t.Fatal("unexpected retention", rs.Retention)
+	}
+
+	// COMPLIANCE retention can not be shortened, even with the bypass header:
+	_, err = svc.PutObjectRetention(&s3.PutObjectRetentionInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+		Retention: &s3.ObjectLockRetention{
+			Mode:            aws.String("COMPLIANCE"),
+			RetainUntilDate: aws.Time(until.Add(-time.Hour)),
+		},
+		BypassGovernanceRetention: aws.Bool(true),
+	})
+	if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+
+	_, err = svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+	ts.assertObject(defaultBucket, "foo", nil, "hello")
+
+	// Once the retention has expired, the object can be deleted:
+	ts.Advance(25 * time.Hour)
+	ts.OKAll(svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+	}))
+}
+
+func TestObjectRetentionGovernance(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+	ts.OKAll(svc.PutObjectRetention(&s3.PutObjectRetentionInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+		Retention: &s3.ObjectLockRetention{
+			Mode:            aws.String("GOVERNANCE"),
+			RetainUntilDate: aws.Time(defaultDate.Add(time.Hour)),
+		},
+	}))
+
+	_, err := svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+
+	ts.OKAll(svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket:                    aws.String(defaultBucket),
+		Key:                       aws.String("foo"),
+		BypassGovernanceRetention: aws.Bool(true),
+	}))
+}
+
+func TestObjectRetentionInvalid(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+	_, err := svc.PutObjectRetention(&s3.PutObjectRetentionInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+		Retention: &s3.ObjectLockRetention{
+			Mode:            aws.String("COMPLIANCE"),
+			RetainUntilDate: aws.Time(defaultDate.Add(-time.Hour)),
+		},
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
+	}
+
+	_, err = svc.PutObjectRetention(&s3.PutObjectRetentionInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("nope"),
+		Retention: &s3.ObjectLockRetention{
+			Mode:            aws.String("COMPLIANCE"),
+			RetainUntilDate: aws.Time(defaultDate.Add(time.Hour)),
+		},
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		t.Fatal("expected NoSuchKey, found", err)
+	}
+}
+
+func TestObjectLegalHold(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+	ts.OKAll(svc.PutObjectLegalHold(&s3.PutObjectLegalHoldInput{
+		Bucket:    aws.String(defaultBucket),
+		Key:       aws.String("foo"),
+		LegalHold: &s3.ObjectLockLegalHold{Status: aws.String("ON")},
+	}))
+
+	rs, err := svc.GetObjectLegalHold(&s3.GetObjectLegalHoldInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+	})
+	ts.OK(err)
+	if aws.StringValue(rs.LegalHold.Status) != "ON" {
+		t.Fatal("unexpected legal hold", rs.LegalHold)
+	}
+
+	_, err = svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket:                    aws.String(defaultBucket),
+		Key:                       aws.String("foo"),
+		BypassGovernanceRetention: aws.Bool(true),
+	})
+	if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+
+	ts.OKAll(svc.PutObjectLegalHold(&s3.PutObjectLegalHoldInput{
+		Bucket:    aws.String(defaultBucket),
+		Key:       aws.String("foo"),
+		LegalHold: &s3.ObjectLockLegalHold{Status: aws.String("OFF")},
+	}))
+	ts.OKAll(svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+	}))
+}
+
+func TestObjectLockVersioned(t *testing.T) {
+	ts := newTestServer(t, withVersioning())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	rs, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket:                    aws.String(defaultBucket),
+		Key:                       aws.String("foo"),
+		Body:                      bytes.NewReader([]byte("hello")),
+		ObjectLockMode:            aws.String("COMPLIANCE"),
+		ObjectLockRetainUntilDate: aws.Time(defaultDate.Add(time.Hour)),
+	})
+	ts.OK(err)
+
+	retention, err := svc.GetObjectRetention(&s3.GetObjectRetentionInput{
+		Bucket:    aws.String(defaultBucket),
+		Key:       aws.String("foo"),
+		VersionId: rs.VersionId,
+	})
+	ts.OK(err)
+	if aws.StringValue(retention.Retention.Mode) != "COMPLIANCE" {
+		t.Fatal("unexpected retention", retention.Retention)
+	}
+
+	// A delete without a version only adds a delete marker:
+	ts.OKAll(svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+	}))
+
+	// The locked version itself can not be deleted:
+	_, err = svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket:    aws.String(defaultBucket),
+		Key:       aws.String("foo"),
+		VersionId: rs.VersionId,
+	})
+	if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+}
+
+func TestPutObjectLockHeadersInvalid(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket:         aws.String(defaultBucket),
+		Key:            aws.String("foo"),
+		Body:           bytes.NewReader([]byte("hello")),
+		ObjectLockMode: aws.String("COMPLIANCE"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
+	}
+	if ts.backendObjectExists(defaultBucket, "foo") {
+		t.Fatal("object should not have been created")
+	}
+}
+
+func TestObjectLockConfiguration(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.GetObjectLockConfiguration(&s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(defaultBucket),
+	})
+	if !hasErrorCode(err, gofakes3.ErrObjectLockConfigurationNotFound) {
+		t.Fatal("expected ObjectLockConfigurationNotFoundError, found", err)
+	}
+
+	ts.OKAll(svc.CreateBucket(&s3.CreateBucketInput{
+		Bucket:                     aws.String("locked"),
+		ObjectLockEnabledForBucket: aws.Bool(true),
+	}))
+
+	rs, err := svc.GetObjectLockConfiguration(&s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String("locked"),
+	})
+	ts.OK(err)
+	if aws.StringValue(rs.ObjectLockConfiguration.ObjectLockEnabled) != "Enabled" || rs.ObjectLockConfiguration.Rule != nil {
+		t.Fatal("unexpected configuration", rs.ObjectLockConfiguration)
+	}
+
+	ts.OKAll(svc.PutObjectLockConfiguration(&s3.PutObjectLockConfigurationInput{
+		Bucket: aws.String("locked"),
+		ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+			ObjectLockEnabled: aws.String("Enabled"),
+			Rule: &s3.ObjectLockRule{
+				DefaultRetention: &s3.DefaultRetention{
+					Mode: aws.String("COMPLIANCE"),
+					Days: aws.Int64(2),
+				},
+			},
+		},
+	}))
+
+	rs, err = svc.GetObjectLockConfiguration(&s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String("locked"),
+	})
+	ts.OK(err)
+	if rs.ObjectLockConfiguration.Rule == nil || aws.Int64Value(rs.ObjectLockConfiguration.Rule.DefaultRetention.Days) != 2 {
+		t.Fatal("unexpected configuration", rs.ObjectLockConfiguration)
+	}
+
+	// The default retention applies to new objects without explicit retention:
+	ts.OKAll(svc.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("locked"),
+		Key:    aws.String("default"),
+		Body:   bytes.NewReader([]byte("hello")),
+	}))
+	retention, err := svc.GetObjectRetention(&s3.GetObjectRetentionInput{
+		Bucket: aws.String("locked"),
+		Key:    aws.String("default"),
+	})
+	ts.OK(err)
+	if aws.StringValue(retention.Retention.Mode) != "COMPLIANCE" ||
+		!aws.TimeValue(retention.Retention.RetainUntilDate).Equal(defaultDate.AddDate(0, 0, 2)) {
+		t.Fatal("unexpected retention", retention.Retention)
+	}
+
+	ts.OKAll(svc.PutObject(&s3.PutObjectInput{
+		Bucket:                    aws.String("locked"),
+		Key:                       aws.String("explicit"),
+		Body:                      bytes.NewReader([]byte("hello")),
+		ObjectLockMode:            aws.String("GOVERNANCE"),
+		ObjectLockRetainUntilDate: aws.Time(defaultDate.Add(time.Hour)),
+	}))
+	retention, err = svc.GetObjectRetention(&s3.GetObjectRetentionInput{
+		Bucket: aws.String("locked"),
+		Key:    aws.String("explicit"),
+	})
+	ts.OK(err)
+	if aws.StringValue(retention.Retention.Mode) != "GOVERNANCE" {
+		t.Fatal("unexpected retention", retention.Retention)
+	}
+}
+
+func TestObjectLockBucketVersioning(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.OKAll(svc.CreateBucket(&s3.CreateBucketInput{
+		Bucket:                     aws.String("locked"),
+		ObjectLockEnabledForBucket: aws.Bool(true),
+	}))
+
+	rs, err := svc.GetBucketVersioning(&s3.GetBucketVersioningInput{Bucket: aws.String("locked")})
+	ts.OK(err)
+	if aws.StringValue(rs.Status) != "Enabled" {
+		t.Fatal("expected versioning to be enabled, found", aws.StringValue(rs.Status))
+	}
+
+	t.Run("unversioned-backend", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithoutVersioning()))
+		defer ts.Close()
+		svc := ts.s3Client()
+
+		_, err := svc.CreateBucket(&s3.CreateBucketInput{
+			Bucket:                     aws.String("locked"),
+			ObjectLockEnabledForBucket: aws.Bool(true),
+		})
+		if !hasErrorCode(err, gofakes3.ErrNotImplemented) {
+			t.Fatal("expected ErrNotImplemented, found", err)
+		}
+		exists, err := ts.backend.BucketExists(mockR.Context(), "locked")
+		ts.OK(err)
+		if exists {
+			t.Fatal("bucket should not have been created")
+		}
+	})
+
+	t.Run("versioning-fails", func(t *testing.T) {
+		ts := newTestServer(t, withBackend(&failingVersioningBackend{s3mem.New()}))
+		defer ts.Close()
+		svc := ts.s3Client()
+
+		_, err := svc.CreateBucket(&s3.CreateBucketInput{
+			Bucket:                     aws.String("locked"),
+			ObjectLockEnabledForBucket: aws.Bool(true),
+		})
+		if !hasErrorCode(err, gofakes3.ErrInternal) {
+			t.Fatal("expected InternalError, found", err)
+		}
+		exists, err := ts.backend.BucketExists(mockR.Context(), "locked")
+		ts.OK(err)
+		if exists {
+			t.Fatal("bucket should have been deleted")
+		}
+	})
+}
+
+// failingVersioningBackend can not change the versioning configuration of a
+// bucket.
+type failingVersioningBackend struct {
+	*s3mem.Backend
+}
+
+func (b *failingVersioningBackend) SetVersioningConfiguration(bucket string, v gofakes3.VersioningConfiguration) error {
+	return gofakes3.ErrInternal
+}
+
+func TestObjectLockConfigurationInvalid(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	for _, rule := range []*s3.DefaultRetention{
+		{Mode: aws.String("COMPLIANCE")},
+		{Mode: aws.String("COMPLIANCE"), Days: aws.Int64(1), Years: aws.Int64(1)},
+		{Mode: aws.String("NOPE"), Days: aws.Int64(1)},
+	} {
+		_, err := svc.PutObjectLockConfiguration(&s3.PutObjectLockConfigurationInput{
+			Bucket: aws.String(defaultBucket),
+			ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+				ObjectLockEnabled: aws.String("Enabled"),
+				Rule:              &s3.ObjectLockRule{DefaultRetention: rule},
+			},
+		})
+		if !hasErrorCode(err, gofakes3.ErrMalformedXML) {
+			t.Fatal("expected MalformedXML for", rule, "found", err)
+		}
+	}
+}
+
+func TestObjectLockDeleteMulti(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.backendPutString(defaultBucket, "locked", nil, "hello")
+	ts.backendPutString(defaultBucket, "unlocked", nil, "hello")
+
+	ts.OKAll(svc.PutObjectLegalHold(&s3.PutObjectLegalHoldInput{
+		Bucket:    aws.String(defaultBucket),
+		Key:       aws.String("locked"),
+		LegalHold: &s3.ObjectLockLegalHold{Status: aws.String("ON")},
+	}))
+
+	for _, quiet := range []bool{false, true} {
+		rs, err := svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(defaultBucket),
+			Delete: &s3.Delete{
+				Objects: []*s3.ObjectIdentifier{
+					{Key: aws.String("locked")},
+					{Key: aws.String("unlocked")},
+				},
+				Quiet: aws.Bool(quiet),
+			},
+		})
+		ts.OK(err)
+
+		if len(rs.Errors) != 1 {
+			t.Fatal("expected one error, found", rs.Errors)
+		}
+		if e := rs.Errors[0]; aws.StringValue(e.Key) != "locked" || aws.StringValue(e.Code) != string(gofakes3.ErrAccessDenied) || aws.StringValue(e.Message) == "" {
+			t.Fatal("unexpected error", e)
+		}
+
+		if quiet && len(rs.Deleted) != 0 {
+			t.Fatal("expected no deleted keys in quiet mode, found", rs.Deleted)
+		} else if !quiet && (len(rs.Deleted) != 1 || aws.StringValue(rs.Deleted[0].Key) != "unlocked") {
+			t.Fatal("unexpected deleted keys", rs.Deleted)
+		}
+	}
+
+	ts.assertObject(defaultBucket, "locked", nil, "hello")
+}
@@ -0,0 +1,133 @@
+package gofakes3
+
+import (
+	"context"
+	"net/http"
+)
+
+// Operation identifies the S3 API operation a request was routed to. The
+// values match the operation names used in the S3 API reference:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_Operations_Amazon_Simple_Storage_Service.html
+type Operation string
+
+const (
+	OpUnknown Operation = "Unknown"
+
+	OpListBuckets Operation = "ListBuckets"
+
+	OpCreateBucket       Operation = "CreateBucket"
+	OpDeleteBucket       Operation = "DeleteBucket"
+	OpHeadBucket         Operation = "HeadBucket"
+	OpGetBucketLocation  Operation = "GetBucketLocation"
+	OpListObjects        Operation = "ListObjects"
+	OpListObjectsV2      Operation = "ListObjectsV2"
+	OpListObjectVersions Operation = "ListObjectVersions"
+	OpDeleteObjects      Operation = "DeleteObjects"
+	OpPostObject         Operation = "PostObject"
+
+	OpGetBucketVersioning Operation = "GetBucketVersioning"
+	OpPutBucketVersioning Operation = "PutBucketVersioning"
+
+	OpGetBucketAcl Operation = "GetBucketAcl"
+	OpPutBucketAcl Operation = "PutBucketAcl"
+
+	OpGetBucketPolicy    Operation = "GetBucketPolicy"
+	OpPutBucketPolicy    Operation = "PutBucketPolicy"
+	OpDeleteBucketPolicy Operation = "DeleteBucketPolicy"
+
+	OpGetBucketCors    Operation = "GetBucketCors"
+	OpPutBucketCors    Operation = "PutBucketCors"
+	OpDeleteBucketCors Operation = "DeleteBucketCors"
+
+	OpGetBucketWebsite    Operation = "GetBucketWebsite"
+	OpPutBucketWebsite    Operation = "PutBucketWebsite"
+	OpDeleteBucketWebsite Operation = "DeleteBucketWebsite"
+
+	OpGetBucketEncryption    Operation = "GetBucketEncryption"
+	OpPutBucketEncryption    Operation = "PutBucketEncryption"
+	OpDeleteBucketEncryption Operation = "DeleteBucketEncryption"
+
+	OpGetBucketRequestPayment Operation = "GetBucketRequestPayment"
+	OpPutBucketRequestPayment Operation = "PutBucketRequestPayment"
+
+	OpGetBucketAccelerateConfiguration Operation = "GetBucketAccelerateConfiguration"
+	OpPutBucketAccelerateConfiguration Operation = "PutBucketAccelerateConfiguration"
+
+	OpGetBucketNotificationConfiguration Operation = "GetBucketNotificationConfiguration"
+	OpPutBucketNotificationConfiguration Operation = "PutBucketNotificationConfiguration"
+
+	OpGetObjectLockConfiguration Operation = "GetObjectLockConfiguration"
+	OpPutObjectLockConfiguration Operation = "PutObjectLockConfiguration"
+
+	OpGetObject    Operation = "GetObject"
+	OpHeadObject   Operation = "HeadObject"
+	OpPutObject    Operation = "PutObject"
+	OpCopyObject   Operation = "CopyObject"
+	OpDeleteObject Operation = "DeleteObject"
+
+	OpGetObjectAcl       Operation = "GetObjectAcl"
+	OpPutObjectAcl       Operation = "PutObjectAcl"
+	OpGetObjectRetention Operation = "GetObjectRetention"
+	OpPutObjectRetention Operation = "PutObjectRetention"
+	OpGetObjectLegalHold Operation = "GetObjectLegalHold"
+	OpPutObjectLegalHold Operation = "PutObjectLegalHold"
+	OpRestoreObject      Operation = "RestoreObject"
+
+	OpSelectObjectContent Operation = "SelectObjectContent"
+
+	OpCreateMultipartUpload   Operation = "CreateMultipartUpload"
+	OpListMultipartUploads    Operation = "ListMultipartUploads"
+	OpUploadPart              Operation = "UploadPart"
+	OpUploadPartCopy          Operation = "UploadPartCopy"
+	OpListParts               Operation = "ListParts"
+	OpCompleteMultipartUpload Operation = "CompleteMultipartUpload"
+	OpAbortMultipartUpload    Operation = "AbortMultipartUpload"
+)
+
+// withRequestContext attaches the values resolved by routeBase to the
+// request's context, so they are available to the Backend through the
+// *FromContext functions.
+func withRequestContext(r *http.Request, bucket, object string, op Operation, requestID string) *http.Request {
+	ctx := r.Context()
+	ctx = context.WithValue(ctx, bucketKey, bucket)
+	ctx = context.WithValue(ctx, objectKey, object)
+	ctx = context.WithValue(ctx, operationKey, op)
+	ctx = context.WithValue(ctx, requestIDKey, requestID)
+	if entry := accessLogEntryFromContext(ctx); entry != nil {
+		entry.Bucket, entry.Key, entry.Operation = bucket, object, op
+	}
+	return r.WithContext(ctx)
+}
+
+// BucketFromContext returns the name of the bucket the request that ctx
+// belongs to was made against. It returns "" for requests that do not
+// address a bucket, or if ctx did not come from GoFakeS3.
+func BucketFromContext(ctx context.Context) string {
+	bucket, _ := ctx.Value(bucketKey).(string)
+	return bucket
+}
+
+// ObjectFromContext returns the object key the request that ctx belongs to
+// was made against, or "" if there is none.
+func ObjectFromContext(ctx context.Context) string {
+	object, _ := ctx.Value(objectKey).(string)
+	return object
+}
+
+// OperationFromContext returns the Operation the request that ctx belongs
+// to was routed to, or OpUnknown if ctx did not come from GoFakeS3.
+func OperationFromContext(ctx context.Context) Operation {
+	op, ok := ctx.Value(operationKey).(Operation)
+	if !ok {
+		return OpUnknown
+	}
+	return op
+}
+
+// RequestIDFromContext returns the "x-amz-request-id" sent in the response
+// to the request that ctx belongs to, or "" if ctx did not come from
+// GoFakeS3.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
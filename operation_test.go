@@ -0,0 +1,86 @@
+package gofakes3
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouteOperation(t *testing.T) {
+	for idx, tc := range []struct {
+		method string
+		path   string
+		header string
+		op     Operation
+	}{
+		{"GET", "/", "", OpListBuckets},
+		{"HEAD", "/", "", OpListBuckets},
+		{"POST", "/", "", OpUnknown},
+		{"PUT", "/bucket", "", OpCreateBucket},
+		{"HEAD", "/bucket", "", OpHeadBucket},
+		{"DELETE", "/bucket", "", OpDeleteBucket},
+		{"GET", "/bucket", "", OpListObjects},
+		{"GET", "/bucket?list-type=2", "", OpListObjectsV2},
+		{"GET", "/bucket?location", "", OpGetBucketLocation},
+		{"POST", "/bucket?delete", "", OpDeleteObjects},
+		{"POST", "/bucket", "", OpPostObject},
+		{"GET", "/bucket?versions", "", OpListObjectVersions},
+		{"PUT", "/bucket?versioning", "", OpPutBucketVersioning},
+		{"DELETE", "/bucket?policy", "", OpDeleteBucketPolicy},
+		{"GET", "/bucket?cors", "", OpGetBucketCors},
+		{"PUT", "/bucket?cors", "", OpPutBucketCors},
+		{"DELETE", "/bucket?cors", "", OpDeleteBucketCors},
+		{"GET", "/bucket?website", "", OpGetBucketWebsite},
+		{"PUT", "/bucket?website", "", OpPutBucketWebsite},
+		{"DELETE", "/bucket?website", "", OpDeleteBucketWebsite},
+		{"GET", "/bucket?requestPayment", "", OpGetBucketRequestPayment},
+		{"PUT", "/bucket?requestPayment", "", OpPutBucketRequestPayment},
+		{"GET", "/bucket?accelerate", "", OpGetBucketAccelerateConfiguration},
+		{"PUT", "/bucket?accelerate", "", OpPutBucketAccelerateConfiguration},
+		{"GET", "/bucket?encryption", "", OpGetBucketEncryption},
+		{"DELETE", "/bucket?encryption", "", OpDeleteBucketEncryption},
+		{"GET", "/bucket?notification", "", OpGetBucketNotificationConfiguration},
+		{"PUT", "/bucket?notification", "", OpPutBucketNotificationConfiguration},
+		{"GET", "/bucket?object-lock", "", OpGetObjectLockConfiguration},
+		{"GET", "/bucket/key", "", OpGetObject},
+		{"HEAD", "/bucket/key", "", OpHeadObject},
+		{"PUT", "/bucket/key", "", OpPutObject},
+		{"PUT", "/bucket/key", "/bucket/src", OpCopyObject},
+		{"DELETE", "/bucket/key", "", OpDeleteObject},
+		{"DELETE", "/bucket/key?versionId=1", "", OpDeleteObject},
+		{"DELETE", "/bucket/key?versionId=null", "", OpDeleteObject},
+		{"PATCH", "/bucket/key", "", OpUnknown},
+		{"PUT", "/bucket/key?acl", "", OpPutObjectAcl},
+		{"GET", "/bucket?acl", "", OpGetBucketAcl},
+		{"PUT", "/bucket?acl", "", OpPutBucketAcl},
+		{"DELETE", "/bucket?acl", "", OpUnknown},
+		{"PUT", "/bucket/key?retention", "", OpPutObjectRetention},
+		{"GET", "/bucket/key?legal-hold", "", OpGetObjectLegalHold},
+		{"POST", "/bucket/key?restore", "", OpRestoreObject},
+		{"POST", "/bucket/key?select&select-type=2", "", OpSelectObjectContent},
+		{"GET", "/bucket/key?restore", "", OpUnknown},
+		{"POST", "/bucket/key?uploads", "", OpCreateMultipartUpload},
+		{"GET", "/bucket?uploads", "", OpListMultipartUploads},
+		{"PUT", "/bucket/key?uploadId=1&partNumber=1", "", OpUploadPart},
+		{"PUT", "/bucket/key?uploadId=1&partNumber=1", "/bucket/src", OpUploadPartCopy},
+		{"GET", "/bucket/key?uploadId=1", "", OpListParts},
+		{"POST", "/bucket/key?uploadId=1", "", OpCompleteMultipartUpload},
+		{"DELETE", "/bucket/key?uploadId=1", "", OpAbortMultipartUpload},
+	} {
+		t.Run("", func(t *testing.T) {
+			rq := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.header != "" {
+				rq.Header.Set("X-Amz-Copy-Source", tc.header)
+			}
+			parts := strings.SplitN(strings.Trim(rq.URL.Path, "/"), "/", 2)
+			var object string
+			if len(parts) == 2 {
+				object = parts[1]
+			}
+			var g GoFakeS3
+			if op, _ := g.route(parts[0], object, rq); op != tc.op {
+				t.Fatal(idx, tc.method, tc.path, "expected", tc.op, "found", op)
+			}
+		})
+	}
+}
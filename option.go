@@ -1,6 +1,10 @@
 package gofakes3
 
-import "time"
+import (
+	"io"
+	"regexp"
+	"time"
+)
 
 type Option func(g *GoFakeS3)
 
@@ -35,8 +39,125 @@ func WithMetadataSizeLimit(size int) Option {
 	return func(g *GoFakeS3) { g.metadataSizeLimit = size }
 }
 
+// WithMaxUploadParts lowers the number of parts a multipart upload may have,
+// so clients can be tested against the limit without uploading 10,000 parts.
+// Part numbers above the limit are rejected with ErrInvalidPart, as is a
+// CompleteMultipartUpload that lists more parts than the limit.
+//
+// See MaxUploadPartNumber for the starting value, which is also the largest
+// value that can be used.
+func WithMaxUploadParts(parts int) Option {
+	return func(g *GoFakeS3) {
+		if parts <= 0 || parts > MaxUploadPartNumber {
+			parts = MaxUploadPartNumber
+		}
+		g.maxUploadParts = parts
+	}
+}
+
+// WithMaxBucketKeys lowers the number of keys ListObjects and ListObjectsV2
+// return in each page, so clients can be tested against aggressive
+// truncation without creating thousands of objects. A larger 'max-keys' is
+// capped to this value, which is also the default.
+//
+// See MaxBucketKeys for the starting value, which is also the largest value
+// that can be used.
+func WithMaxBucketKeys(keys int) Option {
+	return func(g *GoFakeS3) {
+		if keys <= 0 || keys > MaxBucketKeys {
+			keys = MaxBucketKeys
+		}
+		g.maxBucketKeys = int64(keys)
+	}
+}
+
+// WithMaxObjectSize makes PutObject, POST uploads, UploadPart and
+// CompleteMultipartUpload fail with ErrEntityTooLarge if the object would be
+// larger than size bytes. PutObject and UploadPart check the declared size of
+// the body before reading it. A size of '0', the default, disables the limit.
+func WithMaxObjectSize(size int64) Option {
+	return func(g *GoFakeS3) { g.maxObjectSize = size }
+}
+
+// WithMinPartSize allows you to reconfigure the minimum size of every part
+// but the last in a multipart upload, which is checked when the upload is
+// completed.
+//
+// See DefaultUploadPartSize for the starting value, set to '0' to disable.
+func WithMinPartSize(size int64) Option {
+	return func(g *GoFakeS3) { g.minPartSize = size }
+}
+
+// WithCORSPolicy replaces the CORS headers sent for buckets that do not have
+// their own CORS configuration. See DefaultCORSPolicy for the starting value,
+// which permits cross-origin requests from anywhere.
+func WithCORSPolicy(policy CORSPolicy) Option {
+	return func(g *GoFakeS3) { g.corsPolicy = policy }
+}
+
+// WithEventSink delivers an Event to sink whenever an object is created or
+// removed. Delivery happens in the background; if more than
+// DefaultEventBufferSize events are waiting, new events are logged and
+// dropped.
+//
+// Events are sent for every bucket, regardless of the bucket's notification
+// configuration.
+func WithEventSink(sink EventSink) Option {
+	return func(g *GoFakeS3) { g.eventSink = sink }
+}
+
+// WithEventDeliveryTimeout limits how long the EventSink may take to deliver
+// each event, and how long Close waits for the events still queued. See
+// DefaultEventDeliveryTimeout for the starting value.
+func WithEventDeliveryTimeout(timeout time.Duration) Option {
+	return func(g *GoFakeS3) { g.eventTimeout = timeout }
+}
+
+// WithOwner sets the user reported as the owner of all buckets and objects,
+// for example in ListBuckets and in ACLs. See DefaultOwner for the starting
+// value.
+func WithOwner(id, displayName string) Option {
+	return func(g *GoFakeS3) { g.ownerInfo = UserInfo{ID: id, DisplayName: displayName} }
+}
+
+// WithOwnerDisplayName changes only the display name of the owner, leaving
+// the ID alone. An empty name omits the DisplayName element from responses,
+// which some S3-compatible services do.
+func WithOwnerDisplayName(displayName string) Option {
+	return func(g *GoFakeS3) { g.ownerInfo.DisplayName = displayName }
+}
+
+// WithRestoreDelay sets how long a RestoreObject request takes before the
+// object is reported as restored. See DefaultRestoreDelay for the starting
+// value. The delay is measured with the TimeSource, so tests using
+// FixedTimeSource can control it with Advance.
+func WithRestoreDelay(d time.Duration) Option {
+	return func(g *GoFakeS3) { g.restoreDelay = d }
+}
+
+// WithStartupChecks makes New call ListBuckets on the backend once, and log
+// an error if it fails or panics. Use NewWithChecks to have the error
+// returned instead.
+func WithStartupChecks(enabled bool) Option {
+	return func(g *GoFakeS3) { g.startupChecks = enabled }
+}
+
+// WithMultipartCompleteKeepAlive makes CompleteMultipartUpload send a space
+// in the response body every interval while the parts are reassembled and
+// stored, as S3 does for long running uploads to stop clients timing out.
+//
+// Once the first space is sent the status can no longer change, so errors
+// after that point are sent as an <Error> document with a 200 status, which
+// S3 clients already handle for this request. The x-amz-version-id header is
+// also not sent in that case. An interval of zero, the default, disables the
+// keep-alive.
+func WithMultipartCompleteKeepAlive(interval time.Duration) Option {
+	return func(g *GoFakeS3) { g.completeKeepAlive = interval }
+}
+
 // WithIntegrityCheck enables or disables Content-MD5 validation when
-// putting an Object.
+// putting an Object. When enabled, DeleteObjects also requires a Content-MD5
+// or checksum header, as S3 does.
 func WithIntegrityCheck(check bool) Option {
 	return func(g *GoFakeS3) { g.integrityCheck = check }
 }
@@ -53,6 +174,22 @@ func WithGlobalLog() Option {
 	return WithLogger(GlobalLog())
 }
 
+// WithAccessLog writes a line to w for every request served, with the
+// method, path, status, response size and duration, as well as the bucket,
+// key and Operation it was routed to. Lines are written in the given
+// AccessLogFormat once the response is complete; w must not be nil.
+//
+// This is useful for seeing exactly which S3 calls a client made.
+func WithAccessLog(w io.Writer, format AccessLogFormat) Option {
+	return func(g *GoFakeS3) { g.accessLog = &accessLog{out: w, format: format} }
+}
+
+// WithMetrics reports every request served to collector, once the response
+// is complete. See MetricsCollector.
+func WithMetrics(collector MetricsCollector) Option {
+	return func(g *GoFakeS3) { g.metrics = collector }
+}
+
 // WithRequestID sets the starting ID used to generate the "x-amz-request-id"
 // header.
 func WithRequestID(id uint64) Option {
@@ -69,6 +206,18 @@ func WithHostBucket(enabled bool) Option {
 	return func(g *GoFakeS3) { g.hostBucket = enabled }
 }
 
+// WithWebsiteServing makes GoFakeS3 behave like an S3 website endpoint for
+// buckets that have a website configuration, when they are addressed using
+// VirtualHost-style URLs (see WithHostBucket). GET and HEAD requests without
+// a query string for the bucket root, or for a key ending in '/', return the
+// configured IndexDocument. Requests for missing objects return the
+// ErrorDocument, with a 404 status.
+//
+// Redirects and routing rules are not supported.
+func WithWebsiteServing() Option {
+	return func(g *GoFakeS3) { g.websiteServing = true }
+}
+
 // WithoutVersioning disables versioning on the passed backend, if it supported it.
 func WithoutVersioning() Option {
 	return func(g *GoFakeS3) { g.versioned = nil }
@@ -80,12 +229,143 @@ func WithoutVersioning() Option {
 // By default, GoFakeS3 will simply retry a request for a page of objects
 // without the page if the Backend does not implement pagination. This can
 // be used to enable an error in that condition instead.
+//
+// This is the same as WithStrictPagination.
 func WithUnimplementedPageError() Option {
 	return func(g *GoFakeS3) { g.failOnUnimplementedPage = true }
 }
 
+// WithStrictPagination fails ListObjects and ListObjectsV2 with
+// ErrNotImplemented if the Backend returns ErrInternalPageNotImplemented for
+// a page of objects.
+//
+// By default, the request is retried without the page instead, which lists
+// the whole bucket every time and returns every key in one response. A
+// warning is logged at LogWarn each time this happens, so a Backend that is
+// missing pagination can be found before the rescans become slow.
+func WithStrictPagination() Option {
+	return func(g *GoFakeS3) { g.failOnUnimplementedPage = true }
+}
+
 // WithAutoBucket instructs GoFakeS3 to create buckets that don't exist on first use,
 // rather than returning ErrNoSuchBucket.
 func WithAutoBucket(enabled bool) Option {
 	return func(g *GoFakeS3) { g.autoBucket = true }
 }
+
+// WithAllowForceDelete enables a non-standard extension to DeleteBucket: if
+// the request has a 'force' query parameter or an 'x-amz-force: true' header,
+// every object in the bucket is deleted first, instead of failing with
+// ErrBucketNotEmpty. Objects protected by object lock are never deleted.
+//
+// This is disabled by default, as S3 does not support it.
+func WithAllowForceDelete(enabled bool) Option {
+	return func(g *GoFakeS3) { g.allowForceDelete = enabled }
+}
+
+// WithDenyPattern makes every request for one of operations whose
+// 'bucket/key' matches pattern fail with ErrAccessDenied, regardless of
+// authentication, ACLs or bucket policies. Requests that do not address an
+// object are matched against the bucket name alone. If operations is empty,
+// every operation is denied.
+//
+// This is intended for testing how clients handle a denied request. The
+// option may be used more than once; a request is denied if any pattern
+// matches.
+func WithDenyPattern(pattern *regexp.Regexp, operations []Operation) Option {
+	rule := denyRule{pattern: pattern, operations: map[Operation]bool{}}
+	for _, op := range operations {
+		rule.operations[op] = true
+	}
+	return func(g *GoFakeS3) { g.denyRules = append(g.denyRules, rule) }
+}
+
+// WithStrictRegion reports all buckets as belonging to region, and rejects
+// requests signed for any other region with a '301 PermanentRedirect' that
+// carries the 'x-amz-bucket-region' header, as S3 does when a client uses the
+// wrong regional endpoint. The AWS SDKs use this to retry against the
+// correct region.
+//
+// Requests that are not signed with AWS Signature Version 4 do not carry a
+// region and are not checked.
+func WithStrictRegion(region string) Option {
+	return func(g *GoFakeS3) { g.region = region }
+}
+
+// WithCompressListings enables gzip compression of object listing responses
+// (ListObjects, ListObjectsV2 and ListObjectVersions) for clients that send
+// 'Accept-Encoding: gzip'. Object bodies are never compressed.
+func WithCompressListings(enabled bool) Option {
+	return func(g *GoFakeS3) { g.compressListings = enabled }
+}
+
+// WithResponseTrailers sends the object's ETag and a CRC32 checksum of the
+// bytes sent as HTTP trailers after the body of a GET, so a client can verify
+// the integrity of what it read. This is not something S3 does.
+//
+// Trailers require HTTP/2 or a chunked HTTP/1.1 response; with HTTP/1.1 the
+// Content-Length header is omitted so the body is chunked.
+func WithResponseTrailers(enabled bool) Option {
+	return func(g *GoFakeS3) { g.responseTrailersEnabled = enabled }
+}
+
+// WithPrefixPlaceholders adds an empty object for the prefix itself to object
+// listings whose prefix ends in '/', if no such object exists. Some clients
+// that treat the bucket as a filesystem expect these "directory" placeholders,
+// but S3 never returns them, so this is disabled by default.
+func WithPrefixPlaceholders(enabled bool) Option {
+	return func(g *GoFakeS3) { g.prefixPlaceholders = enabled }
+}
+
+// WithBucketQuota limits the total size of the objects stored in each of the
+// named buckets, in bytes. A PutObject or CompleteMultipartUpload that would
+// take a bucket over its quota fails with ErrQuotaExceeded.
+//
+// Quotas are only enforced if the Backend implements QuotaBackend. The size
+// of an object that would be replaced is not subtracted from the usage, as
+// it may be kept as a noncurrent version.
+func WithBucketQuota(quotas map[string]int64) Option {
+	return func(g *GoFakeS3) {
+		g.bucketQuotas = make(map[string]int64, len(quotas))
+		for bucket, quota := range quotas {
+			g.bucketQuotas[bucket] = quota
+		}
+	}
+}
+
+// WithBackendMemoryLimit makes PutObject, POST uploads, CopyObject,
+// UploadPart and CompleteMultipartUpload fail with ErrServiceUnavailable if
+// the data stored in the backend, together with the parts of multipart
+// uploads held in memory, would take up more than limit bytes. This stops a
+// runaway test from exhausting the memory of the process when using s3mem.
+//
+// Only a Backend that implements QuotaBackend has its stored objects
+// counted; for any other Backend, only the parts of multipart uploads held in
+// memory count towards the limit. Parts written to a temporary directory
+// using WithMultipartTempDir are not counted. A limit of '0', the default,
+// disables the check.
+func WithBackendMemoryLimit(limit int64) Option {
+	return func(g *GoFakeS3) { g.memoryLimit = limit }
+}
+
+// WithMultipartTempDir writes the parts of multipart uploads to temporary
+// files in dir, rather than holding them in memory, so large uploads can be
+// tested without running out of memory. The files are removed when the
+// upload is completed or aborted. dir must already exist.
+func WithMultipartTempDir(dir string) Option {
+	return func(g *GoFakeS3) { g.uploader.tempDir = dir }
+}
+
+// WithReadTimeout fails a request with ErrRequestTimeout if the client stops
+// sending its body for longer than timeout, such as in the middle of a
+// PutObject or UploadPart, so a hung client cannot hold up a shared server
+// indefinitely. The connection is closed after the error is sent.
+//
+// The timeout applies to each read of the body rather than to the request
+// as a whole, so slow but steady uploads are not affected. It is separate
+// from the clock used by WithTimeSkewLimit. Use the WriteTimeout of
+// http.Server to bound clients that are slow to read responses. A timeout
+// of '0', the default, disables the check.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(g *GoFakeS3) { g.readTimeout = timeout }
+}
@@ -0,0 +1,92 @@
+package gofakes3_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oneclickvirt/gofakes3"
+)
+
+// accessLogLines receives each line written to the access log. The line is
+// written after the response is sent, so the test has to wait for it.
+type accessLogLines chan string
+
+func (c accessLogLines) Write(b []byte) (int, error) {
+	c <- string(b)
+	return len(b), nil
+}
+
+func (c accessLogLines) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case line := <-c:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for access log line")
+		return ""
+	}
+}
+
+func TestAccessLogText(t *testing.T) {
+	lines := make(accessLogLines, 10)
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithAccessLog(lines, gofakes3.AccessLogText)))
+	defer ts.Close()
+	ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+	rs, err := httpClient().Get(ts.url("/" + defaultBucket + "/foo"))
+	ts.OK(err)
+	rs.Body.Close()
+
+	line := lines.next(t)
+	id := rs.Header.Get("x-amz-request-id")
+	for _, want := range []string{
+		`"GET /` + defaultBucket + `/foo HTTP/1.1" 200 5 `,
+		" " + id + " GetObject " + defaultBucket + " foo ",
+	} {
+		if !strings.Contains(line, want) {
+			t.Fatalf("expected %q in access log line %q", want, line)
+		}
+	}
+	if !strings.HasSuffix(line, "ms\n") {
+		t.Fatal("expected duration at the end of the line", line)
+	}
+
+	rs, err = httpClient().Get(ts.url("/" + defaultBucket + "/missing"))
+	ts.OK(err)
+	rs.Body.Close()
+	if line := lines.next(t); !strings.Contains(line, `HTTP/1.1" 404 `) {
+		t.Fatal("unexpected access log line", line)
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	lines := make(accessLogLines, 10)
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithAccessLog(lines, gofakes3.AccessLogJSON)))
+	defer ts.Close()
+
+	rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/foo"), strings.NewReader("hello"))
+	ts.OK(err)
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	rs.Body.Close()
+
+	var entry struct {
+		Method    string
+		Status    int
+		Bytes     int64
+		RequestID string
+		Operation string
+		Bucket    string
+		Key       string
+	}
+	ts.OK(json.Unmarshal([]byte(lines.next(t)), &entry))
+
+	if entry.Method != "PUT" || entry.Status != http.StatusOK || entry.Bytes != 0 ||
+		entry.Operation != string(gofakes3.OpPutObject) || entry.Bucket != defaultBucket || entry.Key != "foo" ||
+		entry.RequestID != rs.Header.Get("x-amz-request-id") {
+		t.Fatalf("unexpected access log entry %+v", entry)
+	}
+}
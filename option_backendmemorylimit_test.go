@@ -0,0 +1,178 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+	"github.com/oneclickvirt/gofakes3/s3mem"
+)
+
+// slowMemBackend delays every PutObject. Unlike slowPutBackend, it keeps the
+// optional interfaces of s3mem.Backend, so stored objects are counted.
+type slowMemBackend struct {
+	*s3mem.Backend
+	delay time.Duration
+}
+
+func (b *slowMemBackend) PutObject(ctx context.Context, bucketName, key string, meta map[string]string, input io.Reader, size int64) (gofakes3.PutObjectResult, error) {
+	time.Sleep(b.delay)
+	return b.Backend.PutObject(ctx, bucketName, key, meta, input, size)
+}
+
+func TestBackendMemoryLimit(t *testing.T) {
+	// The SDK retries ServiceUnavailable errors, which slows the tests down:
+	s3Client := func(ts *testServer) *s3.S3 {
+		svc := ts.s3Client()
+		svc.Retryer = client.DefaultRetryer{}
+		return svc
+	}
+	putObject := func(ts *testServer, bucket, key, body string) error {
+		_, err := s3Client(ts).PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader([]byte(body)),
+		})
+		return err
+	}
+
+	t.Run("put", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithBackendMemoryLimit(10)))
+		defer ts.Close()
+		ts.backendCreateBucket("other")
+
+		ts.OK(putObject(ts, defaultBucket, "a", "123456"))
+		if err := putObject(ts, "other", "b", "12345"); !hasErrorCode(err, gofakes3.ErrServiceUnavailable) {
+			t.Fatal("expected ServiceUnavailable, found", err)
+		}
+		if ts.backendObjectExists("other", "b") {
+			t.Fatal("object stored despite the limit")
+		}
+		ts.OK(putObject(ts, "other", "b", "1234"))
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(
+			gofakes3.WithMinPartSize(1),
+			gofakes3.WithBackendMemoryLimit(10),
+		))
+		defer ts.Close()
+
+		uploadID := ts.createMultipartUpload(defaultBucket, "obj", nil)
+		parts := []*s3.CompletedPart{
+			ts.uploadPart(defaultBucket, "obj", uploadID, 1, []byte("123456")),
+		}
+
+		// The parts of the upload in progress take up memory too:
+		if err := putObject(ts, defaultBucket, "a", "12345"); !hasErrorCode(err, gofakes3.ErrServiceUnavailable) {
+			t.Fatal("expected ServiceUnavailable, found", err)
+		}
+		_, err := s3Client(ts).UploadPart(&s3.UploadPartInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("obj"),
+			UploadId:   aws.String(uploadID),
+			PartNumber: aws.Int64(2),
+			Body:       bytes.NewReader([]byte("78901")),
+		})
+		if !hasErrorCode(err, gofakes3.ErrServiceUnavailable) {
+			t.Fatal("expected ServiceUnavailable, found", err)
+		}
+
+		// The parts are released when the upload is completed:
+		ts.assertCompleteUpload(defaultBucket, "obj", uploadID, parts, []byte("123456"))
+		ts.OK(putObject(ts, defaultBucket, "a", "1234"))
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithBackendMemoryLimit(10)))
+		defer ts.Close()
+
+		uploadID := ts.createMultipartUpload(defaultBucket, "obj", nil)
+		ts.uploadPart(defaultBucket, "obj", uploadID, 1, []byte("123456"))
+		_, err := ts.s3Client().AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(defaultBucket),
+			Key:      aws.String("obj"),
+			UploadId: aws.String(uploadID),
+		})
+		ts.OK(err)
+		ts.OK(putObject(ts, defaultBucket, "a", "0123456789"))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		ts := newTestServer(t, withVersioning(), withFakerOptions(gofakes3.WithBackendMemoryLimit(10)))
+		defer ts.Close()
+
+		ts.OK(putObject(ts, defaultBucket, "a", "123456"))
+		ts.OK(putObject(ts, defaultBucket, "a", "1234"))
+		if err := putObject(ts, defaultBucket, "b", "1"); !hasErrorCode(err, gofakes3.ErrServiceUnavailable) {
+			t.Fatal("expected ServiceUnavailable, found", err)
+		}
+
+		// Deleting the noncurrent version frees its bytes:
+		versions, err := ts.s3Client().ListObjectVersions(&s3.ListObjectVersionsInput{Bucket: aws.String(defaultBucket)})
+		ts.OK(err)
+		for _, version := range versions.Versions {
+			if !aws.BoolValue(version.IsLatest) {
+				_, err := ts.s3Client().DeleteObject(&s3.DeleteObjectInput{
+					Bucket:    aws.String(defaultBucket),
+					Key:       version.Key,
+					VersionId: version.VersionId,
+				})
+				ts.OK(err)
+			}
+		}
+		ts.OK(putObject(ts, defaultBucket, "b", "123456"))
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		// Slow writes make sure the requests overlap:
+		backend := &slowMemBackend{Backend: s3mem.New(), delay: 50 * time.Millisecond}
+		ts := newTestServer(t, withBackend(backend), withFakerOptions(gofakes3.WithBackendMemoryLimit(10)))
+		defer ts.Close()
+
+		svc := s3Client(ts)
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := svc.PutObject(&s3.PutObjectInput{
+					Bucket: aws.String(defaultBucket),
+					Key:    aws.String(fmt.Sprint(i)),
+					Body:   bytes.NewReader([]byte("12345")),
+				})
+				if err != nil && !hasErrorCode(err, gofakes3.ErrServiceUnavailable) {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		usage, err := backend.TotalUsage(context.Background())
+		ts.OK(err)
+		if usage > 10 {
+			t.Fatal("stored", usage, "bytes despite the limit")
+		}
+	})
+
+	t.Run("temp-dir", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(
+			gofakes3.WithMultipartTempDir(t.TempDir()),
+			gofakes3.WithBackendMemoryLimit(10),
+		))
+		defer ts.Close()
+
+		// Parts written to disk are not counted:
+		uploadID := ts.createMultipartUpload(defaultBucket, "obj", nil)
+		ts.uploadPart(defaultBucket, "obj", uploadID, 1, []byte("0123456789a"))
+		ts.OK(putObject(ts, defaultBucket, "a", "0123456789"))
+	})
+}
@@ -0,0 +1,129 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+	"github.com/oneclickvirt/gofakes3/s3mem"
+)
+
+func TestBucketQuota(t *testing.T) {
+	putObject := func(ts *testServer, bucket, key, body string) error {
+		_, err := ts.s3Client().PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader([]byte(body)),
+		})
+		return err
+	}
+
+	t.Run("put", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(
+			gofakes3.WithBucketQuota(map[string]int64{defaultBucket: 10}),
+		))
+		defer ts.Close()
+		ts.backendCreateBucket("unlimited")
+
+		ts.OK(putObject(ts, defaultBucket, "a", "123456"))
+		if err := putObject(ts, defaultBucket, "b", "12345"); !hasErrorCode(err, gofakes3.ErrQuotaExceeded) {
+			t.Fatal("expected QuotaExceeded, found", err)
+		}
+		if ts.backendObjectExists(defaultBucket, "b") {
+			t.Fatal("object stored despite the quota")
+		}
+		ts.OK(putObject(ts, defaultBucket, "b", "1234"))
+		ts.OK(putObject(ts, "unlimited", "b", "0123456789abcdef"))
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(
+			gofakes3.WithMinPartSize(1),
+			gofakes3.WithBucketQuota(map[string]int64{defaultBucket: 10}),
+		))
+		defer ts.Close()
+
+		svc := ts.s3Client()
+		uploadID := ts.createMultipartUpload(defaultBucket, "obj", nil)
+		parts := []*s3.CompletedPart{
+			ts.uploadPart(defaultBucket, "obj", uploadID, 1, []byte("123456")),
+			ts.uploadPart(defaultBucket, "obj", uploadID, 2, []byte("78901")),
+		}
+		_, err := svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(defaultBucket),
+			Key:             aws.String("obj"),
+			UploadId:        aws.String(uploadID),
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+		if !hasErrorCode(err, gofakes3.ErrQuotaExceeded) {
+			t.Fatal("expected QuotaExceeded, found", err)
+		}
+
+		// The upload is kept, so it can be completed with fewer parts:
+		ts.assertCompleteUpload(defaultBucket, "obj", uploadID, parts[:1], []byte("123456"))
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(
+			gofakes3.WithBucketQuota(map[string]int64{defaultBucket: 10}),
+		))
+		defer ts.Close()
+		ts.backendCreateBucket("unlimited")
+		svc := ts.s3Client()
+
+		ts.OK(putObject(ts, defaultBucket, "a", "123456"))
+		ts.OK(putObject(ts, "unlimited", "big", "12345"))
+
+		_, err := svc.CopyObject(&s3.CopyObjectInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("b"),
+			CopySource: aws.String("unlimited/big"),
+		})
+		if !hasErrorCode(err, gofakes3.ErrQuotaExceeded) {
+			t.Fatal("expected QuotaExceeded, found", err)
+		}
+		if ts.backendObjectExists(defaultBucket, "b") {
+			t.Fatal("object copied despite the quota")
+		}
+
+		// Copying into another bucket is not affected:
+		ts.OKAll(svc.CopyObject(&s3.CopyObjectInput{
+			Bucket:     aws.String("unlimited"),
+			Key:        aws.String("a"),
+			CopySource: aws.String(defaultBucket + "/a"),
+		}))
+
+		uploadID := ts.createMultipartUpload(defaultBucket, "c", nil)
+		_, err = svc.UploadPartCopy(&s3.UploadPartCopyInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("c"),
+			UploadId:   aws.String(uploadID),
+			PartNumber: aws.Int64(1),
+			CopySource: aws.String("unlimited/big"),
+		})
+		if !hasErrorCode(err, gofakes3.ErrQuotaExceeded) {
+			t.Fatal("expected QuotaExceeded, found", err)
+		}
+
+		// A range that fits is accepted:
+		ts.OKAll(svc.UploadPartCopy(&s3.UploadPartCopyInput{
+			Bucket:          aws.String(defaultBucket),
+			Key:             aws.String("c"),
+			UploadId:        aws.String(uploadID),
+			PartNumber:      aws.Int64(1),
+			CopySource:      aws.String("unlimited/big"),
+			CopySourceRange: aws.String("bytes=0-3"),
+		}))
+	})
+
+	t.Run("backend-without-usage", func(t *testing.T) {
+		ts := newTestServer(t,
+			withBackend(&backendWithUnimplementedPaging{s3mem.New()}),
+			withFakerOptions(gofakes3.WithBucketQuota(map[string]int64{defaultBucket: 1})),
+		)
+		defer ts.Close()
+		ts.OK(putObject(ts, defaultBucket, "a", "123456"))
+	})
+}
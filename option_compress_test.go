@@ -0,0 +1,72 @@
+package gofakes3_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestCompressListings(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithCompressListings(true)))
+	defer ts.Close()
+	ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+	listing := func(acceptEncoding string) *http.Response {
+		rq, err := http.NewRequest("GET", ts.url("/"+defaultBucket), nil)
+		ts.OK(err)
+		rq.Header.Set("Accept-Encoding", acceptEncoding)
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		return rs
+	}
+
+	rs := listing("gzip")
+	defer rs.Body.Close()
+	if rs.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatal("expected gzip response, found", rs.Header.Get("Content-Encoding"))
+	}
+	gz, err := gzip.NewReader(rs.Body)
+	ts.OK(err)
+	body, err := ioutil.ReadAll(gz)
+	ts.OK(err)
+	if !strings.Contains(string(body), "<Key>foo</Key>") {
+		t.Fatal("unexpected body", string(body))
+	}
+
+	for _, enc := range []string{"identity", "gzip;q=0"} {
+		rs := listing(enc)
+		rs.Body.Close()
+		if rs.Header.Get("Content-Encoding") != "" {
+			t.Fatal("unexpected content encoding for", enc, rs.Header.Get("Content-Encoding"))
+		}
+	}
+
+	// The SDK's transport decompresses the listing transparently:
+	svc := ts.s3Client()
+	out, err := svc.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+	if len(out.Contents) != 1 || aws.StringValue(out.Contents[0].Key) != "foo" {
+		t.Fatal("unexpected listing", out.Contents)
+	}
+}
+
+func TestCompressListingsDisabled(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	rq, err := http.NewRequest("GET", ts.url("/"+defaultBucket), nil)
+	ts.OK(err)
+	rq.Header.Set("Accept-Encoding", "gzip")
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	defer rs.Body.Close()
+	if rs.Header.Get("Content-Encoding") != "" {
+		t.Fatal("unexpected content encoding", rs.Header.Get("Content-Encoding"))
+	}
+}
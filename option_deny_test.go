@@ -0,0 +1,54 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestDenyPattern(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(
+		gofakes3.WithDenyPattern(regexp.MustCompile(`^`+defaultBucket+`/secret/`), []gofakes3.Operation{gofakes3.OpGetObject, gofakes3.OpHeadObject}),
+		gofakes3.WithDenyPattern(regexp.MustCompile(`\.lock$`), nil),
+	))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.backendPutString(defaultBucket, "secret/file", nil, "hello")
+	ts.backendPutString(defaultBucket, "public/file", nil, "hello")
+	ts.backendPutString(defaultBucket, "public/file.lock", nil, "hello")
+
+	get := func(key string) error {
+		rs, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String(defaultBucket), Key: aws.String(key)})
+		if err == nil {
+			rs.Body.Close()
+		}
+		return err
+	}
+
+	if err := get("secret/file"); !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+	if err := get("public/file.lock"); !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+	ts.OK(get("public/file"))
+
+	// Only the listed operations are denied for the first pattern:
+	ts.OKAll(svc.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("secret/other"),
+		Body:   bytes.NewReader([]byte("hello")),
+	}))
+
+	// The second pattern applies to every operation:
+	_, err := svc.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(defaultBucket), Key: aws.String("public/file.lock")})
+	if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+	ts.assertLs(defaultBucket, "", []string{"public/", "secret/"}, nil)
+}
@@ -0,0 +1,107 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func forceDeleteBucket(ts *testServer, bucket string, force bool) error {
+	ts.Helper()
+	svc := ts.s3Client()
+	rq, _ := svc.DeleteBucketRequest(&s3.DeleteBucketInput{Bucket: aws.String(bucket)})
+	if force {
+		rq.HTTPRequest.Header.Set("x-amz-force", "true")
+	}
+	return rq.Send()
+}
+
+func assertBucketDeleted(ts *testServer, bucket string) {
+	ts.Helper()
+	_, err := ts.s3Client().HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if !hasErrorCode(err, "NotFound") {
+		ts.Fatal("expected bucket to be deleted, found", err)
+	}
+}
+
+func TestForceDeleteBucket(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithAllowForceDelete(true)))
+	defer ts.Close()
+
+	// More objects than fit in a single page:
+	for i := 0; i < gofakes3.DefaultMaxBucketKeys+5; i++ {
+		ts.backendPutString(defaultBucket, fmt.Sprintf("obj%04d", i), nil, "hello")
+	}
+
+	if err := forceDeleteBucket(ts, defaultBucket, false); !hasErrorCode(err, gofakes3.ErrBucketNotEmpty) {
+		t.Fatal("expected BucketNotEmpty, found", err)
+	}
+	ts.OK(forceDeleteBucket(ts, defaultBucket, true))
+	assertBucketDeleted(ts, defaultBucket)
+}
+
+func TestForceDeleteBucketQuery(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithAllowForceDelete(true)))
+	defer ts.Close()
+	ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+	rq, err := http.NewRequest("DELETE", ts.url("/"+defaultBucket+"?force"), nil)
+	ts.OK(err)
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusNoContent {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+}
+
+func TestForceDeleteBucketDisabled(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	ts.backendPutString(defaultBucket, "foo", nil, "hello")
+
+	if err := forceDeleteBucket(ts, defaultBucket, true); !hasErrorCode(err, gofakes3.ErrBucketNotEmpty) {
+		t.Fatal("expected BucketNotEmpty, found", err)
+	}
+}
+
+func TestForceDeleteBucketVersioned(t *testing.T) {
+	ts := newTestServer(t, withVersioning(), withFakerOptions(gofakes3.WithAllowForceDelete(true)))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.backendPutString(defaultBucket, "foo", nil, "v1")
+	ts.backendPutString(defaultBucket, "foo", nil, "v2")
+	ts.OKAll(svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+	}))
+
+	ts.OK(forceDeleteBucket(ts, defaultBucket, true))
+	assertBucketDeleted(ts, defaultBucket)
+}
+
+func TestForceDeleteBucketObjectLock(t *testing.T) {
+	ts := newTestServer(t, withVersioning(), withFakerOptions(gofakes3.WithAllowForceDelete(true)))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.OKAll(svc.PutObject(&s3.PutObjectInput{
+		Bucket:                    aws.String(defaultBucket),
+		Key:                       aws.String("locked"),
+		Body:                      bytes.NewReader([]byte("hello")),
+		ObjectLockMode:            aws.String("COMPLIANCE"),
+		ObjectLockRetainUntilDate: aws.Time(defaultDate.Add(time.Hour)),
+	}))
+
+	if err := forceDeleteBucket(ts, defaultBucket, true); !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+	ts.assertObject(defaultBucket, "locked", nil, "hello")
+}
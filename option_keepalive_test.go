@@ -0,0 +1,132 @@
+package gofakes3_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+	"github.com/oneclickvirt/gofakes3/s3mem"
+)
+
+// slowPutBackend delays every PutObject, and then fails it if err is set.
+type slowPutBackend struct {
+	gofakes3.Backend
+	delay time.Duration
+	err   error
+}
+
+func (b *slowPutBackend) PutObject(ctx context.Context, bucketName, key string, meta map[string]string, input io.Reader, size int64) (gofakes3.PutObjectResult, error) {
+	time.Sleep(b.delay)
+	if b.err != nil {
+		return gofakes3.PutObjectResult{}, b.err
+	}
+	return b.Backend.PutObject(ctx, bucketName, key, meta, input, size)
+}
+
+func completeMultipartUploadBody(part *s3.CompletedPart) string {
+	return `<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>` + aws.StringValue(part.ETag) + `</ETag></Part></CompleteMultipartUpload>`
+}
+
+func TestMultipartCompleteKeepAlive(t *testing.T) {
+	backend := &slowPutBackend{Backend: s3mem.New()}
+	ts := newTestServer(t, withBackend(backend), withFakerOptions(
+		gofakes3.WithMinPartSize(0),
+		gofakes3.WithMultipartCompleteKeepAlive(5*time.Millisecond),
+	))
+	defer ts.Close()
+
+	upload := ts.createMultipartUpload(defaultBucket, "multi", nil)
+	part := ts.uploadPart(defaultBucket, "multi", upload, 1, []byte("hello"))
+
+	backend.delay = 50 * time.Millisecond
+	rq, err := http.NewRequest("POST", ts.url("/"+defaultBucket+"/multi?uploadId="+upload), strings.NewReader(completeMultipartUploadBody(part)))
+	ts.OK(err)
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	defer rs.Body.Close()
+	body, err := ioutil.ReadAll(rs.Body)
+	ts.OK(err)
+
+	if rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	// The XML declaration must come first, followed by the keep-alive spaces:
+	rest := strings.TrimPrefix(string(body), `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	if rest == string(body) || !strings.HasPrefix(rest, " ") {
+		t.Fatal("expected keep-alive whitespace, found", string(body))
+	}
+	if !strings.Contains(rest, "<CompleteMultipartUploadResult") {
+		t.Fatal("missing result", string(body))
+	}
+	ts.assertObject(defaultBucket, "multi", nil, "hello")
+}
+
+func TestMultipartCompleteKeepAliveFast(t *testing.T) {
+	// If the upload completes before the first keep-alive is due, the
+	// response is the same as without one:
+	ts := newTestServer(t, withFakerOptions(
+		gofakes3.WithMinPartSize(0),
+		gofakes3.WithMultipartCompleteKeepAlive(time.Minute),
+	))
+	defer ts.Close()
+
+	upload := ts.createMultipartUpload(defaultBucket, "multi", nil)
+	part := ts.uploadPart(defaultBucket, "multi", upload, 1, []byte("hello"))
+	ts.OKAll(ts.s3Client().CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(defaultBucket),
+		Key:             aws.String("multi"),
+		UploadId:        aws.String(upload),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: []*s3.CompletedPart{part}},
+	}))
+	ts.assertObject(defaultBucket, "multi", nil, "hello")
+
+	// Errors still get their own status:
+	_, err := ts.s3Client().CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(defaultBucket),
+		Key:             aws.String("multi"),
+		UploadId:        aws.String(upload),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: []*s3.CompletedPart{part}},
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchUpload) {
+		t.Fatal("expected NoSuchUpload, found", err)
+	}
+}
+
+func TestMultipartCompleteKeepAliveError(t *testing.T) {
+	backend := &slowPutBackend{Backend: s3mem.New()}
+	ts := newTestServer(t, withBackend(backend), withFakerOptions(
+		gofakes3.WithMinPartSize(0),
+		gofakes3.WithMultipartCompleteKeepAlive(5*time.Millisecond),
+	))
+	defer ts.Close()
+
+	upload := ts.createMultipartUpload(defaultBucket, "multi", nil)
+	part := ts.uploadPart(defaultBucket, "multi", upload, 1, []byte("hello"))
+
+	// The status has already been sent when PutObject fails, so the error is
+	// in the body of a 200 response. The SDK looks for it there, but treats
+	// it as a retryable 503, so this checks the raw response instead:
+	backend.delay = 50 * time.Millisecond
+	backend.err = gofakes3.ErrAccessDenied
+	rq, err := http.NewRequest("POST", ts.url("/"+defaultBucket+"/multi?uploadId="+upload), strings.NewReader(completeMultipartUploadBody(part)))
+	ts.OK(err)
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	defer rs.Body.Close()
+	body, err := ioutil.ReadAll(rs.Body)
+	ts.OK(err)
+
+	if rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	if !strings.Contains(string(body), "<Code>AccessDenied</Code>") {
+		t.Fatal("missing error", string(body))
+	}
+}
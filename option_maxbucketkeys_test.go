@@ -0,0 +1,63 @@
+package gofakes3_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestMaxBucketKeys(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithMaxBucketKeys(2)))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	for i := 0; i < 5; i++ {
+		ts.backendPutString(defaultBucket, fmt.Sprintf("obj%d", i), nil, "")
+	}
+
+	for _, maxKeys := range []*int64{aws.Int64(1000), nil} {
+		rs, err := svc.ListObjectsV2(&s3.ListObjectsV2Input{
+			Bucket:  aws.String(defaultBucket),
+			MaxKeys: maxKeys,
+		})
+		ts.OK(err)
+		if len(rs.Contents) != 2 || aws.Int64Value(rs.MaxKeys) != 2 || !aws.BoolValue(rs.IsTruncated) {
+			t.Fatal("expected a truncated page of 2 keys, found", len(rs.Contents), aws.Int64Value(rs.MaxKeys), aws.BoolValue(rs.IsTruncated))
+		}
+	}
+
+	rs, err := svc.ListObjects(&s3.ListObjectsInput{
+		Bucket:  aws.String(defaultBucket),
+		MaxKeys: aws.Int64(1000),
+	})
+	ts.OK(err)
+	if len(rs.Contents) != 2 || !aws.BoolValue(rs.IsTruncated) {
+		t.Fatal("expected a truncated page of 2 keys, found", len(rs.Contents))
+	}
+
+	// A smaller max-keys is still respected:
+	rs, err = svc.ListObjects(&s3.ListObjectsInput{
+		Bucket:  aws.String(defaultBucket),
+		MaxKeys: aws.Int64(1),
+	})
+	ts.OK(err)
+	if len(rs.Contents) != 1 {
+		t.Fatal("expected 1 key, found", len(rs.Contents))
+	}
+
+	var keys, pages int
+	ts.OK(svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket:  aws.String(defaultBucket),
+		MaxKeys: aws.Int64(1000),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		pages++
+		keys += len(page.Contents)
+		return true
+	}))
+	if keys != 5 || pages != 3 {
+		t.Fatal("expected 5 keys in 3 pages, found", keys, pages)
+	}
+}
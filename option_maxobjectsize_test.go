@@ -0,0 +1,133 @@
+package gofakes3_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestMaxObjectSize(t *testing.T) {
+	putObject := func(ts *testServer, key, body string) error {
+		_, err := ts.s3Client().PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader([]byte(body)),
+		})
+		return err
+	}
+
+	t.Run("put", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithMaxObjectSize(10)))
+		defer ts.Close()
+
+		ts.OK(putObject(ts, "a", "0123456789"))
+		if err := putObject(ts, "b", "0123456789a"); !hasErrorCode(err, gofakes3.ErrEntityTooLarge) {
+			t.Fatal("expected EntityTooLarge, found", err)
+		}
+		if ts.backendObjectExists(defaultBucket, "b") {
+			t.Fatal("object stored despite the limit")
+		}
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithMaxObjectSize(10)))
+		defer ts.Close()
+
+		// The limit applies to the copy, even though the source was stored
+		// without it:
+		ts.backendPutString(defaultBucket, "big", nil, "0123456789a")
+		_, err := ts.s3Client().CopyObject(&s3.CopyObjectInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("copy"),
+			CopySource: aws.String(defaultBucket + "/big"),
+		})
+		if !hasErrorCode(err, gofakes3.ErrEntityTooLarge) {
+			t.Fatal("expected EntityTooLarge, found", err)
+		}
+		if ts.backendObjectExists(defaultBucket, "copy") {
+			t.Fatal("object copied despite the limit")
+		}
+	})
+
+	t.Run("declared-size", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithMaxObjectSize(10)))
+		defer ts.Close()
+
+		// The request is rejected without waiting for a body that would
+		// never fit:
+		u, err := url.Parse(ts.server.URL)
+		ts.OK(err)
+		conn, err := net.Dial("tcp", u.Host)
+		ts.OK(err)
+		defer conn.Close()
+		ts.OK(conn.SetDeadline(time.Now().Add(5 * time.Second)))
+		fmt.Fprintf(conn, "PUT /%s/big HTTP/1.1\r\nHost: %s\r\nContent-Length: %d\r\n\r\n", defaultBucket, u.Host, int64(1)<<40)
+
+		rs, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		ts.OK(err)
+		defer rs.Body.Close()
+		if rs.StatusCode != gofakes3.ErrEntityTooLarge.Status() {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(
+			gofakes3.WithMinPartSize(1),
+			gofakes3.WithMaxObjectSize(10),
+		))
+		defer ts.Close()
+
+		svc := ts.s3Client()
+		uploadID := ts.createMultipartUpload(defaultBucket, "obj", nil)
+
+		_, err := svc.UploadPart(&s3.UploadPartInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("obj"),
+			UploadId:   aws.String(uploadID),
+			PartNumber: aws.Int64(1),
+			Body:       bytes.NewReader([]byte("0123456789a")),
+		})
+		if !hasErrorCode(err, gofakes3.ErrEntityTooLarge) {
+			t.Fatal("expected EntityTooLarge, found", err)
+		}
+
+		parts := []*s3.CompletedPart{
+			ts.uploadPart(defaultBucket, "obj", uploadID, 1, []byte("123456")),
+			ts.uploadPart(defaultBucket, "obj", uploadID, 2, []byte("78901")),
+		}
+		_, err = svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(defaultBucket),
+			Key:             aws.String("obj"),
+			UploadId:        aws.String(uploadID),
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+		if !hasErrorCode(err, gofakes3.ErrEntityTooLarge) {
+			t.Fatal("expected EntityTooLarge, found", err)
+		}
+		ts.assertCompleteUpload(defaultBucket, "obj", uploadID, parts[:1], []byte("123456"))
+	})
+
+	t.Run("post", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithMaxObjectSize(10)))
+		defer ts.Close()
+
+		rs := postForm(ts, [][2]string{{"key", "big"}}, []byte("0123456789a"))
+		rs.Body.Close()
+		if rs.StatusCode != gofakes3.ErrEntityTooLarge.Status() {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+		if ts.backendObjectExists(defaultBucket, "big") {
+			t.Fatal("object stored despite the limit")
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestMaxUploadParts(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(
+		gofakes3.WithMinPartSize(0),
+		gofakes3.WithMaxUploadParts(2),
+	))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	upload := ts.createMultipartUpload(defaultBucket, "multi", nil)
+	part1 := ts.uploadPart(defaultBucket, "multi", upload, 1, []byte("abc"))
+	part2 := ts.uploadPart(defaultBucket, "multi", upload, 2, []byte("def"))
+
+	_, err := svc.UploadPart(&s3.UploadPartInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("multi"),
+		Body:       bytes.NewReader([]byte("ghi")),
+		UploadId:   aws.String(upload),
+		PartNumber: aws.Int64(3),
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidPart) {
+		t.Fatal("expected InvalidPart, found", err)
+	}
+
+	complete := func(parts ...*s3.CompletedPart) error {
+		_, err := svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(defaultBucket),
+			Key:             aws.String("multi"),
+			UploadId:        aws.String(upload),
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+		return err
+	}
+
+	part3 := &s3.CompletedPart{ETag: part2.ETag, PartNumber: aws.Int64(3)}
+	if err := complete(part1, part2, part3); !hasErrorCode(err, gofakes3.ErrInvalidPart) {
+		t.Fatal("expected InvalidPart, found", err)
+	}
+
+	ts.OK(complete(part1, part2))
+	ts.assertObject(defaultBucket, "multi", nil, "abcdef")
+}
@@ -0,0 +1,75 @@
+package gofakes3_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+type observedRequest struct {
+	op       gofakes3.Operation
+	status   int
+	dur      time.Duration
+	bytesIn  int64
+	bytesOut int64
+}
+
+// metricsRecorder receives each request reported to the MetricsCollector.
+// Requests are reported after the response is sent, so the test has to wait
+// for them.
+type metricsRecorder chan observedRequest
+
+func (m metricsRecorder) ObserveRequest(op gofakes3.Operation, status int, dur time.Duration, bytesIn, bytesOut int64) {
+	m <- observedRequest{op, status, dur, bytesIn, bytesOut}
+}
+
+func (m metricsRecorder) next(t *testing.T) observedRequest {
+	t.Helper()
+	select {
+	case rq := <-m:
+		return rq
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for metrics")
+		return observedRequest{}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := make(metricsRecorder, 10)
+	ts := newTestServer(t, withFakerOptions(
+		gofakes3.WithMetrics(metrics),
+		gofakes3.WithV4Auth(map[string]string{"dummy-access": "dummy-secret"}),
+	))
+	defer ts.Close()
+
+	svc := ts.s3Client()
+	ts.OKAll(svc.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("foo"),
+		Body:   strings.NewReader("hello"),
+	}))
+	if rq := metrics.next(t); rq.op != gofakes3.OpPutObject || rq.status != http.StatusOK || rq.bytesIn != 5 || rq.dur <= 0 {
+		t.Fatalf("unexpected request %+v", rq)
+	}
+
+	ts.OKAll(svc.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String(defaultBucket)}))
+	if rq := metrics.next(t); rq.op != gofakes3.OpListObjectsV2 || rq.status != http.StatusOK || rq.bytesOut == 0 {
+		t.Fatalf("unexpected request %+v", rq)
+	}
+
+	// Requests that fail authentication are not routed:
+	rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/foo"), strings.NewReader("hello"))
+	ts.OK(err)
+	rq.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=nope")
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	rs.Body.Close()
+	if rq := metrics.next(t); rq.op != gofakes3.OpUnknown || rq.status != rs.StatusCode || rq.bytesOut == 0 {
+		t.Fatalf("unexpected request %+v", rq)
+	}
+}
@@ -0,0 +1,81 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestMultipartTempDir(t *testing.T) {
+	assertFiles := func(t *testing.T, dir string, n int) {
+		t.Helper()
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != n {
+			t.Fatalf("expected %d part files in temp dir, found %d", n, len(files))
+		}
+	}
+
+	t.Run("complete", func(t *testing.T) {
+		dir := t.TempDir()
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithMultipartTempDir(dir), gofakes3.WithMinPartSize(0)))
+		defer ts.Close()
+
+		uploadID := ts.createMultipartUpload(defaultBucket, "obj", nil)
+		ts.uploadPart(defaultBucket, "obj", uploadID, 1, []byte("replaced"))
+		parts := []*s3.CompletedPart{
+			ts.uploadPart(defaultBucket, "obj", uploadID, 1, []byte("123456")),
+			ts.uploadPart(defaultBucket, "obj", uploadID, 2, []byte("78901")),
+		}
+		assertFiles(t, dir, 2)
+
+		ts.assertCompleteUpload(defaultBucket, "obj", uploadID, parts, []byte("12345678901"))
+		ts.assertObject(defaultBucket, "obj", nil, "12345678901")
+		assertFiles(t, dir, 0)
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		dir := t.TempDir()
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithMultipartTempDir(dir), gofakes3.WithMinPartSize(0)))
+		defer ts.Close()
+
+		uploadID := ts.createMultipartUpload(defaultBucket, "obj", nil)
+		ts.uploadPart(defaultBucket, "obj", uploadID, 1, []byte("123456"))
+		assertFiles(t, dir, 1)
+
+		_, err := ts.s3Client().AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(defaultBucket),
+			Key:      aws.String("obj"),
+			UploadId: aws.String(uploadID),
+		})
+		ts.OK(err)
+		assertFiles(t, dir, 0)
+	})
+
+	t.Run("bad-digest", func(t *testing.T) {
+		dir := t.TempDir()
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithMultipartTempDir(dir), gofakes3.WithMinPartSize(0)))
+		defer ts.Close()
+
+		uploadID := ts.createMultipartUpload(defaultBucket, "obj", nil)
+		_, err := ts.s3Client().UploadPart(&s3.UploadPartInput{
+			Bucket:            aws.String(defaultBucket),
+			Key:               aws.String("obj"),
+			UploadId:          aws.String(uploadID),
+			PartNumber:        aws.Int64(1),
+			Body:              bytes.NewReader([]byte("123456")),
+			ChecksumAlgorithm: aws.String("SHA256"),
+			ChecksumSHA256:    aws.String("47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="),
+		})
+		if !hasErrorCode(err, gofakes3.ErrBadDigest) {
+			t.Fatal("expected BadDigest, found", err)
+		}
+		assertFiles(t, dir, 0)
+	})
+}
@@ -0,0 +1,60 @@
+package gofakes3_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestPrefixPlaceholders(t *testing.T) {
+	listKeys := func(ts *testServer, prefix string) []string {
+		t.Helper()
+		out, err := ts.s3Client().ListObjectsV2(&s3.ListObjectsV2Input{
+			Bucket: aws.String(defaultBucket),
+			Prefix: aws.String(prefix),
+		})
+		ts.OK(err)
+		var keys []string
+		for _, c := range out.Contents {
+			keys = append(keys, aws.StringValue(c.Key))
+		}
+		if aws.Int64Value(out.KeyCount) != int64(len(keys)) {
+			t.Fatal("unexpected KeyCount", aws.Int64Value(out.KeyCount), "!=", len(keys))
+		}
+		return keys
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "dir/a", nil, "a")
+		ts.backendPutString(defaultBucket, "dir/b", nil, "b")
+
+		keys := listKeys(ts, "dir/")
+		if len(keys) != 2 || keys[0] != "dir/a" || keys[1] != "dir/b" {
+			t.Fatal("unexpected keys", keys)
+		}
+		if keys := listKeys(ts, "missing/"); len(keys) != 0 {
+			t.Fatal("unexpected keys", keys)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithPrefixPlaceholders(true)))
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "dir/a", nil, "a")
+		ts.backendPutString(defaultBucket, "other/", nil, "")
+
+		keys := listKeys(ts, "dir/")
+		if len(keys) != 2 || keys[0] != "dir/a" || keys[1] != "dir/" {
+			t.Fatal("unexpected keys", keys)
+		}
+
+		// An existing placeholder is not duplicated:
+		if keys := listKeys(ts, "other/"); len(keys) != 1 || keys[0] != "other/" {
+			t.Fatal("unexpected keys", keys)
+		}
+	})
+}
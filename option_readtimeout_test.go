@@ -0,0 +1,97 @@
+package gofakes3_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestReadTimeout(t *testing.T) {
+	// stall sends the headers and the first half of a body to path, then
+	// waits for the response without sending the rest. The server waits for
+	// the client to hang up, so the connection must be closed before the
+	// server is.
+	stall := func(ts *testServer, path string) (net.Conn, *http.Response) {
+		u, err := url.Parse(ts.server.URL)
+		ts.OK(err)
+		conn, err := net.Dial("tcp", u.Host)
+		ts.OK(err)
+		ts.OK(conn.SetDeadline(time.Now().Add(5 * time.Second)))
+		fmt.Fprintf(conn, "PUT %s HTTP/1.1\r\nHost: %s\r\nContent-Length: 10\r\n\r\nhello", path, u.Host)
+
+		rs, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		ts.OK(err)
+		return conn, rs
+	}
+
+	assertTimeout := func(ts *testServer, rs *http.Response) {
+		t.Helper()
+		if rs.StatusCode != http.StatusBadRequest {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+		body, err := ioutil.ReadAll(rs.Body)
+		ts.OK(err)
+		if !strings.Contains(string(body), "<Code>RequestTimeout</Code>") {
+			t.Fatal("expected RequestTimeout, found", string(body))
+		}
+		if !rs.Close {
+			t.Fatal("expected the connection to be closed")
+		}
+	}
+
+	t.Run("put", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithReadTimeout(50*time.Millisecond)))
+		defer ts.Close()
+
+		conn, rs := stall(ts, "/"+defaultBucket+"/stalled")
+		defer conn.Close()
+		assertTimeout(ts, rs)
+		if ts.backendObjectExists(defaultBucket, "stalled") {
+			t.Fatal("object stored despite the timeout")
+		}
+	})
+
+	t.Run("upload-part", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithReadTimeout(50*time.Millisecond)))
+		defer ts.Close()
+
+		uploadID := ts.createMultipartUpload(defaultBucket, "stalled", nil)
+		conn, rs := stall(ts, fmt.Sprintf("/%s/stalled?partNumber=1&uploadId=%s", defaultBucket, uploadID))
+		defer conn.Close()
+		assertTimeout(ts, rs)
+
+		parts, err := ts.s3Client().ListParts(&s3.ListPartsInput{
+			Bucket:   aws.String(defaultBucket),
+			Key:      aws.String("stalled"),
+			UploadId: aws.String(uploadID),
+		})
+		ts.OK(err)
+		if len(parts.Parts) != 0 {
+			t.Fatal("part stored despite the timeout")
+		}
+	})
+
+	t.Run("steady", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithReadTimeout(time.Second)))
+		defer ts.Close()
+
+		_, err := ts.s3Client().PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("object"),
+			Body:   bytes.NewReader([]byte("hello")),
+		})
+		ts.OK(err)
+		ts.assertObject(defaultBucket, "object", nil, "hello")
+	})
+}
@@ -0,0 +1,108 @@
+package gofakes3_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+const strictRegion = "us-west-2"
+
+func newStrictRegionTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newTestServer(t, withFakerOptions(gofakes3.WithStrictRegion(strictRegion)))
+}
+
+func regionRequest(ts *testServer, method, path, region string) *http.Response {
+	ts.Helper()
+	rq, err := http.NewRequest(method, ts.url(path), nil)
+	ts.OK(err)
+	rq.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=dummy-access/20191010/"+region+"/s3/aws4_request, SignedHeaders=host, Signature=0000")
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	return rs
+}
+
+func TestStrictRegionWrongRegion(t *testing.T) {
+	ts := newStrictRegionTestServer(t)
+	defer ts.Close()
+	ts.backendPutString(defaultBucket, "object", nil, "hello")
+
+	// The SDK signs requests for "region", and translates the redirect into
+	// its own error using the x-amz-bucket-region header:
+	svc := ts.s3Client()
+	_, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	if !hasErrorCode(err, "BucketRegionError") || !strings.Contains(err.Error(), strictRegion) {
+		t.Fatal("expected BucketRegionError, found", err)
+	}
+
+	rs := regionRequest(ts, "GET", "/"+defaultBucket+"/object", "eu-west-1")
+	defer rs.Body.Close()
+	if rs.StatusCode != http.StatusMovedPermanently {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	if region := rs.Header.Get("x-amz-bucket-region"); region != strictRegion {
+		t.Fatal("unexpected x-amz-bucket-region", region)
+	}
+	body, err := ioutil.ReadAll(rs.Body)
+	ts.OK(err)
+	endpoint := "<Endpoint>" + defaultBucket + ".s3." + strictRegion + ".amazonaws.com</Endpoint>"
+	if !strings.Contains(string(body), endpoint) || !strings.Contains(string(body), "<Bucket>"+defaultBucket+"</Bucket>") {
+		t.Fatal("unexpected body", string(body))
+	}
+}
+
+func TestStrictRegionHeadBucket(t *testing.T) {
+	ts := newStrictRegionTestServer(t)
+	defer ts.Close()
+
+	rs := regionRequest(ts, "HEAD", "/"+defaultBucket, "eu-west-1")
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusMovedPermanently {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	if region := rs.Header.Get("x-amz-bucket-region"); region != strictRegion {
+		t.Fatal("unexpected x-amz-bucket-region", region)
+	}
+
+	rs = regionRequest(ts, "HEAD", "/"+defaultBucket, strictRegion)
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	if region := rs.Header.Get("x-amz-bucket-region"); region != strictRegion {
+		t.Fatal("unexpected x-amz-bucket-region", region)
+	}
+}
+
+func TestStrictRegionMissingBucket(t *testing.T) {
+	ts := newStrictRegionTestServer(t)
+	defer ts.Close()
+
+	rs := regionRequest(ts, "GET", "/nope/object", "eu-west-1")
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusNotFound {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+}
+
+func TestStrictRegionBucketLocation(t *testing.T) {
+	ts := newStrictRegionTestServer(t)
+	defer ts.Close()
+
+	rs := regionRequest(ts, "GET", "/"+defaultBucket+"?location", strictRegion)
+	defer rs.Body.Close()
+	body, err := ioutil.ReadAll(rs.Body)
+	ts.OK(err)
+	if !strings.Contains(string(body), strictRegion) {
+		t.Fatal("unexpected body", string(body))
+	}
+}
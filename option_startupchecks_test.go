@@ -0,0 +1,56 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/oneclickvirt/gofakes3"
+	"github.com/oneclickvirt/gofakes3/s3mem"
+)
+
+type brokenListBackend struct {
+	gofakes3.Backend
+	err error
+}
+
+func (b *brokenListBackend) ListBuckets(ctx context.Context) ([]gofakes3.BucketInfo, error) {
+	if b.err == nil {
+		panic("broken")
+	}
+	return nil, b.err
+}
+
+func TestNewWithChecks(t *testing.T) {
+	if _, err := gofakes3.NewWithChecks(s3mem.New()); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := gofakes3.NewWithChecks(&brokenListBackend{Backend: s3mem.New(), err: errors.New("no credentials")})
+	if err == nil || !strings.Contains(err.Error(), "no credentials") {
+		t.Fatal("expected error, found", err)
+	}
+
+	_, err = gofakes3.NewWithChecks(&brokenListBackend{Backend: s3mem.New()})
+	if err == nil || !strings.Contains(err.Error(), "panicked") {
+		t.Fatal("expected error, found", err)
+	}
+}
+
+func TestStartupChecks(t *testing.T) {
+	var buf bytes.Buffer
+	logger := gofakes3.StdLog(log.New(&buf, "", 0), gofakes3.LogErr)
+
+	gofakes3.New(&brokenListBackend{Backend: s3mem.New()}, gofakes3.WithLogger(logger))
+	if buf.Len() != 0 {
+		t.Fatal("unexpected log", buf.String())
+	}
+
+	gofakes3.New(&brokenListBackend{Backend: s3mem.New()}, gofakes3.WithLogger(logger), gofakes3.WithStartupChecks(true))
+	if !strings.Contains(buf.String(), "panicked") {
+		t.Fatal("expected startup check to be logged, found", buf.String())
+	}
+}
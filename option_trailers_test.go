@@ -0,0 +1,93 @@
+package gofakes3_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestResponseTrailers(t *testing.T) {
+	const body = "hello, trailers"
+	checksum := gofakes3.ChecksumCRC32.Sum([]byte(body))
+
+	get := func(ts *testServer, client *http.Client, url, rnge string) (*http.Response, string) {
+		t.Helper()
+		rq, err := http.NewRequest("GET", url+"/"+defaultBucket+"/object", nil)
+		ts.OK(err)
+		if rnge != "" {
+			rq.Header.Set("Range", rnge)
+		}
+		rs, err := client.Do(rq)
+		ts.OK(err)
+		defer rs.Body.Close()
+		data, err := ioutil.ReadAll(rs.Body)
+		ts.OK(err)
+		return rs, string(data)
+	}
+
+	assertTrailers := func(ts *testServer, rs *http.Response, etag, checksum string) {
+		t.Helper()
+		if rs.Trailer.Get("ETag") != etag {
+			t.Fatal("unexpected ETag trailer", rs.Trailer.Get("ETag"), "!=", etag)
+		}
+		if v := rs.Trailer.Get("x-amz-checksum-crc32"); v != checksum {
+			t.Fatal("unexpected checksum trailer", v, "!=", checksum)
+		}
+	}
+
+	t.Run("http2", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithResponseTrailers(true)))
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "object", nil, body)
+
+		srv := httptest.NewUnstartedServer(ts.Server())
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		defer srv.Close()
+
+		rs, data := get(ts, srv.Client(), srv.URL, "")
+		if rs.ProtoMajor != 2 {
+			t.Fatal("expected HTTP/2, found", rs.Proto)
+		}
+		if data != body {
+			t.Fatal("unexpected body", data)
+		}
+		assertTrailers(ts, rs, rs.Header.Get("ETag"), checksum)
+
+		// The checksum covers the bytes sent, not the whole object:
+		rs, data = get(ts, srv.Client(), srv.URL, "bytes=0-4")
+		if rs.StatusCode != http.StatusPartialContent || data != "hello" {
+			t.Fatal("unexpected response", rs.StatusCode, data)
+		}
+		assertTrailers(ts, rs, rs.Header.Get("ETag"), gofakes3.ChecksumCRC32.Sum([]byte("hello")))
+	})
+
+	t.Run("http1-chunked", func(t *testing.T) {
+		ts := newTestServer(t, withFakerOptions(gofakes3.WithResponseTrailers(true)))
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "object", nil, body)
+
+		rs, data := get(ts, httpClient(), ts.server.URL, "")
+		if data != body {
+			t.Fatal("unexpected body", data)
+		}
+		if len(rs.TransferEncoding) == 0 || rs.TransferEncoding[0] != "chunked" {
+			t.Fatal("expected chunked response, found", rs.TransferEncoding)
+		}
+		assertTrailers(ts, rs, rs.Header.Get("ETag"), checksum)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+		ts.backendPutString(defaultBucket, "object", nil, body)
+
+		rs, _ := get(ts, httpClient(), ts.server.URL, "")
+		if len(rs.Trailer) != 0 || rs.ContentLength != int64(len(body)) {
+			t.Fatal("unexpected trailers", rs.Trailer, rs.ContentLength)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package gofakes3
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/oneclickvirt/gofakes3/policy"
+)
+
+// validateBucketPolicy checks that a bucket policy document can be understood
+// by the policy package before it is stored.
+func validateBucketPolicy(doc []byte) error {
+	if !json.Valid(doc) {
+		return ErrorMessage(ErrMalformedPolicy, "Policies must be valid JSON and the first byte must be '{'")
+	}
+	if _, err := policy.Parse(doc); err != nil {
+		return ErrorMessage(ErrMalformedPolicy, strings.TrimPrefix(err.Error(), "policy: "))
+	}
+	return nil
+}
+
+// authorize decides whether the request may proceed. An explicit Deny in the
+// bucket policy rejects the request even if it was signed. Anonymous requests
+// are accepted if the bucket policy allows them, otherwise the object's ACL
+// decides.
+func (g *GoFakeS3) authorize(bucket, object string, r *http.Request) error {
+	decision, err := g.evaluateBucketPolicy(bucket, object, r)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case decision == policy.Denied:
+		return ErrAccessDenied
+	case !isAnonymousRequest(r), decision == policy.Allowed:
+		return nil
+	case OperationFromContext(r.Context()) == OpPostObject:
+		// Browser-based uploads are signed in the form, which is checked
+		// once it has been parsed; see checkPostPolicy.
+		return nil
+	default:
+		return g.authorizeAnonymous(bucket, object, r)
+	}
+}
+
+// evaluateBucketPolicy evaluates the bucket policy, if there is one, against
+// the request. Only object reads are currently mapped to a policy action
+// ('s3:GetObject'); all other requests are NotApplicable.
+func (g *GoFakeS3) evaluateBucketPolicy(bucket, object string, r *http.Request) (policy.Decision, error) {
+	if g.policy == nil || !isObjectRead(object, r) {
+		return policy.NotApplicable, nil
+	}
+
+	doc, err := g.policy.GetBucketPolicy(r.Context(), bucket)
+	if HasErrorCode(err, ErrNoSuchBucketPolicy) || HasErrorCode(err, ErrNoSuchBucket) {
+		return policy.NotApplicable, nil
+	} else if err != nil {
+		return policy.NotApplicable, err
+	}
+
+	parsed, err := g.policies.parse(bucket, doc)
+	if err != nil {
+		return policy.NotApplicable, err
+	}
+	return parsed.Evaluate("s3:GetObject", policy.ObjectARN(bucket, object)), nil
+}
+
+// bucketPolicyCache holds the most recently parsed policy of each bucket, so
+// the policy is not parsed again for every object read. A cached policy is
+// only used while the backend returns the same document, so a policy set on
+// the backend directly is picked up as well.
+//
+// The zero value is an empty cache.
+type bucketPolicyCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedBucketPolicy
+}
+
+type cachedBucketPolicy struct {
+	doc    string
+	parsed *policy.Policy
+}
+
+// parse returns the parsed policy doc for the bucket, from the cache if doc
+// has not changed.
+func (c *bucketPolicyCache) parse(bucket string, doc []byte) (*policy.Policy, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[bucket]
+	c.mu.Unlock()
+	if ok && entry.doc == string(doc) {
+		return entry.parsed, nil
+	}
+
+	parsed, err := policy.Parse(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cachedBucketPolicy)
+	}
+	c.entries[bucket] = cachedBucketPolicy{doc: string(doc), parsed: parsed}
+	return parsed, nil
+}
+
+// forget removes the cached policy of the bucket, once the policy or the
+// bucket has been deleted.
+func (c *bucketPolicyCache) forget(bucket string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, bucket)
+}
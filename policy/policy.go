@@ -0,0 +1,280 @@
+// Package policy evaluates a small subset of the S3 bucket policy language.
+//
+// GoFakeS3 has no concept of users or accounts, so the only principal that can
+// be matched is the wildcard principal '*', which matches everybody. Conditions
+// and NotPrincipal are not supported. A statement that cannot be evaluated,
+// because of one of these or because it names some other principal, never
+// matches; it does not make the policy invalid.
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/userguide/bucket-policies.html
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Effect string
+
+const (
+	Allow Effect = "Allow"
+	Deny  Effect = "Deny"
+)
+
+// Decision is the result of evaluating a Policy against a request.
+type Decision int
+
+const (
+	// NotApplicable means no statement in the policy matched the request, so
+	// the decision must be made by some other means, such as an ACL.
+	NotApplicable Decision = iota
+
+	// Allowed means at least one Allow statement matched the request, and no
+	// Deny statements did.
+	Allowed
+
+	// Denied means at least one Deny statement matched the request. An
+	// explicit Deny always overrides an Allow.
+	Denied
+)
+
+func (d Decision) String() string {
+	switch d {
+	case Allowed:
+		return "Allowed"
+	case Denied:
+		return "Denied"
+	default:
+		return "NotApplicable"
+	}
+}
+
+type Policy struct {
+	Version   string        `json:"Version"`
+	ID        string        `json:"Id,omitempty"`
+	Statement StatementList `json:"Statement"`
+}
+
+// Statement is a single statement of a Policy. Exactly one of Action and
+// NotAction, and one of Resource and NotResource, is set.
+type Statement struct {
+	Sid          string          `json:"Sid,omitempty"`
+	Effect       Effect          `json:"Effect"`
+	Principal    Principal       `json:"Principal"`
+	NotPrincipal json.RawMessage `json:"NotPrincipal,omitempty"`
+	Action       StringList      `json:"Action,omitempty"`
+	NotAction    StringList      `json:"NotAction,omitempty"`
+	Resource     StringList      `json:"Resource,omitempty"`
+	NotResource  StringList      `json:"NotResource,omitempty"`
+	Condition    json.RawMessage `json:"Condition,omitempty"`
+}
+
+// StatementList accepts either a single statement or an array of statements.
+type StatementList []Statement
+
+func (s *StatementList) UnmarshalJSON(b []byte) error {
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '{' {
+		var one Statement
+		if err := json.Unmarshal(b, &one); err != nil {
+			return err
+		}
+		*s = StatementList{one}
+		return nil
+	}
+
+	var many []Statement
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*s = many
+	return nil
+}
+
+// Principal is either a string, of which only the wildcard '*' is
+// understood, or an object mapping a principal type (for example 'AWS') to
+// one or more identifiers:
+//
+//	"Principal": "*"
+//	"Principal": {"AWS": "*"}
+//	"Principal": {"AWS": ["arn:aws:iam::111122223333:root"]}
+type Principal struct {
+	Wildcard bool
+	Values   map[string]StringList
+}
+
+func (p *Principal) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*p = Principal{Wildcard: s == "*"}
+		return nil
+	}
+
+	var values map[string]StringList
+	if err := json.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("policy: invalid principal: %w", err)
+	}
+	*p = Principal{Values: values}
+	return nil
+}
+
+// MatchesEveryone reports whether the principal is '*', or {"AWS": "*"}.
+func (p Principal) MatchesEveryone() bool {
+	if p.Wildcard {
+		return true
+	}
+	for _, v := range p.Values["AWS"] {
+		if v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// StringList accepts either a single string or an array of strings.
+type StringList []string
+
+func (s *StringList) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*s = StringList{one}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return fmt.Errorf("policy: expected string or array of strings: %w", err)
+	}
+	*s = many
+	return nil
+}
+
+// Parse decodes and validates a bucket policy document.
+func Parse(doc []byte) (*Policy, error) {
+	var p Policy
+	if err := json.Unmarshal(doc, &p); err != nil {
+		return nil, err
+	}
+	if p.Version == "" {
+		return nil, errors.New("policy: missing required field Version")
+	}
+	if len(p.Statement) == 0 {
+		return nil, errors.New("policy: missing required field Statement")
+	}
+
+	for i, stmt := range p.Statement {
+		if stmt.Effect != Allow && stmt.Effect != Deny {
+			return nil, fmt.Errorf("policy: invalid effect %q in statement %d", stmt.Effect, i)
+		}
+		if (len(stmt.Action) == 0) == (len(stmt.NotAction) == 0) {
+			return nil, fmt.Errorf("policy: statement %d must contain exactly one of Action and NotAction", i)
+		}
+		if (len(stmt.Resource) == 0) == (len(stmt.NotResource) == 0) {
+			return nil, fmt.Errorf("policy: statement %d must contain exactly one of Resource and NotResource", i)
+		}
+	}
+
+	return &p, nil
+}
+
+// Evaluate decides whether the policy allows anybody to perform the action,
+// for example 's3:GetObject', against the resource ARN, for example
+// 'arn:aws:s3:::bucket/key'. Only statements with a wildcard principal are
+// considered.
+func (p *Policy) Evaluate(action, resource string) Decision {
+	if p == nil {
+		return NotApplicable
+	}
+
+	decision := NotApplicable
+	for _, stmt := range p.Statement {
+		if !stmt.matches(action, resource) {
+			continue
+		}
+		if stmt.Effect == Deny {
+			return Denied
+		}
+		decision = Allowed
+	}
+	return decision
+}
+
+func (s Statement) matches(action, resource string) bool {
+	if len(s.Condition) > 0 || len(s.NotPrincipal) > 0 || !s.Principal.MatchesEveryone() {
+		return false
+	}
+
+	if len(s.NotAction) > 0 {
+		if matchAny(s.NotAction, action, true) {
+			return false
+		}
+	} else if !matchAny(s.Action, action, true) {
+		return false
+	}
+
+	if len(s.NotResource) > 0 {
+		return !matchAny(s.NotResource, resource, false)
+	}
+	return matchAny(s.Resource, resource, false)
+}
+
+// ObjectARN returns the ARN used to refer to an object in a policy.
+func ObjectARN(bucket, key string) string {
+	return "arn:aws:s3:::" + bucket + "/" + key
+}
+
+// BucketARN returns the ARN used to refer to a bucket in a policy.
+func BucketARN(bucket string) string {
+	return "arn:aws:s3:::" + bucket
+}
+
+func matchAny(patterns []string, value string, foldCase bool) bool {
+	if foldCase {
+		// Action names are case insensitive, resources are not.
+		value = strings.ToLower(value)
+	}
+	for _, pattern := range patterns {
+		if foldCase {
+			pattern = strings.ToLower(pattern)
+		}
+		if Match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether value matches pattern, where '*' in the pattern
+// matches any sequence of characters (including '/'), and '?' matches any
+// single character.
+func Match(pattern, value string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(value); i++ {
+				if Match(pattern, value[i:]) {
+					return true
+				}
+			}
+			return false
+
+		case '?':
+			if value == "" {
+				return false
+			}
+
+		default:
+			if value == "" || pattern[0] != value[0] {
+				return false
+			}
+		}
+		pattern, value = pattern[1:], value[1:]
+	}
+	return value == ""
+}
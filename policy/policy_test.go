@@ -0,0 +1,111 @@
+package policy_test
+
+import (
+	"testing"
+
+	"github.com/oneclickvirt/gofakes3/policy"
+)
+
+func TestParseInvalid(t *testing.T) {
+	for _, doc := range []string{
+		`nope`,
+		`{"Version": "2012-10-17"}`,
+		`{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "*"}]}`,
+		`{"Version": "2012-10-17", "Statement": [{"Effect": "Maybe", "Principal": "*", "Action": "s3:GetObject", "Resource": "*"}]}`,
+		`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": "*", "Resource": "*"}]}`,
+		`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject"}]}`,
+		`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": "*", "Action": 1, "Resource": "*"}]}`,
+		`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "NotAction": "s3:PutObject", "Resource": "*"}]}`,
+		`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "*", "NotResource": "*"}]}`,
+		`{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Principal": "*", "Action": 1, "Resource": "*"}}`,
+	} {
+		if _, err := policy.Parse([]byte(doc)); err == nil {
+			t.Fatal("expected error for", doc)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	const (
+		allowPublic  = `{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*"}`
+		denySecret   = `{"Effect": "Deny", "Principal": {"AWS": "*"}, "Action": ["s3:Get*"], "Resource": ["arn:aws:s3:::bucket/secret/*"]}`
+		allowUser    = `{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::111122223333:root"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::other/*"}`
+		conditional  = `{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::other/*", "Condition": {"Bool": {"aws:SecureTransport": "true"}}}`
+		notAction    = `{"Effect": "Allow", "Principal": "*", "NotAction": "s3:Put*", "Resource": "arn:aws:s3:::bucket/*"}`
+		notResource  = `{"Effect": "Deny", "Principal": "*", "Action": "s3:GetObject", "NotResource": "arn:aws:s3:::bucket/public/*"}`
+		notPrincipal = `{"Effect": "Allow", "NotPrincipal": {"AWS": "arn:aws:iam::111122223333:root"}, "Action": "s3:GetObject", "Resource": "*"}`
+		namedUser    = `{"Effect": "Allow", "Principal": "arn:aws:iam::111122223333:root", "Action": "s3:GetObject", "Resource": "*"}`
+	)
+
+	for idx, tc := range []struct {
+		statements string
+		action     string
+		resource   string
+		decision   policy.Decision
+	}{
+		{allowPublic, "s3:GetObject", policy.ObjectARN("bucket", "foo"), policy.Allowed},
+		{allowPublic, "S3:GETOBJECT", policy.ObjectARN("bucket", "foo/bar"), policy.Allowed},
+		{allowPublic, "s3:PutObject", policy.ObjectARN("bucket", "foo"), policy.NotApplicable},
+		{allowPublic, "s3:GetObject", policy.ObjectARN("other", "foo"), policy.NotApplicable},
+		{allowPublic, "s3:GetObject", policy.ObjectARN("BUCKET", "foo"), policy.NotApplicable},
+		{allowPublic + "," + denySecret, "s3:GetObject", policy.ObjectARN("bucket", "foo"), policy.Allowed},
+		{allowPublic + "," + denySecret, "s3:GetObject", policy.ObjectARN("bucket", "secret/foo"), policy.Denied},
+		{denySecret + "," + allowPublic, "s3:GetObject", policy.ObjectARN("bucket", "secret/foo"), policy.Denied},
+		{allowUser, "s3:GetObject", policy.ObjectARN("other", "foo"), policy.NotApplicable},
+		{conditional, "s3:GetObject", policy.ObjectARN("other", "foo"), policy.NotApplicable},
+		{notAction, "s3:GetObject", policy.ObjectARN("bucket", "foo"), policy.Allowed},
+		{notAction, "s3:PutObject", policy.ObjectARN("bucket", "foo"), policy.NotApplicable},
+		{notAction, "s3:GetObject", policy.ObjectARN("other", "foo"), policy.NotApplicable},
+		{allowPublic + "," + notResource, "s3:GetObject", policy.ObjectARN("bucket", "public/foo"), policy.Allowed},
+		{allowPublic + "," + notResource, "s3:GetObject", policy.ObjectARN("bucket", "foo"), policy.Denied},
+		{notPrincipal, "s3:GetObject", policy.ObjectARN("bucket", "foo"), policy.NotApplicable},
+		{namedUser, "s3:GetObject", policy.ObjectARN("bucket", "foo"), policy.NotApplicable},
+	} {
+		doc := `{"Version": "2012-10-17", "Statement": [` + tc.statements + `]}`
+		p, err := policy.Parse([]byte(doc))
+		if err != nil {
+			t.Fatal(idx, err)
+		}
+		if result := p.Evaluate(tc.action, tc.resource); result != tc.decision {
+			t.Fatal(idx, "expected", tc.decision, "found", result)
+		}
+	}
+}
+
+func TestParseSingleStatement(t *testing.T) {
+	doc := `{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*"}}`
+	p, err := policy.Parse([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Statement) != 1 {
+		t.Fatal("expected 1 statement, found", len(p.Statement))
+	}
+	if result := p.Evaluate("s3:GetObject", policy.ObjectARN("bucket", "foo")); result != policy.Allowed {
+		t.Fatal("expected", policy.Allowed, "found", result)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for idx, tc := range []struct {
+		pattern, value string
+		match          bool
+	}{
+		{"", "", true},
+		{"*", "", true},
+		{"*", "anything/at/all", true},
+		{"a*c", "abc", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "ab", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"a**", "a", true},
+		{"abc", "abcd", false},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket/", true},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket", false},
+	} {
+		if result := policy.Match(tc.pattern, tc.value); result != tc.match {
+			t.Fatal(idx, tc.pattern, tc.value, "expected", tc.match, "found", result)
+		}
+	}
+}
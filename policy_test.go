@@ -0,0 +1,165 @@
+package gofakes3_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+const testBucketPolicy = `{
+	"Version": "2012-10-17",
+	"Statement": [{
+		"Effect": "Allow",
+		"Principal": "*",
+		"Action": "s3:GetObject",
+		"Resource": "arn:aws:s3:::bucket/*"
+	}]
+}`
+
+func TestBucketPolicy(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.GetBucketPolicy(&s3.GetBucketPolicyInput{Bucket: aws.String(defaultBucket)})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchBucketPolicy) {
+		t.Fatal("expected NoSuchBucketPolicy, found", err)
+	}
+
+	ts.OKAll(svc.PutBucketPolicy(&s3.PutBucketPolicyInput{
+		Bucket: aws.String(defaultBucket),
+		Policy: aws.String(testBucketPolicy),
+	}))
+
+	rs, err := svc.GetBucketPolicy(&s3.GetBucketPolicyInput{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+	if aws.StringValue(rs.Policy) != testBucketPolicy {
+		t.Fatal("unexpected policy", aws.StringValue(rs.Policy))
+	}
+
+	ts.OKAll(svc.DeleteBucketPolicy(&s3.DeleteBucketPolicyInput{Bucket: aws.String(defaultBucket)}))
+
+	_, err = svc.GetBucketPolicy(&s3.GetBucketPolicyInput{Bucket: aws.String(defaultBucket)})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchBucketPolicy) {
+		t.Fatal("expected NoSuchBucketPolicy, found", err)
+	}
+}
+
+func TestBucketPolicyContentType(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.OKAll(svc.PutBucketPolicy(&s3.PutBucketPolicyInput{
+		Bucket: aws.String(defaultBucket),
+		Policy: aws.String(testBucketPolicy),
+	}))
+
+	rq, err := http.NewRequest("GET", ts.url("/"+defaultBucket+"?policy"), nil)
+	ts.OK(err)
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	defer rs.Body.Close()
+
+	if ct := rs.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatal("unexpected content type", ct)
+	}
+	body, err := ioutil.ReadAll(rs.Body)
+	ts.OK(err)
+	if string(body) != testBucketPolicy {
+		t.Fatal("unexpected policy", string(body))
+	}
+}
+
+func TestBucketPolicyMalformed(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	for _, policy := range []string{
+		`nope`,
+		`{"Statement": []}`,
+		`{"Version": "2012-10-17"}`,
+		`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject"}]}`,
+	} {
+		_, err := svc.PutBucketPolicy(&s3.PutBucketPolicyInput{
+			Bucket: aws.String(defaultBucket),
+			Policy: aws.String(policy),
+		})
+		if !hasErrorCode(err, gofakes3.ErrMalformedPolicy) {
+			t.Fatal("expected MalformedPolicy for", policy, "found", err)
+		}
+	}
+}
+
+func TestBucketPolicyMissingBucket(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.PutBucketPolicy(&s3.PutBucketPolicyInput{
+		Bucket: aws.String("nope"),
+		Policy: aws.String(testBucketPolicy),
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchBucket) {
+		t.Fatal("expected NoSuchBucket, found", err)
+	}
+}
+
+func TestBucketPolicyAnonymousAccess(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(
+		gofakes3.WithV4Auth(map[string]string{"dummy-access": "dummy-secret"}),
+	))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.backendPutString(defaultBucket, "public/foo", nil, "hello")
+	ts.backendPutString(defaultBucket, "public/secret", nil, "hello")
+	ts.backendPutString(defaultBucket, "private", nil, "hello")
+
+	ts.OKAll(svc.PutBucketPolicy(&s3.PutBucketPolicyInput{
+		Bucket: aws.String(defaultBucket),
+		Policy: aws.String(`{
+			"Version": "2012-10-17",
+			"Statement": [
+				{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::` + defaultBucket + `/public/*"},
+				{"Effect": "Deny", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::` + defaultBucket + `/public/secret"}
+			]
+		}`),
+	}))
+
+	assertStatus := func(method, path string, code int) {
+		t.Helper()
+		rq, err := http.NewRequest(method, ts.url(path), nil)
+		ts.OK(err)
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		defer rs.Body.Close()
+		if rs.StatusCode != code {
+			t.Fatal("expected status", code, "for", method, path, "found", rs.StatusCode)
+		}
+	}
+
+	assertStatus("GET", "/"+defaultBucket+"/public/foo", 200)
+	assertStatus("HEAD", "/"+defaultBucket+"/public/foo", 200)
+	assertStatus("GET", "/"+defaultBucket+"/public/secret", 403)
+	assertStatus("GET", "/"+defaultBucket+"/private", 403)
+	assertStatus("PUT", "/"+defaultBucket+"/public/foo", 403)
+
+	// An explicit Deny applies to signed requests too:
+	ts.OKAll(svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("public/foo"),
+	}))
+	_, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("public/secret"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+}
@@ -0,0 +1,208 @@
+package gofakes3
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/oneclickvirt/gofakes3/signature"
+)
+
+// postPolicy is the policy document sent with a browser-based POST upload,
+// which lists the conditions the form must meet:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-HTTPPOSTConstructPolicy.html
+type postPolicy struct {
+	expiration time.Time
+	conditions []postPolicyCondition
+
+	// contentLengthRange is set by a 'content-length-range' condition.
+	contentLengthRange *postPolicyLengthRange
+}
+
+type postPolicyCondition struct {
+	op    string // "eq" or "starts-with"
+	field string // lower case, without the leading '$'
+	value string
+	raw   json.RawMessage
+}
+
+type postPolicyLengthRange struct {
+	min, max int64
+}
+
+// check returns ErrEntityTooSmall or ErrEntityTooLarge if size falls outside
+// the range, which includes both min and max.
+func (lr *postPolicyLengthRange) check(size int64) error {
+	if size < lr.min {
+		return ErrorMessagef(ErrEntityTooSmall, "Your proposed upload is smaller than the minimum allowed size of %d bytes", lr.min)
+	}
+	if size > lr.max {
+		return ErrorMessagef(ErrEntityTooLarge, "Your proposed upload exceeds the maximum allowed size of %d bytes", lr.max)
+	}
+	return nil
+}
+
+// formFieldsExemptFromPolicy are the form fields that do not need a
+// condition in the policy. Fields starting with 'x-ignore-' are also exempt.
+var formFieldsExemptFromPolicy = map[string]bool{
+	"policy":          true,
+	"x-amz-signature": true,
+	"file":            true,
+}
+
+func parsePostPolicy(encoded string) (*postPolicy, error) {
+	doc, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrorMessage(ErrInvalidPolicyDocument, "Invalid Policy: Invalid 'Base64' encoding.")
+	}
+
+	var in struct {
+		Expiration string            `json:"expiration"`
+		Conditions []json.RawMessage `json:"conditions"`
+	}
+	if err := json.Unmarshal(doc, &in); err != nil {
+		return nil, ErrorMessage(ErrInvalidPolicyDocument, "Invalid Policy: Invalid JSON.")
+	}
+
+	var policy postPolicy
+	if policy.expiration, err = time.Parse(time.RFC3339, in.Expiration); err != nil {
+		return nil, ErrorMessage(ErrInvalidPolicyDocument, "Invalid Policy: Invalid 'expiration' value: '"+in.Expiration+"'")
+	}
+
+	for _, raw := range in.Conditions {
+		if err := policy.addCondition(raw); err != nil {
+			return nil, err
+		}
+	}
+	return &policy, nil
+}
+
+// addCondition parses a condition, which is either an object with a single
+// field that must match exactly, or an array of the form
+// '[op, "$field", value]' or '["content-length-range", min, max]'.
+func (p *postPolicy) addCondition(raw json.RawMessage) error {
+	invalid := ErrorMessagef(ErrInvalidPolicyDocument, "Invalid Policy: Invalid Condition: %s", raw)
+
+	var exact map[string]string
+	if err := json.Unmarshal(raw, &exact); err == nil {
+		if len(exact) != 1 {
+			return invalid
+		}
+		for field, value := range exact {
+			p.conditions = append(p.conditions, postPolicyCondition{op: "eq", field: strings.ToLower(field), value: value, raw: raw})
+		}
+		return nil
+	}
+
+	var args []interface{}
+	if err := json.Unmarshal(raw, &args); err != nil || len(args) != 3 {
+		return invalid
+	}
+	op, _ := args[0].(string)
+	op = strings.ToLower(op)
+
+	if op == "content-length-range" {
+		min, minOK := args[1].(float64)
+		max, maxOK := args[2].(float64)
+		if !minOK || !maxOK || min < 0 || min > max {
+			return invalid
+		}
+		p.contentLengthRange = &postPolicyLengthRange{min: int64(min), max: int64(max)}
+		return nil
+	}
+
+	field, _ := args[1].(string)
+	value, valueOK := args[2].(string)
+	if (op != "eq" && op != "starts-with") || !strings.HasPrefix(field, "$") || !valueOK {
+		return invalid
+	}
+	p.conditions = append(p.conditions, postPolicyCondition{op: op, field: strings.ToLower(field[1:]), value: value, raw: raw})
+	return nil
+}
+
+// check verifies that the form fields of an upload to bucket meet the
+// policy's conditions, and that every field is covered by a condition.
+func (p *postPolicy) check(bucket string, form map[string][]string, now time.Time) error {
+	if !now.Before(p.expiration) {
+		return ErrorMessage(ErrAccessDenied, "Invalid according to Policy: Policy expired.")
+	}
+
+	fields := map[string]string{"bucket": bucket}
+	for k, v := range form {
+		if len(v) > 0 {
+			fields[strings.ToLower(k)] = v[0]
+		}
+	}
+
+	covered := map[string]bool{}
+	for _, cond := range p.conditions {
+		value, ok := fields[cond.field]
+		matched := ok && ((cond.op == "eq" && value == cond.value) ||
+			(cond.op == "starts-with" && strings.HasPrefix(value, cond.value)))
+		if !matched {
+			return ErrorMessagef(ErrAccessDenied, "Invalid according to Policy: Policy Condition failed: %s", cond.raw)
+		}
+		covered[cond.field] = true
+	}
+
+	for field := range fields {
+		if field != "bucket" && !covered[field] && !formFieldsExemptFromPolicy[field] && !strings.HasPrefix(field, "x-ignore-") {
+			return ErrorMessagef(ErrAccessDenied, "Invalid according to Policy: Extra input fields: %s", field)
+		}
+	}
+	return nil
+}
+
+// checkPostPolicy verifies the policy sent with a browser-based POST upload.
+// When authentication is enabled the form must carry a policy signed using
+// one of the configured keys; otherwise a policy is optional, but its
+// expiration and conditions are still checked if one is sent.
+//
+// It returns the policy, which is nil if none was sent.
+func (g *GoFakeS3) checkPostPolicy(bucket string, r *http.Request) (*postPolicy, error) {
+	form := r.MultipartForm.Value
+	formValue := func(name string) string {
+		for k, v := range form {
+			if strings.EqualFold(k, name) && len(v) > 0 {
+				return v[0]
+			}
+		}
+		return ""
+	}
+
+	// Requests without a signature are only marked as anonymous when
+	// authentication is enabled; see authMiddleware:
+	mustSign := isAnonymousRequest(r)
+
+	encoded := formValue("policy")
+	if encoded == "" {
+		if mustSign {
+			return nil, ErrorMessage(ErrAccessDenied, "Bucket POST must contain a field named 'policy'.")
+		}
+		return nil, nil
+	}
+
+	policy, err := parsePostPolicy(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if mustSign {
+		result := signature.PostPolicyV4Verify(encoded, formValue("x-amz-algorithm"), formValue("x-amz-credential"), formValue("x-amz-signature"))
+		if result != signature.ErrNone {
+			apiErr := signature.GetAPIError(result)
+			g.log.Print(LogWarn, "Access Denied:", r.RemoteAddr, "=>", r.URL, apiErr.Code)
+			if apiErr.Code == string(ErrSignatureDoesNotMatch) {
+				return nil, ErrSignatureDoesNotMatch
+			}
+			return nil, ErrorMessage(ErrAccessDenied, apiErr.Description)
+		}
+	}
+
+	if err := policy.check(bucket, form, g.timeSource.Now()); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
@@ -0,0 +1,277 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oneclickvirt/gofakes3"
+	"github.com/oneclickvirt/gofakes3/signature"
+	xml "github.com/oneclickvirt/gofakes3/xml"
+)
+
+const (
+	postAccessKey = "dummy-access"
+	postSecretKey = "dummy-secret"
+	postRegion    = "us-east-1"
+)
+
+func postPolicyCredential() string {
+	return postAccessKey + "/" + defaultDate.Format("20060102") + "/" + postRegion + "/s3/aws4_request"
+}
+
+// encodePostPolicy returns the base64 encoded policy document with the given
+// conditions, expiring an hour after defaultDate.
+func encodePostPolicy(t *testing.T, conditions ...interface{}) string {
+	t.Helper()
+	doc, err := json.Marshal(map[string]interface{}{
+		"expiration": defaultDate.Add(time.Hour).UTC().Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(doc)
+}
+
+// signedPostFields returns the form fields for a browser-based upload of key,
+// signed with postSecretKey.
+func signedPostFields(t *testing.T, key string, conditions ...interface{}) [][2]string {
+	t.Helper()
+	conditions = append(conditions,
+		map[string]string{"bucket": defaultBucket},
+		map[string]string{"x-amz-algorithm": "AWS4-HMAC-SHA256"},
+		map[string]string{"x-amz-credential": postPolicyCredential()},
+	)
+	policy := encodePostPolicy(t, conditions...)
+	return [][2]string{
+		{"key", key},
+		{"policy", policy},
+		{"x-amz-algorithm", "AWS4-HMAC-SHA256"},
+		{"x-amz-credential", postPolicyCredential()},
+		{"x-amz-signature", signature.SignPostPolicyV4(policy, postSecretKey, postRegion, defaultDate)},
+	}
+}
+
+func postForm(ts *testServer, fields [][2]string, file []byte) *http.Response {
+	ts.Helper()
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	for _, f := range fields {
+		ts.OK(w.WriteField(f[0], f[1]))
+	}
+	mw, err := w.CreateFormFile("file", "upload")
+	ts.OK(err)
+	_, err = mw.Write(file)
+	ts.OK(err)
+	ts.OK(w.Close())
+
+	rq, err := http.NewRequest("POST", ts.url("/"+defaultBucket), &b)
+	ts.OK(err)
+	rq.Header.Set("Content-Type", w.FormDataContentType())
+	// Don't follow the 'success_action_redirect':
+	client := httpClient()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	rs, err := client.Do(rq)
+	ts.OK(err)
+	return rs
+}
+
+func assertPostFails(ts *testServer, rs *http.Response, code gofakes3.ErrorCode) {
+	ts.Helper()
+	defer rs.Body.Close()
+	if rs.StatusCode != code.Status() {
+		ts.Fatal("bad status", rs.StatusCode, "!=", code.Status())
+	}
+	var errResp gofakes3.ErrorResponse
+	ts.OK(xml.NewDecoder(rs.Body).Decode(&errResp))
+	if errResp.Code != code {
+		ts.Fatal("bad code", errResp.Code, "!=", code, errResp.Message)
+	}
+}
+
+func newPostPolicyTestServer(t *testing.T) *testServer {
+	return newTestServer(t, withFakerOptions(
+		gofakes3.WithV4Auth(map[string]string{postAccessKey: postSecretKey}),
+	))
+}
+
+func TestPostPolicy(t *testing.T) {
+	startsWithUploads := []string{"starts-with", "$key", "uploads/"}
+
+	t.Run("signed", func(t *testing.T) {
+		ts := newPostPolicyTestServer(t)
+		defer ts.Close()
+		rs := postForm(ts, signedPostFields(t, "uploads/yep", startsWithUploads), []byte("stuff"))
+		rs.Body.Close()
+		if rs.StatusCode != http.StatusOK {
+			t.Fatal("bad status", rs.StatusCode)
+		}
+		ts.assertObject(defaultBucket, "uploads/yep", nil, "stuff")
+	})
+
+	t.Run("bad-signature", func(t *testing.T) {
+		ts := newPostPolicyTestServer(t)
+		defer ts.Close()
+		fields := signedPostFields(t, "uploads/yep", startsWithUploads)
+		fields[len(fields)-1][1] = signature.SignPostPolicyV4(fields[1][1], "wrong-secret", postRegion, defaultDate)
+		assertPostFails(ts, postForm(ts, fields, []byte("stuff")), gofakes3.ErrSignatureDoesNotMatch)
+	})
+
+	t.Run("missing-policy", func(t *testing.T) {
+		ts := newPostPolicyTestServer(t)
+		defer ts.Close()
+		assertPostFails(ts, postForm(ts, [][2]string{{"key", "uploads/yep"}}, []byte("stuff")), gofakes3.ErrAccessDenied)
+	})
+
+	t.Run("condition-failed", func(t *testing.T) {
+		ts := newPostPolicyTestServer(t)
+		defer ts.Close()
+		assertPostFails(ts, postForm(ts, signedPostFields(t, "elsewhere/yep", startsWithUploads), []byte("stuff")), gofakes3.ErrAccessDenied)
+	})
+
+	t.Run("extra-field", func(t *testing.T) {
+		ts := newPostPolicyTestServer(t)
+		defer ts.Close()
+		fields := append(signedPostFields(t, "uploads/yep", startsWithUploads), [2]string{"x-amz-meta-extra", "nope"})
+		assertPostFails(ts, postForm(ts, fields, []byte("stuff")), gofakes3.ErrAccessDenied)
+
+		// Fields starting with 'x-ignore-' do not need a condition:
+		fields[len(fields)-1][0] = "x-ignore-extra"
+		rs := postForm(ts, fields, []byte("stuff"))
+		rs.Body.Close()
+		if rs.StatusCode != http.StatusOK {
+			t.Fatal("bad status", rs.StatusCode)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		ts := newPostPolicyTestServer(t)
+		defer ts.Close()
+		ts.Advance(2 * time.Hour)
+		assertPostFails(ts, postForm(ts, signedPostFields(t, "uploads/yep", startsWithUploads), []byte("stuff")), gofakes3.ErrAccessDenied)
+	})
+
+	t.Run("invalid-policy", func(t *testing.T) {
+		ts := newPostPolicyTestServer(t)
+		defer ts.Close()
+		fields := signedPostFields(t, "uploads/yep", startsWithUploads)
+		fields[1][1] = "not base64!"
+		assertPostFails(ts, postForm(ts, fields, []byte("stuff")), gofakes3.ErrInvalidPolicyDocument)
+	})
+
+	t.Run("unsigned-without-auth", func(t *testing.T) {
+		// Without authentication the signature is not needed, but the
+		// conditions are still checked:
+		ts := newTestServer(t)
+		defer ts.Close()
+		fields := [][2]string{
+			{"key", "elsewhere/yep"},
+			{"policy", encodePostPolicy(t, startsWithUploads)},
+		}
+		assertPostFails(ts, postForm(ts, fields, []byte("stuff")), gofakes3.ErrAccessDenied)
+	})
+}
+
+func TestPostPolicyContentLengthRange(t *testing.T) {
+	lengthRange := []interface{}{"content-length-range", 2, 4}
+
+	for idx, tc := range []struct {
+		body string
+		code gofakes3.ErrorCode
+	}{
+		{"a", gofakes3.ErrEntityTooSmall},
+		{"ab", ""},
+		{"abcd", ""},
+		{"abcde", gofakes3.ErrEntityTooLarge},
+	} {
+		t.Run(fmt.Sprintf("%d/%d", idx, len(tc.body)), func(t *testing.T) {
+			ts := newPostPolicyTestServer(t)
+			defer ts.Close()
+			rs := postForm(ts, signedPostFields(t, "yep", []string{"starts-with", "$key", ""}, lengthRange), []byte(tc.body))
+			if tc.code != "" {
+				assertPostFails(ts, rs, tc.code)
+				if ts.backendObjectExists(defaultBucket, "yep") {
+					t.Fatal("object should not exist")
+				}
+				return
+			}
+			rs.Body.Close()
+			if rs.StatusCode != http.StatusOK {
+				t.Fatal("bad status", rs.StatusCode)
+			}
+			ts.assertObject(defaultBucket, "yep", nil, tc.body)
+		})
+	}
+}
+
+func TestPostPolicySuccessAction(t *testing.T) {
+	keyCond := []string{"starts-with", "$key", ""}
+
+	t.Run("redirect", func(t *testing.T) {
+		ts := newPostPolicyTestServer(t)
+		defer ts.Close()
+		fields := append(signedPostFields(t, "yep", keyCond,
+			[]string{"eq", "$success_action_redirect", "http://example.com/done?a=b"}),
+			[2]string{"success_action_redirect", "http://example.com/done?a=b"})
+		rs := postForm(ts, fields, []byte("stuff"))
+		rs.Body.Close()
+		if rs.StatusCode != http.StatusSeeOther {
+			t.Fatal("bad status", rs.StatusCode)
+		}
+		loc, err := url.Parse(rs.Header.Get("Location"))
+		ts.OK(err)
+		if loc.Host != "example.com" || loc.Path != "/done" {
+			t.Fatal("bad location", loc)
+		}
+		q := loc.Query()
+		if q.Get("a") != "b" || q.Get("bucket") != defaultBucket || q.Get("key") != "yep" || q.Get("etag") != rs.Header.Get("ETag") {
+			t.Fatal("bad query", q)
+		}
+	})
+
+	for _, tc := range []struct {
+		status string
+		expect int
+	}{
+		{"", http.StatusOK},
+		{"200", http.StatusOK},
+		{"201", http.StatusCreated},
+		{"204", http.StatusNoContent},
+		{"418", http.StatusOK},
+	} {
+		t.Run("status/"+tc.status, func(t *testing.T) {
+			ts := newPostPolicyTestServer(t)
+			defer ts.Close()
+			fields := signedPostFields(t, "yep", keyCond)
+			if tc.status != "" {
+				fields = append(signedPostFields(t, "yep", keyCond, []string{"eq", "$success_action_status", tc.status}),
+					[2]string{"success_action_status", tc.status})
+			}
+			rs := postForm(ts, fields, []byte("stuff"))
+			defer rs.Body.Close()
+			if rs.StatusCode != tc.expect {
+				t.Fatal("bad status", rs.StatusCode, "!=", tc.expect)
+			}
+			if tc.expect != http.StatusCreated {
+				return
+			}
+
+			var result gofakes3.PostResponse
+			ts.OK(xml.NewDecoder(rs.Body).Decode(&result))
+			if result.Bucket != defaultBucket || result.Key != "yep" || result.ETag != rs.Header.Get("ETag") {
+				t.Fatal("bad response", result)
+			}
+			if !strings.HasSuffix(result.Location, "/"+defaultBucket+"/yep") {
+				t.Fatal("bad location", result.Location)
+			}
+		})
+	}
+}
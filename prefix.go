@@ -3,6 +3,7 @@ package gofakes3
 import (
 	"fmt"
 	"net/url"
+	"sort"
 	"strings"
 )
 
@@ -62,11 +63,10 @@ func (p Prefix) FilePrefix() (path, remaining string, ok bool) {
 	}
 }
 
-// PrefixMatch checks whether key starts with prefix. If the prefix does not
-// match, nil is returned.
+// Match checks whether key starts with prefix. If the prefix does not match,
+// it returns false.
 //
-// It is a best-effort attempt to implement the prefix/delimiter matching found
-// in S3.
+// It implements the prefix/delimiter matching found in S3.
 //
 // To check whether the key belongs in Contents or CommonPrefixes, compare the
 // result to key.
@@ -79,7 +79,7 @@ func (p Prefix) Match(key string, match *PrefixMatch) (ok bool) {
 		return true
 	}
 
-	if !p.HasDelimiter {
+	if !p.HasDelimiter || p.Delimiter == "" {
 		// If the request does not contain a delimiter, prefix matching is a
 		// simple string prefix:
 		if strings.HasPrefix(key, p.Prefix) {
@@ -91,58 +91,84 @@ func (p Prefix) Match(key string, match *PrefixMatch) (ok bool) {
 		return false
 	}
 
-	// Delimited + Prefix matches, for example:
-	//	 $ aws s3 ls s3://my-bucket/
-	//	                            PRE AWSLogs/
-	//	 $ aws s3 ls s3://my-bucket/AWSLogs
-	//	                            PRE AWSLogs/
-	//	 $ aws s3 ls s3://my-bucket/AWSLogs/
-	//	                            PRE 260839334643/
-	//	 $ aws s3 ls s3://my-bucket/AWSLogs/2608
-	//	                            PRE 260839334643/
+	// The delimiter is an opaque string, which may be longer than one
+	// character. Keys that contain it after the prefix are rolled up into the
+	// prefix plus everything up to and including its first occurrence, for
+	// example with the delimiter '/':
+	//
+	//	prefix ""             key "AWSLogs/260839334643/x"  =>  "AWSLogs/"
+	//	prefix "AWSLogs/"     key "AWSLogs/260839334643/x"  =>  "AWSLogs/260839334643/"
+	//	prefix "AWSLogs/2608" key "AWSLogs/260839334643/x"  =>  "AWSLogs/260839334643/"
+	if !strings.HasPrefix(key, p.Prefix) {
+		return false
+	}
 
-	keyParts := strings.Split(strings.TrimLeft(key, p.Delimiter), p.Delimiter)
-	preParts := strings.Split(strings.TrimLeft(p.Prefix, p.Delimiter), p.Delimiter)
+	out := key
+	if idx := strings.Index(key[len(p.Prefix):], p.Delimiter); idx >= 0 {
+		out = key[:len(p.Prefix)+idx+len(p.Delimiter)]
+	}
 
-	if len(keyParts) < len(preParts) {
-		return false
+	if match != nil {
+		*match = PrefixMatch{Key: key, CommonPrefix: out != key, MatchedPart: out}
 	}
+	return true
+}
 
-	// If the key exactly matches the prefix, but only up to a delimiter,
-	// AWS appends the delimiter to the result:
-	//	 $ aws s3 ls s3://my-bucket/AWSLogs
-	//	                            PRE AWSLogs/
-	appendDelim := len(keyParts) != len(preParts)
-	matched := 0
-
-	last := len(preParts) - 1
-	for i := 0; i < len(preParts); i++ {
-		if i == last {
-			if !strings.HasPrefix(keyParts[i], preParts[i]) {
-				return false
-			}
+// RollupObjectList builds the listing S3 would return for a flat list of
+// contents: keys that do not match the prefix are dropped, and keys that
+// contain the delimiter after the prefix are rolled up into CommonPrefixes.
+// contents does not need to be sorted.
+//
+// The page is applied to the combined, sorted list of keys and common
+// prefixes, each of which counts once against MaxKeys. If the listing is
+// truncated, NextMarker is the last key or common prefix returned; a common
+// prefix used as the marker is not returned again.
+func RollupObjectList(contents []*Content, prefix Prefix, page ListBucketPage) *ObjectList {
+	sorted := make([]*Content, len(contents))
+	copy(sorted, contents)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+
+	var (
+		response = NewObjectList()
+		match    PrefixMatch
+		last     string
+		cnt      int64
+	)
+
+	for _, item := range sorted {
+		if page.HasMarker && item.Key <= page.Marker {
+			continue
+		}
+		if !prefix.Match(item.Key, &match) {
+			continue
+		}
 
-		} else {
-			if keyParts[i] != preParts[i] {
-				return false
+		next := item.Key
+		if match.CommonPrefix {
+			next = match.MatchedPart
+			if next == last || (page.HasMarker && next == page.Marker) {
+				continue // Should not count towards keys
 			}
 		}
-		matched++
-	}
 
-	if matched == 0 {
-		return false
-	}
+		if page.MaxKeys > 0 && cnt >= page.MaxKeys {
+			response.IsTruncated = true
+			break
+		}
 
-	out := strings.Join(keyParts[:matched], p.Delimiter)
-	if appendDelim {
-		out += p.Delimiter
+		if match.CommonPrefix {
+			response.AddPrefix(next)
+		} else {
+			response.Add(item)
+		}
+		last = next
+		cnt++
 	}
 
-	if match != nil {
-		*match = PrefixMatch{Key: key, CommonPrefix: out != key, MatchedPart: out}
+	if response.IsTruncated {
+		response.NextMarker = last
 	}
-	return true
+	return response
 }
 
 func (p Prefix) String() string {
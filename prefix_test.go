@@ -21,7 +21,20 @@ func TestPrefixMatch(t *testing.T) {
 		{key: "foo/bar", p: s("foo"), d: s("/"), out: s("foo/"), common: true},
 		{key: "foo/bar", p: s("foo/ba"), d: s("/"), out: s("foo/bar")},
 		{key: "foo/bar", p: s("foo/ba/"), d: s("/"), out: nil},
-		{key: "foo/bar", p: s("/"), d: s("/"), out: s("foo/"), common: true},
+		{key: "foo/bar", p: s("/"), d: s("/"), out: nil},
+		{key: "foo/bar", p: s(""), d: s("/"), out: s("foo/"), common: true},
+		{key: "foo/bar/baz", p: s("foo/"), d: s("/"), out: s("foo/bar/"), common: true},
+		{key: "foo/bar/baz", p: s("foo/b"), d: s("/"), out: s("foo/bar/"), common: true},
+		{key: "foo/bar", p: nil, d: s("/"), out: s("foo/"), common: true},
+		{key: "foo", p: nil, d: s("/"), out: s("foo")},
+
+		// Any delimiter is allowed, including multi-character ones:
+		{key: "2020-01-02", p: nil, d: s("-"), out: s("2020-"), common: true},
+		{key: "2020-01-02", p: s("2020-"), d: s("-"), out: s("2020-01-"), common: true},
+		{key: "2020-01-02", p: s("2020-01-"), d: s("-"), out: s("2020-01-02")},
+		{key: "a::b::c", p: s("a::"), d: s("::"), out: s("a::b::"), common: true},
+		{key: "a::b:c", p: s("a::"), d: s("::"), out: s("a::b:c")},
+		{key: "a/b", p: s("a"), d: s(""), out: s("a")},
 
 		// Without a delimiter, it's just a boring ol' prefix match:
 		{key: "foo/bar", p: s("foo/b"), out: s("foo/b")},
@@ -129,3 +142,71 @@ func unwrapStr(v *string) string {
 	}
 	return ""
 }
+
+func TestRollupObjectList(t *testing.T) {
+	contents := func(keys ...string) []*Content {
+		out := make([]*Content, len(keys))
+		for i, k := range keys {
+			out[i] = &Content{Key: k}
+		}
+		return out
+	}
+
+	keys := func(list *ObjectList) (out []string) {
+		for _, c := range list.Contents {
+			out = append(out, c.Key)
+		}
+		return out
+	}
+
+	prefixes := func(list *ObjectList) (out []string) {
+		for _, cp := range list.CommonPrefixes {
+			out = append(out, cp.Prefix)
+		}
+		return out
+	}
+
+	folders := contents("b/2", "a", "b/1", "c/d/e", "c/f", "c/d/g", "d")
+
+	for idx, tc := range []struct {
+		in       []*Content
+		prefix   Prefix
+		page     ListBucketPage
+		keys     []string
+		prefixes []string
+		next     string
+	}{
+		{in: folders, prefix: NewFolderPrefix(""), keys: []string{"a", "d"}, prefixes: []string{"b/", "c/"}},
+		{in: folders, prefix: NewFolderPrefix("c/"), keys: []string{"c/f"}, prefixes: []string{"c/d/"}},
+		{in: folders, prefix: NewFolderPrefix("c/d/"), keys: []string{"c/d/e", "c/d/g"}},
+		{in: folders, prefix: NewFolderPrefix("nope/")},
+
+		// Each common prefix counts once against MaxKeys, and is not
+		// repeated on the next page when used as the marker:
+		{in: folders, prefix: NewFolderPrefix(""), page: ListBucketPage{MaxKeys: 2},
+			keys: []string{"a"}, prefixes: []string{"b/"}, next: "b/"},
+		{in: folders, prefix: NewFolderPrefix(""), page: ListBucketPage{MaxKeys: 2, Marker: "b/", HasMarker: true},
+			keys: []string{"d"}, prefixes: []string{"c/"}},
+
+		// Delimiters other than '/':
+		{in: contents("2020-01-a", "2020-01-b", "2020-02-a", "2021", "readme"),
+			prefix: Prefix{HasDelimiter: true, Delimiter: "-"},
+			keys:   []string{"2021", "readme"}, prefixes: []string{"2020-"}},
+		{in: contents("2020-01-a", "2020-01-b", "2020-02-a", "2021", "readme"),
+			prefix:   Prefix{HasPrefix: true, Prefix: "2020-", HasDelimiter: true, Delimiter: "-"},
+			prefixes: []string{"2020-01-", "2020-02-"}},
+	} {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			list := RollupObjectList(tc.in, tc.prefix, tc.page)
+			if !reflect.DeepEqual(keys(list), tc.keys) {
+				t.Fatal("unexpected keys", keys(list), "!=", tc.keys)
+			}
+			if !reflect.DeepEqual(prefixes(list), tc.prefixes) {
+				t.Fatal("unexpected prefixes", prefixes(list), "!=", tc.prefixes)
+			}
+			if list.NextMarker != tc.next || list.IsTruncated != (tc.next != "") {
+				t.Fatal("unexpected next marker", list.NextMarker, list.IsTruncated)
+			}
+		})
+	}
+}
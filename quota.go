@@ -0,0 +1,69 @@
+package gofakes3
+
+import "context"
+
+// checkBucketQuota returns ErrQuotaExceeded if storing size more bytes in the
+// bucket would take it over the quota set using WithBucketQuota.
+func (g *GoFakeS3) checkBucketQuota(ctx context.Context, bucket string, size int64) error {
+	quota, ok := g.bucketQuotas[bucket]
+	if !ok || g.usage == nil {
+		return nil
+	}
+
+	usage, err := g.usage.BucketUsage(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	if usage+size > quota {
+		return ErrorMessagef(ErrQuotaExceeded, "Storing %d bytes would take bucket %q over its quota of %d bytes; %d bytes are in use.", size, bucket, quota, usage)
+	}
+	return nil
+}
+
+// checkObjectSize returns ErrEntityTooLarge if an object of size bytes would
+// be larger than the limit set using WithMaxObjectSize.
+func (g *GoFakeS3) checkObjectSize(size int64) error {
+	if g.maxObjectSize > 0 && size > g.maxObjectSize {
+		return entityTooLarge(size, g.maxObjectSize)
+	}
+	return nil
+}
+
+// checkMemoryLimit returns ErrServiceUnavailable if storing size more bytes
+// would take the objects in the backend, together with the multipart upload
+// parts held in memory, over the limit set using WithBackendMemoryLimit.
+// released is the number of bytes that are freed once the data is stored,
+// such as the parts of an upload that is being completed.
+//
+// If the data fits, size bytes are reserved until release is called, so
+// concurrent requests can not each pass the check and together go over the
+// limit. release must be called once the data has been stored, or has failed
+// to be.
+func (g *GoFakeS3) checkMemoryLimit(ctx context.Context, size, released int64) (release func(), err error) {
+	if g.memoryLimit <= 0 {
+		return func() {}, nil
+	}
+
+	g.memoryMu.Lock()
+	defer g.memoryMu.Unlock()
+
+	usage := g.uploader.memoryUsage() + g.memoryReserved
+	if g.usage != nil {
+		stored, err := g.usage.TotalUsage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		usage += stored
+	}
+
+	if usage-released+size > g.memoryLimit {
+		return nil, ErrorMessagef(ErrServiceUnavailable, "Storing %d bytes would take the backend over its memory limit of %d bytes; %d bytes are in use.", size, g.memoryLimit, usage)
+	}
+
+	g.memoryReserved += size
+	return func() {
+		g.memoryMu.Lock()
+		g.memoryReserved -= size
+		g.memoryMu.Unlock()
+	}, nil
+}
@@ -54,7 +54,7 @@ func (o *ObjectRangeRequest) Range(size int64) (*ObjectRange, error) {
 	}
 
 	if start < 0 || length < 0 || start >= size {
-		return nil, ErrInvalidRange
+		return nil, InvalidRange(size)
 	}
 
 	if start+length > size {
@@ -64,6 +64,17 @@ func (o *ObjectRangeRequest) Range(size int64) (*ObjectRange, error) {
 	return &ObjectRange{Start: start, Length: length}, nil
 }
 
+// completeRangeError adds the requested range to an error returned by
+// ObjectRangeRequest.Range, and sets the 'Content-Range' header S3 sends with
+// a 416 response. Other errors are returned unchanged.
+func completeRangeError(err error, requested string, w http.ResponseWriter) error {
+	if rerr, ok := err.(*invalidRangeResponse); ok {
+		rerr.RangeRequested = requested
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", rerr.ActualObjectSize))
+	}
+	return err
+}
+
 // parseRangeHeader parses a single byte range from the Range header.
 //
 // Amazon S3 doesn't support retrieving multiple ranges of data per GET request:
@@ -16,6 +16,8 @@ func TestRangeRequest(t *testing.T) {
 		{inst: 0, inend: RangeNoEnd, sz: 5, outst: 0, outln: 5},
 		{inst: 0, inend: 5, sz: 10, outst: 0, outln: 6},
 		{inst: 0, inend: 0, sz: 4, outst: 0, outln: 1},
+		{inst: 0, inend: 0, sz: 1, outst: 0, outln: 1},
+		{inst: 0, inend: 1, sz: 1, outst: 0, outln: 1},
 		{inst: 1, inend: 5, sz: 10, outst: 1, outln: 5},
 		{inst: 1, inend: 5, sz: 3, outst: 1, outln: 2},
 		{inst: 5, inend: 7, sz: 6, outst: 5, outln: 1},
@@ -0,0 +1,80 @@
+package gofakes3
+
+import (
+	"net/http"
+
+	xml "github.com/oneclickvirt/gofakes3/xml"
+)
+
+// Payer is who pays for requests to a bucket and the data they download.
+type Payer string
+
+const (
+	PayerBucketOwner Payer = "BucketOwner"
+	PayerRequester   Payer = "Requester"
+)
+
+// RequestPaymentConfiguration is used by the '?requestPayment' subresource on
+// buckets, both as the response body for a GET and as the request body for a
+// PUT:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketRequestPayment.html
+type RequestPaymentConfiguration struct {
+	XMLName xml.Name `xml:"RequestPaymentConfiguration"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Payer   Payer    `xml:"Payer"`
+}
+
+func (c *RequestPaymentConfiguration) validate() error {
+	switch c.Payer {
+	case PayerBucketOwner, PayerRequester:
+		return nil
+	default:
+		return ErrMalformedXML
+	}
+}
+
+func (g *GoFakeS3) getBucketRequestPayment(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET BUCKET REQUEST PAYMENT", bucket)
+
+	if g.payment == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	config, err := g.payment.GetBucketRequestPayment(r.Context(), bucket)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		config = &RequestPaymentConfiguration{
+			Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/",
+			Payer: PayerBucketOwner,
+		}
+	}
+
+	return g.xmlEncoder(w).Encode(config)
+}
+
+func (g *GoFakeS3) putBucketRequestPayment(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT BUCKET REQUEST PAYMENT", bucket)
+
+	if g.payment == nil {
+		return ErrNotImplemented
+	}
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	var in RequestPaymentConfiguration
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := in.validate(); err != nil {
+		return err
+	}
+	in.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	return g.payment.PutBucketRequestPayment(r.Context(), bucket, &in)
+}
@@ -0,0 +1,46 @@
+package gofakes3_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestBucketRequestPayment(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	assertPayer := func(expected string) {
+		t.Helper()
+		rs, err := svc.GetBucketRequestPayment(&s3.GetBucketRequestPaymentInput{Bucket: aws.String(defaultBucket)})
+		ts.OK(err)
+		if aws.StringValue(rs.Payer) != expected {
+			t.Fatal("unexpected payer", aws.StringValue(rs.Payer))
+		}
+	}
+
+	assertPayer("BucketOwner")
+
+	ts.OKAll(svc.PutBucketRequestPayment(&s3.PutBucketRequestPaymentInput{
+		Bucket:                      aws.String(defaultBucket),
+		RequestPaymentConfiguration: &s3.RequestPaymentConfiguration{Payer: aws.String("Requester")},
+	}))
+	assertPayer("Requester")
+
+	_, err := svc.PutBucketRequestPayment(&s3.PutBucketRequestPaymentInput{
+		Bucket:                      aws.String(defaultBucket),
+		RequestPaymentConfiguration: &s3.RequestPaymentConfiguration{Payer: aws.String("Nobody")},
+	})
+	if !hasErrorCode(err, gofakes3.ErrMalformedXML) {
+		t.Fatal("expected MalformedXML, found", err)
+	}
+	assertPayer("Requester")
+
+	_, err = svc.GetBucketRequestPayment(&s3.GetBucketRequestPaymentInput{Bucket: aws.String("missing")})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchBucket) {
+		t.Fatal("expected NoSuchBucket, found", err)
+	}
+}
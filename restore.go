@@ -0,0 +1,180 @@
+package gofakes3
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	xml "github.com/oneclickvirt/gofakes3/xml"
+)
+
+// DefaultRestoreDelay is how long a RestoreObject request takes to complete
+// unless WithRestoreDelay is used.
+const DefaultRestoreDelay = 5 * time.Second
+
+// RestoreRequest is the request body for a POST to the '?restore'
+// subresource of an object:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_RestoreObject.html
+//
+// Only the restore of an archived object is supported; Select requests are
+// not.
+type RestoreRequest struct {
+	XMLName              xml.Name              `xml:"RestoreRequest"`
+	Days                 int                   `xml:"Days"`
+	GlacierJobParameters *GlacierJobParameters `xml:"GlacierJobParameters,omitempty"`
+}
+
+type GlacierJobParameters struct {
+	Tier string `xml:"Tier"`
+}
+
+func (rr *RestoreRequest) validate() error {
+	if rr.Days < 1 {
+		return ErrMalformedXML
+	}
+	if rr.GlacierJobParameters != nil {
+		switch rr.GlacierJobParameters.Tier {
+		case "Standard", "Bulk", "Expedited":
+		default:
+			return ErrMalformedXML
+		}
+	}
+	return nil
+}
+
+// archived reports whether objects in this storage class must be restored
+// before they can be read.
+func (s StorageClass) archived() bool {
+	return s == StorageGlacier || s == StorageDeepArchive
+}
+
+// restorer tracks the restores requested for archived objects. Restores do
+// not change the stored object, so the state is kept here rather than in the
+// Backend, and is lost when GoFakeS3 is stopped.
+type restorer struct {
+	mu       sync.Mutex
+	restores map[restoreKey]*restoreState
+}
+
+type restoreKey struct {
+	bucket  string
+	object  string
+	version VersionID
+}
+
+type restoreState struct {
+	// lastModified identifies the object the restore was requested for, so
+	// the restore does not carry over to an object written to the same key
+	// afterwards.
+	lastModified string
+
+	ready  time.Time
+	expiry time.Time
+}
+
+func newRestorer() *restorer {
+	return &restorer{restores: map[restoreKey]*restoreState{}}
+}
+
+func (rs *restoreState) ongoing(at time.Time) bool {
+	return at.Before(rs.ready)
+}
+
+// header returns the value of the 'x-amz-restore' header.
+func (rs *restoreState) header(at time.Time) string {
+	if rs.ongoing(at) {
+		return `ongoing-request="true"`
+	}
+	return fmt.Sprintf(`ongoing-request="false", expiry-date="%s"`, rs.expiry.UTC().Format(http.TimeFormat))
+}
+
+// get returns the restore state of obj, or nil if no restore has been
+// requested or the restored copy has expired. The caller must hold the lock.
+func (r *restorer) get(bucket string, obj *Object, at time.Time) *restoreState {
+	key := restoreKey{bucket: bucket, object: obj.Name, version: obj.VersionID}
+	state := r.restores[key]
+	if state == nil {
+		return nil
+	}
+	if state.lastModified != obj.Metadata["Last-Modified"] || !at.Before(state.expiry) {
+		delete(r.restores, key)
+		return nil
+	}
+	return state
+}
+
+func (g *GoFakeS3) restoreObject(bucket, object string, version VersionID, w http.ResponseWriter, r *http.Request) (err error) {
+	g.log.Print(LogInfo, "RESTORE OBJECT", bucket, object, version)
+
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	var in RestoreRequest
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := in.validate(); err != nil {
+		return err
+	}
+
+	var obj *Object
+	if version == "" {
+		obj, err = g.storage.HeadObject(r.Context(), bucket, object)
+	} else if g.versioned == nil {
+		return ErrNotImplemented
+	} else {
+		obj, err = g.versioned.HeadObjectVersion(bucket, object, version)
+	}
+	if err != nil {
+		return err
+	}
+	defer CheckClose(obj.Contents, &err)
+	if obj.IsDeleteMarker {
+		return KeyNotFound(object)
+	}
+
+	if !storageClassFromMetadata(obj.Metadata).archived() {
+		return ErrInvalidObjectState
+	}
+
+	now := g.timeSource.Now()
+	days := time.Duration(in.Days) * 24 * time.Hour
+
+	g.restorer.mu.Lock()
+	defer g.restorer.mu.Unlock()
+
+	if state := g.restorer.get(bucket, obj, now); state != nil {
+		if state.ongoing(now) {
+			return ErrRestoreAlreadyInProgress
+		}
+		// Restoring an object that has already been restored only changes
+		// the expiry date:
+		state.expiry = now.Add(days)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	ready := now.Add(g.restoreDelay)
+	g.restorer.restores[restoreKey{bucket: bucket, object: obj.Name, version: obj.VersionID}] = &restoreState{
+		lastModified: obj.Metadata["Last-Modified"],
+		ready:        ready,
+		expiry:       ready.Add(days),
+	}
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+// writeRestoreHeader sets the 'x-amz-restore' header for an object that has
+// a restore in progress, or that has been restored.
+func (g *GoFakeS3) writeRestoreHeader(bucket string, obj *Object, w http.ResponseWriter) {
+	now := g.timeSource.Now()
+
+	g.restorer.mu.Lock()
+	defer g.restorer.mu.Unlock()
+
+	if state := g.restorer.get(bucket, obj, now); state != nil {
+		w.Header().Set("x-amz-restore", state.header(now))
+	}
+}
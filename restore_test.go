@@ -0,0 +1,102 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestRestoreObject(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithRestoreDelay(time.Minute)))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.OKAll(svc.PutObject(&s3.PutObjectInput{
+		Bucket:       aws.String(defaultBucket),
+		Key:          aws.String("archived"),
+		Body:         bytes.NewReader([]byte("hello")),
+		StorageClass: aws.String(s3.StorageClassGlacier),
+	}))
+
+	restore := func() (int, error) {
+		t.Helper()
+		rq, _ := svc.RestoreObjectRequest(&s3.RestoreObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("archived"),
+			RestoreRequest: &s3.RestoreRequest{
+				Days:                 aws.Int64(2),
+				GlacierJobParameters: &s3.GlacierJobParameters{Tier: aws.String(s3.TierStandard)},
+			},
+		})
+		err := rq.Send()
+		return rq.HTTPResponse.StatusCode, err
+	}
+
+	assertRestoreHeader := func(expected string) {
+		t.Helper()
+		head, err := svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(defaultBucket), Key: aws.String("archived")})
+		ts.OK(err)
+		if aws.StringValue(head.Restore) != expected {
+			t.Fatalf("x-amz-restore:\nexp: %q\ngot: %q", expected, aws.StringValue(head.Restore))
+		}
+	}
+
+	assertRestoreHeader("")
+
+	status, err := restore()
+	ts.OK(err)
+	if status != http.StatusAccepted {
+		t.Fatal("unexpected status", status)
+	}
+	assertRestoreHeader(`ongoing-request="true"`)
+
+	if _, err := restore(); !hasErrorCode(err, gofakes3.ErrRestoreAlreadyInProgress) {
+		t.Fatal("expected RestoreAlreadyInProgress, found", err)
+	}
+
+	ts.Advance(time.Minute)
+	assertRestoreHeader(`ongoing-request="false", expiry-date="Wed, 03 Jan 2018 12:01:00 GMT"`)
+
+	// Restoring again extends the expiry:
+	ts.Advance(time.Hour)
+	status, err = restore()
+	ts.OK(err)
+	if status != http.StatusOK {
+		t.Fatal("unexpected status", status)
+	}
+	assertRestoreHeader(`ongoing-request="false", expiry-date="Wed, 03 Jan 2018 13:01:00 GMT"`)
+
+	// Once the restored copy expires, the header goes away:
+	ts.Advance(48 * time.Hour)
+	assertRestoreHeader("")
+}
+
+func TestRestoreObjectInvalidObjectState(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.backendPutString(defaultBucket, "standard", nil, "hello")
+
+	_, err := svc.RestoreObject(&s3.RestoreObjectInput{
+		Bucket:         aws.String(defaultBucket),
+		Key:            aws.String("standard"),
+		RestoreRequest: &s3.RestoreRequest{Days: aws.Int64(1)},
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidObjectState) {
+		t.Fatal("expected InvalidObjectState, found", err)
+	}
+
+	_, err = svc.RestoreObject(&s3.RestoreObjectInput{
+		Bucket:         aws.String(defaultBucket),
+		Key:            aws.String("missing"),
+		RestoreRequest: &s3.RestoreRequest{Days: aws.Int64(1)},
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		t.Fatal("expected NoSuchKey, found", err)
+	}
+}
@@ -1,8 +1,6 @@
 package gofakes3
 
 import (
-	"encoding/base64"
-	"fmt"
 	"net/http"
 	"strings"
 )
@@ -15,6 +13,12 @@ import (
 //
 //	/<bucket>/<object>
 //
+// Slashes around the bucket are ignored, so '/<bucket>/' and '/<bucket>//'
+// address the bucket itself rather than an object with an empty key: a GET
+// lists the bucket, with or without listing parameters such as
+// '?list-type=2'. Object subresources that need a key, such as '?versionId',
+// fail with NoSuchKey when it is empty.
+//
 // The operation for most of the core functionality is built around HTTP
 // verbs, but outside the core functionality, the clean separation starts
 // to degrade, especially around multipart uploads.
@@ -25,168 +29,585 @@ func (g *GoFakeS3) routeBase(w http.ResponseWriter, r *http.Request) {
 		bucket = parts[0]
 		query  = r.URL.Query()
 		object = ""
-		err    error
 	)
 
-	hdr := w.Header()
-
-	id := fmt.Sprintf("%016X", g.nextRequestID())
-	hdr.Set("x-amz-id-2", base64.StdEncoding.EncodeToString([]byte(id+id+id+id))) // x-amz-id-2 is 48 bytes of random stuff
-	hdr.Set("x-amz-request-id", id)
-	hdr.Set("Server", "AmazonS3")
-
 	if len(parts) == 2 {
 		object = parts[1]
 	}
 
+	op, handler := g.route(bucket, object, r)
+	g.log.Print(LogInfo, op, r.Method, r.URL.Path)
+	r = withRequestContext(r, bucket, object, op, RequestIDFromContext(r.Context()))
+
+	if err := g.checkDenyRules(bucket, object, op); err != nil {
+		g.httpError(w, r, err)
+		return
+	}
+
+	if err := g.authorize(bucket, object, r); err != nil {
+		g.httpError(w, r, err)
+		return
+	}
+
+	if err := g.checkRegion(bucket, w, r); err != nil {
+		g.httpError(w, r, err)
+		return
+	}
+
+	if g.websiteServing && g.hostBucket && bucket != "" && len(query) == 0 {
+		if handled, err := g.serveWebsite(bucket, object, w, r); handled {
+			if err != nil {
+				g.httpError(w, r, err)
+			}
+			return
+		}
+	}
+
+	if err := handler(w, r); err != nil {
+		g.httpError(w, r, err)
+	}
+}
+
+// routeHandler serves a request once routeBase has checked that it may
+// proceed.
+type routeHandler func(w http.ResponseWriter, r *http.Request) error
+
+// routeError returns a routeHandler that fails with err.
+func routeError(err error) routeHandler {
+	return func(w http.ResponseWriter, r *http.Request) error { return err }
+}
+
+// route works out which Operation the request is for, and the routeHandler
+// that serves it. Requests that are rejected with ErrMethodNotAllowed are
+// OpUnknown.
+func (g *GoFakeS3) route(bucket, object string, r *http.Request) (Operation, routeHandler) {
+	query := r.URL.Query()
+
 	if uploadID := UploadID(query.Get("uploadId")); uploadID != "" {
-		err = g.routeMultipartUpload(bucket, object, uploadID, w, r)
+		return g.routeMultipartUpload(bucket, object, uploadID, r)
 
 	} else if _, ok := query["uploads"]; ok {
-		err = g.routeMultipartUploadBase(bucket, object, w, r)
+		return g.routeMultipartUploadBase(bucket, object, r)
+
+	} else if _, ok := query["acl"]; ok && object != "" {
+		return g.routeObjectACL(bucket, object, r)
+
+	} else if _, ok := query["acl"]; ok {
+		return g.routeBucketACL(bucket, r)
+
+	} else if _, ok := query["retention"]; ok && object != "" {
+		return g.routeObjectRetention(bucket, object, VersionID(versionFromQuery(query["versionId"])), r)
+
+	} else if _, ok := query["legal-hold"]; ok && object != "" {
+		return g.routeObjectLegalHold(bucket, object, VersionID(versionFromQuery(query["versionId"])), r)
+
+	} else if _, ok := query["restore"]; ok && object != "" {
+		return g.routeObjectRestore(bucket, object, VersionID(versionFromQuery(query["versionId"])), r)
+
+	} else if _, ok := query["select"]; ok && object != "" {
+		return g.routeObjectSelect(bucket, object, r)
+
+	} else if _, ok := query["object-lock"]; ok && object == "" {
+		return g.routeBucketObjectLock(bucket, r)
+
+	} else if _, ok := query["policy"]; ok && object == "" {
+		return g.routeBucketPolicy(bucket, r)
+
+	} else if _, ok := query["cors"]; ok && object == "" {
+		return g.routeBucketCORS(bucket, r)
+
+	} else if _, ok := query["website"]; ok && object == "" {
+		return g.routeBucketWebsite(bucket, r)
+
+	} else if _, ok := query["requestPayment"]; ok && object == "" {
+		return g.routeBucketRequestPayment(bucket, r)
+
+	} else if _, ok := query["accelerate"]; ok && object == "" {
+		return g.routeBucketAccelerate(bucket, r)
+
+	} else if _, ok := query["encryption"]; ok && object == "" {
+		return g.routeBucketEncryption(bucket, r)
+
+	} else if _, ok := query["notification"]; ok && object == "" {
+		return g.routeBucketNotification(bucket, r)
 
 	} else if _, ok := query["versioning"]; ok {
-		err = g.routeVersioning(bucket, w, r)
+		return g.routeVersioning(bucket, r)
 
 	} else if _, ok := query["versions"]; ok {
-		err = g.routeVersions(bucket, w, r)
+		return g.routeVersions(bucket, r)
 
 	} else if versionID := versionFromQuery(query["versionId"]); versionID != "" {
-		err = g.routeVersion(bucket, object, VersionID(versionID), w, r)
+		return g.routeVersion(bucket, object, VersionID(versionID), r)
 
 	} else if bucket != "" && object != "" {
 		if strings.HasSuffix(r.URL.Path, "/") {
 			object = object + "/"
 		}
-		err = g.routeObject(bucket, object, w, r)
+		return g.routeObject(bucket, object, r)
 
 	} else if bucket != "" {
-		err = g.routeBucket(bucket, w, r)
+		return g.routeBucket(bucket, r)
 
 	} else if r.Method == "GET" {
-		err = g.listBuckets(w, r)
+		return OpListBuckets, g.listBuckets
 
-	} else {
-		http.NotFound(w, r)
-		return
+	} else if r.Method == "HEAD" {
+		// Tools probe the service root with a HEAD to check connectivity and
+		// credentials; authentication has already passed by this point, so
+		// this is treated as a ListBuckets without a body:
+		return OpListBuckets, func(w http.ResponseWriter, r *http.Request) error {
+			w.WriteHeader(http.StatusOK)
+			return nil
+		}
 	}
 
-	if err != nil {
-		g.httpError(w, r, err)
+	return OpUnknown, func(w http.ResponseWriter, r *http.Request) error {
+		http.NotFound(w, r)
+		return nil
 	}
 }
 
 // routeObject oandles URLs that contain both a bucket path segment and an
 // object path segment.
-func (g *GoFakeS3) routeObject(bucket, object string, w http.ResponseWriter, r *http.Request) (err error) {
+func (g *GoFakeS3) routeObject(bucket, object string, r *http.Request) (Operation, routeHandler) {
 	switch r.Method {
 	case "GET":
-		return g.getObject(bucket, object, "", w, r)
+		return OpGetObject, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getObject(bucket, object, "", w, r)
+		}
 	case "HEAD":
-		return g.headObject(bucket, object, "", w, r)
+		return OpHeadObject, func(w http.ResponseWriter, r *http.Request) error {
+			return g.headObject(bucket, object, "", w, r)
+		}
 	case "PUT":
-		return g.createObject(bucket, object, w, r)
+		op := OpPutObject
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			op = OpCopyObject
+		}
+		return op, func(w http.ResponseWriter, r *http.Request) error {
+			return g.createObject(bucket, object, w, r)
+		}
 	case "DELETE":
-		return g.deleteObject(bucket, object, w, r)
+		return OpDeleteObject, func(w http.ResponseWriter, r *http.Request) error {
+			return g.deleteObject(bucket, object, w, r)
+		}
+	case "POST":
+		return OpUnknown, routeError(objectPostNotAllowed(object))
 	default:
-		return ErrMethodNotAllowed
+		return OpUnknown, routeError(ErrMethodNotAllowed)
 	}
 }
 
+// objectPostSubresources are the only subresources that accept a POST to an
+// object: CreateMultipartUpload, CompleteMultipartUpload, RestoreObject and
+// SelectObjectContent. routeBase dispatches each of them before routeObject
+// is reached.
+var objectPostSubresources = []string{"?uploads", "?uploadId", "?restore", "?select"}
+
+// objectPostNotAllowed is returned for a POST to an object that does not
+// use one of the objectPostSubresources. Browser-based uploads are POSTed to
+// the bucket, not the object.
+func objectPostNotAllowed(object string) error {
+	return ErrorMessagef(ErrMethodNotAllowed,
+		"POST is not allowed on object %q without one of the %s subresources.",
+		object, strings.Join(objectPostSubresources, ", "))
+}
+
 // routeBucket handles URLs that contain only a bucket path segment, not an
 // object path segment.
-func (g *GoFakeS3) routeBucket(bucket string, w http.ResponseWriter, r *http.Request) (err error) {
+func (g *GoFakeS3) routeBucket(bucket string, r *http.Request) (Operation, routeHandler) {
+	query := r.URL.Query()
 	switch r.Method {
 	case "GET":
-		if _, ok := r.URL.Query()["location"]; ok {
-			return g.getBucketLocation(bucket, w, r)
-		} else {
+		if _, ok := query["location"]; ok {
+			return OpGetBucketLocation, func(w http.ResponseWriter, r *http.Request) error {
+				return g.getBucketLocation(bucket, w, r)
+			}
+		}
+		op := OpListObjects
+		if query.Get("list-type") == "2" {
+			op = OpListObjectsV2
+		}
+		return op, func(w http.ResponseWriter, r *http.Request) error {
 			return g.listBucket(bucket, w, r)
 		}
 	case "PUT":
-		return g.createBucket(bucket, w, r)
+		return OpCreateBucket, func(w http.ResponseWriter, r *http.Request) error {
+			return g.createBucket(bucket, w, r)
+		}
 	case "DELETE":
-		return g.deleteBucket(bucket, w, r)
+		return OpDeleteBucket, func(w http.ResponseWriter, r *http.Request) error {
+			return g.deleteBucket(bucket, w, r)
+		}
 	case "HEAD":
-		return g.headBucket(bucket, w, r)
+		return OpHeadBucket, func(w http.ResponseWriter, r *http.Request) error {
+			return g.headBucket(bucket, w, r)
+		}
 	case "POST":
-		if _, ok := r.URL.Query()["delete"]; ok {
-			return g.deleteMulti(bucket, w, r)
-		} else {
+		if _, ok := query["delete"]; ok {
+			return OpDeleteObjects, func(w http.ResponseWriter, r *http.Request) error {
+				return g.deleteMulti(bucket, w, r)
+			}
+		}
+		return OpPostObject, func(w http.ResponseWriter, r *http.Request) error {
 			return g.createObjectBrowserUpload(bucket, w, r)
 		}
 	default:
-		return ErrMethodNotAllowed
+		return OpUnknown, routeError(ErrMethodNotAllowed)
 	}
 }
 
 // routeMultipartUploadBase operates on routes that contain '?uploads' in the
 // query string. These routes may or may not have a value for bucket or object;
 // this is validated and handled in the target handler functions.
-func (g *GoFakeS3) routeMultipartUploadBase(bucket, object string, w http.ResponseWriter, r *http.Request) error {
+func (g *GoFakeS3) routeMultipartUploadBase(bucket, object string, r *http.Request) (Operation, routeHandler) {
+	switch r.Method {
+	case "GET":
+		return OpListMultipartUploads, func(w http.ResponseWriter, r *http.Request) error {
+			return g.listMultipartUploads(bucket, w, r)
+		}
+	case "POST":
+		return OpCreateMultipartUpload, func(w http.ResponseWriter, r *http.Request) error {
+			return g.initiateMultipartUpload(bucket, object, w, r)
+		}
+	default:
+		return OpUnknown, routeError(ErrMethodNotAllowed)
+	}
+}
+
+// routeObjectACL operates on routes that contain '?acl' in the query string
+// and both a bucket and an object path segment.
+func (g *GoFakeS3) routeObjectACL(bucket, object string, r *http.Request) (Operation, routeHandler) {
+	switch r.Method {
+	case "GET":
+		return OpGetObjectAcl, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getObjectACL(bucket, object, w, r)
+		}
+	case "PUT":
+		return OpPutObjectAcl, func(w http.ResponseWriter, r *http.Request) error {
+			return g.putObjectACL(bucket, object, w, r)
+		}
+	default:
+		return OpUnknown, routeError(ErrMethodNotAllowed)
+	}
+}
+
+// routeObjectRetention operates on routes that contain '?retention' in the
+// query string and both a bucket and an object path segment.
+func (g *GoFakeS3) routeObjectRetention(bucket, object string, version VersionID, r *http.Request) (Operation, routeHandler) {
 	switch r.Method {
 	case "GET":
-		return g.listMultipartUploads(bucket, w, r)
+		return OpGetObjectRetention, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getObjectRetention(bucket, object, version, w, r)
+		}
+	case "PUT":
+		return OpPutObjectRetention, func(w http.ResponseWriter, r *http.Request) error {
+			return g.putObjectRetention(bucket, object, version, w, r)
+		}
+	default:
+		return OpUnknown, routeError(ErrMethodNotAllowed)
+	}
+}
+
+// routeObjectRestore operates on routes that contain '?restore' in the
+// query string and both a bucket and an object path segment.
+func (g *GoFakeS3) routeObjectRestore(bucket, object string, version VersionID, r *http.Request) (Operation, routeHandler) {
+	switch r.Method {
+	case "POST":
+		return OpRestoreObject, func(w http.ResponseWriter, r *http.Request) error {
+			return g.restoreObject(bucket, object, version, w, r)
+		}
+	default:
+		return OpUnknown, routeError(ErrMethodNotAllowed)
+	}
+}
+
+// routeObjectSelect operates on routes that contain '?select' in the query
+// string and both a bucket and an object path segment.
+func (g *GoFakeS3) routeObjectSelect(bucket, object string, r *http.Request) (Operation, routeHandler) {
+	switch r.Method {
 	case "POST":
-		return g.initiateMultipartUpload(bucket, object, w, r)
+		return OpSelectObjectContent, func(w http.ResponseWriter, r *http.Request) error {
+			return g.selectObjectContent(bucket, object, w, r)
+		}
+	default:
+		return OpUnknown, routeError(ErrMethodNotAllowed)
+	}
+}
+
+// routeObjectLegalHold operates on routes that contain '?legal-hold' in the
+// query string and both a bucket and an object path segment.
+func (g *GoFakeS3) routeObjectLegalHold(bucket, object string, version VersionID, r *http.Request) (Operation, routeHandler) {
+	switch r.Method {
+	case "GET":
+		return OpGetObjectLegalHold, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getObjectLegalHold(bucket, object, version, w, r)
+		}
+	case "PUT":
+		return OpPutObjectLegalHold, func(w http.ResponseWriter, r *http.Request) error {
+			return g.putObjectLegalHold(bucket, object, version, w, r)
+		}
+	default:
+		return OpUnknown, routeError(ErrMethodNotAllowed)
+	}
+}
+
+// routeBucketObjectLock operates on routes that contain '?object-lock' in the
+// query string and only a bucket path segment.
+func (g *GoFakeS3) routeBucketObjectLock(bucket string, r *http.Request) (Operation, routeHandler) {
+	switch r.Method {
+	case "GET":
+		return OpGetObjectLockConfiguration, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getObjectLockConfiguration(bucket, w, r)
+		}
+	case "PUT":
+		return OpPutObjectLockConfiguration, func(w http.ResponseWriter, r *http.Request) error {
+			return g.putObjectLockConfiguration(bucket, w, r)
+		}
 	default:
-		return ErrMethodNotAllowed
+		return OpUnknown, routeError(ErrMethodNotAllowed)
+	}
+}
+
+// routeBucketACL operates on routes that contain '?acl' in the query string
+// and only a bucket path segment.
+func (g *GoFakeS3) routeBucketACL(bucket string, r *http.Request) (Operation, routeHandler) {
+	switch r.Method {
+	case "GET":
+		return OpGetBucketAcl, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getBucketACL(bucket, w, r)
+		}
+	case "PUT":
+		return OpPutBucketAcl, func(w http.ResponseWriter, r *http.Request) error {
+			return g.putBucketACL(bucket, w, r)
+		}
+	default:
+		return OpUnknown, routeError(ErrMethodNotAllowed)
+	}
+}
+
+// routeBucketPolicy operates on routes that contain '?policy' in the query
+// string and only a bucket path segment.
+func (g *GoFakeS3) routeBucketPolicy(bucket string, r *http.Request) (Operation, routeHandler) {
+	switch r.Method {
+	case "GET":
+		return OpGetBucketPolicy, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getBucketPolicy(bucket, w, r)
+		}
+	case "PUT":
+		return OpPutBucketPolicy, func(w http.ResponseWriter, r *http.Request) error {
+			return g.putBucketPolicy(bucket, w, r)
+		}
+	case "DELETE":
+		return OpDeleteBucketPolicy, func(w http.ResponseWriter, r *http.Request) error {
+			return g.deleteBucketPolicy(bucket, w, r)
+		}
+	default:
+		return OpUnknown, routeError(ErrMethodNotAllowed)
+	}
+}
+
+// routeBucketCORS operates on routes that contain '?cors' in the query string
+// and only a bucket path segment.
+func (g *GoFakeS3) routeBucketCORS(bucket string, r *http.Request) (Operation, routeHandler) {
+	switch r.Method {
+	case "GET":
+		return OpGetBucketCors, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getBucketCORS(bucket, w, r)
+		}
+	case "PUT":
+		return OpPutBucketCors, func(w http.ResponseWriter, r *http.Request) error {
+			return g.putBucketCORS(bucket, w, r)
+		}
+	case "DELETE":
+		return OpDeleteBucketCors, func(w http.ResponseWriter, r *http.Request) error {
+			return g.deleteBucketCORS(bucket, w, r)
+		}
+	default:
+		return OpUnknown, routeError(ErrMethodNotAllowed)
+	}
+}
+
+// routeBucketRequestPayment operates on routes that contain '?requestPayment'
+// in the query string and only a bucket path segment.
+func (g *GoFakeS3) routeBucketRequestPayment(bucket string, r *http.Request) (Operation, routeHandler) {
+	switch r.Method {
+	case "GET":
+		return OpGetBucketRequestPayment, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getBucketRequestPayment(bucket, w, r)
+		}
+	case "PUT":
+		return OpPutBucketRequestPayment, func(w http.ResponseWriter, r *http.Request) error {
+			return g.putBucketRequestPayment(bucket, w, r)
+		}
+	default:
+		return OpUnknown, routeError(ErrMethodNotAllowed)
+	}
+}
+
+// routeBucketAccelerate operates on routes that contain '?accelerate' in the
+// query string and only a bucket path segment.
+func (g *GoFakeS3) routeBucketAccelerate(bucket string, r *http.Request) (Operation, routeHandler) {
+	switch r.Method {
+	case "GET":
+		return OpGetBucketAccelerateConfiguration, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getBucketAccelerate(bucket, w, r)
+		}
+	case "PUT":
+		return OpPutBucketAccelerateConfiguration, func(w http.ResponseWriter, r *http.Request) error {
+			return g.putBucketAccelerate(bucket, w, r)
+		}
+	default:
+		return OpUnknown, routeError(ErrMethodNotAllowed)
+	}
+}
+
+// routeBucketWebsite operates on routes that contain '?website' in the query
+// string and only a bucket path segment.
+func (g *GoFakeS3) routeBucketWebsite(bucket string, r *http.Request) (Operation, routeHandler) {
+	switch r.Method {
+	case "GET":
+		return OpGetBucketWebsite, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getBucketWebsite(bucket, w, r)
+		}
+	case "PUT":
+		return OpPutBucketWebsite, func(w http.ResponseWriter, r *http.Request) error {
+			return g.putBucketWebsite(bucket, w, r)
+		}
+	case "DELETE":
+		return OpDeleteBucketWebsite, func(w http.ResponseWriter, r *http.Request) error {
+			return g.deleteBucketWebsite(bucket, w, r)
+		}
+	default:
+		return OpUnknown, routeError(ErrMethodNotAllowed)
+	}
+}
+
+// routeBucketEncryption operates on routes that contain '?encryption' in the
+// query string and only a bucket path segment.
+func (g *GoFakeS3) routeBucketEncryption(bucket string, r *http.Request) (Operation, routeHandler) {
+	switch r.Method {
+	case "GET":
+		return OpGetBucketEncryption, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getBucketEncryption(bucket, w, r)
+		}
+	case "PUT":
+		return OpPutBucketEncryption, func(w http.ResponseWriter, r *http.Request) error {
+			return g.putBucketEncryption(bucket, w, r)
+		}
+	case "DELETE":
+		return OpDeleteBucketEncryption, func(w http.ResponseWriter, r *http.Request) error {
+			return g.deleteBucketEncryption(bucket, w, r)
+		}
+	default:
+		return OpUnknown, routeError(ErrMethodNotAllowed)
+	}
+}
+
+// routeBucketNotification operates on routes that contain '?notification' in
+// the query string and only a bucket path segment.
+func (g *GoFakeS3) routeBucketNotification(bucket string, r *http.Request) (Operation, routeHandler) {
+	switch r.Method {
+	case "GET":
+		return OpGetBucketNotificationConfiguration, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getBucketNotification(bucket, w, r)
+		}
+	case "PUT":
+		return OpPutBucketNotificationConfiguration, func(w http.ResponseWriter, r *http.Request) error {
+			return g.putBucketNotification(bucket, w, r)
+		}
+	default:
+		return OpUnknown, routeError(ErrMethodNotAllowed)
 	}
 }
 
 // routeVersioningBase operates on routes that contain '?versioning' in the
 // query string. These routes may or may not have a value for bucket; this is
 // validated and handled in the target handler functions.
-func (g *GoFakeS3) routeVersioning(bucket string, w http.ResponseWriter, r *http.Request) error {
+func (g *GoFakeS3) routeVersioning(bucket string, r *http.Request) (Operation, routeHandler) {
 	switch r.Method {
 	case "GET":
-		return g.getBucketVersioning(bucket, w, r)
+		return OpGetBucketVersioning, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getBucketVersioning(bucket, w, r)
+		}
 	case "PUT":
-		return g.putBucketVersioning(bucket, w, r)
+		return OpPutBucketVersioning, func(w http.ResponseWriter, r *http.Request) error {
+			return g.putBucketVersioning(bucket, w, r)
+		}
 	default:
-		return ErrMethodNotAllowed
+		return OpUnknown, routeError(ErrMethodNotAllowed)
 	}
 }
 
 // routeVersions operates on routes that contain '?versions' in the query string.
-func (g *GoFakeS3) routeVersions(bucket string, w http.ResponseWriter, r *http.Request) error {
+func (g *GoFakeS3) routeVersions(bucket string, r *http.Request) (Operation, routeHandler) {
 	switch r.Method {
 	case "GET":
-		return g.listBucketVersions(bucket, w, r)
+		return OpListObjectVersions, func(w http.ResponseWriter, r *http.Request) error {
+			return g.listBucketVersions(bucket, w, r)
+		}
 	default:
-		return ErrMethodNotAllowed
+		return OpUnknown, routeError(ErrMethodNotAllowed)
 	}
 }
 
 // routeVersion operates on routes that contain '?versionId=<id>' in the
 // query string.
-func (g *GoFakeS3) routeVersion(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+func (g *GoFakeS3) routeVersion(bucket, object string, versionID VersionID, r *http.Request) (Operation, routeHandler) {
+	var (
+		op      = OpUnknown
+		handler = routeError(ErrMethodNotAllowed)
+	)
 	switch r.Method {
 	case "GET":
-		return g.getObject(bucket, object, versionID, w, r)
+		op, handler = OpGetObject, func(w http.ResponseWriter, r *http.Request) error {
+			return g.getObject(bucket, object, versionID, w, r)
+		}
 	case "HEAD":
-		return g.headObject(bucket, object, versionID, w, r)
+		op, handler = OpHeadObject, func(w http.ResponseWriter, r *http.Request) error {
+			return g.headObject(bucket, object, versionID, w, r)
+		}
 	case "DELETE":
-		return g.deleteObjectVersion(bucket, object, versionID, w, r)
-	default:
-		return ErrMethodNotAllowed
+		op, handler = OpDeleteObject, func(w http.ResponseWriter, r *http.Request) error {
+			return g.deleteObjectVersion(bucket, object, versionID, w, r)
+		}
+	case "POST":
+		handler = routeError(objectPostNotAllowed(object))
 	}
+
+	if object == "" {
+		handler = routeError(KeyNotFound(object))
+	}
+	return op, handler
 }
 
 // routeMultipartUpload operates on routes that contain '?uploadId=<id>' in the
 // query string.
-func (g *GoFakeS3) routeMultipartUpload(bucket, object string, uploadID UploadID, w http.ResponseWriter, r *http.Request) error {
+func (g *GoFakeS3) routeMultipartUpload(bucket, object string, uploadID UploadID, r *http.Request) (Operation, routeHandler) {
 	switch r.Method {
 	case "GET":
-		return g.listMultipartUploadParts(bucket, object, uploadID, w, r)
+		return OpListParts, func(w http.ResponseWriter, r *http.Request) error {
+			return g.listMultipartUploadParts(bucket, object, uploadID, w, r)
+		}
 	case "PUT":
-		return g.putMultipartUploadPart(bucket, object, uploadID, w, r)
+		op := OpUploadPart
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			op = OpUploadPartCopy
+		}
+		return op, func(w http.ResponseWriter, r *http.Request) error {
+			return g.putMultipartUploadPart(bucket, object, uploadID, w, r)
+		}
 	case "DELETE":
-		return g.abortMultipartUpload(bucket, object, uploadID, w, r)
+		return OpAbortMultipartUpload, func(w http.ResponseWriter, r *http.Request) error {
+			return g.abortMultipartUpload(bucket, object, uploadID, w, r)
+		}
 	case "POST":
-		return g.completeMultipartUpload(bucket, object, uploadID, w, r)
+		return OpCompleteMultipartUpload, func(w http.ResponseWriter, r *http.Request) error {
+			return g.completeMultipartUpload(bucket, object, uploadID, w, r)
+		}
 	default:
-		return ErrMethodNotAllowed
+		return OpUnknown, routeError(ErrMethodNotAllowed)
 	}
 }
 
@@ -1,7 +1,15 @@
 package gofakes3_test
 
 import (
+	"io/ioutil"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/oneclickvirt/gofakes3"
 )
 
 func TestRoutingSlashes(t *testing.T) {
@@ -30,3 +38,162 @@ func TestRoutingSlashes(t *testing.T) {
 	assertStatus("test/obj/", 200)
 	assertStatus("test/obj//", 200)
 }
+
+func TestRoutingEmptyKey(t *testing.T) {
+	ts := newTestServer(t, withoutInitialBuckets())
+	defer ts.Close()
+	ts.backendCreateBucket("test")
+	ts.backendPutString("test", "obj", nil, "yep")
+
+	get := func(url string) (*http.Response, string) {
+		t.Helper()
+		rs, err := httpClient().Get(ts.server.URL + url)
+		ts.OK(err)
+		defer rs.Body.Close()
+		body, err := ioutil.ReadAll(rs.Body)
+		ts.OK(err)
+		return rs, string(body)
+	}
+
+	// An empty key addresses the bucket, so these are all listings:
+	for _, url := range []string{"/test/", "/test/?list-type=2", "/test//", "//test/"} {
+		rs, body := get(url)
+		if rs.StatusCode != http.StatusOK {
+			t.Fatal(url, "unexpected status", rs.StatusCode)
+		}
+		if !strings.Contains(body, "<ListBucketResult") || !strings.Contains(body, "<Key>obj</Key>") {
+			t.Fatal(url, "expected listing, found", body)
+		}
+	}
+
+	// Object subresources need a key:
+	for _, url := range []string{"/test/?versionId=abc", "/test//?versionId=abc"} {
+		rs, body := get(url)
+		if rs.StatusCode != http.StatusNotFound || !strings.Contains(body, "<Code>"+string(gofakes3.ErrNoSuchKey)+"</Code>") {
+			t.Fatal(url, "expected NoSuchKey, found", rs.StatusCode, body)
+		}
+	}
+}
+
+func TestRoutingObjectPost(t *testing.T) {
+	ts := newTestServer(t, withoutInitialBuckets())
+	defer ts.Close()
+	ts.backendCreateBucket("test")
+	ts.backendPutString("test", "obj", nil, "yep")
+
+	post := func(url string) (*http.Response, string) {
+		t.Helper()
+		rs, err := httpClient().Post(ts.server.URL+url, "application/octet-stream", strings.NewReader("body"))
+		ts.OK(err)
+		defer rs.Body.Close()
+		body, err := ioutil.ReadAll(rs.Body)
+		ts.OK(err)
+		return rs, string(body)
+	}
+
+	for _, url := range []string{"/test/obj", "/test/obj?versionId=1", "/test/obj?tagging", "/test/missing"} {
+		rs, body := post(url)
+		if rs.StatusCode != gofakes3.ErrMethodNotAllowed.Status() {
+			t.Fatal(url, "unexpected status", rs.StatusCode)
+		}
+		if !strings.Contains(body, "<Code>MethodNotAllowed</Code>") || !strings.Contains(body, "?restore") {
+			t.Fatal(url, "unexpected body", body)
+		}
+	}
+
+	// The object was not touched:
+	ts.assertObject("test", "obj", nil, "yep")
+
+	if rs, body := post("/test/obj?uploads"); rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode, body)
+	}
+}
+
+func TestHeadServiceRoot(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(
+		gofakes3.WithV4Auth(map[string]string{"dummy-access": "dummy-secret"}),
+	))
+	defer ts.Close()
+
+	do := func(method, secret string) (*http.Response, string) {
+		t.Helper()
+		rq, err := http.NewRequest(method, ts.url("/"), nil)
+		ts.OK(err)
+		if secret != "" {
+			signer := v4.NewSigner(credentials.NewStaticCredentials("dummy-access", secret, ""))
+			_, err = signer.Sign(rq, nil, "s3", "region", time.Now())
+			ts.OK(err)
+		}
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		defer rs.Body.Close()
+		body, err := ioutil.ReadAll(rs.Body)
+		ts.OK(err)
+		return rs, string(body)
+	}
+
+	if rs, body := do("HEAD", "dummy-secret"); rs.StatusCode != http.StatusOK || body != "" {
+		t.Fatal("unexpected response", rs.StatusCode, body)
+	}
+	if rs, body := do("HEAD", "wrong-secret"); rs.StatusCode != http.StatusForbidden || body != "" {
+		t.Fatal("unexpected response", rs.StatusCode, body)
+	}
+	if rs, body := do("HEAD", ""); rs.StatusCode != http.StatusForbidden || body != "" {
+		t.Fatal("unexpected response", rs.StatusCode, body)
+	}
+
+	// Only a GET has the error document:
+	rs, body := do("GET", "wrong-secret")
+	if rs.StatusCode != http.StatusForbidden || !strings.Contains(body, "<Code>SignatureDoesNotMatch</Code>") {
+		t.Fatal("unexpected response", rs.StatusCode, body)
+	}
+	if ct := rs.Header.Get("Content-Type"); ct != "application/xml" {
+		t.Fatal("unexpected Content-Type", ct)
+	}
+}
+
+func TestRequestIDHeaders(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(
+		gofakes3.WithV4Auth(map[string]string{"dummy-access": "dummy-secret"}),
+	))
+	defer ts.Close()
+
+	do := func(method, path, secret string) (*http.Response, string) {
+		t.Helper()
+		rq, err := http.NewRequest(method, ts.url(path), nil)
+		ts.OK(err)
+		signer := v4.NewSigner(credentials.NewStaticCredentials("dummy-access", secret, ""))
+		_, err = signer.Sign(rq, nil, "s3", "region", time.Now())
+		ts.OK(err)
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		defer rs.Body.Close()
+		body, err := ioutil.ReadAll(rs.Body)
+		ts.OK(err)
+
+		id := rs.Header.Get("x-amz-request-id")
+		if id == "" || rs.Header.Get("x-amz-id-2") == "" {
+			t.Fatal("missing request id headers", rs.Header)
+		}
+		if rs.StatusCode >= 300 && !strings.Contains(string(body), "<RequestId>"+id+"</RequestId>") {
+			t.Fatal("error does not carry the request id", id, string(body))
+		}
+		return rs, string(body)
+	}
+
+	if rs, _ := do("GET", "/"+defaultBucket, "dummy-secret"); rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	if rs, _ := do("GET", "/"+defaultBucket+"/missing", "dummy-secret"); rs.StatusCode != http.StatusNotFound {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	if rs, _ := do("GET", "/"+defaultBucket, "wrong-secret"); rs.StatusCode != http.StatusForbidden {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+
+	first, _ := do("GET", "/", "dummy-secret")
+	second, _ := do("GET", "/", "dummy-secret")
+	if first.Header.Get("x-amz-request-id") == second.Header.Get("x-amz-request-id") {
+		t.Fatal("expected a new request id for each request")
+	}
+}
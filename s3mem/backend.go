@@ -5,6 +5,7 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"io"
+	"net/http"
 	"sync"
 	"time"
 
@@ -29,6 +30,19 @@ type Backend struct {
 
 var _ gofakes3.Backend = &Backend{}
 var _ gofakes3.VersionedBackend = &Backend{}
+var _ gofakes3.VersionCopyBackend = &Backend{}
+var _ gofakes3.ACLBackend = &Backend{}
+var _ gofakes3.BucketACLBackend = &Backend{}
+var _ gofakes3.PolicyBackend = &Backend{}
+var _ gofakes3.CORSBackend = &Backend{}
+var _ gofakes3.WebsiteBackend = &Backend{}
+var _ gofakes3.EncryptionBackend = &Backend{}
+var _ gofakes3.NotificationBackend = &Backend{}
+var _ gofakes3.ObjectLockBackend = &Backend{}
+var _ gofakes3.ResumableBackend = &Backend{}
+var _ gofakes3.QuotaBackend = &Backend{}
+var _ gofakes3.RequestPaymentBackend = &Backend{}
+var _ gofakes3.AccelerateBackend = &Backend{}
 
 type Option func(b *Backend)
 
@@ -120,6 +134,7 @@ func (db *Backend) ListBucket(ctx context.Context, name string, prefix *gofakes3
 				LastModified: gofakes3.NewContentTime(item.data.lastModified),
 				ETag:         `"` + hex.EncodeToString(item.data.hash) + `"`,
 				Size:         int64(len(item.data.body)),
+				StorageClass: gofakes3.StorageClass(item.data.metadata["X-Amz-Storage-Class"]),
 			})
 		}
 
@@ -183,7 +198,16 @@ func (db *Backend) HeadObject(ctx context.Context, bucketName, objectName string
 		return nil, gofakes3.KeyNotFound(objectName)
 	}
 
-	return obj.data.toObject(nil, false)
+	result, err := obj.data.toObject(nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if bucket.versioning != gofakes3.VersioningEnabled {
+		result.VersionID = ""
+	}
+
+	return result, nil
 }
 
 func (db *Backend) GetObject(ctx context.Context, bucketName, objectName string, rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
@@ -232,6 +256,11 @@ func (db *Backend) PutObject(ctx context.Context, bucketName, objectName string,
 		return result, err
 	}
 
+	return db.putObject(bucketName, objectName, meta, bts)
+}
+
+// putObject stores bts with exactly the metadata in meta.
+func (db *Backend) putObject(bucketName, objectName string, meta map[string]string, bts []byte) (result gofakes3.PutObjectResult, err error) {
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -261,6 +290,60 @@ func (db *Backend) PutObject(ctx context.Context, bucketName, objectName string,
 	return result, nil
 }
 
+// WriteAt appends to an existing object, keeping its metadata, ACL and Object
+// Lock settings. If versioning is enabled, the result is a new version.
+func (db *Backend) WriteAt(ctx context.Context, bucketName, objectName string, offset int64, input io.Reader, size int64) (result gofakes3.PutObjectResult, err error) {
+	bts, err := gofakes3.ReadAll(input, size)
+	if err != nil {
+		return result, err
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return result, gofakes3.BucketNotFound(bucketName)
+	}
+
+	obj := bucket.object(objectName)
+	if obj == nil || obj.data == nil || obj.data.deleteMarker {
+		return result, gofakes3.KeyNotFound(objectName)
+	}
+	if int64(len(obj.data.body)) != offset {
+		return result, gofakes3.ErrInvalidWriteOffset
+	}
+
+	body := make([]byte, 0, len(obj.data.body)+len(bts))
+	body = append(append(body, obj.data.body...), bts...)
+	hash := md5.Sum(body)
+
+	now := db.timeSource.Now()
+	item := *obj.data
+	item.body = body
+	item.hash = hash[:]
+	item.etag = `"` + hex.EncodeToString(hash[:]) + `"`
+	item.lastModified = now
+
+	// The metadata is shared with the previous version, so it is copied
+	// before the modification time is updated:
+	item.metadata = make(map[string]string, len(obj.data.metadata))
+	for k, v := range obj.data.metadata {
+		item.metadata[k] = v
+	}
+	if _, ok := item.metadata["Last-Modified"]; ok {
+		item.metadata["Last-Modified"] = now.UTC().Format(http.TimeFormat)
+	}
+
+	bucket.put(objectName, &item)
+
+	if bucket.versioning == gofakes3.VersioningEnabled {
+		result.VersionID = item.versionID
+	}
+
+	return result, nil
+}
+
 func (db *Backend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, meta map[string]string) (result gofakes3.CopyObjectResult, err error) {
 
 	c, err := db.GetObject(ctx, srcBucket, srcKey, nil)
@@ -274,13 +357,16 @@ func (db *Backend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket,
 		}
 	}()
 
-	for k, v := range c.Metadata {
-		if _, found := meta[k]; !found && k != "X-Amz-Acl" {
-			meta[k] = v
-		}
+	bts, err := gofakes3.ReadAll(c.Contents, c.Size)
+	if err != nil {
+		return
 	}
 
-	_, err = db.PutObject(ctx, dstBucket, dstKey, meta, c.Contents, c.Size)
+	// The metadata is not merged with that of an existing destination object,
+	// as it is by PutObject: the caller has already decided which metadata to
+	// copy from the source, and a copy with the REPLACE directive must be able
+	// to remove it.
+	put, err := db.putObject(dstBucket, dstKey, meta, bts)
 	if err != nil {
 		return
 	}
@@ -288,6 +374,7 @@ func (db *Backend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket,
 	return gofakes3.CopyObjectResult{
 		ETag:         `"` + hex.EncodeToString(c.Hash) + `"`,
 		LastModified: gofakes3.NewContentTime(time.Now()),
+		VersionID:    put.VersionID,
 	}, nil
 }
 
@@ -316,10 +403,10 @@ func (db *Backend) DeleteMulti(ctx context.Context, bucketName string, objects .
 
 	for _, object := range objects {
 		dresult, err := bucket.rm(object, now)
-		_ = dresult // FIXME: what to do with rm result in multi delete?
 
 		if err != nil {
 			errres := gofakes3.ErrorResultFromError(err)
+			errres.Key = object
 			// if errres.Code == gofakes3.ErrInternal {
 			// 	// FIXME: log
 			// }
@@ -327,9 +414,12 @@ func (db *Backend) DeleteMulti(ctx context.Context, bucketName string, objects .
 			result.Error = append(result.Error, errres)
 
 		} else {
-			result.Deleted = append(result.Deleted, gofakes3.ObjectID{
-				Key: object,
-			})
+			deleted := gofakes3.ObjectID{Key: object}
+			if dresult.IsDeleteMarker {
+				deleted.DeleteMarker = true
+				deleted.DeleteMarkerVersionID = string(dresult.VersionID)
+			}
+			result.Deleted = append(result.Deleted, deleted)
 		}
 	}
 
@@ -389,6 +479,32 @@ func (db *Backend) GetObjectVersion(
 	return ver.toObject(rangeRequest, true)
 }
 
+func (db *Backend) CopyObjectVersion(srcBucket, srcKey string, srcVersion gofakes3.VersionID, dstBucket, dstKey string, meta map[string]string) (result gofakes3.CopyObjectResult, err error) {
+	c, err := db.GetObjectVersion(srcBucket, srcKey, srcVersion, nil)
+	if err != nil {
+		return result, err
+	}
+	defer gofakes3.CheckClose(c.Contents, &err)
+
+	bts, err := gofakes3.ReadAll(c.Contents, c.Size)
+	if err != nil {
+		return result, err
+	}
+
+	// As in CopyObject, the metadata is not merged with that of the
+	// destination:
+	put, err := db.putObject(dstBucket, dstKey, meta, bts)
+	if err != nil {
+		return result, err
+	}
+
+	return gofakes3.CopyObjectResult{
+		ETag:         `"` + hex.EncodeToString(c.Hash) + `"`,
+		LastModified: gofakes3.NewContentTime(db.timeSource.Now()),
+		VersionID:    put.VersionID,
+	}, nil
+}
+
 func (db *Backend) HeadObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID) (*gofakes3.Object, error) {
 	db.lock.RLock()
 	defer db.lock.RUnlock()
@@ -451,20 +567,16 @@ func (db *Backend) ListBucketVersions(
 		iter.Seek(page.KeyMarker)
 	}
 
-	var truncated = false
-	var first = true
-	var cnt int64 = 0
-
-	// FIXME: The S3 docs have this to say on the topic of result ordering:
-	//   "The following request returns objects in the order they were stored,
-	//   returning the most recently stored object first starting with the value
-	//   for key-marker."
-	//
-	// OK so this method....
-	// - Returns objects in the order they were stored
-	// - Returning the most recently stored object first
-	//
-	// This makes no sense at all!
+	// Keys are listed in ascending order, and the versions of each key from
+	// newest to oldest. The markers are exclusive: the page starts after
+	// the version-id-marker of the key-marker, or after the key-marker if
+	// there is no version-id-marker. Common prefixes count towards MaxKeys,
+	// as they do in S3.
+	var cnt int64
+	var lastPrefix string
+	full := func() bool {
+		return page.MaxKeys > 0 && cnt >= page.MaxKeys
+	}
 
 	for iter.Next() {
 		object := iter.Value().(*bucketObject)
@@ -474,63 +586,491 @@ func (db *Backend) ListBucketVersions(
 		}
 
 		if match.CommonPrefix {
+			// A prefix that sorts before the key-marker was returned by an
+			// earlier page:
+			if page.KeyMarker != "" && match.MatchedPart <= page.KeyMarker {
+				continue
+			}
+			if match.MatchedPart == lastPrefix {
+				continue
+			}
+			if full() {
+				result.IsTruncated = true
+				break
+			}
+			lastPrefix = match.MatchedPart
 			result.AddPrefix(match.MatchedPart)
+			result.NextKeyMarker, result.NextVersionIDMarker = match.MatchedPart, ""
+			cnt++
 			continue
 		}
 
-		versions := iter.Value().(*bucketObject).Iterator()
-		if first {
-			if page.VersionIDMarker != "" {
-				if !versions.Seek(page.VersionIDMarker) {
-					// FIXME: log
-					return result, gofakes3.ErrInternal
+		for _, version := range object.newestFirst() {
+			if object.name == page.KeyMarker {
+				// Version IDs increase as versions are added, so this still
+				// works if the marker version has since been deleted:
+				if page.VersionIDMarker == "" || version.versionID >= page.VersionIDMarker {
+					continue
 				}
 			}
-			first = false
-		}
+			if full() {
+				result.IsTruncated = true
+				goto done
+			}
 
-		for versions.Next() {
-			version := versions.Value()
+			var versionID gofakes3.VersionID
+			if bucket.versioning != gofakes3.VersioningNone { // S300005
+				versionID = version.versionID
+			}
 
 			if version.deleteMarker {
-				marker := &gofakes3.DeleteMarker{
+				result.Versions = append(result.Versions, &gofakes3.DeleteMarker{
 					Key:          version.name,
+					VersionID:    versionID,
 					IsLatest:     version == object.data,
 					LastModified: gofakes3.NewContentTime(version.lastModified),
-				}
-				if bucket.versioning != gofakes3.VersioningNone { // S300005
-					marker.VersionID = version.versionID
-				}
-				result.Versions = append(result.Versions, marker)
+				})
 
 			} else {
-				resultVer := &gofakes3.Version{
+				result.Versions = append(result.Versions, &gofakes3.Version{
 					Key:          version.name,
+					VersionID:    versionID,
 					IsLatest:     version == object.data,
 					LastModified: gofakes3.NewContentTime(version.lastModified),
 					Size:         int64(len(version.body)),
 					ETag:         version.etag,
-				}
-				if bucket.versioning != gofakes3.VersioningNone { // S300005
-					resultVer.VersionID = version.versionID
-				}
-				result.Versions = append(result.Versions, resultVer)
+				})
 			}
-
+			result.NextKeyMarker, result.NextVersionIDMarker = version.name, versionID
 			cnt++
-			if page.MaxKeys > 0 && cnt >= page.MaxKeys {
-				truncated = versions.Next()
-				goto done
-			}
 		}
 	}
 
 done:
-	result.IsTruncated = truncated || iter.Next()
+	if !result.IsTruncated {
+		result.NextKeyMarker, result.NextVersionIDMarker = "", ""
+	}
 
 	return result, nil
 }
 
+func (db *Backend) GetObjectACL(ctx context.Context, bucketName, objectName string) (*gofakes3.AccessControlPolicy, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+
+	obj := bucket.object(objectName)
+	if obj == nil || obj.data == nil || obj.data.deleteMarker {
+		return nil, gofakes3.KeyNotFound(objectName)
+	}
+
+	return obj.data.acl, nil
+}
+
+func (db *Backend) PutObjectACL(ctx context.Context, bucketName, objectName string, acl *gofakes3.AccessControlPolicy) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	obj := bucket.object(objectName)
+	if obj == nil || obj.data == nil || obj.data.deleteMarker {
+		return gofakes3.KeyNotFound(objectName)
+	}
+
+	obj.data.acl = acl
+	return nil
+}
+
+// BucketUsage returns the total size of every version of every object in the
+// bucket.
+func (db *Backend) BucketUsage(ctx context.Context, bucketName string) (int64, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return 0, gofakes3.BucketNotFound(bucketName)
+	}
+
+	return bucket.usage, nil
+}
+
+// TotalUsage returns the total size of every version of every object in
+// every bucket.
+func (db *Backend) TotalUsage(ctx context.Context) (int64, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var usage int64
+	for _, bucket := range db.buckets {
+		usage += bucket.usage
+	}
+	return usage, nil
+}
+
+func (db *Backend) GetBucketACL(ctx context.Context, bucketName string) (*gofakes3.AccessControlPolicy, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	return bucket.acl, nil
+}
+
+func (db *Backend) PutBucketACL(ctx context.Context, bucketName string, acl *gofakes3.AccessControlPolicy) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+	bucket.acl = acl
+	return nil
+}
+
+func (db *Backend) GetBucketPolicy(ctx context.Context, bucketName string) ([]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	if bucket.policy == nil {
+		return nil, gofakes3.ResourceError(gofakes3.ErrNoSuchBucketPolicy, bucketName)
+	}
+
+	return bucket.policy, nil
+}
+
+func (db *Backend) SetBucketPolicy(ctx context.Context, bucketName string, policy []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	bucket.policy = policy
+	return nil
+}
+
+func (db *Backend) DeleteBucketPolicy(ctx context.Context, bucketName string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	bucket.policy = nil
+	return nil
+}
+
+func (db *Backend) GetBucketCORS(ctx context.Context, bucketName string) (*gofakes3.CORSConfiguration, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	if bucket.cors == nil {
+		return nil, gofakes3.ResourceError(gofakes3.ErrNoSuchCORSConfiguration, bucketName)
+	}
+
+	return bucket.cors, nil
+}
+
+func (db *Backend) PutBucketCORS(ctx context.Context, bucketName string, config *gofakes3.CORSConfiguration) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	bucket.cors = config
+	return nil
+}
+
+func (db *Backend) DeleteBucketCORS(ctx context.Context, bucketName string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	bucket.cors = nil
+	return nil
+}
+
+func (db *Backend) GetBucketWebsite(ctx context.Context, bucketName string) (*gofakes3.WebsiteConfiguration, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	if bucket.website == nil {
+		return nil, gofakes3.ResourceError(gofakes3.ErrNoSuchWebsiteConfiguration, bucketName)
+	}
+
+	return bucket.website, nil
+}
+
+func (db *Backend) PutBucketWebsite(ctx context.Context, bucketName string, config *gofakes3.WebsiteConfiguration) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	bucket.website = config
+	return nil
+}
+
+func (db *Backend) DeleteBucketWebsite(ctx context.Context, bucketName string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	bucket.website = nil
+	return nil
+}
+
+func (db *Backend) GetBucketRequestPayment(ctx context.Context, bucketName string) (*gofakes3.RequestPaymentConfiguration, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	return bucket.payment, nil
+}
+
+func (db *Backend) PutBucketRequestPayment(ctx context.Context, bucketName string, config *gofakes3.RequestPaymentConfiguration) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+	bucket.payment = config
+	return nil
+}
+
+func (db *Backend) GetBucketAccelerate(ctx context.Context, bucketName string) (*gofakes3.AccelerateConfiguration, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	return bucket.accelerate, nil
+}
+
+func (db *Backend) PutBucketAccelerate(ctx context.Context, bucketName string, config *gofakes3.AccelerateConfiguration) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+	bucket.accelerate = config
+	return nil
+}
+
+func (db *Backend) GetBucketEncryption(ctx context.Context, bucketName string) (*gofakes3.ServerSideEncryptionConfiguration, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	if bucket.encryption == nil {
+		return nil, gofakes3.ResourceError(gofakes3.ErrServerSideEncryptionConfigurationNotFound, bucketName)
+	}
+
+	return bucket.encryption, nil
+}
+
+func (db *Backend) PutBucketEncryption(ctx context.Context, bucketName string, config *gofakes3.ServerSideEncryptionConfiguration) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	bucket.encryption = config
+	return nil
+}
+
+func (db *Backend) DeleteBucketEncryption(ctx context.Context, bucketName string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	bucket.encryption = nil
+	return nil
+}
+
+func (db *Backend) GetBucketNotification(ctx context.Context, bucketName string) (*gofakes3.NotificationConfiguration, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	if bucket.notification == nil {
+		return &gofakes3.NotificationConfiguration{}, nil
+	}
+
+	return bucket.notification, nil
+}
+
+func (db *Backend) PutBucketNotification(ctx context.Context, bucketName string, config *gofakes3.NotificationConfiguration) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	bucket.notification = config
+	return nil
+}
+
+func (db *Backend) GetObjectLockConfiguration(ctx context.Context, bucketName string) (*gofakes3.ObjectLockConfiguration, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	if bucket.objectLock == nil {
+		return nil, gofakes3.ResourceError(gofakes3.ErrObjectLockConfigurationNotFound, bucketName)
+	}
+
+	return bucket.objectLock, nil
+}
+
+func (db *Backend) PutObjectLockConfiguration(ctx context.Context, bucketName string, config *gofakes3.ObjectLockConfiguration) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	bucket.objectLock = config
+	return nil
+}
+
+func (db *Backend) GetObjectRetention(ctx context.Context, bucketName, objectName string, versionID gofakes3.VersionID) (*gofakes3.ObjectLockRetention, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+
+	ver, err := bucket.lockableVersion(objectName, versionID)
+	if err != nil {
+		return nil, err
+	}
+	return ver.retention, nil
+}
+
+func (db *Backend) PutObjectRetention(ctx context.Context, bucketName, objectName string, versionID gofakes3.VersionID, retention *gofakes3.ObjectLockRetention) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	ver, err := bucket.lockableVersion(objectName, versionID)
+	if err != nil {
+		return err
+	}
+	ver.retention = retention
+	return nil
+}
+
+func (db *Backend) GetObjectLegalHold(ctx context.Context, bucketName, objectName string, versionID gofakes3.VersionID) (*gofakes3.ObjectLockLegalHold, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+
+	ver, err := bucket.lockableVersion(objectName, versionID)
+	if err != nil {
+		return nil, err
+	}
+	return ver.legalHold, nil
+}
+
+func (db *Backend) PutObjectLegalHold(ctx context.Context, bucketName, objectName string, versionID gofakes3.VersionID, hold *gofakes3.ObjectLockLegalHold) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	ver, err := bucket.lockableVersion(objectName, versionID)
+	if err != nil {
+		return err
+	}
+	ver.legalHold = hold
+	return nil
+}
+
 // nextVersion assumes the backend's lock is acquired
 func (db *Backend) nextVersion() gofakes3.VersionID {
 	v, scr := db.versionGenerator.Next(db.versionScratch)
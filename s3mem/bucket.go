@@ -17,8 +17,21 @@ type bucket struct {
 	versioning   gofakes3.VersioningStatus
 	versionGen   versionGenFunc
 	creationDate gofakes3.ContentTime
+	acl          *gofakes3.AccessControlPolicy
+	policy       []byte
+	objectLock   *gofakes3.ObjectLockConfiguration
+	cors         *gofakes3.CORSConfiguration
+	website      *gofakes3.WebsiteConfiguration
+	notification *gofakes3.NotificationConfiguration
+	encryption   *gofakes3.ServerSideEncryptionConfiguration
+	payment      *gofakes3.RequestPaymentConfiguration
+	accelerate   *gofakes3.AccelerateConfiguration
 
 	objects *skiplist.SkipList
+
+	// usage is the total size of every version of every object in the
+	// bucket; it is kept up to date by put, rm and rmVersion.
+	usage int64
 }
 
 func newBucket(name string, at time.Time, versionGen versionGenFunc) *bucket {
@@ -48,6 +61,25 @@ func (b *bucketObject) Iterator() *bucketObjectIterator {
 	}
 }
 
+// newestFirst returns every version of the object, starting with the
+// current one.
+func (b *bucketObject) newestFirst() []*bucketData {
+	var versions []*bucketData
+	if b.data != nil {
+		versions = append(versions, b.data)
+	}
+	if b.versions != nil {
+		iter := b.versions.SeekToLast()
+		if iter != nil {
+			for ok := true; ok; ok = iter.Previous() {
+				versions = append(versions, iter.Value().(*bucketData))
+			}
+			iter.Close()
+		}
+	}
+	return versions
+}
+
 type bucketObjectIterator struct {
 	data *bucketData
 	iter skiplist.Iterator
@@ -117,6 +149,9 @@ type bucketData struct {
 	hash         []byte
 	etag         string
 	metadata     map[string]string
+	acl          *gofakes3.AccessControlPolicy
+	retention    *gofakes3.ObjectLockRetention
+	legalHold    *gofakes3.ObjectLockLegalHold
 }
 
 func (bi *bucketData) toObject(rangeRequest *gofakes3.ObjectRangeRequest, withBody bool) (obj *gofakes3.Object, err error) {
@@ -153,6 +188,7 @@ func (bi *bucketData) toObject(rangeRequest *gofakes3.ObjectRangeRequest, withBo
 		Range:          rnge,
 		IsDeleteMarker: bi.deleteMarker,
 		VersionID:      bi.versionID,
+		LastModified:   bi.lastModified,
 		Contents:       contents,
 	}, nil
 }
@@ -194,6 +230,20 @@ func (b *bucket) objectVersion(objectName string, versionID gofakes3.VersionID)
 	return versionIface.(*bucketData), nil
 }
 
+// lockableVersion returns the version of the object that retention and legal
+// holds apply to. An empty versionID refers to the current version.
+func (b *bucket) lockableVersion(objectName string, versionID gofakes3.VersionID) (*bucketData, error) {
+	if versionID != "" {
+		return b.objectVersion(objectName, versionID)
+	}
+
+	obj := b.object(objectName)
+	if obj == nil || obj.data == nil || obj.data.deleteMarker {
+		return nil, gofakes3.KeyNotFound(objectName)
+	}
+	return obj.data, nil
+}
+
 func (b *bucket) put(name string, item *bucketData) {
 	// Always generate a version for convenience; we can just mask it on return.
 	item.versionID = b.versionGen()
@@ -213,9 +263,12 @@ func (b *bucket) put(name string, item *bucketData) {
 			}
 			object.versions.Set(object.data.versionID, object.data)
 		}
+	} else if object.data != nil {
+		b.usage -= int64(len(object.data.body))
 	}
 
 	object.data = item
+	b.usage += int64(len(item.body))
 }
 
 func (b *bucket) rm(name string, at time.Time) (result gofakes3.ObjectDeleteResult, rerr error) {
@@ -232,6 +285,9 @@ func (b *bucket) rm(name string, at time.Time) (result gofakes3.ObjectDeleteResu
 		result.VersionID = item.versionID
 
 	} else {
+		if object.data != nil {
+			b.usage -= int64(len(object.data.body))
+		}
 		object.data = nil
 		if object.versions == nil || object.versions.Len() == 0 {
 			b.objects.Delete(name)
@@ -249,6 +305,7 @@ func (b *bucket) rmVersion(name string, versionID gofakes3.VersionID, at time.Ti
 	} else if object.data != nil && object.data.versionID == versionID {
 		result.VersionID = versionID
 		result.IsDeleteMarker = object.data.deleteMarker
+		b.usage -= int64(len(object.data.body))
 		object.data = nil
 
 	} else if object.versions != nil {
@@ -259,6 +316,7 @@ func (b *bucket) rmVersion(name string, versionID gofakes3.VersionID, at time.Ti
 		}
 
 		version := versionIface.(*bucketData)
+		b.usage -= int64(len(version.body))
 		result.VersionID = version.versionID
 		result.IsDeleteMarker = version.deleteMarker
 	}
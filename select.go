@@ -0,0 +1,552 @@
+package gofakes3
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	xml "github.com/oneclickvirt/gofakes3/xml"
+)
+
+// SelectObjectContentRequest is the request body for a POST to the
+// '?select&select-type=2' subresource of an object:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_SelectObjectContent.html
+//
+// See selectQuery for the subset of SQL that is supported. Parquet input and
+// ScanRange are not supported.
+type SelectObjectContentRequest struct {
+	XMLName             xml.Name                  `xml:"SelectObjectContentRequest"`
+	Expression          string                    `xml:"Expression"`
+	ExpressionType      string                    `xml:"ExpressionType"`
+	RequestProgress     *SelectRequestProgress    `xml:"RequestProgress,omitempty"`
+	InputSerialization  SelectInputSerialization  `xml:"InputSerialization"`
+	OutputSerialization SelectOutputSerialization `xml:"OutputSerialization"`
+}
+
+type SelectRequestProgress struct {
+	Enabled bool `xml:"Enabled"`
+}
+
+type SelectInputSerialization struct {
+	CompressionType string          `xml:"CompressionType,omitempty"`
+	CSV             *SelectCSVInput `xml:"CSV,omitempty"`
+	JSON            *SelectJSON     `xml:"JSON,omitempty"`
+	Parquet         *struct{}       `xml:"Parquet,omitempty"`
+}
+
+type SelectCSVInput struct {
+	FileHeaderInfo  string `xml:"FileHeaderInfo,omitempty"`
+	Comments        string `xml:"Comments,omitempty"`
+	FieldDelimiter  string `xml:"FieldDelimiter,omitempty"`
+	QuoteCharacter  string `xml:"QuoteCharacter,omitempty"`
+	RecordDelimiter string `xml:"RecordDelimiter,omitempty"`
+}
+
+type SelectOutputSerialization struct {
+	CSV  *SelectCSVOutput `xml:"CSV,omitempty"`
+	JSON *SelectJSON      `xml:"JSON,omitempty"`
+}
+
+type SelectCSVOutput struct {
+	QuoteFields     string `xml:"QuoteFields,omitempty"`
+	FieldDelimiter  string `xml:"FieldDelimiter,omitempty"`
+	QuoteCharacter  string `xml:"QuoteCharacter,omitempty"`
+	RecordDelimiter string `xml:"RecordDelimiter,omitempty"`
+}
+
+// SelectJSON is used for both the JSON InputSerialization, which uses Type,
+// and the JSON OutputSerialization, which uses RecordDelimiter.
+type SelectJSON struct {
+	Type            string `xml:"Type,omitempty"`
+	RecordDelimiter string `xml:"RecordDelimiter,omitempty"`
+}
+
+// SelectStats is the payload of the 'Stats' and 'Progress' events.
+type SelectStats struct {
+	BytesScanned   int64 `xml:"BytesScanned"`
+	BytesProcessed int64 `xml:"BytesProcessed"`
+	BytesReturned  int64 `xml:"BytesReturned"`
+}
+
+// selectRecordsChunkSize is the amount of output that is buffered before it
+// is sent to the client in a 'Records' event.
+const selectRecordsChunkSize = 64 * 1024
+
+func (in *SelectObjectContentRequest) validate() error {
+	if in.ExpressionType != "SQL" {
+		return ErrInvalidExpressionType
+	}
+
+	switch strings.ToUpper(in.InputSerialization.CompressionType) {
+	case "", "NONE", "GZIP", "BZIP2":
+	default:
+		return ErrorInvalidArgument("CompressionType", in.InputSerialization.CompressionType, "Invalid compression type.")
+	}
+
+	inputs := 0
+	if csv := in.InputSerialization.CSV; csv != nil {
+		inputs++
+		switch strings.ToUpper(csv.FileHeaderInfo) {
+		case "", "NONE", "USE", "IGNORE":
+		default:
+			return ErrorInvalidArgument("FileHeaderInfo", csv.FileHeaderInfo, "Invalid FileHeaderInfo.")
+		}
+		switch csv.RecordDelimiter {
+		case "", "\n", "\r\n":
+		default:
+			return ErrorMessage(ErrNotImplemented, "Only newline record delimiters are supported for CSV input.")
+		}
+		if csv.QuoteCharacter != "" && csv.QuoteCharacter != `"` {
+			return ErrorMessage(ErrNotImplemented, "Only '\"' is supported as the quote character for CSV input.")
+		}
+		if utf8.RuneCountInString(csv.FieldDelimiter) > 1 {
+			return ErrorInvalidArgument("FieldDelimiter", csv.FieldDelimiter, "The field delimiter must be a single character.")
+		}
+		if utf8.RuneCountInString(csv.Comments) > 1 {
+			return ErrorInvalidArgument("Comments", csv.Comments, "The comment character must be a single character.")
+		}
+	}
+	if json := in.InputSerialization.JSON; json != nil {
+		inputs++
+		switch strings.ToUpper(json.Type) {
+		case "DOCUMENT", "LINES":
+		default:
+			return ErrorInvalidArgument("Type", json.Type, "Invalid JSON type.")
+		}
+	}
+	if in.InputSerialization.Parquet != nil {
+		return ErrorMessage(ErrNotImplemented, "Parquet input is not supported.")
+	}
+	if inputs != 1 {
+		return ErrMalformedXML
+	}
+
+	if (in.OutputSerialization.CSV == nil) == (in.OutputSerialization.JSON == nil) {
+		return ErrMalformedXML
+	}
+	if csv := in.OutputSerialization.CSV; csv != nil {
+		switch strings.ToUpper(csv.QuoteFields) {
+		case "", "ASNEEDED", "ALWAYS":
+		default:
+			return ErrorInvalidArgument("QuoteFields", csv.QuoteFields, "Invalid QuoteFields.")
+		}
+	}
+	return nil
+}
+
+func (g *GoFakeS3) selectObjectContent(bucket, object string, w http.ResponseWriter, r *http.Request) (err error) {
+	g.log.Print(LogInfo, "SELECT OBJECT CONTENT", bucket, object)
+
+	if err := g.ensureBucketExists(r, bucket); err != nil {
+		return err
+	}
+
+	var in SelectObjectContentRequest
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := in.validate(); err != nil {
+		return err
+	}
+	query, err := parseSelectQuery(in.Expression)
+	if err != nil {
+		return err
+	}
+
+	obj, err := g.storage.GetObject(r.Context(), bucket, object, nil)
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		g.log.Print(LogErr, "unexpected nil object for key", bucket, object)
+		return ErrInternal
+	}
+	defer CheckClose(obj.Contents, &err)
+
+	scanned := &countingReader{r: obj.Contents}
+	var contents io.Reader = scanned
+	switch strings.ToUpper(in.InputSerialization.CompressionType) {
+	case "GZIP":
+		gz, err := gzip.NewReader(contents)
+		if err != nil {
+			return ErrorMessage(ErrInvalidArgument, "The object is not GZIP-compressed.")
+		}
+		defer gz.Close()
+		contents = gz
+	case "BZIP2":
+		contents = bzip2.NewReader(contents)
+	}
+	processed := &countingReader{r: contents}
+
+	var next func() (selectRecord, error)
+	if in.InputSerialization.CSV != nil {
+		next = csvRecordReader(processed, in.InputSerialization.CSV)
+	} else {
+		next = jsonRecordReader(processed)
+	}
+
+	var format func(buf *bytes.Buffer, row []selectField)
+	if in.OutputSerialization.CSV != nil {
+		format = csvRecordFormatter(in.OutputSerialization.CSV)
+	} else {
+		format = jsonRecordFormatter(in.OutputSerialization.JSON)
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+
+	events := newEventStreamWriter(w)
+	var records bytes.Buffer
+	var returned int64
+
+	flush := func() error {
+		if records.Len() == 0 {
+			return nil
+		}
+		returned += int64(records.Len())
+		err := events.writeEvent("Records", "application/octet-stream", records.Bytes())
+		records.Reset()
+		return err
+	}
+
+	err = query.run(next, func(row []selectField) error {
+		format(&records, row)
+		if records.Len() >= selectRecordsChunkSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// The response has already started, so the error has to be sent as
+		// part of the event stream:
+		code, message := ErrInternal, ErrInternal.Message()
+		if serr, ok := err.(Error); ok {
+			code = serr.ErrorCode()
+			message = code.Message()
+			if resp, ok := err.(*ErrorResponse); ok && resp.Message != "" {
+				message = resp.Message
+			}
+		}
+		g.log.Print(LogErr, "select failed", bucket, object, err)
+		return events.writeError(code, message)
+	}
+
+	stats := SelectStats{
+		BytesScanned:   scanned.n,
+		BytesProcessed: processed.n,
+		BytesReturned:  returned,
+	}
+	if in.RequestProgress != nil && in.RequestProgress.Enabled {
+		if err := g.writeSelectStats(events, "Progress", stats); err != nil {
+			return err
+		}
+	}
+	if err := g.writeSelectStats(events, "Stats", stats); err != nil {
+		return err
+	}
+	return events.writeEvent("End", "", nil)
+}
+
+func (g *GoFakeS3) writeSelectStats(events *eventStreamWriter, eventType string, stats SelectStats) error {
+	payload, err := xml.Marshal(struct {
+		XMLName xml.Name
+		SelectStats
+	}{xml.Name{Local: eventType}, stats})
+	if err != nil {
+		return err
+	}
+	return events.writeEvent(eventType, "text/xml", payload)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// csvRecord is a record read from a CSV object. header is nil unless the
+// FileHeaderInfo was 'USE'.
+type csvRecord struct {
+	header []string
+	values []string
+}
+
+func (rec *csvRecord) lookup(path []string) interface{} {
+	if len(path) != 1 {
+		return nil
+	}
+	if idx, ok := selectPosition(path[0]); ok {
+		if idx < len(rec.values) {
+			return rec.values[idx]
+		}
+		return nil
+	}
+	for i, name := range rec.header {
+		if strings.EqualFold(name, path[0]) && i < len(rec.values) {
+			return rec.values[i]
+		}
+	}
+	return nil
+}
+
+func (rec *csvRecord) fields() []selectField {
+	out := make([]selectField, len(rec.values))
+	for i, v := range rec.values {
+		name := fmt.Sprintf("_%d", i+1)
+		if i < len(rec.header) {
+			name = rec.header[i]
+		}
+		out[i] = selectField{name: name, value: v}
+	}
+	return out
+}
+
+// selectPosition returns the index of a positional column name, like '_1'.
+func selectPosition(name string) (int, bool) {
+	if !strings.HasPrefix(name, "_") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(name[1:])
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n - 1, true
+}
+
+func csvRecordReader(rdr io.Reader, in *SelectCSVInput) func() (selectRecord, error) {
+	cr := csv.NewReader(rdr)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	if in.FieldDelimiter != "" {
+		cr.Comma, _ = utf8.DecodeRuneInString(in.FieldDelimiter)
+	}
+	if in.Comments != "" {
+		cr.Comment, _ = utf8.DecodeRuneInString(in.Comments)
+	}
+
+	headerInfo := strings.ToUpper(in.FileHeaderInfo)
+	first := true
+	var header []string
+
+	return func() (selectRecord, error) {
+		for {
+			values, err := cr.Read()
+			if err == io.EOF {
+				return nil, nil
+			} else if err != nil {
+				return nil, ErrorMessagef(ErrCSVParsingError, "Encountered an error parsing the CSV file: %v", err)
+			}
+
+			if first {
+				first = false
+				if headerInfo == "USE" {
+					header = values
+					continue
+				} else if headerInfo == "IGNORE" {
+					continue
+				}
+			}
+			return &csvRecord{header: header, values: values}, nil
+		}
+	}
+}
+
+// jsonObject is a decoded JSON object that keeps the order of its fields,
+// so that 'SELECT *' returns them in the order they were stored.
+type jsonObject []selectField
+
+func (obj jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range obj {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(f.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonRecord is a record read from a JSON object.
+type jsonRecord struct {
+	value interface{}
+}
+
+func (rec *jsonRecord) lookup(path []string) interface{} {
+	cur := rec.value
+	for _, part := range path {
+		obj, ok := cur.(jsonObject)
+		if !ok {
+			return nil
+		}
+		cur = nil
+		for _, f := range obj {
+			if f.name == part {
+				cur = f.value
+				break
+			}
+		}
+		if cur == nil {
+			for _, f := range obj {
+				if strings.EqualFold(f.name, part) {
+					cur = f.value
+					break
+				}
+			}
+		}
+	}
+	return cur
+}
+
+func (rec *jsonRecord) fields() []selectField {
+	if obj, ok := rec.value.(jsonObject); ok {
+		return obj
+	}
+	return []selectField{{name: "_1", value: rec.value}}
+}
+
+// jsonRecordReader reads each top-level JSON value in rdr as a record. This
+// handles both the 'LINES' and 'DOCUMENT' types.
+func jsonRecordReader(rdr io.Reader) func() (selectRecord, error) {
+	dec := json.NewDecoder(rdr)
+	dec.UseNumber()
+
+	return func() (selectRecord, error) {
+		value, err := decodeJSONValue(dec)
+		if err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, ErrorMessagef(ErrJSONParsingError, "Encountered an error parsing the JSON file: %v", err)
+		}
+		return &jsonRecord{value: value}, nil
+	}
+}
+
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		obj := jsonObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, unexpectedJSONEOF(err)
+			}
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, unexpectedJSONEOF(err)
+			}
+			obj = append(obj, selectField{name: key.(string), value: value})
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, unexpectedJSONEOF(err)
+		}
+		return obj, nil
+
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, unexpectedJSONEOF(err)
+			}
+			arr = append(arr, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, unexpectedJSONEOF(err)
+		}
+		return arr, nil
+
+	case json.Delim('}'), json.Delim(']'):
+		return nil, fmt.Errorf("unexpected %v", tok)
+
+	default:
+		return tok, nil
+	}
+}
+
+// unexpectedJSONEOF converts an io.EOF inside a value into an error, so it
+// is not mistaken for the end of the input.
+func unexpectedJSONEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func csvRecordFormatter(out *SelectCSVOutput) func(buf *bytes.Buffer, row []selectField) {
+	fieldDelimiter, recordDelimiter, quote := ",", "\n", `"`
+	if out.FieldDelimiter != "" {
+		fieldDelimiter = out.FieldDelimiter
+	}
+	if out.RecordDelimiter != "" {
+		recordDelimiter = out.RecordDelimiter
+	}
+	if out.QuoteCharacter != "" {
+		quote = out.QuoteCharacter
+	}
+	always := strings.EqualFold(out.QuoteFields, "ALWAYS")
+
+	return func(buf *bytes.Buffer, row []selectField) {
+		for i, f := range row {
+			if i > 0 {
+				buf.WriteString(fieldDelimiter)
+			}
+			v := selectValueString(f.value)
+			if always || strings.Contains(v, fieldDelimiter) || strings.Contains(v, quote) ||
+				strings.Contains(v, recordDelimiter) || strings.ContainsAny(v, "\r\n") {
+				buf.WriteString(quote)
+				buf.WriteString(strings.ReplaceAll(v, quote, quote+quote))
+				buf.WriteString(quote)
+			} else {
+				buf.WriteString(v)
+			}
+		}
+		buf.WriteString(recordDelimiter)
+	}
+}
+
+func jsonRecordFormatter(out *SelectJSON) func(buf *bytes.Buffer, row []selectField) {
+	recordDelimiter := "\n"
+	if out.RecordDelimiter != "" {
+		recordDelimiter = out.RecordDelimiter
+	}
+
+	return func(buf *bytes.Buffer, row []selectField) {
+		// Every value was decoded from JSON or CSV, so this can't fail:
+		b, _ := json.Marshal(jsonObject(row))
+		buf.Write(b)
+		buf.WriteString(recordDelimiter)
+	}
+}
@@ -0,0 +1,165 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+const selectTestCSV = "name,city,age\n" +
+	"alice,London,31\n" +
+	"bob,\"Paris, France\",45\n" +
+	"carol,London,27\n"
+
+const selectTestJSON = `{"name":"alice","address":{"city":"London"},"age":31}
+{"name":"bob","address":{"city":"Paris"},"age":45}
+{"name":"carol","address":{"city":"London"},"age":27}
+`
+
+func csvInput(headerInfo string) *s3.InputSerialization {
+	return &s3.InputSerialization{CSV: &s3.CSVInput{FileHeaderInfo: aws.String(headerInfo)}}
+}
+
+var (
+	jsonLinesInput = &s3.InputSerialization{JSON: &s3.JSONInput{Type: aws.String(s3.JSONTypeLines)}}
+	csvOutput      = &s3.OutputSerialization{CSV: &s3.CSVOutput{}}
+	jsonOutput     = &s3.OutputSerialization{JSON: &s3.JSONOutput{}}
+)
+
+// selectContent runs a SelectObjectContent request, and returns the
+// concatenated records and the stats.
+func (ts *testServer) selectContent(key, expr string, in *s3.InputSerialization, out *s3.OutputSerialization) (string, *s3.Stats, error) {
+	ts.Helper()
+	svc := ts.s3Client()
+	rs, err := svc.SelectObjectContent(&s3.SelectObjectContentInput{
+		Bucket:              aws.String(defaultBucket),
+		Key:                 aws.String(key),
+		Expression:          aws.String(expr),
+		ExpressionType:      aws.String(s3.ExpressionTypeSql),
+		InputSerialization:  in,
+		OutputSerialization: out,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	defer rs.EventStream.Close()
+
+	var records strings.Builder
+	var stats *s3.Stats
+	var ended bool
+	for event := range rs.EventStream.Events() {
+		switch e := event.(type) {
+		case *s3.RecordsEvent:
+			records.Write(e.Payload)
+		case *s3.StatsEvent:
+			stats = e.Details
+		case *s3.EndEvent:
+			ended = true
+		}
+	}
+	if err := rs.EventStream.Err(); err != nil {
+		return "", nil, err
+	}
+	if !ended {
+		ts.Fatal("missing End event")
+	}
+	return records.String(), stats, nil
+}
+
+func TestSelectObjectContent(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	ts.backendPutString(defaultBucket, "people.csv", nil, selectTestCSV)
+	ts.backendPutString(defaultBucket, "people.json", nil, selectTestJSON)
+
+	for idx, tc := range []struct {
+		key      string
+		expr     string
+		in       *s3.InputSerialization
+		out      *s3.OutputSerialization
+		expected string
+	}{
+		{"people.csv", "SELECT * FROM S3Object", csvInput("NONE"), csvOutput, selectTestCSV},
+		{"people.csv", "SELECT * FROM S3Object", csvInput("IGNORE"), csvOutput,
+			"alice,London,31\nbob,\"Paris, France\",45\ncarol,London,27\n"},
+		{"people.csv", "SELECT s.name FROM S3Object s WHERE s.city = 'London'", csvInput("USE"), csvOutput,
+			"alice\ncarol\n"},
+		{"people.csv", "SELECT _1, _3 FROM S3Object WHERE _3 > 30 AND NOT _1 = 'name'", csvInput("NONE"), csvOutput,
+			"alice,31\nbob,45\n"},
+		{"people.csv", "SELECT name FROM S3Object WHERE age < 40 OR city LIKE 'Par%'", csvInput("USE"), csvOutput,
+			"alice\nbob\ncarol\n"},
+		{"people.csv", "SELECT name, age FROM S3Object LIMIT 1", csvInput("USE"), jsonOutput,
+			"{\"name\":\"alice\",\"age\":\"31\"}\n"},
+		{"people.csv", "SELECT COUNT(*) FROM S3Object s WHERE s.city <> 'London'", csvInput("USE"), csvOutput,
+			"1\n"},
+		{"people.json", "SELECT * FROM S3Object s WHERE s.address.city = 'Paris'", jsonLinesInput, jsonOutput,
+			"{\"name\":\"bob\",\"address\":{\"city\":\"Paris\"},\"age\":45}\n"},
+		{"people.json", "SELECT s.name, s.address.city AS town FROM S3Object[*] s WHERE s.age >= 31", jsonLinesInput, jsonOutput,
+			"{\"name\":\"alice\",\"town\":\"London\"}\n{\"name\":\"bob\",\"town\":\"Paris\"}\n"},
+		{"people.json", "SELECT s.name FROM S3Object s WHERE s.missing IS NULL AND s.age != 45", jsonLinesInput, csvOutput,
+			"alice\ncarol\n"},
+	} {
+		records, stats, err := ts.selectContent(tc.key, tc.expr, tc.in, tc.out)
+		ts.OK(err)
+		if records != tc.expected {
+			t.Fatalf("%d: %s\nexp: %q\ngot: %q", idx, tc.expr, tc.expected, records)
+		}
+		if stats == nil || aws.Int64Value(stats.BytesReturned) != int64(len(records)) {
+			t.Fatalf("%d: unexpected stats %v", idx, stats)
+		}
+	}
+}
+
+func TestSelectObjectContentGzip(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(selectTestCSV))
+	gz.Close()
+	ts.backendPutBytes(defaultBucket, "people.csv.gz", nil, buf.Bytes())
+
+	in := csvInput("USE")
+	in.CompressionType = aws.String(s3.CompressionTypeGzip)
+	records, stats, err := ts.selectContent("people.csv.gz", "SELECT name FROM S3Object WHERE age = 45", in, csvOutput)
+	ts.OK(err)
+	if records != "bob\n" {
+		t.Fatal("unexpected records", records)
+	}
+	if aws.Int64Value(stats.BytesScanned) != int64(buf.Len()) || aws.Int64Value(stats.BytesProcessed) != int64(len(selectTestCSV)) {
+		t.Fatal("unexpected stats", stats)
+	}
+}
+
+func TestSelectObjectContentErrors(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	ts.backendPutString(defaultBucket, "people.csv", nil, selectTestCSV)
+	ts.backendPutString(defaultBucket, "bad.json", nil, `{"name": "alice"} {"name": `)
+
+	for _, tc := range []struct {
+		key  string
+		expr string
+		in   *s3.InputSerialization
+		code gofakes3.ErrorCode
+	}{
+		{"people.csv", "SELECT FROM S3Object", csvInput("USE"), gofakes3.ErrParseSelectFailure},
+		{"people.csv", "SELECT * FROM Elsewhere", csvInput("USE"), gofakes3.ErrParseSelectFailure},
+		{"people.csv", "SELECT * FROM S3Object WHERE name ~ 'x'", csvInput("USE"), gofakes3.ErrParseSelectFailure},
+		{"missing.csv", "SELECT * FROM S3Object", csvInput("USE"), gofakes3.ErrNoSuchKey},
+		{"bad.json", "SELECT * FROM S3Object", jsonLinesInput, gofakes3.ErrJSONParsingError},
+	} {
+		_, _, err := ts.selectContent(tc.key, tc.expr, tc.in, csvOutput)
+		if !hasErrorCode(err, tc.code) {
+			t.Fatal("expected", tc.code, "found", err)
+		}
+	}
+}
@@ -0,0 +1,650 @@
+package gofakes3
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// selectQuery is a parsed SelectObjectContent expression. Only a small subset
+// of the S3 Select SQL dialect is supported:
+//
+//	SELECT * | COUNT(*) | <column> [AS <name>], ...
+//	FROM S3Object [[AS] <alias>]
+//	[WHERE <condition>]
+//	[LIMIT <n>]
+//
+// Columns are referred to by name, by position ('_1' is the first column of a
+// CSV record), or by a path into a JSON record ('s.a.b'). Conditions compare
+// a column to a literal or another column using =, !=, <>, <, <=, > and >=,
+// test for NULL with IS [NOT] NULL, match patterns with [NOT] LIKE, and may
+// be combined using AND, OR, NOT and parentheses. Values that look like
+// numbers are compared as numbers, and everything else as strings.
+type selectQuery struct {
+	star       bool
+	count      bool
+	projection []selectColumn
+	where      selectExpr
+	limit      int64 // -1 if there is no limit
+}
+
+type selectColumn struct {
+	path []string
+	name string
+}
+
+// selectField is a single named value in a record produced by a query.
+type selectField struct {
+	name  string
+	value interface{}
+}
+
+// selectRecord is a single record read from the object. Values are strings
+// for CSV records, or decoded JSON values for JSON records.
+type selectRecord interface {
+	// lookup returns the value at path, or nil if there is none.
+	lookup(path []string) interface{}
+
+	// fields returns all the top-level fields of the record, in order.
+	fields() []selectField
+}
+
+func selectParseError(format string, args ...interface{}) error {
+	return ErrorMessagef(ErrParseSelectFailure, format, args...)
+}
+
+// parseSelectQuery parses the SQL expression of a SelectObjectContent
+// request.
+func parseSelectQuery(expr string) (*selectQuery, error) {
+	tokens, err := tokenizeSelect(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &selectParser{tokens: tokens}
+	return p.parseQuery()
+}
+
+type selectTokenKind int
+
+const (
+	selectTokenEOF selectTokenKind = iota
+	selectTokenIdent
+	selectTokenQuotedIdent
+	selectTokenString
+	selectTokenNumber
+	selectTokenSymbol
+)
+
+type selectToken struct {
+	kind  selectTokenKind
+	value string
+}
+
+// keyword reports whether the token is the unquoted keyword kw.
+func (t selectToken) keyword(kw string) bool {
+	return t.kind == selectTokenIdent && strings.EqualFold(t.value, kw)
+}
+
+func (t selectToken) symbol(sym string) bool {
+	return t.kind == selectTokenSymbol && t.value == sym
+}
+
+func (t selectToken) String() string {
+	if t.kind == selectTokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.value)
+}
+
+func tokenizeSelect(expr string) (tokens []selectToken, err error) {
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '\'' || c == '"':
+			// Strings are quoted with ', identifiers with ". The quote is
+			// escaped by doubling it.
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(runes); j++ {
+				if runes[j] == c {
+					if j+1 < len(runes) && runes[j+1] == c {
+						sb.WriteRune(c)
+						j++
+						continue
+					}
+					break
+				}
+				sb.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, selectParseError("Unterminated quote at position %d", i+1)
+			}
+			kind := selectTokenString
+			if c == '"' {
+				kind = selectTokenQuotedIdent
+			}
+			tokens = append(tokens, selectToken{kind, sb.String()})
+			i = j + 1
+
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, selectToken{selectTokenNumber, string(runes[i:j])})
+			i = j
+
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, selectToken{selectTokenIdent, string(runes[i:j])})
+			i = j
+
+		default:
+			sym := string(c)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "!=", "<>", "<=", ">=":
+					sym = two
+				}
+			}
+			switch sym {
+			case "*", ",", "(", ")", ".", "=", "!=", "<>", "<", "<=", ">", ">=", "[", "]":
+			default:
+				return nil, selectParseError("Unexpected character %q at position %d", c, i+1)
+			}
+			tokens = append(tokens, selectToken{selectTokenSymbol, sym})
+			i += len([]rune(sym))
+		}
+	}
+	return append(tokens, selectToken{kind: selectTokenEOF}), nil
+}
+
+type selectParser struct {
+	tokens []selectToken
+	pos    int
+	alias  string
+}
+
+func (p *selectParser) peek() selectToken { return p.tokens[p.pos] }
+
+func (p *selectParser) next() selectToken {
+	t := p.tokens[p.pos]
+	if t.kind != selectTokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *selectParser) expectKeyword(kw string) error {
+	if t := p.next(); !t.keyword(kw) {
+		return selectParseError("Expected %s, found %s", kw, t)
+	}
+	return nil
+}
+
+func (p *selectParser) expectSymbol(sym string) error {
+	if t := p.next(); !t.symbol(sym) {
+		return selectParseError("Expected %q, found %s", sym, t)
+	}
+	return nil
+}
+
+func (p *selectParser) parseQuery() (*selectQuery, error) {
+	q := &selectQuery{limit: -1}
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+
+	// The projection refers to the alias defined after it, so it is parsed
+	// once the FROM clause has been:
+	projectionStart := p.pos
+	for t := p.peek(); !t.keyword("FROM"); t = p.peek() {
+		if t.kind == selectTokenEOF {
+			return nil, selectParseError("Expected FROM, found %s", t)
+		}
+		p.next()
+	}
+	projectionEnd := p.pos
+
+	p.next()
+	if t := p.next(); !t.keyword("S3Object") {
+		return nil, selectParseError("Expected S3Object, found %s", t)
+	}
+	if p.peek().symbol("[") {
+		// 'S3Object[*]' reads each JSON record, which is what happens anyway:
+		for _, sym := range []string{"[", "*", "]"} {
+			if err := p.expectSymbol(sym); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if p.peek().keyword("AS") {
+		p.next()
+	}
+	if t := p.peek(); t.kind == selectTokenIdent && !t.keyword("WHERE") && !t.keyword("LIMIT") {
+		p.alias = p.next().value
+	}
+
+	if p.peek().keyword("WHERE") {
+		p.next()
+		where, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		q.where = where
+	}
+
+	if p.peek().keyword("LIMIT") {
+		p.next()
+		t := p.next()
+		limit, err := strconv.ParseInt(t.value, 10, 64)
+		if t.kind != selectTokenNumber || err != nil || limit < 0 {
+			return nil, selectParseError("Invalid LIMIT %s", t)
+		}
+		q.limit = limit
+	}
+
+	if t := p.peek(); t.kind != selectTokenEOF {
+		return nil, selectParseError("Unexpected %s", t)
+	}
+
+	end := p.pos
+	p.pos = projectionStart
+	if err := p.parseProjection(q, projectionEnd); err != nil {
+		return nil, err
+	}
+	p.pos = end
+
+	return q, nil
+}
+
+func (p *selectParser) parseProjection(q *selectQuery, end int) error {
+	switch t := p.peek(); {
+	case t.symbol("*"):
+		p.next()
+		q.star = true
+
+	case t.keyword("COUNT"):
+		p.next()
+		for _, sym := range []string{"(", "*", ")"} {
+			if err := p.expectSymbol(sym); err != nil {
+				return err
+			}
+		}
+		q.count = true
+
+	default:
+		for {
+			path, err := p.parseColumn()
+			if err != nil {
+				return err
+			}
+			col := selectColumn{path: path, name: path[len(path)-1]}
+			if p.peek().keyword("AS") {
+				p.next()
+				t := p.next()
+				if t.kind != selectTokenIdent && t.kind != selectTokenQuotedIdent {
+					return selectParseError("Expected a column name after AS, found %s", t)
+				}
+				col.name = t.value
+			}
+			q.projection = append(q.projection, col)
+
+			if !p.peek().symbol(",") {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if p.pos != end {
+		return selectParseError("Unexpected %s in the SELECT clause", p.peek())
+	}
+	return nil
+}
+
+// parseColumn parses a reference to a column, without the table alias if
+// one was used.
+func (p *selectParser) parseColumn() (path []string, err error) {
+	for {
+		t := p.next()
+		if t.kind != selectTokenIdent && t.kind != selectTokenQuotedIdent {
+			return nil, selectParseError("Expected a column name, found %s", t)
+		}
+		path = append(path, t.value)
+		if !p.peek().symbol(".") {
+			break
+		}
+		p.next()
+	}
+
+	if len(path) > 1 && (strings.EqualFold(path[0], p.alias) || strings.EqualFold(path[0], "S3Object")) {
+		path = path[1:]
+	}
+	return path, nil
+}
+
+func (p *selectParser) parseOr() (selectExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &selectLogical{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *selectParser) parseAnd() (selectExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &selectLogical{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *selectParser) parseNot() (selectExpr, error) {
+	if p.peek().keyword("NOT") {
+		p.next()
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &selectNot{expr}, nil
+	}
+	return p.parseCondition()
+}
+
+func (p *selectParser) parseCondition() (selectExpr, error) {
+	if p.peek().symbol("(") {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expectSymbol(")")
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := p.next(); {
+	case t.keyword("IS"):
+		negate := false
+		if p.peek().keyword("NOT") {
+			p.next()
+			negate = true
+		}
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &selectIsNull{operand: left, negate: negate}, nil
+
+	case t.keyword("LIKE"), t.keyword("NOT"):
+		negate := t.keyword("NOT")
+		if negate {
+			if err := p.expectKeyword("LIKE"); err != nil {
+				return nil, err
+			}
+		}
+		pattern := p.next()
+		if pattern.kind != selectTokenString {
+			return nil, selectParseError("Expected a string after LIKE, found %s", pattern)
+		}
+		return &selectLike{operand: left, pattern: likePattern(pattern.value), negate: negate}, nil
+
+	case t.kind == selectTokenSymbol:
+		switch t.value {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return &selectComparison{op: t.value, left: left, right: right}, nil
+		}
+		return nil, selectParseError("Expected an operator, found %s", t)
+
+	default:
+		return nil, selectParseError("Expected an operator, found %s", t)
+	}
+}
+
+func (p *selectParser) parseOperand() (selectOperand, error) {
+	switch t := p.peek(); t.kind {
+	case selectTokenString:
+		p.next()
+		return selectOperand{literal: t.value}, nil
+	case selectTokenNumber:
+		p.next()
+		return selectOperand{literal: json.Number(t.value)}, nil
+	case selectTokenIdent:
+		if t.keyword("NULL") {
+			p.next()
+			return selectOperand{isNull: true}, nil
+		}
+	}
+
+	path, err := p.parseColumn()
+	if err != nil {
+		return selectOperand{}, err
+	}
+	return selectOperand{path: path}, nil
+}
+
+// likePattern converts a LIKE pattern, where '%' matches any sequence of
+// characters and '_' matches any one character, to a regular expression.
+func likePattern(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	for _, c := range pattern {
+		switch c {
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+type selectExpr interface {
+	eval(rec selectRecord) bool
+}
+
+type selectOperand struct {
+	path    []string
+	literal interface{}
+	isNull  bool
+}
+
+func (o selectOperand) value(rec selectRecord) interface{} {
+	if o.path != nil {
+		return rec.lookup(o.path)
+	}
+	if o.isNull {
+		return nil
+	}
+	return o.literal
+}
+
+type selectLogical struct {
+	or          bool
+	left, right selectExpr
+}
+
+func (e *selectLogical) eval(rec selectRecord) bool {
+	if e.or {
+		return e.left.eval(rec) || e.right.eval(rec)
+	}
+	return e.left.eval(rec) && e.right.eval(rec)
+}
+
+type selectNot struct{ expr selectExpr }
+
+func (e *selectNot) eval(rec selectRecord) bool { return !e.expr.eval(rec) }
+
+type selectIsNull struct {
+	operand selectOperand
+	negate  bool
+}
+
+func (e *selectIsNull) eval(rec selectRecord) bool {
+	return (e.operand.value(rec) == nil) != e.negate
+}
+
+type selectLike struct {
+	operand selectOperand
+	pattern *regexp.Regexp
+	negate  bool
+}
+
+func (e *selectLike) eval(rec selectRecord) bool {
+	v := e.operand.value(rec)
+	if v == nil {
+		return false
+	}
+	return e.pattern.MatchString(selectValueString(v)) != e.negate
+}
+
+type selectComparison struct {
+	op          string
+	left, right selectOperand
+}
+
+func (e *selectComparison) eval(rec selectRecord) bool {
+	l, r := e.left.value(rec), e.right.value(rec)
+	if l == nil || r == nil {
+		return false // Comparisons with NULL are never true.
+	}
+
+	var cmp int
+	ln, lok := selectValueNumber(l)
+	rn, rok := selectValueNumber(r)
+	if lok && rok {
+		switch {
+		case ln < rn:
+			cmp = -1
+		case ln > rn:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(selectValueString(l), selectValueString(r))
+	}
+
+	switch e.op {
+	case "=":
+		return cmp == 0
+	case "!=", "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func selectValueNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// selectValueString returns the string form of a value, as used in CSV
+// output and string comparisons.
+func selectValueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// run applies the query to the records returned by next, which returns a
+// nil record once there are no more. emit is called with each resulting
+// record.
+func (q *selectQuery) run(next func() (selectRecord, error), emit func([]selectField) error) error {
+	var count, emitted int64
+	for q.limit < 0 || emitted < q.limit {
+		rec, err := next()
+		if err != nil {
+			return err
+		} else if rec == nil {
+			break
+		}
+
+		if q.where != nil && !q.where.eval(rec) {
+			continue
+		}
+
+		if q.count {
+			count++
+			continue
+		}
+
+		var row []selectField
+		if q.star {
+			row = rec.fields()
+		} else {
+			row = make([]selectField, len(q.projection))
+			for i, col := range q.projection {
+				row[i] = selectField{name: col.name, value: rec.lookup(col.path)}
+			}
+		}
+		if err := emit(row); err != nil {
+			return err
+		}
+		emitted++
+	}
+
+	if q.count {
+		return emit([]selectField{{name: "_1", value: json.Number(strconv.FormatInt(count, 10))}})
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package signature
+
+import (
+	"time"
+)
+
+// PostPolicyV4Verify - Verify the signature of a browser-based POST upload, in
+// accordance with
+//   - https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-HTTPPOSTConstructPolicy.html
+//
+// policy is the base64 encoded policy document exactly as it appears in the
+// form, and algorithm, credential and sig are the values of the
+// 'x-amz-algorithm', 'x-amz-credential' and 'x-amz-signature' form fields.
+// The policy document itself is not checked.
+//
+// returns ErrNone if signature matches.
+func PostPolicyV4Verify(policy, algorithm, credential, sig string) ErrorCode {
+	if algorithm != signV4Algorithm {
+		return ErrUnsupportAlgorithm
+	}
+	if credential == "" {
+		return errMissingCredTag
+	}
+	if sig == "" {
+		return errMissingSignTag
+	}
+
+	cred, err := parseCredentialHeader("Credential=" + credential)
+	if err != ErrNone {
+		return err
+	}
+	keys, _, err := checkKeyValid(nil, cred.accessKey)
+	if err != ErrNone {
+		return err
+	}
+
+	signingKey := signingKeys.get(keys.AccessKey, keys.SecretKey, cred.scope.date, cred.scope.region)
+	if !compareSignatureV4(getSignature(signingKey, policy), sig) {
+		return errSignatureDoesNotMatch
+	}
+	return ErrNone
+}
+
+// SignPostPolicyV4 returns the 'x-amz-signature' form field for a
+// browser-based POST upload, given the base64 encoded policy document. date
+// and region must match the 'x-amz-credential' form field.
+func SignPostPolicyV4(policy, secretKey, region string, date time.Time) string {
+	return getSignature(getSigningKey(secretKey, date, region), policy)
+}
@@ -0,0 +1,60 @@
+package signature
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxPresignExpires is the longest expiry S3 accepts for a presigned URL.
+const maxPresignExpires = 7 * 24 * time.Hour
+
+// PresignV4 returns a presigned URL for req, using query string
+// authentication:
+//   - https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-query-string-auth.html
+//
+// Only the host header is signed, and the payload is always unsigned, so the
+// URL can be handed to a browser or curl. The URL is built with the same
+// canonicalization V4SignVerify uses, and is valid from TimeNow for expires,
+// which must be between one second and seven days.
+func PresignV4(req *http.Request, accessKey, secretKey, region string, expires time.Duration) (string, error) {
+	if expires < time.Second || expires > maxPresignExpires {
+		return "", fmt.Errorf("signature: presigned URL expiry %s must be between 1s and %s", expires, maxPresignExpires)
+	}
+
+	t := TimeNow().UTC()
+	cred := credentialHeader{
+		accessKey: accessKey,
+		scope: signScope{
+			date:    t,
+			region:  region,
+			service: serviceS3,
+			request: "aws4_request",
+		},
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	u := *req.URL
+	query := u.Query()
+	query.Del(amzSignature)
+	query.Set(amzAlgorithm, signV4Algorithm)
+	query.Set(amzCredential, accessKey+slashSeparator+cred.getScope())
+	query.Set(amzDate, t.Format(iso8601Format))
+	query.Set(amzExpires, strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set(amzSignedHeaders, "host")
+
+	signedHeaders := http.Header{}
+	signedHeaders.Set("host", host)
+
+	canonicalRequest := getCanonicalRequest(signedHeaders, "UNSIGNED-PAYLOAD", query.Encode(), u.Path, req.Method)
+	stringToSign := getStringToSign(canonicalRequest, t, cred.getScope())
+	query.Set(amzSignature, getSignature(getSigningKey(secretKey, t, region), stringToSign))
+
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
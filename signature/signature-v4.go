@@ -220,7 +220,7 @@ func V4SignVerify(r *http.Request) ErrorCode {
 	rawquery := queryf.Encode()
 
 	// Get hmac signing key.
-	signingKey := getSigningKey(cred.SecretKey, signV4Values.Credential.scope.date, signV4Values.Credential.scope.region)
+	signingKey := signingKeys.get(cred.AccessKey, cred.SecretKey, signV4Values.Credential.scope.date, signV4Values.Credential.scope.region)
 
 	var newSignature string
 	if isUnsignedPayload {
@@ -235,3 +235,46 @@ func TestCheckExpiration(t *testing.T) {
 		})
 	}
 }
+
+func TestPresignV4(t *testing.T) {
+	originalTimeNow := signature.TimeNow
+	defer func() { signature.TimeNow = originalTimeNow }()
+
+	ak := RandString(32)
+	sk := RandString(64)
+	region := RandString(16)
+	signature.ReloadKeys(map[string]string{ak: sk})
+
+	now := time.Now()
+	signature.TimeNow = func() time.Time { return now }
+
+	req, err := http.NewRequest(http.MethodGet, "https://s3-endpoint.example.com/bucket/some%20key?versionId=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	presigned, err := signature.PresignV4(req, ak, sk, region, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func() signature.ErrorCode {
+		req, err := http.NewRequest(http.MethodGet, presigned, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signature.V4SignVerify(req)
+	}
+
+	if result := verify(); result != signature.ErrNone {
+		t.Fatalf("invalid result: expect none but got %+v", signature.GetAPIError(result))
+	}
+
+	signature.TimeNow = func() time.Time { return now.Add(6 * time.Minute) }
+	if result := verify(); signature.GetAPIError(result).Code != "AccessDenied" {
+		t.Fatalf("expected expired request, found %+v", signature.GetAPIError(result))
+	}
+
+	if _, err := signature.PresignV4(req, ak, sk, region, 8*24*time.Hour); err == nil {
+		t.Fatal("expected error for expiry over seven days")
+	}
+}
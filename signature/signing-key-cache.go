@@ -0,0 +1,104 @@
+package signature
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// signingKeyCacheSize is the number of derived signing keys that are
+	// kept. Each client needs one per day and region it signs requests for.
+	signingKeyCacheSize = 1024
+
+	// signingKeyMaxAge is how long after its scope date a cached signing key
+	// is kept. Presigned URLs may be valid for up to 7 days, so the key for a
+	// date may be needed until then.
+	signingKeyMaxAge = 8 * 24 * time.Hour
+)
+
+// signingKeys caches the signing keys derived by getSigningKey, as deriving
+// a key takes four HMAC calculations for every signed request.
+var signingKeys = newSigningKeyCache(signingKeyCacheSize)
+
+type signingKeyID struct {
+	accessKey string
+	date      string
+	region    string
+	service   string
+}
+
+type signingKeyEntry struct {
+	id         signingKeyID
+	secretKey  string
+	scopeDate  time.Time
+	signingKey []byte
+}
+
+// signingKeyCache is an LRU cache of derived signing keys, safe for
+// concurrent use.
+type signingKeyCache struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // Most recently used first
+	entries map[signingKeyID]*list.Element
+}
+
+func newSigningKeyCache(max int) *signingKeyCache {
+	return &signingKeyCache{
+		max:     max,
+		order:   list.New(),
+		entries: map[signingKeyID]*list.Element{},
+	}
+}
+
+// get returns the signing key for the given credentials and scope, deriving
+// it if it is not cached. The secret key is checked as well as the access
+// key, so a key is never used after the secret it was derived from changes.
+func (c *signingKeyCache) get(accessKey, secretKey string, t time.Time, region string) []byte {
+	id := signingKeyID{accessKey: accessKey, date: t.Format(yyyymmdd), region: region, service: stype}
+	now := TimeNow()
+
+	c.mu.Lock()
+	if elem, ok := c.entries[id]; ok {
+		entry := elem.Value.(*signingKeyEntry)
+		if entry.secretKey == secretKey && now.Before(entry.scopeDate.Add(signingKeyMaxAge)) {
+			c.order.MoveToFront(elem)
+			c.mu.Unlock()
+			return entry.signingKey
+		}
+		c.remove(elem)
+	}
+	c.mu.Unlock()
+
+	signingKey := getSigningKey(secretKey, t, region)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[id]; !ok {
+		c.entries[id] = c.order.PushFront(&signingKeyEntry{
+			id:         id,
+			secretKey:  secretKey,
+			scopeDate:  t,
+			signingKey: signingKey,
+		})
+		for c.order.Len() > c.max {
+			c.remove(c.order.Back())
+		}
+	}
+	return signingKey
+}
+
+// remove deletes elem from the cache. The caller must hold the lock.
+func (c *signingKeyCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*signingKeyEntry).id)
+}
+
+// purge removes every cached key.
+func (c *signingKeyCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = map[signingKeyID]*list.Element{}
+}
@@ -0,0 +1,88 @@
+package signature
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSigningKeyCache(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	defer func(now func() time.Time) { TimeNow = now }(TimeNow)
+	TimeNow = func() time.Time { return date }
+
+	c := newSigningKeyCache(2)
+
+	key := c.get("access", "secret", date, "us-east-1")
+	if !bytes.Equal(key, getSigningKey("secret", date, "us-east-1")) {
+		t.Fatal("unexpected signing key")
+	}
+	if c.order.Len() != 1 {
+		t.Fatal("expected key to be cached")
+	}
+
+	// A changed secret must not reuse the old key:
+	key = c.get("access", "rotated", date, "us-east-1")
+	if !bytes.Equal(key, getSigningKey("rotated", date, "us-east-1")) {
+		t.Fatal("stale signing key used after the secret changed")
+	}
+
+	// The least recently used key is evicted:
+	c.get("access", "rotated", date, "eu-west-1")
+	c.get("access", "rotated", date, "us-east-1")
+	c.get("access", "rotated", date, "ap-south-1")
+	if _, ok := c.entries[signingKeyID{"access", date.Format(yyyymmdd), "eu-west-1", stype}]; ok {
+		t.Fatal("expected least recently used key to be evicted")
+	}
+	if _, ok := c.entries[signingKeyID{"access", date.Format(yyyymmdd), "us-east-1", stype}]; !ok {
+		t.Fatal("expected recently used key to be kept")
+	}
+
+	// Keys expire once their date is too old to be used:
+	cached := c.get("access", "rotated", date, "us-east-1")
+	if fresh := c.get("access", "rotated", date, "us-east-1"); &fresh[0] != &cached[0] {
+		t.Fatal("expected cached key to be reused")
+	}
+	TimeNow = func() time.Time { return date.Add(signingKeyMaxAge) }
+	if fresh := c.get("access", "rotated", date, "us-east-1"); &fresh[0] == &cached[0] {
+		t.Fatal("expected expired key to be derived again")
+	}
+}
+
+func TestReloadKeysPurgesSigningKeys(t *testing.T) {
+	date := time.Now()
+	signingKeys.get("reload-access", "secret", date, "us-east-1")
+	ReloadKeys(map[string]string{"reload-access": "secret"})
+	if signingKeys.order.Len() != 0 {
+		t.Fatal("expected ReloadKeys to purge the signing key cache")
+	}
+}
+
+func BenchmarkSigningKey(b *testing.B) {
+	date := time.Now()
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			getSigningKey("secret", date, "us-east-1")
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		c := newSigningKeyCache(signingKeyCacheSize)
+		for i := 0; i < b.N; i++ {
+			c.get("access", "secret", date, "us-east-1")
+		}
+	})
+
+	b.Run("cached-parallel", func(b *testing.B) {
+		c := newSigningKeyCache(signingKeyCacheSize)
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				c.get(fmt.Sprintf("access%d", i%8), "secret", date, "us-east-1")
+				i++
+			}
+		})
+	})
+}
@@ -37,6 +37,8 @@ func StoreKeys(pairs map[string]string) {
 	}
 }
 
+// ReloadKeys replaces the stored accessKey-secretKey pairs with pairs, and
+// discards any signing keys derived from the old ones.
 func ReloadKeys(pairs map[string]string) {
 	credStore.Range(func(key, value interface{}) bool {
 		if _, ok := pairs[key.(string)]; !ok {
@@ -45,6 +47,7 @@ func ReloadKeys(pairs map[string]string) {
 		return true
 	})
 	StoreKeys(pairs)
+	signingKeys.purge()
 }
 
 func sumHMAC(key []byte, data []byte) []byte {
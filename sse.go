@@ -0,0 +1,214 @@
+package gofakes3
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	xml "github.com/oneclickvirt/gofakes3/xml"
+)
+
+// Values of the 'x-amz-server-side-encryption' header. GoFakeS3 does not
+// encrypt anything; the headers are stored with the object and sent back on
+// GET and HEAD, so clients that check them see what S3 would send.
+const (
+	ServerSideEncryptionAES256 = "AES256"
+	ServerSideEncryptionKMS    = "aws:kms"
+)
+
+var (
+	sseHeader            = http.CanonicalHeaderKey("x-amz-server-side-encryption")
+	sseKMSKeyIDHeader    = http.CanonicalHeaderKey("x-amz-server-side-encryption-aws-kms-key-id")
+	sseBucketKeyHeader   = http.CanonicalHeaderKey("x-amz-server-side-encryption-bucket-key-enabled")
+	sseCustomerAlgHeader = http.CanonicalHeaderKey("x-amz-server-side-encryption-customer-algorithm")
+	sseCustomerKeyHeader = http.CanonicalHeaderKey("x-amz-server-side-encryption-customer-key")
+	sseCustomerMD5Header = http.CanonicalHeaderKey("x-amz-server-side-encryption-customer-key-MD5")
+
+	sseCopySourceCustomerAlgHeader = http.CanonicalHeaderKey("x-amz-copy-source-server-side-encryption-customer-algorithm")
+	sseCopySourceCustomerKeyHeader = http.CanonicalHeaderKey("x-amz-copy-source-server-side-encryption-customer-key")
+	sseCopySourceCustomerMD5Header = http.CanonicalHeaderKey("x-amz-copy-source-server-side-encryption-customer-key-MD5")
+)
+
+// sseMetadataKeys are the metadata keys that describe how an object is
+// encrypted. They belong to a single object, so CopyObject never copies them
+// from the source.
+var sseMetadataKeys = []string{
+	sseHeader,
+	sseKMSKeyIDHeader,
+	sseBucketKeyHeader,
+	sseCustomerAlgHeader,
+	sseCustomerMD5Header,
+}
+
+// checkServerSideEncryption validates the encryption headers in the metadata
+// for a new object, or for a multipart upload part. Customer-provided keys
+// (SSE-C) are removed from meta so they are never stored; only the algorithm
+// and the MD5 of the key are kept, as S3 does.
+func checkServerSideEncryption(meta map[string]string) error {
+	alg, key, keyMD5 := meta[sseCustomerAlgHeader], meta[sseCustomerKeyHeader], meta[sseCustomerMD5Header]
+	delete(meta, sseCustomerKeyHeader)
+
+	// The copy source headers describe a different object; copyObject reads
+	// them from the request instead:
+	delete(meta, sseCopySourceCustomerAlgHeader)
+	delete(meta, sseCopySourceCustomerKeyHeader)
+	delete(meta, sseCopySourceCustomerMD5Header)
+
+	sse := meta[sseHeader]
+	if sse != "" && sse != ServerSideEncryptionAES256 && sse != ServerSideEncryptionKMS {
+		return ErrorInvalidArgument("x-amz-server-side-encryption", sse, "The encryption method specified is not supported")
+	}
+	if bucketKey, ok := meta[sseBucketKeyHeader]; ok {
+		if !strings.EqualFold(bucketKey, "true") && !strings.EqualFold(bucketKey, "false") {
+			return ErrorInvalidArgument("x-amz-server-side-encryption-bucket-key-enabled", bucketKey, "Bucket Key value must be true or false")
+		}
+		meta[sseBucketKeyHeader] = strings.ToLower(bucketKey)
+	}
+
+	if alg == "" && key == "" && keyMD5 == "" {
+		return nil
+	}
+	if sse != "" {
+		return ErrorInvalidArgument("x-amz-server-side-encryption", sse, "Server Side Encryption with Customer provided key is incompatible with the encryption method specified")
+	}
+	sum, err := sseCustomerKeyMD5(alg, key, keyMD5)
+	if err != nil {
+		return err
+	}
+	meta[sseCustomerMD5Header] = sum
+	return nil
+}
+
+// sseCustomerKeyMD5 validates the SSE-C headers sent with a request, and
+// returns the base64 encoded MD5 of the key.
+func sseCustomerKeyMD5(alg, key, keyMD5 string) (string, error) {
+	if alg != ServerSideEncryptionAES256 {
+		return "", ErrorInvalidArgument("x-amz-server-side-encryption-customer-algorithm", alg, "The requested encryption algorithm is not valid, must be AES256.")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		// The key itself is never included in the response:
+		return "", ErrorInvalidArgument("x-amz-server-side-encryption-customer-key", "", "The secret key was invalid for the specified algorithm.")
+	}
+
+	sum := md5.Sum(raw)
+	calculated := base64.StdEncoding.EncodeToString(sum[:])
+	if keyMD5 == "" {
+		return "", ErrorInvalidArgument("x-amz-server-side-encryption-customer-key-MD5", "", "Requests specifying Server Side Encryption with Customer provided keys must provide the client calculated MD5 of the secret key.")
+	} else if keyMD5 != calculated {
+		return "", ErrorInvalidArgument("x-amz-server-side-encryption-customer-key-MD5", keyMD5, "The calculated MD5 hash of the key did not match the hash that was provided.")
+	}
+	return calculated, nil
+}
+
+// checkSSECustomerKey checks that the SSE-C headers sent to read an object
+// match the key the object was stored with. alg, key and keyMD5 come from
+// the 'x-amz-server-side-encryption-customer-*' headers for GET and HEAD, or
+// from the 'x-amz-copy-source-server-side-encryption-customer-*' headers for
+// the source of a copy.
+func checkSSECustomerKey(stored map[string]string, alg, key, keyMD5 string) error {
+	storedMD5 := stored[sseCustomerMD5Header]
+	if storedMD5 == "" {
+		if alg != "" || key != "" {
+			return ErrorMessage(ErrInvalidRequest, "The encryption parameters are not applicable to this object.")
+		}
+		return nil
+	}
+
+	if alg == "" && key == "" && keyMD5 == "" {
+		return ErrorMessage(ErrInvalidRequest, "The object was stored using a form of Server Side Encryption. The correct parameters must be provided to retrieve the object.")
+	}
+	sum, err := sseCustomerKeyMD5(alg, key, keyMD5)
+	if err != nil {
+		return err
+	}
+	if sum != storedMD5 {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// echoEncryptionHeaders copies the encryption headers of a new object to the
+// response, as S3 does for PUT and copy requests.
+func echoEncryptionHeaders(meta map[string]string, hdr http.Header) {
+	for _, k := range sseMetadataKeys {
+		if v, ok := meta[k]; ok {
+			hdr.Set(k, v)
+		}
+	}
+}
+
+// ServerSideEncryptionConfiguration is used by the '?encryption' subresource
+// on buckets, both as the response body for a GET and as the request body for
+// a PUT:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketEncryption.html
+//
+// The default encryption is added to the metadata of new objects that are
+// uploaded without any encryption headers.
+type ServerSideEncryptionConfiguration struct {
+	XMLName xml.Name                   `xml:"ServerSideEncryptionConfiguration"`
+	Xmlns   string                     `xml:"xmlns,attr"`
+	Rules   []ServerSideEncryptionRule `xml:"Rule"`
+}
+
+type ServerSideEncryptionRule struct {
+	ApplyServerSideEncryptionByDefault *ServerSideEncryptionByDefault `xml:"ApplyServerSideEncryptionByDefault,omitempty"`
+	BucketKeyEnabled                   bool                           `xml:"BucketKeyEnabled,omitempty"`
+}
+
+type ServerSideEncryptionByDefault struct {
+	SSEAlgorithm   string `xml:"SSEAlgorithm"`
+	KMSMasterKeyID string `xml:"KMSMasterKeyID,omitempty"`
+}
+
+func (c *ServerSideEncryptionConfiguration) validate() error {
+	if len(c.Rules) == 0 {
+		return ErrMalformedXML
+	}
+	for _, rule := range c.Rules {
+		def := rule.ApplyServerSideEncryptionByDefault
+		if def == nil {
+			continue
+		}
+		if def.SSEAlgorithm != ServerSideEncryptionAES256 && def.SSEAlgorithm != ServerSideEncryptionKMS {
+			return ErrMalformedXML
+		}
+		if def.KMSMasterKeyID != "" && def.SSEAlgorithm != ServerSideEncryptionKMS {
+			return ErrorMessage(ErrInvalidArgument, "a KMSMasterKeyID is not applicable if the default sse algorithm is not aws:kms")
+		}
+	}
+	return nil
+}
+
+// applyDefaultEncryption adds the bucket's default encryption to the
+// metadata of a new object, unless the request asked for encryption itself.
+func (g *GoFakeS3) applyDefaultEncryption(bucket string, meta map[string]string, r *http.Request) error {
+	if g.encryption == nil || meta[sseHeader] != "" || meta[sseCustomerAlgHeader] != "" {
+		return nil
+	}
+
+	config, err := g.encryption.GetBucketEncryption(r.Context(), bucket)
+	if HasErrorCode(err, ErrServerSideEncryptionConfigurationNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, rule := range config.Rules {
+		def := rule.ApplyServerSideEncryptionByDefault
+		if def == nil {
+			continue
+		}
+		meta[sseHeader] = def.SSEAlgorithm
+		if def.KMSMasterKeyID != "" {
+			meta[sseKMSKeyIDHeader] = def.KMSMasterKeyID
+		}
+		if rule.BucketKeyEnabled && def.SSEAlgorithm == ServerSideEncryptionKMS {
+			meta[sseBucketKeyHeader] = "true"
+		}
+		break
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestServerSideEncryption(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	put, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(defaultBucket),
+		Key:                  aws.String("kms"),
+		Body:                 bytes.NewReader([]byte("hello")),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+		SSEKMSKeyId:          aws.String("my-key"),
+	})
+	ts.OK(err)
+	if aws.StringValue(put.ServerSideEncryption) != "aws:kms" || aws.StringValue(put.SSEKMSKeyId) != "my-key" {
+		t.Fatal("unexpected encryption", put)
+	}
+
+	head, err := svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(defaultBucket), Key: aws.String("kms")})
+	ts.OK(err)
+	if aws.StringValue(head.ServerSideEncryption) != "aws:kms" || aws.StringValue(head.SSEKMSKeyId) != "my-key" {
+		t.Fatal("unexpected encryption", head)
+	}
+
+	if head.BucketKeyEnabled != nil {
+		t.Fatal("unexpected bucket key header", head)
+	}
+
+	_, err = svc.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(defaultBucket),
+		Key:                  aws.String("nope"),
+		Body:                 bytes.NewReader([]byte("hello")),
+		ServerSideEncryption: aws.String("nope"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
+	}
+}
+
+// setSSECustomerKey adds the SSE-C headers to rq. The SDK refuses to send
+// customer keys over plain HTTP, so they can't be passed in the input. The
+// SDK encodes the key and adds its MD5 when the request is built.
+func setSSECustomerKey(rq *request.Request, prefix, key string) {
+	rq.HTTPRequest.Header.Set(prefix+"-algorithm", "AES256")
+	rq.HTTPRequest.Header.Set(prefix+"-key", key)
+}
+
+const (
+	sseCustomerPrefix           = "x-amz-server-side-encryption-customer"
+	sseCopySourceCustomerPrefix = "x-amz-copy-source-server-side-encryption-customer"
+)
+
+func TestServerSideEncryptionBucketKey(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	put, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(defaultBucket),
+		Key:                  aws.String("kms"),
+		Body:                 bytes.NewReader([]byte("hello")),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+		BucketKeyEnabled:     aws.Bool(true),
+	})
+	ts.OK(err)
+	if !aws.BoolValue(put.BucketKeyEnabled) {
+		t.Fatal("expected bucket key on put", put)
+	}
+
+	get, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String(defaultBucket), Key: aws.String("kms")})
+	ts.OK(err)
+	defer get.Body.Close()
+	if !aws.BoolValue(get.BucketKeyEnabled) || aws.StringValue(get.ServerSideEncryption) != "aws:kms" {
+		t.Fatal("expected bucket key on get", get)
+	}
+}
+
+func TestServerSideEncryptionCustomerKey(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	key := string(bytes.Repeat([]byte("k"), 32))
+	otherKey := string(bytes.Repeat([]byte("o"), 32))
+	keySum := md5.Sum([]byte(key))
+	keyMD5 := base64.StdEncoding.EncodeToString(keySum[:])
+
+	put, _ := svc.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("ssec"),
+		Body:   bytes.NewReader([]byte("hello")),
+	})
+	setSSECustomerKey(put, sseCustomerPrefix, key)
+	ts.OK(put.Send())
+	if put.HTTPResponse.Header.Get("x-amz-server-side-encryption-customer-key-MD5") != keyMD5 {
+		t.Fatal("unexpected response headers", put.HTTPResponse.Header)
+	}
+
+	t.Run("matching-key", func(t *testing.T) {
+		rq, rs := svc.GetObjectRequest(&s3.GetObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("ssec"),
+		})
+		setSSECustomerKey(rq, sseCustomerPrefix, key)
+		ts.OK(rq.Send())
+		defer rs.Body.Close()
+		if aws.StringValue(rs.SSECustomerAlgorithm) != "AES256" || aws.StringValue(rs.SSECustomerKeyMD5) != keyMD5 {
+			t.Fatal("unexpected encryption", rs)
+		}
+
+		// The key itself is never stored, so it can't be sent back:
+		obj, err := ts.backend.HeadObject(mockR.Context(), defaultBucket, "ssec")
+		ts.OK(err)
+		if _, ok := obj.Metadata["X-Amz-Server-Side-Encryption-Customer-Key"]; ok {
+			t.Fatal("customer key was stored")
+		}
+	})
+
+	t.Run("missing-key", func(t *testing.T) {
+		_, err := svc.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("ssec"),
+		})
+		if !hasErrorCode(err, "BadRequest") {
+			t.Fatal("expected BadRequest, found", err)
+		}
+	})
+
+	t.Run("wrong-key", func(t *testing.T) {
+		rq, _ := svc.GetObjectRequest(&s3.GetObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("ssec"),
+		})
+		setSSECustomerKey(rq, sseCustomerPrefix, otherKey)
+		if err := rq.Send(); !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+			t.Fatal("expected AccessDenied, found", err)
+		}
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		_, err := svc.CopyObject(&s3.CopyObjectInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("copy"),
+			CopySource: aws.String(defaultBucket + "/ssec"),
+		})
+		if !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+			t.Fatal("expected InvalidRequest, found", err)
+		}
+
+		// The copy is not encrypted unless asked:
+		rq, _ := svc.CopyObjectRequest(&s3.CopyObjectInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("copy"),
+			CopySource: aws.String(defaultBucket + "/ssec"),
+		})
+		setSSECustomerKey(rq, sseCopySourceCustomerPrefix, key)
+		ts.OK(rq.Send())
+		ts.assertObject(defaultBucket, "copy", nil, "hello")
+	})
+
+	t.Run("bad-key-md5", func(t *testing.T) {
+		rq, _ := svc.PutObjectRequest(&s3.PutObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("bad"),
+			Body:   bytes.NewReader([]byte("hello")),
+		})
+		setSSECustomerKey(rq, sseCustomerPrefix, key)
+		rq.HTTPRequest.Header.Set("x-amz-server-side-encryption-customer-key-MD5", "bm9wZQ==")
+		if err := rq.Send(); !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+			t.Fatal("expected InvalidArgument, found", err)
+		}
+	})
+}
+
+func TestBucketEncryption(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.GetBucketEncryption(&s3.GetBucketEncryptionInput{Bucket: aws.String(defaultBucket)})
+	if !hasErrorCode(err, gofakes3.ErrServerSideEncryptionConfigurationNotFound) {
+		t.Fatal("expected ServerSideEncryptionConfigurationNotFoundError, found", err)
+	}
+
+	ts.OKAll(svc.PutBucketEncryption(&s3.PutBucketEncryptionInput{
+		Bucket: aws.String(defaultBucket),
+		ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+			Rules: []*s3.ServerSideEncryptionRule{{
+				ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{
+					SSEAlgorithm:   aws.String(s3.ServerSideEncryptionAwsKms),
+					KMSMasterKeyID: aws.String("my-key"),
+				},
+				BucketKeyEnabled: aws.Bool(true),
+			}},
+		},
+	}))
+
+	rs, err := svc.GetBucketEncryption(&s3.GetBucketEncryptionInput{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+	rules := rs.ServerSideEncryptionConfiguration.Rules
+	if len(rules) != 1 || aws.StringValue(rules[0].ApplyServerSideEncryptionByDefault.KMSMasterKeyID) != "my-key" ||
+		!aws.BoolValue(rules[0].BucketKeyEnabled) {
+		t.Fatal("unexpected configuration", rs)
+	}
+
+	// New objects get the default encryption:
+	put, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("default"),
+		Body:   bytes.NewReader([]byte("hello")),
+	})
+	ts.OK(err)
+	if aws.StringValue(put.ServerSideEncryption) != "aws:kms" || aws.StringValue(put.SSEKMSKeyId) != "my-key" ||
+		!aws.BoolValue(put.BucketKeyEnabled) {
+		t.Fatal("unexpected encryption", put)
+	}
+	head, err := svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(defaultBucket), Key: aws.String("default")})
+	ts.OK(err)
+	if aws.StringValue(head.ServerSideEncryption) != "aws:kms" {
+		t.Fatal("unexpected encryption", head)
+	}
+
+	// ...unless they ask for encryption themselves:
+	put, err = svc.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(defaultBucket),
+		Key:                  aws.String("explicit"),
+		Body:                 bytes.NewReader([]byte("hello")),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAes256),
+	})
+	ts.OK(err)
+	if aws.StringValue(put.ServerSideEncryption) != "AES256" || put.SSEKMSKeyId != nil {
+		t.Fatal("unexpected encryption", put)
+	}
+
+	ts.OKAll(svc.DeleteBucketEncryption(&s3.DeleteBucketEncryptionInput{Bucket: aws.String(defaultBucket)}))
+	_, err = svc.GetBucketEncryption(&s3.GetBucketEncryptionInput{Bucket: aws.String(defaultBucket)})
+	if !hasErrorCode(err, gofakes3.ErrServerSideEncryptionConfigurationNotFound) {
+		t.Fatal("expected ServerSideEncryptionConfigurationNotFoundError, found", err)
+	}
+}
+
+func TestBucketEncryptionInvalid(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.PutBucketEncryption(&s3.PutBucketEncryptionInput{
+		Bucket: aws.String(defaultBucket),
+		ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+			Rules: []*s3.ServerSideEncryptionRule{{
+				ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{
+					SSEAlgorithm: aws.String("nope"),
+				},
+			}},
+		},
+	})
+	if !hasErrorCode(err, gofakes3.ErrMalformedXML) {
+		t.Fatal("expected MalformedXML, found", err)
+	}
+}
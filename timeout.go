@@ -0,0 +1,82 @@
+package gofakes3
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// readTimeoutMiddleware bounds how long a read of the request body may
+// stall, see WithReadTimeout.
+func (g *GoFakeS3) readTimeoutMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		if rq.Body != nil && rq.Body != http.NoBody {
+			rq.Body = &timeoutReader{inner: rq.Body, timeout: g.readTimeout, w: w}
+		}
+		handler.ServeHTTP(w, rq)
+	})
+}
+
+// timeoutReader fails with ErrRequestTimeout if a single Read from inner
+// does not return within timeout.
+//
+// A Read that has timed out is left running in the background, as there is
+// no way to interrupt it from inside a handler; nothing more is read from
+// inner after that. The connection is marked to be closed once the response
+// has been sent, so the server is not left waiting for the rest of a body
+// that may never arrive.
+type timeoutReader struct {
+	inner   io.ReadCloser
+	timeout time.Duration
+	w       http.ResponseWriter
+	buf     []byte
+	err     error
+}
+
+type timeoutRead struct {
+	n   int
+	err error
+}
+
+func (t *timeoutReader) Read(p []byte) (n int, err error) {
+	if t.err != nil {
+		return 0, t.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// The background read must not write to p, as the caller is free to
+	// reuse p as soon as Read returns with a timeout:
+	if cap(t.buf) < len(p) {
+		t.buf = make([]byte, len(p))
+	}
+	buf := t.buf[:len(p)]
+
+	done := make(chan timeoutRead, 1)
+	go func() {
+		n, err := t.inner.Read(buf)
+		done <- timeoutRead{n, err}
+	}()
+
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+
+	select {
+	case rd := <-done:
+		return copy(p, buf[:rd.n]), rd.err
+	case <-timer.C:
+		t.err = ErrRequestTimeout
+		t.buf = nil
+		t.w.Header().Set("Connection", "close")
+		return 0, t.err
+	}
+}
+
+func (t *timeoutReader) Close() error {
+	if t.err != nil {
+		// Closing the body would wait for the stalled Read to finish.
+		return nil
+	}
+	return t.inner.Close()
+}
@@ -0,0 +1,40 @@
+package gofakes3
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+)
+
+// trailerChecksumAlgorithm is used for the checksum sent in the response
+// trailers enabled by WithResponseTrailers.
+const trailerChecksumAlgorithm = ChecksumCRC32
+
+// responseTrailers declares the trailers sent after an object body when
+// WithResponseTrailers is enabled. It must be called before the status is
+// written; the body should then be copied to the returned writer, and the
+// returned func called once it has been to set the trailer values.
+//
+// The trailers carry the object's ETag and the checksum of the bytes actually
+// sent, so a client can verify what it read. They need HTTP/2 or a chunked
+// HTTP/1.1 response, so the Content-Length is dropped for HTTP/1.1 and no
+// trailers are sent to HTTP/1.0 clients.
+func (g *GoFakeS3) responseTrailers(w http.ResponseWriter, r *http.Request) (io.Writer, func()) {
+	if !g.responseTrailersEnabled || !r.ProtoAtLeast(1, 1) {
+		return w, func() {}
+	}
+
+	hdr := w.Header()
+	checksumHeader := trailerChecksumAlgorithm.Header()
+	hdr.Set("Trailer", "ETag, "+checksumHeader)
+	if r.ProtoMajor == 1 {
+		hdr.Del("Content-Length")
+	}
+
+	etag := hdr.Get("ETag")
+	h := trailerChecksumAlgorithm.newHash()
+	return io.MultiWriter(w, h), func() {
+		hdr.Set("ETag", etag)
+		hdr.Set(checksumHeader, base64.StdEncoding.EncodeToString(h.Sum(nil)))
+	}
+}
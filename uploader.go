@@ -1,13 +1,16 @@
 package gofakes3
 
 import (
-	"crypto/md5"
-	"encoding/hex"
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/big"
 	"net/url"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/oneclickvirt/gofakes3/internal/goskipiter"
@@ -135,10 +138,11 @@ func (bu *bucketUploads) remove(uploadID UploadID) {
 //   - uploads do not interface with the Backend, so they do not
 //     currently persist across reboots
 //
-//   - upload parts are held in memory, so if you want to upload something huge
-//     in multiple parts (which is pretty much exactly what you'd want multipart
-//     uploads for), you'll need to make sure your memory is also sufficiently
-//     huge!
+//   - upload parts are held in memory unless a tempDir is set with
+//     WithMultipartTempDir, so if you want to upload something huge in
+//     multiple parts (which is pretty much exactly what you'd want multipart
+//     uploads for), you'll need to make sure your memory, or your disk, is
+//     also sufficiently huge!
 //
 // At this stage, the current thinking would be to add a second optional
 // Backend interface that allows persistent operations on multipart upload
@@ -154,6 +158,14 @@ type uploader struct {
 
 	buckets map[string]*bucketUploads
 	mu      sync.Mutex
+
+	// If tempDir is not empty, the parts of each upload are written to
+	// temporary files in this directory rather than held in memory.
+	tempDir string
+
+	// memory is the size of the parts held in memory, in bytes. Access it
+	// using sync/atomic.
+	memory int64
 }
 
 func newUploader() *uploader {
@@ -163,7 +175,7 @@ func newUploader() *uploader {
 	}
 }
 
-func (u *uploader) Begin(bucket, object string, meta map[string]string, initiated time.Time) *multipartUpload {
+func (u *uploader) Begin(bucket, object string, meta map[string]string, checksum ChecksumAlgorithm, initiated time.Time) *multipartUpload {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
@@ -175,6 +187,8 @@ func (u *uploader) Begin(bucket, object string, meta map[string]string, initiate
 		Object:    object,
 		Meta:      meta,
 		Initiated: initiated,
+
+		ChecksumAlgorithm: checksum,
 	}
 
 	// FIXME: make sure the uploader responds to DeleteBucket
@@ -189,7 +203,9 @@ func (u *uploader) Begin(bucket, object string, meta map[string]string, initiate
 	return mpu
 }
 
-func (u *uploader) ListParts(bucket, object string, uploadID UploadID, marker int, limit int64) (*ListMultipartUploadPartsResult, error) {
+// ListParts lists the parts of an upload. owner is reported as both the
+// Initiator and the Owner of the upload.
+func (u *uploader) ListParts(bucket, object string, uploadID UploadID, marker int, limit int64, owner *UserInfo) (*ListMultipartUploadPartsResult, error) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
@@ -199,12 +215,15 @@ func (u *uploader) ListParts(bucket, object string, uploadID UploadID, marker in
 	}
 
 	var result = ListMultipartUploadPartsResult{
+		Xmlns:            "http://s3.amazonaws.com/doc/2006-03-01/",
 		Bucket:           bucket,
 		Key:              object,
 		UploadID:         uploadID,
+		Initiator:        owner,
+		Owner:            owner,
 		MaxParts:         limit,
 		PartNumberMarker: marker,
-		StorageClass:     "STANDARD", // FIXME
+		StorageClass:     storageClassFromMetadata(mpu.Meta),
 	}
 
 	var cnt int64
@@ -219,12 +238,14 @@ func (u *uploader) ListParts(bucket, object string, uploadID UploadID, marker in
 			break
 		}
 
-		result.Parts = append(result.Parts, ListMultipartUploadPartItem{
+		item := ListMultipartUploadPartItem{
 			ETag:         part.ETag,
-			Size:         int64(len(part.Body)),
+			Size:         part.Size,
 			PartNumber:   partNumber,
 			LastModified: part.LastModified,
-		})
+		}
+		item.Checksums.Set(mpu.ChecksumAlgorithm, part.Checksum)
+		result.Parts = append(result.Parts, item)
 
 		cnt++
 	}
@@ -232,7 +253,9 @@ func (u *uploader) ListParts(bucket, object string, uploadID UploadID, marker in
 	return &result, nil
 }
 
-func (u *uploader) List(bucket string, marker *UploadListMarker, prefix Prefix, limit int64) (*ListMultipartUploadsResult, error) {
+// List lists the uploads in progress for a bucket. owner is reported as both
+// the Initiator and the Owner of every upload.
+func (u *uploader) List(bucket string, marker *UploadListMarker, prefix Prefix, limit int64, owner *UserInfo) (*ListMultipartUploadsResult, error) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
@@ -242,6 +265,7 @@ func (u *uploader) List(bucket string, marker *UploadListMarker, prefix Prefix,
 	}
 
 	var result = ListMultipartUploadsResult{
+		Xmlns:      "http://s3.amazonaws.com/doc/2006-03-01/",
 		Bucket:     bucket,
 		Delimiter:  prefix.Delimiter,
 		Prefix:     prefix.Prefix,
@@ -252,9 +276,15 @@ func (u *uploader) List(bucket string, marker *UploadListMarker, prefix Prefix,
 	// supplied, otherwise assume we can start from the start of the iterator:
 	var firstFound = true
 
+	// Keys before the prefix can never match, so the iterator starts at
+	// whichever of the prefix and the key-marker comes last:
 	var iter = goskipiter.New(bucketUploads.objectIndex.Iterator())
-	if marker != nil {
+	if marker != nil && marker.Object >= prefix.Prefix {
 		iter.Seek(marker.Object)
+	} else if prefix.Prefix != "" {
+		iter.Seek(prefix.Prefix)
+	}
+	if marker != nil {
 		firstFound = marker.UploadID == ""
 		result.UploadIDMarker = marker.UploadID
 		result.KeyMarker = marker.Object
@@ -277,12 +307,24 @@ func (u *uploader) List(bucket string, marker *UploadListMarker, prefix Prefix,
 		object := iter.Key().(string)
 		uploads := iter.Value().([]*multipartUpload)
 
+		// Without an upload-id-marker, only keys after the key-marker are
+		// listed:
+		if marker != nil && marker.UploadID == "" && object == marker.Object {
+			continue
+		}
+
 	retry:
 		matched := prefix.Match(object, &match)
 		if !matched {
 			continue
 		}
 
+		// If the key-marker has no uploads left, or is outside the prefix,
+		// the page starts at the first key after it:
+		if !firstFound && object != marker.Object {
+			firstFound = true
+		}
+
 		if !firstFound {
 			for idx, mpu := range uploads {
 				if mpu.ID == marker.UploadID {
@@ -302,9 +344,11 @@ func (u *uploader) List(bucket string, marker *UploadListMarker, prefix Prefix,
 			} else {
 				for idx, upload := range uploads {
 					result.Uploads = append(result.Uploads, ListMultipartUploadItem{
-						StorageClass: "STANDARD", // FIXME
+						StorageClass: storageClassFromMetadata(upload.Meta),
 						Key:          object,
 						UploadID:     upload.ID,
+						Initiator:    owner,
+						Owner:        owner,
 						Initiated:    ContentTime{Time: upload.Initiated},
 					})
 
@@ -328,7 +372,8 @@ done:
 	if !truncated {
 		for iter.Next() {
 			object := iter.Key().(string)
-			if matched := prefix.Match(object, &match); matched && !match.CommonPrefix {
+			matched := prefix.Match(object, &match)
+			if matched && (!match.CommonPrefix || !seenPrefixes[match.MatchedPart]) {
 				truncated = true
 
 				// This is not especially defensive; it assumes the rest of the code works
@@ -359,6 +404,54 @@ func (u *uploader) Complete(bucket, object string, id UploadID) (*multipartUploa
 	return up, nil
 }
 
+// newPart reads a part of size bytes from body, and keeps it in memory or in
+// a temporary file in tempDir. ErrIncompleteBody is returned if body is
+// shorter or longer than size.
+//
+// The ETag, Checksum, PartNumber and LastModified are left for the caller
+// to fill in.
+func (u *uploader) newPart(body io.Reader, size int64) (*multipartUploadPart, error) {
+	if u.tempDir == "" {
+		data, err := ReadAll(body, size)
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddInt64(&u.memory, size)
+		return &multipartUploadPart{Size: size, body: data, uploader: u}, nil
+	}
+
+	f, err := ioutil.TempFile(u.tempDir, "gofakes3-part-")
+	if err != nil {
+		return nil, err
+	}
+	part := &multipartUploadPart{Size: size, path: f.Name()}
+
+	n, err := io.Copy(f, io.LimitReader(body, size))
+	if err == nil && n != size {
+		err = ErrIncompleteBody
+	}
+	if err == nil {
+		// Read to EOF, so a hashingReader can check the body:
+		var extra []byte
+		if extra, err = ioutil.ReadAll(body); err == nil && len(extra) > 0 {
+			err = ErrIncompleteBody
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		part.discard()
+		return nil, err
+	}
+	return part, nil
+}
+
+// memoryUsage returns the size of the parts held in memory, in bytes.
+func (u *uploader) memoryUsage() int64 {
+	return atomic.LoadInt64(&u.memory)
+}
+
 func (u *uploader) Get(bucket, object string, id UploadID) (mu *multipartUpload, err error) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
@@ -420,8 +513,42 @@ func uploadListMarkerFromQuery(q url.Values) *UploadListMarker {
 type multipartUploadPart struct {
 	PartNumber   int
 	ETag         string
-	Body         []byte
+	Size         int64
 	LastModified ContentTime
+
+	// Checksum is the base64 encoded checksum of the part, calculated using
+	// the upload's ChecksumAlgorithm, if there is one.
+	Checksum string
+
+	// The contents of the part are held in body, unless the uploader has a
+	// tempDir, in which case they are in the file at path.
+	body []byte
+	path string
+
+	uploader  *uploader
+	discarded bool
+}
+
+func (part *multipartUploadPart) open() (io.ReadCloser, error) {
+	if part.path == "" {
+		return ioutil.NopCloser(bytes.NewReader(part.body)), nil
+	}
+	return os.Open(part.path)
+}
+
+// discard removes the part's temporary file, if it has one, or stops
+// counting the memory it holds. The body itself is left for a reader that
+// may still be using it.
+func (part *multipartUploadPart) discard() {
+	if part.discarded {
+		return
+	}
+	part.discarded = true
+	if part.path != "" {
+		os.Remove(part.path)
+	} else if part.uploader != nil {
+		atomic.AddInt64(&part.uploader.memory, -part.Size)
+	}
 }
 
 type multipartUpload struct {
@@ -431,6 +558,12 @@ type multipartUpload struct {
 	Meta      map[string]string
 	Initiated time.Time
 
+	// ChecksumAlgorithm is declared when the upload is initiated, using the
+	// 'x-amz-checksum-algorithm' header. If it is set, each part is
+	// checksummed using this algorithm, and the completed upload reports a
+	// composite checksum calculated from the part checksums.
+	ChecksumAlgorithm ChecksumAlgorithm
+
 	// Part numbers are limited in S3 to 10,000, so we can be a little wasteful.
 	// If a new part number is added, the slice is grown to that size. Depending
 	// on how bad the input is, this could mean you have a 10,000 element slice
@@ -445,74 +578,206 @@ type multipartUpload struct {
 	// Do not attempt to access parts without locking mu.
 	parts []*multipartUploadPart
 
+	// readers counts the readers returned by Reassemble that have not been
+	// closed yet. While there are any, parts that are replaced or discarded
+	// are kept in replaced, as a reader may still be reading them, and are
+	// discarded once the last reader is closed.
+	readers  int
+	replaced []*multipartUploadPart
+
 	mu sync.Mutex
 }
 
-func (mpu *multipartUpload) AddPart(partNumber int, at time.Time, body []byte) (etag string, err error) {
+// AddPart adds a part created by uploader.newPart to the upload, replacing
+// and discarding any part that was already uploaded with the same number.
+func (mpu *multipartUpload) AddPart(partNumber int, at time.Time, part *multipartUploadPart) error {
 	if partNumber > MaxUploadPartNumber {
-		return "", ErrInvalidPart
+		return ErrInvalidPart
 	}
 
 	mpu.mu.Lock()
 	defer mpu.mu.Unlock()
 
-	// What the ETag actually is is not specified, so let's just invent any old thing
-	// from guaranteed unique input:
-	hash := md5.New()
-	hash.Write(body)
-	etag = fmt.Sprintf(`"%s"`, hex.EncodeToString(hash.Sum(nil)))
+	part.PartNumber = partNumber
+	part.LastModified = NewContentTime(at)
 
-	part := multipartUploadPart{
-		PartNumber:   partNumber,
-		Body:         body,
-		ETag:         etag,
-		LastModified: NewContentTime(at),
-	}
 	if partNumber >= len(mpu.parts) {
 		mpu.parts = append(mpu.parts, make([]*multipartUploadPart, partNumber-len(mpu.parts)+1)...)
 	}
-	mpu.parts[partNumber] = &part
-	return etag, nil
+	if old := mpu.parts[partNumber]; old != nil {
+		mpu.discardPart(old)
+	}
+	mpu.parts[partNumber] = part
+	return nil
+}
+
+// discardPart discards part, or defers it until the last reader returned by
+// Reassemble is closed. mu must be held.
+func (mpu *multipartUpload) discardPart(part *multipartUploadPart) {
+	if mpu.readers > 0 {
+		mpu.replaced = append(mpu.replaced, part)
+		return
+	}
+	part.discard()
 }
 
-func (mpu *multipartUpload) Reassemble(input *CompleteMultipartUploadRequest) (body []byte, etag string, err error) {
+// discard removes the temporary files of all of the upload's parts. It is
+// called once the upload has been completed or aborted.
+func (mpu *multipartUpload) discard() {
+	mpu.mu.Lock()
+	defer mpu.mu.Unlock()
+	for _, part := range mpu.parts {
+		if part != nil {
+			mpu.discardPart(part)
+		}
+	}
+	mpu.parts = nil
+}
+
+// memoryUsage returns the size of the upload's parts that are held in
+// memory, in bytes.
+func (mpu *multipartUpload) memoryUsage() (size int64) {
+	mpu.mu.Lock()
+	defer mpu.mu.Unlock()
+	for _, part := range mpu.parts {
+		if part != nil && part.path == "" {
+			size += part.Size
+		}
+	}
+	return size
+}
+
+// Reassemble validates the parts listed in input and returns a reader that
+// joins them together to form the completed object, along with its size.
+// The parts are opened one at a time as the reader reaches them, so the
+// object is never held in memory as a whole. The reader must be closed.
+//
+// Every part except the last must be at least minPartSize bytes long; a
+// minPartSize of 0 disables the check.
+func (mpu *multipartUpload) Reassemble(input *CompleteMultipartUploadRequest, minPartSize int64) (body io.ReadCloser, size int64, err error) {
 	mpu.mu.Lock()
 	defer mpu.mu.Unlock()
 
 	mpuPartsLen := len(mpu.parts)
 
-	// FIXME: what does AWS do when mpu.Parts > input.Parts? Presumably you may
-	// end up uploading more parts than you need to assemble, so it should
-	// probably just ignore that?
-	if len(input.Parts) > mpuPartsLen {
-		return nil, "", ErrInvalidPart
+	// Parts that were uploaded but not listed in the input are left out of
+	// the completed object, as they are by S3.
+	if len(input.Parts) == 0 {
+		return nil, 0, ErrMalformedXML
 	}
 
-	if !input.partsAreSorted() {
-		return nil, "", ErrInvalidPartOrder
+	if idx := input.firstUnsortedPart(); idx >= 0 {
+		return nil, 0, ErrorMessagef(ErrInvalidPartOrder,
+			"The list of parts was not in ascending order. Part %d must come after part %d.",
+			input.Parts[idx-1].PartNumber, input.Parts[idx].PartNumber)
 	}
 
-	var size int64
-
-	for _, inPart := range input.Parts {
-		if inPart.PartNumber >= mpuPartsLen || mpu.parts[inPart.PartNumber] == nil {
-			return nil, "", ErrorMessagef(ErrInvalidPart, "unexpected part number %d in complete request", inPart.PartNumber)
+	for idx, inPart := range input.Parts {
+		if inPart.PartNumber <= 0 || inPart.PartNumber >= mpuPartsLen || mpu.parts[inPart.PartNumber] == nil {
+			return nil, 0, invalidPart(mpu.ID, inPart.PartNumber, inPart.ETag,
+				fmt.Sprintf("Part %d has not been uploaded.", inPart.PartNumber))
 		}
 
 		upPart := mpu.parts[inPart.PartNumber]
 		if strings.Trim(inPart.ETag, "\"") != strings.Trim(upPart.ETag, "\"") {
-			return nil, "", ErrorMessagef(ErrInvalidPart, "unexpected part etag for number %d in complete request", inPart.PartNumber)
+			return nil, 0, invalidPart(mpu.ID, inPart.PartNumber, inPart.ETag,
+				fmt.Sprintf("The ETag for part %d does not match the uploaded part.", inPart.PartNumber))
+		}
+		if sum := inPart.Checksums.Get(mpu.ChecksumAlgorithm); sum != "" && sum != upPart.Checksum {
+			return nil, 0, invalidPart(mpu.ID, inPart.PartNumber, inPart.ETag,
+				fmt.Sprintf("The checksum for part %d does not match the uploaded part.", inPart.PartNumber))
 		}
 
-		size += int64(len(upPart.Body))
+		partSize := upPart.Size
+		if idx < len(input.Parts)-1 && partSize < minPartSize {
+			return nil, 0, entityTooSmall(inPart.PartNumber, upPart.ETag, partSize, minPartSize)
+		}
+
+		size += partSize
 	}
 
-	body = make([]byte, 0, size)
-	for _, part := range input.Parts {
-		body = append(body, mpu.parts[part.PartNumber].Body...)
+	parts := make([]*multipartUploadPart, len(input.Parts))
+	for idx, part := range input.Parts {
+		parts[idx] = mpu.parts[part.PartNumber]
 	}
+	mpu.readers++
+	return &partsReader{mpu: mpu, parts: parts}, size, nil
+}
+
+// partsReader reads each of parts in turn. The parts are read without
+// holding the upload's lock; the upload keeps any part that is replaced in
+// the meantime until the reader is closed.
+type partsReader struct {
+	mpu    *multipartUpload
+	parts  []*multipartUploadPart
+	cur    io.ReadCloser
+	closed bool
+}
 
-	hash := fmt.Sprintf("%x", md5.Sum(body))
+func (pr *partsReader) Read(p []byte) (n int, err error) {
+	for {
+		if pr.cur == nil {
+			if len(pr.parts) == 0 {
+				return 0, io.EOF
+			}
+			if pr.cur, err = pr.parts[0].open(); err != nil {
+				return 0, err
+			}
+			pr.parts = pr.parts[1:]
+		}
 
-	return body, hash, nil
+		n, err = pr.cur.Read(p)
+		if err == io.EOF {
+			err = pr.cur.Close()
+			pr.cur = nil
+			if n == 0 && err == nil {
+				continue
+			}
+		}
+		return n, err
+	}
+}
+
+func (pr *partsReader) Close() (err error) {
+	if pr.closed {
+		return nil
+	}
+	pr.closed = true
+	pr.parts = nil
+	if pr.cur != nil {
+		err = pr.cur.Close()
+		pr.cur = nil
+	}
+
+	mpu := pr.mpu
+	mpu.mu.Lock()
+	defer mpu.mu.Unlock()
+	mpu.readers--
+	if mpu.readers == 0 {
+		for _, part := range mpu.replaced {
+			part.discard()
+		}
+		mpu.replaced = nil
+	}
+	return err
+}
+
+// CompositeChecksum returns the checksum of the completed upload, calculated
+// from the checksums of the parts listed in input. If the upload was not
+// initiated with a ChecksumAlgorithm, an empty string is returned.
+//
+// This assumes the input has already been validated by Reassemble.
+func (mpu *multipartUpload) CompositeChecksum(input *CompleteMultipartUploadRequest) (string, error) {
+	if mpu.ChecksumAlgorithm == ChecksumNone {
+		return "", nil
+	}
+
+	mpu.mu.Lock()
+	defer mpu.mu.Unlock()
+
+	sums := make([]string, 0, len(input.Parts))
+	for _, part := range input.Parts {
+		sums = append(sums, mpu.parts[part.PartNumber].Checksum)
+	}
+	return mpu.ChecksumAlgorithm.compositeSum(sums)
 }
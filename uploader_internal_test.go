@@ -0,0 +1,53 @@
+package gofakes3
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReassembleKeepsReplacedPart(t *testing.T) {
+	u := newUploader()
+	u.tempDir = t.TempDir()
+	mpu := u.Begin("bucket", "object", nil, "", time.Now())
+
+	addPart := func(body string) *multipartUploadPart {
+		part, err := u.newPart(strings.NewReader(body), int64(len(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.ETag = `"` + body + `"`
+		if err := mpu.AddPart(1, time.Now(), part); err != nil {
+			t.Fatal(err)
+		}
+		return part
+	}
+
+	old := addPart("old")
+	rdr, _, err := mpu.Reassemble(&CompleteMultipartUploadRequest{
+		Parts: []CompletedPart{{PartNumber: 1, ETag: old.ETag}},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replacing the part while the reader is open must not remove the file
+	// the reader is about to read:
+	addPart("new")
+	body, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "old" {
+		t.Fatalf("expected %q, found %q", "old", body)
+	}
+
+	if err := rdr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old.path); !os.IsNotExist(err) {
+		t.Fatal("replaced part was not removed once the reader was closed:", err)
+	}
+}
@@ -1,10 +1,19 @@
 package gofakes3_test
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"reflect"
 	"testing"
 
-	"github.com/oneclickvirt/gofakes3"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
 )
 
 func TestMultipartUpload(t *testing.T) {
@@ -112,9 +121,12 @@ func TestListMultipartUploadsPrefix(t *testing.T) {
 	ts.createMultipartUpload(defaultBucket, "food/baz", nil)
 	ts.createMultipartUpload(defaultBucket, "yep/qux", nil)
 
-	ts.assertListMultipartUploads(defaultBucket, listUploadsOpts{Prefix: prefixFile("/"),
+	ts.assertListMultipartUploads(defaultBucket, listUploadsOpts{Prefix: prefixFile(""),
 		Prefixes: strs("foo/", "food/", "yep/")})
 
+	// As in S3, a leading delimiter in the prefix is not ignored:
+	ts.assertListMultipartUploads(defaultBucket, listUploadsOpts{Prefix: prefixFile("/")})
+
 	ts.assertListMultipartUploads(defaultBucket, listUploadsOpts{Prefix: prefixFile("fo"),
 		Prefixes: strs("foo/", "food/")})
 
@@ -138,9 +150,106 @@ func TestListMultipartUploadsPrefix(t *testing.T) {
 	//     Uploads:  strs("foo/bar/1", "foo/bar/2")})
 }
 
-func TestListMultipartUploadParts(t *testing.T) {
+func TestListMultipartUploadsPrefixAndKeyMarker(t *testing.T) {
 	ts := newTestServer(t)
 	defer ts.Close()
+	svc := ts.s3Client()
+
+	for _, key := range []string{"bar/a", "foo/a", "foo/b", "foo/b", "foo/c", "food/a", "zed/a"} {
+		ts.createMultipartUpload(defaultBucket, key, nil)
+	}
+
+	list := func(prefix, keyMarker, uploadIDMarker string) []string {
+		t.Helper()
+		rs, err := svc.ListMultipartUploads(&s3.ListMultipartUploadsInput{
+			Bucket:         aws.String(defaultBucket),
+			Prefix:         aws.String(prefix),
+			KeyMarker:      aws.String(keyMarker),
+			UploadIdMarker: aws.String(uploadIDMarker),
+		})
+		ts.OK(err)
+		var found []string
+		for _, upload := range rs.Uploads {
+			found = append(found, aws.StringValue(upload.Key)+"/"+aws.StringValue(upload.UploadId))
+		}
+		return found
+	}
+
+	for idx, tc := range []struct {
+		prefix, keyMarker, uploadIDMarker string
+		uploads                           []string
+	}{
+		// Only keys after the key-marker are listed:
+		{"foo/", "foo/a", "", strs("foo/b/3", "foo/b/4", "foo/c/5")},
+		{"foo/", "foo/b", "", strs("foo/c/5")},
+
+		// A key-marker before the prefix lists the whole prefix:
+		{"foo/", "bar/a", "", strs("foo/a/2", "foo/b/3", "foo/b/4", "foo/c/5")},
+		{"foo/", "a", "", strs("foo/a/2", "foo/b/3", "foo/b/4", "foo/c/5")},
+
+		// A key-marker after the prefix lists nothing:
+		{"foo/", "food/a", "", nil},
+		{"foo", "foo/c", "", strs("food/a/6")},
+
+		// A key-marker that does not exist:
+		{"foo/", "foo/bb", "", strs("foo/c/5")},
+
+		// The upload-id-marker picks up within the key-marker's uploads:
+		{"foo/", "foo/b", "4", strs("foo/b/4", "foo/c/5")},
+		{"foo/", "foo/bb", "4", strs("foo/c/5")},
+		{"foo/", "bar/a", "1", strs("foo/a/2", "foo/b/3", "foo/b/4", "foo/c/5")},
+	} {
+		t.Run(fmt.Sprint(idx), func(t *testing.T) {
+			found := list(tc.prefix, tc.keyMarker, tc.uploadIDMarker)
+			if !reflect.DeepEqual(found, tc.uploads) {
+				t.Fatal("unexpected uploads", found, "!=", tc.uploads)
+			}
+		})
+	}
+}
+
+func TestListMultipartUploadsOwner(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithOwner("owner-id", "Owner Name")))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	id := ts.createMultipartUpload(defaultBucket, "foo", nil)
+
+	assertUser := func(kind, id, name string) {
+		t.Helper()
+		if id != "owner-id" || name != "Owner Name" {
+			t.Fatalf("unexpected %s %q %q", kind, id, name)
+		}
+	}
+
+	uploads, err := svc.ListMultipartUploads(&s3.ListMultipartUploadsInput{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+	if len(uploads.Uploads) != 1 {
+		t.Fatal("unexpected uploads", uploads.Uploads)
+	}
+	upload := uploads.Uploads[0]
+	if upload.Initiator == nil || upload.Owner == nil {
+		t.Fatal("missing Initiator or Owner", upload)
+	}
+	assertUser("Initiator", aws.StringValue(upload.Initiator.ID), aws.StringValue(upload.Initiator.DisplayName))
+	assertUser("Owner", aws.StringValue(upload.Owner.ID), aws.StringValue(upload.Owner.DisplayName))
+
+	parts, err := svc.ListParts(&s3.ListPartsInput{
+		Bucket:   aws.String(defaultBucket),
+		Key:      aws.String("foo"),
+		UploadId: aws.String(id),
+	})
+	ts.OK(err)
+	if parts.Initiator == nil || parts.Owner == nil {
+		t.Fatal("missing Initiator or Owner", parts)
+	}
+	assertUser("Initiator", aws.StringValue(parts.Initiator.ID), aws.StringValue(parts.Initiator.DisplayName))
+	assertUser("Owner", aws.StringValue(parts.Owner.ID), aws.StringValue(parts.Owner.DisplayName))
+}
+
+func TestListMultipartUploadParts(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithMinPartSize(0)))
+	defer ts.Close()
 
 	id := ts.createMultipartUpload(defaultBucket, "foo", nil)
 
@@ -158,3 +267,339 @@ func TestListMultipartUploadParts(t *testing.T) {
 	// No parts should be returned after the upload is completed:
 	ts.assertListUploadPartsFails(gofakes3.ErrNoSuchUpload, defaultBucket, "foo", id, listUploadPartsOpts{})
 }
+
+func TestMultipartUploadChecksum(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithMinPartSize(0)))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	crc := func(data []byte) []byte {
+		sum := make([]byte, 4)
+		binary.BigEndian.PutUint32(sum, crc32.ChecksumIEEE(data))
+		return sum
+	}
+	b64 := base64.StdEncoding.EncodeToString
+
+	mpu, err := svc.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:            aws.String(defaultBucket),
+		Key:               aws.String("foo"),
+		ChecksumAlgorithm: aws.String("CRC32"),
+	})
+	ts.OK(err)
+	if aws.StringValue(mpu.ChecksumAlgorithm) != "CRC32" {
+		t.Fatal("unexpected checksum algorithm", aws.StringValue(mpu.ChecksumAlgorithm))
+	}
+
+	var parts []*s3.CompletedPart
+	for idx, body := range [][]byte{[]byte("abc"), []byte("def")} {
+		rs, err := svc.UploadPart(&s3.UploadPartInput{
+			Bucket:        aws.String(defaultBucket),
+			Key:           aws.String("foo"),
+			Body:          bytes.NewReader(body),
+			UploadId:      mpu.UploadId,
+			PartNumber:    aws.Int64(int64(idx + 1)),
+			ChecksumCRC32: aws.String(b64(crc(body))),
+		})
+		ts.OK(err)
+		if aws.StringValue(rs.ChecksumCRC32) != b64(crc(body)) {
+			t.Fatal("unexpected part checksum", aws.StringValue(rs.ChecksumCRC32))
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: rs.ETag, PartNumber: aws.Int64(int64(idx + 1)), ChecksumCRC32: rs.ChecksumCRC32})
+	}
+
+	// A part with a mismatched checksum must be rejected:
+	_, err = svc.UploadPart(&s3.UploadPartInput{
+		Bucket:        aws.String(defaultBucket),
+		Key:           aws.String("foo"),
+		Body:          bytes.NewReader([]byte("ghi")),
+		UploadId:      mpu.UploadId,
+		PartNumber:    aws.Int64(3),
+		ChecksumCRC32: aws.String(b64(crc([]byte("nope")))),
+	})
+	if !hasErrorCode(err, gofakes3.ErrBadDigest) {
+		t.Fatal("expected BadDigest, found", err)
+	}
+
+	// So must a checksum using a different algorithm:
+	_, err = svc.UploadPart(&s3.UploadPartInput{
+		Bucket:         aws.String(defaultBucket),
+		Key:            aws.String("foo"),
+		Body:           bytes.NewReader([]byte("ghi")),
+		UploadId:       mpu.UploadId,
+		PartNumber:     aws.Int64(3),
+		ChecksumSHA256: aws.String("nope"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+		t.Fatal("expected InvalidRequest, found", err)
+	}
+
+	rs, err := svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(defaultBucket),
+		Key:             aws.String("foo"),
+		UploadId:        mpu.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	ts.OK(err)
+
+	expected := b64(crc(append(crc([]byte("abc")), crc([]byte("def"))...))) + "-2"
+	if aws.StringValue(rs.ChecksumCRC32) != expected {
+		t.Fatal("unexpected composite checksum", aws.StringValue(rs.ChecksumCRC32), "!=", expected)
+	}
+	ts.assertObject(defaultBucket, "foo", nil, []byte("abcdef"))
+}
+
+func TestMultipartUploadChecksumInvalidAlgorithm(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:            aws.String(defaultBucket),
+		Key:               aws.String("foo"),
+		ChecksumAlgorithm: aws.String("MD4"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
+	}
+}
+
+func TestMultipartUploadPartChecksumWithoutAlgorithm(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithMinPartSize(0)))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	// Checksums sent with the parts of an upload created without a checksum
+	// algorithm are still verified:
+	upload := ts.createMultipartUpload(defaultBucket, "foo", nil)
+	rs, err := svc.UploadPart(&s3.UploadPartInput{
+		Bucket:        aws.String(defaultBucket),
+		Key:           aws.String("foo"),
+		Body:          bytes.NewReader([]byte("hello")),
+		UploadId:      aws.String(upload),
+		PartNumber:    aws.Int64(1),
+		ChecksumCRC32: aws.String("NhCmhg=="),
+	})
+	ts.OK(err)
+	if aws.StringValue(rs.ChecksumCRC32) != "NhCmhg==" {
+		t.Fatal("unexpected part checksum", aws.StringValue(rs.ChecksumCRC32))
+	}
+
+	_, err = svc.UploadPart(&s3.UploadPartInput{
+		Bucket:        aws.String(defaultBucket),
+		Key:           aws.String("foo"),
+		Body:          bytes.NewReader([]byte("hello")),
+		UploadId:      aws.String(upload),
+		PartNumber:    aws.Int64(2),
+		ChecksumCRC32: aws.String("AAAAAA=="),
+	})
+	if !hasErrorCode(err, gofakes3.ErrBadDigest) {
+		t.Fatal("expected BadDigest, found", err)
+	}
+}
+
+func TestListMultipartUploadsDelimiter(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	ts.createMultipartUpload(defaultBucket, "top", nil)
+	ts.createMultipartUpload(defaultBucket, "photos/2019/a.jpg", nil)
+	ts.createMultipartUpload(defaultBucket, "photos/2020/b.jpg", nil)
+	ts.createMultipartUpload(defaultBucket, "photos/c.jpg", nil)
+	ts.createMultipartUpload(defaultBucket, "videos/d.mp4", nil)
+
+	svc := ts.s3Client()
+	list := func(prefix *string) (prefixes []string, uploads []string) {
+		t.Helper()
+		rs, err := svc.ListMultipartUploads(&s3.ListMultipartUploadsInput{
+			Bucket:    aws.String(defaultBucket),
+			Delimiter: aws.String("/"),
+			Prefix:    prefix,
+		})
+		ts.OK(err)
+		if aws.StringValue(rs.Delimiter) != "/" {
+			t.Fatal("unexpected delimiter", aws.StringValue(rs.Delimiter))
+		}
+		for _, cp := range rs.CommonPrefixes {
+			prefixes = append(prefixes, aws.StringValue(cp.Prefix))
+		}
+		for _, up := range rs.Uploads {
+			uploads = append(uploads, aws.StringValue(up.Key))
+		}
+		return prefixes, uploads
+	}
+
+	prefixes, uploads := list(nil)
+	if !reflect.DeepEqual(prefixes, strs("photos/", "videos/")) || !reflect.DeepEqual(uploads, strs("top")) {
+		t.Fatal("unexpected listing", prefixes, uploads)
+	}
+
+	// A common prefix remaining after the last upload still truncates the page:
+	rs, err := svc.ListMultipartUploads(&s3.ListMultipartUploadsInput{
+		Bucket:     aws.String(defaultBucket),
+		Delimiter:  aws.String("/"),
+		MaxUploads: aws.Int64(1),
+	})
+	ts.OK(err)
+	if !aws.BoolValue(rs.IsTruncated) || aws.StringValue(rs.NextKeyMarker) != "videos/d.mp4" {
+		t.Fatal("expected truncated listing, found", rs)
+	}
+
+	prefixes, uploads = list(aws.String("photos/"))
+	if !reflect.DeepEqual(prefixes, strs("photos/2019/", "photos/2020/")) || !reflect.DeepEqual(uploads, strs("photos/c.jpg")) {
+		t.Fatal("unexpected listing", prefixes, uploads)
+	}
+}
+
+func TestUploadPartCopy(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	body := randomFileBody(defaultUploadPartSize + 100)
+	ts.backendPutBytes(defaultBucket, "src", nil, body)
+
+	uploadID := ts.createMultipartUpload(defaultBucket, "dst", nil)
+
+	copyPart := func(num int64, rnge string) (*s3.CompletedPart, error) {
+		in := &s3.UploadPartCopyInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("dst"),
+			CopySource: aws.String(defaultBucket + "/src"),
+			UploadId:   aws.String(uploadID),
+			PartNumber: aws.Int64(num),
+		}
+		if rnge != "" {
+			in.CopySourceRange = aws.String(rnge)
+		}
+		rs, err := svc.UploadPartCopy(in)
+		if err != nil {
+			return nil, err
+		}
+		return &s3.CompletedPart{ETag: rs.CopyPartResult.ETag, PartNumber: aws.Int64(num)}, nil
+	}
+
+	part1, err := copyPart(1, fmt.Sprintf("bytes=0-%d", defaultUploadPartSize-1))
+	ts.OK(err)
+	if aws.StringValue(part1.ETag) != `"`+hashMD5Bytes(body[:defaultUploadPartSize]).Hex()+`"` {
+		t.Fatal("unexpected etag", aws.StringValue(part1.ETag))
+	}
+	middle := randomFileBody(defaultUploadPartSize)
+	part2 := ts.uploadPart(defaultBucket, "dst", uploadID, 2, middle)
+	part3, err := copyPart(3, "")
+	ts.OK(err)
+
+	for _, rnge := range []string{"bytes=0-", "bytes=-10", "bytes=10-5", fmt.Sprintf("bytes=0-%d", len(body))} {
+		if _, err := copyPart(4, rnge); !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+			t.Fatal("expected InvalidArgument for", rnge, "found", err)
+		}
+	}
+
+	_, err = svc.UploadPartCopy(&s3.UploadPartCopyInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("dst"),
+		CopySource: aws.String(defaultBucket + "/nope"),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int64(4),
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		t.Fatal("expected NoSuchKey, found", err)
+	}
+
+	var expected []byte
+	expected = append(expected, body[:defaultUploadPartSize]...)
+	expected = append(expected, middle...)
+	expected = append(expected, body...)
+	ts.assertCompleteUpload(defaultBucket, "dst", uploadID, []*s3.CompletedPart{part1, part2, part3}, expected)
+}
+
+func TestCompleteMultipartUploadPartTooSmall(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithMinPartSize(4)))
+	defer ts.Close()
+
+	id := ts.createMultipartUpload(defaultBucket, "foo", nil)
+	parts := []*s3.CompletedPart{
+		ts.uploadPart(defaultBucket, "foo", id, 1, []byte("abcd")),
+		ts.uploadPart(defaultBucket, "foo", id, 2, []byte("efg")),
+		ts.uploadPart(defaultBucket, "foo", id, 3, []byte("h")),
+	}
+
+	complete := func(parts ...*s3.CompletedPart) (*http.Response, []byte) {
+		t.Helper()
+		var body bytes.Buffer
+		body.WriteString("<CompleteMultipartUpload>")
+		for _, part := range parts {
+			fmt.Fprintf(&body, "<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", aws.Int64Value(part.PartNumber), aws.StringValue(part.ETag))
+		}
+		body.WriteString("</CompleteMultipartUpload>")
+
+		rs, err := httpClient().Post(ts.url("/"+defaultBucket+"/foo?uploadId="+id), "application/xml", &body)
+		ts.OK(err)
+		defer rs.Body.Close()
+		out, err := ioutil.ReadAll(rs.Body)
+		ts.OK(err)
+		return rs, out
+	}
+
+	rs, body := complete(parts...)
+	if rs.StatusCode != http.StatusBadRequest {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	for _, expected := range []string{
+		"<Code>EntityTooSmall</Code>",
+		"<ProposedSize>3</ProposedSize>",
+		"<MinSizeAllowed>4</MinSizeAllowed>",
+		"<PartNumber>2</PartNumber>",
+	} {
+		if !bytes.Contains(body, []byte(expected)) {
+			t.Fatal("expected", expected, "in", string(body))
+		}
+	}
+
+	// Only the last part may be smaller than the minimum:
+	id = ts.createMultipartUpload(defaultBucket, "foo", nil)
+	parts = []*s3.CompletedPart{
+		ts.uploadPart(defaultBucket, "foo", id, 1, []byte("abcd")),
+		ts.uploadPart(defaultBucket, "foo", id, 2, []byte("e")),
+	}
+	ts.assertCompleteUpload(defaultBucket, "foo", id, parts, []byte("abcde"))
+}
+
+func TestCompleteMultipartUploadInvalidParts(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithMinPartSize(0)))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	id := ts.createMultipartUpload(defaultBucket, "foo", nil)
+	part1 := ts.uploadPart(defaultBucket, "foo", id, 1, []byte("abc"))
+	part2 := ts.uploadPart(defaultBucket, "foo", id, 2, []byte("def"))
+
+	complete := func(parts ...*s3.CompletedPart) error {
+		_, err := svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(defaultBucket),
+			Key:             aws.String("foo"),
+			UploadId:        aws.String(id),
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+		return err
+	}
+
+	wrongETag := &s3.CompletedPart{ETag: part1.ETag, PartNumber: aws.Int64(2)}
+	if err := complete(part1, wrongETag); !hasErrorCode(err, gofakes3.ErrInvalidPart) {
+		t.Fatal("expected InvalidPart for wrong etag, found", err)
+	}
+
+	missing := &s3.CompletedPart{ETag: part2.ETag, PartNumber: aws.Int64(3)}
+	if err := complete(part1, missing); !hasErrorCode(err, gofakes3.ErrInvalidPart) {
+		t.Fatal("expected InvalidPart for missing part, found", err)
+	}
+
+	if err := complete(part2, part1); !hasErrorCode(err, gofakes3.ErrInvalidPartOrder) {
+		t.Fatal("expected InvalidPartOrder for reversed parts, found", err)
+	}
+	if err := complete(part1, part1); !hasErrorCode(err, gofakes3.ErrInvalidPartOrder) {
+		t.Fatal("expected InvalidPartOrder for duplicate parts, found", err)
+	}
+
+	// A failed attempt leaves the upload in place so it can be retried:
+	ts.assertCompleteUpload(defaultBucket, "foo", id, []*s3.CompletedPart{part1, part2}, []byte("abcdef"))
+}
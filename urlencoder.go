@@ -1,6 +1,11 @@
 // Package s3 implements a fake s3 server for rclone
 package gofakes3
 
+import (
+	"net/url"
+	"strings"
+)
+
 // From: minio/cmd/api-utils.go
 // License: AGPL-3.0
 
@@ -75,3 +80,38 @@ func URLEncode(s string) string {
 	}
 	return string(t)
 }
+
+// listEncoding is the 'encoding-type' requested for a listing. S3 only
+// supports 'url', which asks for the keys, prefixes, delimiter and markers in
+// the response to be encoded with URLEncode, so keys containing characters
+// that XML 1.0 cannot represent can still be listed. The EncodingType element
+// is only sent in the response if it was requested.
+type listEncoding string
+
+const listEncodingURL listEncoding = "url"
+
+func listEncodingFromQuery(q url.Values) (listEncoding, error) {
+	enc := q.Get("encoding-type")
+	if enc == "" {
+		return "", nil
+	}
+	if !strings.EqualFold(enc, string(listEncodingURL)) {
+		return "", ErrorInvalidArgument("encoding-type", enc, "Invalid Encoding Method specified in Request")
+	}
+	return listEncodingURL, nil
+}
+
+// encode returns s encoded as requested, or s itself if no encoding was
+// requested.
+func (e listEncoding) encode(s string) string {
+	if e != listEncodingURL {
+		return s
+	}
+	return URLEncode(s)
+}
+
+func (e listEncoding) encodePrefixes(prefixes []CommonPrefix) {
+	for i := range prefixes {
+		prefixes[i].Prefix = e.encode(prefixes[i].Prefix)
+	}
+}
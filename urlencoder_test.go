@@ -0,0 +1,161 @@
+package gofakes3_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestListEncodingType(t *testing.T) {
+	const key, encodedKey = "foo bar/ü", "foo+bar/%C3%BC"
+
+	ts := newTestServer(t)
+	defer ts.Close()
+	ts.backendPutString(defaultBucket, key, nil, "hello")
+	ts.backendPutString(defaultBucket, "a b", nil, "hello")
+	uploadID := ts.createMultipartUpload(defaultBucket, key, nil)
+
+	list := func(query url.Values) (int, string) {
+		t.Helper()
+		rs, err := httpClient().Get(ts.url("/" + defaultBucket + "?" + query.Encode()))
+		ts.OK(err)
+		defer rs.Body.Close()
+		body, err := ioutil.ReadAll(rs.Body)
+		ts.OK(err)
+		return rs.StatusCode, string(body)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		query url.Values
+	}{
+		{"ListObjects", url.Values{"prefix": {"foo "}, "marker": {"a b"}}},
+		{"ListObjectsV2", url.Values{"list-type": {"2"}, "prefix": {"foo "}, "start-after": {"a b"}}},
+		{"ListObjectVersions", url.Values{"versions": {""}, "prefix": {"foo "}}},
+		{"ListMultipartUploads", url.Values{"uploads": {""}, "prefix": {"foo "}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := list(tc.query)
+			if status != http.StatusOK {
+				t.Fatal("unexpected status", status, body)
+			}
+			if strings.Contains(body, "<EncodingType>") || !strings.Contains(body, "<Key>"+key+"</Key>") ||
+				!strings.Contains(body, "<Prefix>foo </Prefix>") {
+				t.Fatal("unexpected encoding", body)
+			}
+
+			tc.query.Set("encoding-type", "url")
+			status, body = list(tc.query)
+			if status != http.StatusOK {
+				t.Fatal("unexpected status", status, body)
+			}
+			if !strings.Contains(body, "<EncodingType>url</EncodingType>") || !strings.Contains(body, "<Key>"+encodedKey+"</Key>") ||
+				!strings.Contains(body, "<Prefix>foo+</Prefix>") {
+				t.Fatal("expected url encoding", body)
+			}
+			if (tc.query.Has("marker") && !strings.Contains(body, "<Marker>a+b</Marker>")) ||
+				(tc.query.Has("start-after") && !strings.Contains(body, "<StartAfter>a+b</StartAfter>")) {
+				t.Fatal("expected url encoded marker", body)
+			}
+
+			tc.query.Set("encoding-type", "base64")
+			if status, body = list(tc.query); status != http.StatusBadRequest || !strings.Contains(body, string(gofakes3.ErrInvalidArgument)) {
+				t.Fatal("unexpected response for unsupported encoding", status, body)
+			}
+		})
+	}
+
+	t.Run("ListParts", func(t *testing.T) {
+		get := func(query url.Values) string {
+			t.Helper()
+			query.Set("uploadId", uploadID)
+			rs, err := httpClient().Get(ts.url("/" + defaultBucket + "/" + url.PathEscape(key) + "?" + query.Encode()))
+			ts.OK(err)
+			defer rs.Body.Close()
+			body, err := ioutil.ReadAll(rs.Body)
+			ts.OK(err)
+			if rs.StatusCode != http.StatusOK {
+				t.Fatal("unexpected status", rs.StatusCode, string(body))
+			}
+			return string(body)
+		}
+
+		if body := get(url.Values{}); strings.Contains(body, "<EncodingType>") || !strings.Contains(body, "<Key>"+key+"</Key>") {
+			t.Fatal("unexpected encoding", body)
+		}
+		if body := get(url.Values{"encoding-type": {"url"}}); !strings.Contains(body, "<EncodingType>url</EncodingType>") ||
+			!strings.Contains(body, "<Key>"+encodedKey+"</Key>") {
+			t.Fatal("expected url encoding", body)
+		}
+	})
+}
+
+func TestListEncodingTypeDelimiterAndMarkers(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	for _, key := range []string{"aéb", "aéc", "d e", "f g"} {
+		ts.backendPutString(defaultBucket, key, nil, "hello")
+	}
+
+	list := func(query url.Values) string {
+		t.Helper()
+		rs, err := httpClient().Get(ts.url("/" + defaultBucket + "?" + query.Encode()))
+		ts.OK(err)
+		defer rs.Body.Close()
+		body, err := ioutil.ReadAll(rs.Body)
+		ts.OK(err)
+		if rs.StatusCode != http.StatusOK {
+			t.Fatal("unexpected status", rs.StatusCode, string(body))
+		}
+		return string(body)
+	}
+
+	assertContains := func(body string, elems ...string) {
+		t.Helper()
+		for _, elem := range elems {
+			if !strings.Contains(body, elem) {
+				t.Fatalf("expected %s in response:\n%s", elem, body)
+			}
+		}
+	}
+
+	t.Run("ListObjects", func(t *testing.T) {
+		query := url.Values{"delimiter": {"é"}, "max-keys": {"2"}}
+		assertContains(list(query),
+			"<Delimiter>é</Delimiter>", "<Prefix>aé</Prefix>", "<Key>d e</Key>", "<NextMarker>d e</NextMarker>")
+
+		query.Set("encoding-type", "url")
+		body := list(query)
+		assertContains(body, "<EncodingType>url</EncodingType>",
+			"<Delimiter>%C3%A9</Delimiter>", "<Prefix>a%C3%A9</Prefix>", "<Key>d+e</Key>", "<NextMarker>d+e</NextMarker>")
+
+		// The marker sent back is the decoded key:
+		query.Set("marker", "d e")
+		assertContains(list(query), "<Marker>d+e</Marker>", "<Key>f+g</Key>")
+	})
+
+	t.Run("ListObjectsV2", func(t *testing.T) {
+		query := url.Values{"list-type": {"2"}, "delimiter": {"é"}, "max-keys": {"2"}, "encoding-type": {"url"}}
+		body := list(query)
+		assertContains(body, "<EncodingType>url</EncodingType>",
+			"<Delimiter>%C3%A9</Delimiter>", "<Prefix>a%C3%A9</Prefix>", "<Key>d+e</Key>", "<KeyCount>2</KeyCount>")
+
+		// The continuation token is opaque, so it is not encoded, and leads to
+		// the next page:
+		start := strings.Index(body, "<NextContinuationToken>")
+		end := strings.Index(body, "</NextContinuationToken>")
+		if start < 0 || end < start {
+			t.Fatal("expected a continuation token", body)
+		}
+		query.Set("continuation-token", body[start+len("<NextContinuationToken>"):end])
+		body = list(query)
+		assertContains(body, "<Key>f+g</Key>")
+		if strings.Contains(body, "<Key>d+e</Key>") {
+			t.Fatal("unexpected key from the previous page", body)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package gofakes3
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"strconv"
@@ -56,3 +57,23 @@ func ReadAll(r io.Reader, size int64) (b []byte, err error) {
 
 	return b, nil
 }
+
+// copyContext is like io.Copy, but stops with the error of ctx as soon as it
+// is done. It is used to send the contents of objects, so the Backend is not
+// read any further once the client has gone away.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	return io.Copy(dst, &contextReader{ctx: ctx, inner: src})
+}
+
+// contextReader checks ctx before every read from inner.
+type contextReader struct {
+	ctx   context.Context
+	inner io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (n int, err error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.inner.Read(p)
+}
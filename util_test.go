@@ -1,6 +1,9 @@
 package gofakes3
 
 import (
+	"bytes"
+	"context"
+	"io/ioutil"
 	"strings"
 	"testing"
 )
@@ -62,3 +65,48 @@ func TestReadAll(t *testing.T) {
 		}
 	})
 }
+
+// endlessReader returns an endless stream of zeroes, calling onRead before
+// each read.
+type endlessReader struct {
+	reads  int
+	onRead func(reads int)
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	r.reads++
+	r.onRead(r.reads)
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestCopyContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := &endlessReader{onRead: func(reads int) {
+		if reads == 3 {
+			cancel()
+		}
+	}}
+	n, err := copyContext(ctx, ioutil.Discard, src)
+	if err != context.Canceled {
+		t.Fatal("expected context.Canceled, found", err)
+	}
+	if src.reads != 3 || n == 0 {
+		t.Fatal("copy did not stop after the context was canceled; reads:", src.reads, "bytes:", n)
+	}
+}
+
+func TestCopyContext(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := copyContext(context.Background(), &buf, strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || buf.String() != "hello" {
+		t.Fatal("unexpected copy", n, buf.String())
+	}
+}
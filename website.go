@@ -0,0 +1,153 @@
+package gofakes3
+
+import (
+	"net/http"
+	"strings"
+
+	xml "github.com/oneclickvirt/gofakes3/xml"
+)
+
+// WebsiteConfiguration is used by the '?website' subresource on buckets, both
+// as the response body for a GET and as the request body for a PUT:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketWebsite.html
+//
+// Either RedirectAllRequestsTo or IndexDocument must be set, but not both.
+type WebsiteConfiguration struct {
+	XMLName               xml.Name               `xml:"WebsiteConfiguration"`
+	Xmlns                 string                 `xml:"xmlns,attr"`
+	RedirectAllRequestsTo *RedirectAllRequestsTo `xml:"RedirectAllRequestsTo,omitempty"`
+	IndexDocument         *IndexDocument         `xml:"IndexDocument,omitempty"`
+	ErrorDocument         *ErrorDocument         `xml:"ErrorDocument,omitempty"`
+	RoutingRules          []RoutingRule          `xml:"RoutingRules>RoutingRule,omitempty"`
+}
+
+type RedirectAllRequestsTo struct {
+	HostName string `xml:"HostName"`
+	Protocol string `xml:"Protocol,omitempty"`
+}
+
+// IndexDocument is appended to requests for a directory, i.e. with a Suffix
+// of 'index.html', a request for 'images/' returns 'images/index.html'.
+type IndexDocument struct {
+	Suffix string `xml:"Suffix"`
+}
+
+// ErrorDocument is the key of the object returned when an error occurs.
+type ErrorDocument struct {
+	Key string `xml:"Key"`
+}
+
+type RoutingRule struct {
+	Condition *RoutingRuleCondition `xml:"Condition,omitempty"`
+	Redirect  *RoutingRuleRedirect  `xml:"Redirect"`
+}
+
+type RoutingRuleCondition struct {
+	HTTPErrorCodeReturnedEquals string `xml:"HttpErrorCodeReturnedEquals,omitempty"`
+	KeyPrefixEquals             string `xml:"KeyPrefixEquals,omitempty"`
+}
+
+type RoutingRuleRedirect struct {
+	HostName             string `xml:"HostName,omitempty"`
+	HTTPRedirectCode     string `xml:"HttpRedirectCode,omitempty"`
+	Protocol             string `xml:"Protocol,omitempty"`
+	ReplaceKeyPrefixWith string `xml:"ReplaceKeyPrefixWith,omitempty"`
+	ReplaceKeyWith       string `xml:"ReplaceKeyWith,omitempty"`
+}
+
+func (c *WebsiteConfiguration) validate() error {
+	if c.RedirectAllRequestsTo != nil {
+		if c.IndexDocument != nil || c.ErrorDocument != nil || len(c.RoutingRules) > 0 ||
+			c.RedirectAllRequestsTo.HostName == "" {
+			return ErrMalformedXML
+		}
+		return nil
+	}
+
+	if c.IndexDocument == nil {
+		return ErrMalformedXML
+	}
+	if suffix := c.IndexDocument.Suffix; suffix == "" || strings.Contains(suffix, "/") {
+		return ErrorMessage(ErrInvalidArgument, "The IndexDocument Suffix is not well formed")
+	}
+	if c.ErrorDocument != nil && c.ErrorDocument.Key == "" {
+		return ErrorMessage(ErrInvalidArgument, "The ErrorDocument Key is not well formed")
+	}
+
+	for _, rule := range c.RoutingRules {
+		if rule.Redirect == nil {
+			return ErrMalformedXML
+		}
+		if rule.Redirect.ReplaceKeyPrefixWith != "" && rule.Redirect.ReplaceKeyWith != "" {
+			return ErrorMessage(ErrInvalidRequest, "You can only define ReplaceKeyPrefix or ReplaceKey but not both.")
+		}
+	}
+	return nil
+}
+
+// serveWebsite handles GET and HEAD requests to a bucket with a website
+// configuration when WithWebsiteServing is enabled. Requests for the bucket
+// root or for a key ending in '/' return the IndexDocument, and missing
+// objects return the ErrorDocument. It reports whether the request was
+// handled; if not, the request should be routed as a REST API request.
+func (g *GoFakeS3) serveWebsite(bucket, object string, w http.ResponseWriter, r *http.Request) (handled bool, err error) {
+	if g.website == nil || (r.Method != "GET" && r.Method != "HEAD") {
+		return false, nil
+	}
+
+	config, err := g.website.GetBucketWebsite(r.Context(), bucket)
+	if HasErrorCode(err, ErrNoSuchWebsiteConfiguration) || HasErrorCode(err, ErrNoSuchBucket) {
+		return false, nil
+	} else if err != nil {
+		return true, err
+	}
+	if config.IndexDocument == nil {
+		// RedirectAllRequestsTo is not supported:
+		return false, nil
+	}
+
+	if object != "" && strings.HasSuffix(r.URL.Path, "/") {
+		object += "/"
+	}
+	if object == "" || strings.HasSuffix(object, "/") {
+		object += config.IndexDocument.Suffix
+	}
+	g.log.Print(LogInfo, "WEBSITE", bucket, object)
+
+	if r.Method == "HEAD" {
+		err = g.headObject(bucket, object, "", w, r)
+	} else {
+		err = g.getObject(bucket, object, "", w, r)
+	}
+	if HasErrorCode(err, ErrNoSuchKey) && config.ErrorDocument != nil {
+		return true, g.serveWebsiteError(bucket, config.ErrorDocument.Key, err, w, r)
+	}
+	return true, err
+}
+
+// serveWebsiteError sends the ErrorDocument with the status of the original
+// error. If the ErrorDocument does not exist, the original error is
+// returned.
+func (g *GoFakeS3) serveWebsiteError(bucket, key string, cause error, w http.ResponseWriter, r *http.Request) (err error) {
+	obj, err := g.storage.GetObject(r.Context(), bucket, key, nil)
+	if err != nil {
+		g.log.Print(LogWarn, "website error document", key, "unavailable:", err)
+		return cause
+	}
+	defer CheckClose(obj.Contents, &err)
+	if obj.IsDeleteMarker {
+		return cause
+	}
+
+	for mk, mv := range obj.Metadata {
+		w.Header().Set(mk, mv)
+	}
+	obj.Range.writeHeader(obj.Size, w)
+	w.WriteHeader(ensureErrorResponse(cause, "").ErrorCode().Status())
+
+	if r.Method == "HEAD" {
+		return nil
+	}
+	_, err = copyContext(r.Context(), w, obj.Contents)
+	return err
+}
@@ -0,0 +1,148 @@
+package gofakes3_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oneclickvirt/gofakes3"
+)
+
+func TestBucketWebsite(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.GetBucketWebsite(&s3.GetBucketWebsiteInput{Bucket: aws.String(defaultBucket)})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchWebsiteConfiguration) {
+		t.Fatal("expected NoSuchWebsiteConfiguration, found", err)
+	}
+
+	ts.OKAll(svc.PutBucketWebsite(&s3.PutBucketWebsiteInput{
+		Bucket: aws.String(defaultBucket),
+		WebsiteConfiguration: &s3.WebsiteConfiguration{
+			IndexDocument: &s3.IndexDocument{Suffix: aws.String("index.html")},
+			ErrorDocument: &s3.ErrorDocument{Key: aws.String("error.html")},
+			RoutingRules: []*s3.RoutingRule{{
+				Condition: &s3.Condition{KeyPrefixEquals: aws.String("docs/")},
+				Redirect:  &s3.Redirect{ReplaceKeyPrefixWith: aws.String("documents/")},
+			}},
+		},
+	}))
+
+	rs, err := svc.GetBucketWebsite(&s3.GetBucketWebsiteInput{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+	if aws.StringValue(rs.IndexDocument.Suffix) != "index.html" || aws.StringValue(rs.ErrorDocument.Key) != "error.html" {
+		t.Fatal("unexpected configuration", rs)
+	}
+	if len(rs.RoutingRules) != 1 || aws.StringValue(rs.RoutingRules[0].Redirect.ReplaceKeyPrefixWith) != "documents/" {
+		t.Fatal("unexpected routing rules", rs.RoutingRules)
+	}
+
+	ts.OKAll(svc.DeleteBucketWebsite(&s3.DeleteBucketWebsiteInput{Bucket: aws.String(defaultBucket)}))
+
+	_, err = svc.GetBucketWebsite(&s3.GetBucketWebsiteInput{Bucket: aws.String(defaultBucket)})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchWebsiteConfiguration) {
+		t.Fatal("expected NoSuchWebsiteConfiguration, found", err)
+	}
+}
+
+func TestBucketWebsiteInvalid(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	for _, tc := range []struct {
+		config *s3.WebsiteConfiguration
+		code   gofakes3.ErrorCode
+	}{
+		{&s3.WebsiteConfiguration{}, gofakes3.ErrMalformedXML},
+		{&s3.WebsiteConfiguration{IndexDocument: &s3.IndexDocument{Suffix: aws.String("a/index.html")}}, gofakes3.ErrInvalidArgument},
+		{&s3.WebsiteConfiguration{
+			RedirectAllRequestsTo: &s3.RedirectAllRequestsTo{HostName: aws.String("example.com")},
+			IndexDocument:         &s3.IndexDocument{Suffix: aws.String("index.html")},
+		}, gofakes3.ErrMalformedXML},
+	} {
+		_, err := svc.PutBucketWebsite(&s3.PutBucketWebsiteInput{
+			Bucket:               aws.String(defaultBucket),
+			WebsiteConfiguration: tc.config,
+		})
+		if !hasErrorCode(err, tc.code) {
+			t.Fatal("expected", tc.code, "for", tc.config, "found", err)
+		}
+	}
+}
+
+func TestWebsiteServing(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(
+		gofakes3.WithHostBucket(true),
+		gofakes3.WithWebsiteServing(),
+	))
+	defer ts.Close()
+
+	ts.backendPutString(defaultBucket, "index.html", nil, "root index")
+	ts.backendPutString(defaultBucket, "docs/index.html", nil, "docs index")
+	ts.backendPutString(defaultBucket, "page.html", nil, "page")
+	ts.backendPutString(defaultBucket, "error.html", nil, "not found")
+
+	get := func(method, path string) (int, string) {
+		t.Helper()
+		rq, err := http.NewRequest(method, ts.url(path), nil)
+		ts.OK(err)
+		rq.Host = defaultBucket + ".localhost"
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		defer rs.Body.Close()
+		body, err := ioutil.ReadAll(rs.Body)
+		ts.OK(err)
+		return rs.StatusCode, string(body)
+	}
+
+	// Without a website configuration, the bucket root lists the objects:
+	if status, body := get("GET", "/"); status != 200 || !strings.Contains(body, "<ListBucketResult") {
+		t.Fatal("expected bucket listing, found", status, body)
+	}
+
+	website := ts.backend.(gofakes3.WebsiteBackend)
+	ts.OK(website.PutBucketWebsite(mockR.Context(), defaultBucket, &gofakes3.WebsiteConfiguration{
+		IndexDocument: &gofakes3.IndexDocument{Suffix: "index.html"},
+		ErrorDocument: &gofakes3.ErrorDocument{Key: "error.html"},
+	}))
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/", 200, "root index"},
+		{"GET", "/docs/", 200, "docs index"},
+		{"GET", "/page.html", 200, "page"},
+		{"GET", "/missing.html", 404, "not found"},
+		{"GET", "/missing/", 404, "not found"},
+		{"HEAD", "/", 200, ""},
+		{"HEAD", "/missing.html", 404, ""},
+	} {
+		status, body := get(tc.method, tc.path)
+		if status != tc.status || body != tc.body {
+			t.Fatal("unexpected response for", tc.method, tc.path, status, body)
+		}
+	}
+
+	// Requests with a query string are still handled by the REST API:
+	if status, body := get("GET", "/?list-type=2"); status != 200 || !strings.Contains(body, "<ListBucketResult") {
+		t.Fatal("expected bucket listing, found", status, body)
+	}
+
+	t.Run("missing-error-document", func(t *testing.T) {
+		ts.OK(website.PutBucketWebsite(mockR.Context(), defaultBucket, &gofakes3.WebsiteConfiguration{
+			IndexDocument: &gofakes3.IndexDocument{Suffix: "index.html"},
+			ErrorDocument: &gofakes3.ErrorDocument{Key: "nope.html"},
+		}))
+		if status, body := get("GET", "/missing.html"); status != 404 || !strings.Contains(body, "<Code>NoSuchKey</Code>") {
+			t.Fatal("expected NoSuchKey, found", status, body)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package gofakes3
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strconv"
+)
+
+// writeOffsetHeader is sent with a PutObject to write to an existing object
+// at an offset; see ResumableBackend.
+const writeOffsetHeader = "x-amz-write-offset-bytes"
+
+// checkWriteOffset validates the 'x-amz-write-offset-bytes' header of a
+// PutObject request, which must equal the current size of the object.
+//
+// If resume is true, the body should be written to the existing object at
+// offset using the ResumableBackend. An offset of 0 for an object that does
+// not exist yet is allowed, and the object is created as usual.
+func (g *GoFakeS3) checkWriteOffset(bucket, object string, r *http.Request) (offset int64, resume bool, err error) {
+	values, ok := r.Header[http.CanonicalHeaderKey(writeOffsetHeader)]
+	if !ok {
+		return 0, false, nil
+	}
+	if g.resumable == nil {
+		return 0, false, ErrNotImplemented
+	}
+
+	offset, err = strconv.ParseInt(values[0], 10, 64)
+	if err != nil || offset < 0 {
+		return 0, false, ErrorInvalidArgument(writeOffsetHeader, values[0], "The write offset must be a non-negative integer.")
+	}
+
+	var size int64
+	obj, err := g.storage.HeadObject(r.Context(), bucket, object)
+	if HasErrorCode(err, ErrNoSuchKey) {
+		err = nil
+	} else if err != nil {
+		return 0, false, err
+	} else {
+		defer CheckClose(obj.Contents, &err)
+		size, resume = obj.Size, !obj.IsDeleteMarker
+	}
+
+	if offset != size {
+		return 0, false, ErrInvalidWriteOffset
+	}
+	return offset, resume, nil
+}
+
+// objectETag returns the quoted ETag of the object currently stored at the
+// key.
+func (g *GoFakeS3) objectETag(r *http.Request, bucket, object string) (etag string, err error) {
+	obj, err := g.storage.HeadObject(r.Context(), bucket, object)
+	if err != nil {
+		return "", err
+	}
+	defer CheckClose(obj.Contents, &err)
+	return `"` + hex.EncodeToString(obj.Hash) + `"`, nil
+}